@@ -1,10 +1,12 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/dcim/collector-agent/internal/agent"
 	"github.com/dcim/collector-agent/pkg/config"
@@ -31,6 +33,10 @@ func main() {
 		logger.Log.Fatal("failed to load config", zap.Error(err))
 	}
 
+	if err := logger.SetLevel(cfg.Log.Level); err != nil {
+		logger.Log.Fatal("failed to set log level", zap.Error(err))
+	}
+
 	logger.Log.Info("config loaded",
 		zap.String("agent_id", cfg.Agent.ID),
 		zap.String("agent_name", cfg.Agent.Name))
@@ -46,17 +52,47 @@ func main() {
 		logger.Log.Fatal("failed to start agent", zap.Error(err))
 	}
 
-	// 监听退出信号
+	// 监听配置文件变更
+	watchCtx, stopWatch := context.WithCancel(context.Background())
+	defer stopWatch()
+	configChanges := config.Watch(watchCtx, *configPath,
+		time.Duration(cfg.Agent.ConfigWatchInterval)*time.Second)
+
+	// 监听退出信号和重载信号(SIGHUP)
 	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
 
 	logger.Log.Info("agent is running, press Ctrl+C to exit")
 
-	// 等待退出信号
-	<-sigChan
+	// 等待退出信号，期间处理配置热加载
+	for running := true; running; {
+		select {
+		case sig := <-sigChan:
+			if sig == syscall.SIGHUP {
+				logger.Log.Info("received SIGHUP, reloading config")
+				reloadConfig(agentInstance)
+				continue
+			}
+			running = false
+		case <-configChanges:
+			logger.Log.Info("config file changed, reloading config")
+			reloadConfig(agentInstance)
+		}
+	}
 
 	// 优雅退出
 	logger.Log.Info("shutting down agent...")
 	agentInstance.Stop()
 	logger.Log.Info("agent shutdown complete")
 }
+
+// reloadConfig 重新加载配置文件并应用到Agent，加载失败时保留当前配置
+func reloadConfig(agentInstance *agent.Agent) {
+	cfg, err := config.LoadConfig(*configPath)
+	if err != nil {
+		logger.Log.Error("failed to reload config, keeping current config", zap.Error(err))
+		return
+	}
+
+	agentInstance.Reload(cfg)
+}
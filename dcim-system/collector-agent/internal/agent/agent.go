@@ -4,11 +4,14 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"reflect"
 	"sync"
 	"time"
 
 	"github.com/dcim/collector-agent/internal/cache"
+	"github.com/dcim/collector-agent/internal/codec"
 	"github.com/dcim/collector-agent/internal/collector"
+	"github.com/dcim/collector-agent/internal/discovery"
 	"github.com/dcim/collector-agent/internal/protocol"
 	"github.com/dcim/collector-agent/internal/receiver"
 	"github.com/dcim/collector-agent/internal/scheduler"
@@ -25,10 +28,15 @@ type Agent struct {
 	scheduler  *scheduler.Scheduler
 	receiver   *receiver.Receiver // 被动接收器
 	cache      *cache.LocalCache
+	codec      codec.Codec // 数据上报编码器
 	mqttClient mqtt.Client
+	mgmtClient *discovery.MgmtClient // 采集管理服务客户端，未配置agent.mgmt_url时为nil
 	ctx        context.Context
 	cancel     context.CancelFunc
 	wg         sync.WaitGroup
+	mu         sync.Mutex // 保护配置热加载，热加载时整体替换config
+
+	heartbeatReset chan time.Duration // 心跳间隔变更通知
 }
 
 // NewAgent 创建Agent实例
@@ -67,6 +75,13 @@ func NewAgent(cfg *config.Config) (*Agent, error) {
 		sched = scheduler.NewScheduler(coll)
 	}
 
+	// 创建数据编码器
+	dataCodec, err := codec.New(cfg.MQTT.Encoding)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to create codec: %w", err)
+	}
+
 	// 创建MQTT客户端
 	mqttClient := createMQTTClient(cfg.MQTT)
 
@@ -75,9 +90,15 @@ func NewAgent(cfg *config.Config) (*Agent, error) {
 		collector:  coll,
 		scheduler:  sched,
 		cache:      localCache,
+		codec:      dataCodec,
 		mqttClient: mqttClient,
 		ctx:        ctx,
 		cancel:     cancel,
+
+		heartbeatReset: make(chan time.Duration, 1),
+	}
+	if cfg.Agent.MgmtURL != "" {
+		agent.mgmtClient = discovery.NewMgmtClient(cfg.Agent.MgmtURL, cfg.Agent.ID, cfg.Agent.MgmtAPIKey)
 	}
 
 	// 创建被动接收器（被动接收模式）
@@ -95,9 +116,10 @@ func NewAgent(cfg *config.Config) (*Agent, error) {
 
 // Start 启动Agent
 func (a *Agent) Start() error {
+	cfg := a.currentConfig()
 	logger.Log.Info("starting agent",
-		zap.String("agent_id", a.config.Agent.ID),
-		zap.String("agent_name", a.config.Agent.Name))
+		zap.String("agent_id", cfg.Agent.ID),
+		zap.String("agent_name", cfg.Agent.Name))
 
 	// 连接MQTT
 	if token := a.mqttClient.Connect(); token.Wait() && token.Error() != nil {
@@ -106,13 +128,13 @@ func (a *Agent) Start() error {
 	logger.Log.Info("MQTT connected")
 
 	// 启动主动拉取模式
-	if a.config.Agent.EnablePullMode && a.scheduler != nil {
+	if cfg.Agent.EnablePullMode && a.scheduler != nil {
 		a.scheduler.Start()
 		logger.Log.Info("pull mode started")
 	}
 
 	// 启动被动接收模式
-	if a.config.Agent.EnablePushMode && a.receiver != nil {
+	if cfg.Agent.EnablePushMode && a.receiver != nil {
 		if err := a.receiver.Start(); err != nil {
 			return fmt.Errorf("failed to start receiver: %w", err)
 		}
@@ -127,6 +149,13 @@ func (a *Agent) Start() error {
 	a.wg.Add(1)
 	go a.retryLoop()
 
+	// 启动设备发现任务轮询
+	if cfg.Discovery.Enabled {
+		a.wg.Add(1)
+		go a.discoveryLoop()
+		logger.Log.Info("discovery started", zap.String("mgmt_url", cfg.Agent.MgmtURL))
+	}
+
 	logger.Log.Info("agent started successfully")
 
 	return nil
@@ -175,13 +204,16 @@ func (a *Agent) RemoveTask(taskID string) error {
 }
 
 // PublishData 发布数据到MQTT
+// 非JSON编码的数据发布到 <topic>/<suffix>，由Topic后缀标识载荷编码格式
 func (a *Agent) PublishData(data *protocol.DeviceData) error {
-	payload, err := json.Marshal(data)
+	cfg := a.currentConfig()
+	payload, err := a.codec.Marshal(data)
 	if err != nil {
 		return fmt.Errorf("failed to marshal data: %w", err)
 	}
 
-	token := a.mqttClient.Publish(a.config.MQTT.Topic, a.config.MQTT.QoS, false, payload)
+	topic := codec.Topic(cfg.MQTT.Topic, a.codec)
+	token := a.mqttClient.Publish(topic, cfg.MQTT.QoS, false, payload)
 	token.Wait()
 
 	if token.Error() != nil {
@@ -199,7 +231,8 @@ func (a *Agent) PublishData(data *protocol.DeviceData) error {
 
 	logger.Log.Debug("data published",
 		zap.String("device_id", data.DeviceID),
-		zap.String("topic", a.config.MQTT.Topic))
+		zap.String("topic", topic),
+		zap.String("encoding", string(a.codec.Encoding())))
 
 	return nil
 }
@@ -207,37 +240,117 @@ func (a *Agent) PublishData(data *protocol.DeviceData) error {
 // heartbeatLoop 心跳上报循环
 func (a *Agent) heartbeatLoop() {
 	defer a.wg.Done()
+	cfg := a.currentConfig()
 
-	ticker := time.NewTicker(time.Duration(a.config.Agent.HeartbeatInterval) * time.Second)
+	ticker := time.NewTicker(time.Duration(cfg.Agent.HeartbeatInterval) * time.Second)
 	defer ticker.Stop()
 
 	for {
 		select {
 		case <-ticker.C:
 			a.sendHeartbeat()
+		case interval := <-a.heartbeatReset:
+			ticker.Reset(interval)
 		case <-a.ctx.Done():
 			return
 		}
 	}
 }
 
+// currentConfig 当前配置，热加载时整体替换，返回的配置不能修改
+func (a *Agent) currentConfig() *config.Config {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.config
+}
+
+// Reload 热加载配置
+// 仅应用可安全变更的配置项（日志级别、接收器订阅Topic、心跳间隔），其余变更需重启生效
+func (a *Agent) Reload(cfg *config.Config) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	// 在副本上应用变更后整体替换，读取方持有的旧配置不受影响
+	old := a.config
+	next := *old
+
+	// 日志级别
+	if cfg.Log.Level != old.Log.Level {
+		if err := logger.SetLevel(cfg.Log.Level); err != nil {
+			logger.Log.Error("failed to set log level", zap.Error(err))
+		} else {
+			logger.Log.Info("log level updated", zap.String("level", cfg.Log.Level))
+			next.Log.Level = cfg.Log.Level
+		}
+	}
+
+	// 心跳间隔
+	if cfg.Agent.HeartbeatInterval != old.Agent.HeartbeatInterval {
+		interval := time.Duration(cfg.Agent.HeartbeatInterval) * time.Second
+		select {
+		case <-a.heartbeatReset:
+		default:
+		}
+		a.heartbeatReset <- interval
+		next.Agent.HeartbeatInterval = cfg.Agent.HeartbeatInterval
+		logger.Log.Info("heartbeat interval updated", zap.Duration("interval", interval))
+	}
+
+	// 接收器订阅Topic，更新失败时保留原Topic，下次热加载时重试
+	topics := cfg.Receiver.MQTTReceiver.SubscribeTopics
+	if !reflect.DeepEqual(topics, old.Receiver.MQTTReceiver.SubscribeTopics) {
+		if a.receiver == nil {
+			next.Receiver.MQTTReceiver.SubscribeTopics = topics
+		} else if err := a.receiver.UpdateSubscribeTopics(topics); err != nil {
+			logger.Log.Error("failed to update receiver topics", zap.Error(err))
+		} else {
+			logger.Log.Info("receiver topics updated", zap.Strings("topics", topics))
+			next.Receiver.MQTTReceiver.SubscribeTopics = topics
+		}
+	}
+	a.config = &next
+
+	// 其余配置项变更需要重启（可热加载的配置项应用失败时只记录错误）
+	rest := next
+	rest.Log.Level = cfg.Log.Level
+	rest.Receiver.MQTTReceiver.SubscribeTopics = topics
+	if !reflect.DeepEqual(rest, *cfg) {
+		logger.Log.Warn("config changes other than log level, receiver topics and heartbeat interval require restart")
+	}
+}
+
 // sendHeartbeat 发送心跳
 func (a *Agent) sendHeartbeat() {
+	cfg := a.currentConfig()
 	heartbeat := map[string]interface{}{
-		"agent_id":    a.config.Agent.ID,
-		"agent_name":  a.config.Agent.Name,
-		"data_center": a.config.Agent.DataCenter,
-		"room":        a.config.Agent.Room,
+		"agent_id":    cfg.Agent.ID,
+		"agent_name":  cfg.Agent.Name,
+		"data_center": cfg.Agent.DataCenter,
+		"room":        cfg.Agent.Room,
 		"timestamp":   time.Now().Unix(),
 		"status":      "running",
-		"pull_mode":   a.config.Agent.EnablePullMode,
-		"push_mode":   a.config.Agent.EnablePushMode,
+		"pull_mode":   cfg.Agent.EnablePullMode,
+		"push_mode":   cfg.Agent.EnablePushMode,
+	}
+	if a.scheduler != nil {
+		scheduled, avgCollectMs := a.scheduler.CollectStats()
+		heartbeat["scheduled_tasks"] = scheduled
+		heartbeat["avg_collect_ms"] = avgCollectMs
 	}
 
 	payload, _ := json.Marshal(heartbeat)
-	topic := fmt.Sprintf("%s/heartbeat", a.config.MQTT.Topic)
+	topic := fmt.Sprintf("%s/heartbeat", cfg.MQTT.Topic)
 
-	a.mqttClient.Publish(topic, a.config.MQTT.QoS, false, payload)
+	a.mqttClient.Publish(topic, cfg.MQTT.QoS, false, payload)
+
+	// 上报采集管理服务，用于任务自动分配和离线故障转移
+	if a.mgmtClient != nil {
+		ctx, cancel := context.WithTimeout(a.ctx, 10*time.Second)
+		defer cancel()
+		if err := a.mgmtClient.SendHeartbeat(ctx, heartbeat); err != nil {
+			logger.Log.Warn("failed to send heartbeat to mgmt", zap.Error(err))
+		}
+	}
 
 	logger.Log.Debug("heartbeat sent")
 }
@@ -281,6 +394,62 @@ func (a *Agent) retryCachedData() {
 	}
 }
 
+// discoveryLoop 轮询采集管理服务下发的设备发现任务并执行
+func (a *Agent) discoveryLoop() {
+	defer a.wg.Done()
+	cfg := a.currentConfig()
+
+	// 与心跳共用采集管理服务客户端，校验已保证启用发现时配置了agent.mgmt_url
+	scanner := discovery.NewScanner(cfg.Discovery.MaxConcurrency)
+
+	ticker := time.NewTicker(time.Duration(cfg.Discovery.PollInterval) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			a.runDiscoveryJobs(a.mgmtClient, scanner)
+		case <-a.ctx.Done():
+			return
+		}
+	}
+}
+
+// runDiscoveryJobs 领取并依次执行待处理的发现任务，结果上报采集管理服务
+func (a *Agent) runDiscoveryJobs(client *discovery.MgmtClient, scanner *discovery.Scanner) {
+	jobs, err := client.PendingJobs(a.ctx)
+	if err != nil {
+		logger.Log.Warn("failed to poll discovery jobs", zap.Error(err))
+		return
+	}
+
+	for _, pending := range jobs {
+		job, err := client.ClaimJob(a.ctx, pending.JobID)
+		if err != nil {
+			logger.Log.Warn("failed to claim discovery job",
+				zap.String("job_id", pending.JobID),
+				zap.Error(err))
+			continue
+		}
+
+		result := scanner.Run(a.ctx, job)
+
+		// Agent退出时仍尽量上报已有结果
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		err = client.ReportResult(ctx, result)
+		cancel()
+		if err != nil {
+			logger.Log.Error("failed to report discovery result",
+				zap.String("job_id", job.JobID),
+				zap.Error(err))
+		}
+
+		if a.ctx.Err() != nil {
+			return
+		}
+	}
+}
+
 // handleReceivedData 处理被动接收的数据
 func (a *Agent) handleReceivedData(data *protocol.DeviceData) error {
 	logger.Log.Info("received data from push mode",
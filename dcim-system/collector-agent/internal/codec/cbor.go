@@ -0,0 +1,31 @@
+package codec
+
+import (
+	"fmt"
+
+	"github.com/dcim/collector-agent/internal/protocol"
+	"github.com/fxamacker/cbor/v2"
+)
+
+// cborCodec CBOR编码器
+type cborCodec struct {
+	mode cbor.EncMode
+}
+
+// newCBORCodec 创建CBOR编码器
+func newCBORCodec() (*cborCodec, error) {
+	// 时间按Unix时间戳(带小数秒)编码，比RFC3339字符串更紧凑
+	mode, err := cbor.EncOptions{Time: cbor.TimeUnixDynamic}.EncMode()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create CBOR encoder: %w", err)
+	}
+	return &cborCodec{mode: mode}, nil
+}
+
+func (c *cborCodec) Encoding() Encoding { return EncodingCBOR }
+
+func (c *cborCodec) TopicSuffix() string { return "cbor" }
+
+func (c *cborCodec) Marshal(data *protocol.DeviceData) ([]byte, error) {
+	return c.mode.Marshal(data)
+}
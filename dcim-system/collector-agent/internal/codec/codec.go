@@ -0,0 +1,65 @@
+package codec
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/dcim/collector-agent/internal/protocol"
+)
+
+// Encoding 数据上报编码格式
+type Encoding string
+
+const (
+	// EncodingJSON JSON编码（默认）
+	EncodingJSON Encoding = "json"
+	// EncodingProtobuf Protobuf编码，消息定义见 proto/collector.proto 中的 DeviceData
+	EncodingProtobuf Encoding = "protobuf"
+	// EncodingCBOR CBOR编码
+	EncodingCBOR Encoding = "cbor"
+)
+
+// Codec 设备数据编码器
+type Codec interface {
+	// Encoding 返回编码格式
+	Encoding() Encoding
+
+	// TopicSuffix 返回上报Topic后缀，用于标识载荷的编码格式（JSON为空）
+	TopicSuffix() string
+
+	// Marshal 编码设备数据
+	Marshal(data *protocol.DeviceData) ([]byte, error)
+}
+
+// New 根据编码格式创建编码器
+func New(encoding string) (Codec, error) {
+	switch Encoding(encoding) {
+	case "", EncodingJSON:
+		return jsonCodec{}, nil
+	case EncodingProtobuf:
+		return protobufCodec{}, nil
+	case EncodingCBOR:
+		return newCBORCodec()
+	default:
+		return nil, fmt.Errorf("unsupported encoding: %s", encoding)
+	}
+}
+
+// Topic 根据编码器生成上报Topic
+func Topic(base string, c Codec) string {
+	if suffix := c.TopicSuffix(); suffix != "" {
+		return base + "/" + suffix
+	}
+	return base
+}
+
+// jsonCodec JSON编码器
+type jsonCodec struct{}
+
+func (jsonCodec) Encoding() Encoding { return EncodingJSON }
+
+func (jsonCodec) TopicSuffix() string { return "" }
+
+func (jsonCodec) Marshal(data *protocol.DeviceData) ([]byte, error) {
+	return json.Marshal(data)
+}
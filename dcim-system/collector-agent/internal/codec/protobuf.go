@@ -0,0 +1,134 @@
+package codec
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/dcim/collector-agent/internal/protocol"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// DeviceData 消息字段编号（与 proto/collector.proto 保持一致）
+const (
+	fieldDeviceID   protowire.Number = 1
+	fieldDeviceIP   protowire.Number = 2
+	fieldDeviceType protowire.Number = 3
+	fieldTimestamp  protowire.Number = 4
+	fieldMetrics    protowire.Number = 5
+	fieldStatus     protowire.Number = 6
+	fieldError      protowire.Number = 7
+
+	fieldMapKey   protowire.Number = 1
+	fieldMapValue protowire.Number = 2
+
+	fieldDoubleValue protowire.Number = 1
+	fieldIntValue    protowire.Number = 2
+	fieldUintValue   protowire.Number = 3
+	fieldStringValue protowire.Number = 4
+	fieldBoolValue   protowire.Number = 5
+)
+
+// protobufCodec Protobuf编码器
+type protobufCodec struct{}
+
+func (protobufCodec) Encoding() Encoding { return EncodingProtobuf }
+
+func (protobufCodec) TopicSuffix() string { return "proto" }
+
+// Marshal 按 collector.DeviceData 消息格式编码
+func (protobufCodec) Marshal(data *protocol.DeviceData) ([]byte, error) {
+	var b []byte
+	b = appendString(b, fieldDeviceID, data.DeviceID)
+	b = appendString(b, fieldDeviceIP, data.DeviceIP)
+	b = appendString(b, fieldDeviceType, data.DeviceType)
+	if !data.Timestamp.IsZero() {
+		b = protowire.AppendTag(b, fieldTimestamp, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(data.Timestamp.UnixNano()))
+	}
+
+	for name, value := range data.Metrics {
+		encoded, ok := encodeMetricValue(value)
+		if !ok {
+			continue
+		}
+
+		var entry []byte
+		entry = appendString(entry, fieldMapKey, name)
+		entry = protowire.AppendTag(entry, fieldMapValue, protowire.BytesType)
+		entry = protowire.AppendBytes(entry, encoded)
+
+		b = protowire.AppendTag(b, fieldMetrics, protowire.BytesType)
+		b = protowire.AppendBytes(b, entry)
+	}
+
+	b = appendString(b, fieldStatus, data.Status)
+	b = appendString(b, fieldError, data.Error)
+
+	return b, nil
+}
+
+// appendString 追加非空字符串字段（proto3默认值不编码）
+func appendString(b []byte, num protowire.Number, v string) []byte {
+	if v == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, v)
+}
+
+// encodeMetricValue 编码 MetricValue 消息
+func encodeMetricValue(value interface{}) ([]byte, bool) {
+	var b []byte
+
+	switch v := value.(type) {
+	case nil:
+		return nil, false
+	case float64:
+		b = protowire.AppendTag(b, fieldDoubleValue, protowire.Fixed64Type)
+		b = protowire.AppendFixed64(b, math.Float64bits(v))
+	case float32:
+		b = protowire.AppendTag(b, fieldDoubleValue, protowire.Fixed64Type)
+		b = protowire.AppendFixed64(b, math.Float64bits(float64(v)))
+	case int:
+		b = appendInt(b, int64(v))
+	case int8:
+		b = appendInt(b, int64(v))
+	case int16:
+		b = appendInt(b, int64(v))
+	case int32:
+		b = appendInt(b, int64(v))
+	case int64:
+		b = appendInt(b, v)
+	case uint:
+		b = appendUint(b, uint64(v))
+	case uint8:
+		b = appendUint(b, uint64(v))
+	case uint16:
+		b = appendUint(b, uint64(v))
+	case uint32:
+		b = appendUint(b, uint64(v))
+	case uint64:
+		b = appendUint(b, v)
+	case bool:
+		b = protowire.AppendTag(b, fieldBoolValue, protowire.VarintType)
+		b = protowire.AppendVarint(b, protowire.EncodeBool(v))
+	case string:
+		b = protowire.AppendTag(b, fieldStringValue, protowire.BytesType)
+		b = protowire.AppendString(b, v)
+	default:
+		b = protowire.AppendTag(b, fieldStringValue, protowire.BytesType)
+		b = protowire.AppendString(b, fmt.Sprintf("%v", v))
+	}
+
+	return b, true
+}
+
+func appendInt(b []byte, v int64) []byte {
+	b = protowire.AppendTag(b, fieldIntValue, protowire.VarintType)
+	return protowire.AppendVarint(b, protowire.EncodeZigZag(v))
+}
+
+func appendUint(b []byte, v uint64) []byte {
+	b = protowire.AppendTag(b, fieldUintValue, protowire.VarintType)
+	return protowire.AppendVarint(b, v)
+}
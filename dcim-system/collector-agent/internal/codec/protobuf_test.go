@@ -0,0 +1,95 @@
+package codec
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/dcim/collector-agent/internal/protocol"
+)
+
+// vectorsFile 与data-processor共用的Protobuf测试向量，两端的编解码必须与其一致
+const vectorsFile = "../../../proto/testdata/device_data_vectors.json"
+
+// vector 测试向量：设备数据按metrics中的类型编码后应得到hex
+type vector struct {
+	Name   string `json:"name"`
+	Device struct {
+		DeviceID    string `json:"device_id"`
+		DeviceIP    string `json:"device_ip"`
+		DeviceType  string `json:"device_type"`
+		TimestampNS int64  `json:"timestamp_ns"`
+		Status      string `json:"status"`
+		Error       string `json:"error"`
+	} `json:"device"`
+	Metrics map[string]struct {
+		Type  string          `json:"type"`
+		Value json.RawMessage `json:"value"`
+	} `json:"metrics"`
+	Hex string `json:"hex"`
+}
+
+func TestProtobufMarshalVectors(t *testing.T) {
+	raw, err := os.ReadFile(vectorsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var vectors []vector
+	if err := json.Unmarshal(raw, &vectors); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, v := range vectors {
+		t.Run(v.Name, func(t *testing.T) {
+			data := &protocol.DeviceData{
+				DeviceID:   v.Device.DeviceID,
+				DeviceIP:   v.Device.DeviceIP,
+				DeviceType: v.Device.DeviceType,
+				Status:     v.Device.Status,
+				Error:      v.Device.Error,
+				Metrics:    make(map[string]interface{}),
+			}
+			if v.Device.TimestampNS != 0 {
+				data.Timestamp = time.Unix(0, v.Device.TimestampNS)
+			}
+			for name, m := range v.Metrics {
+				data.Metrics[name] = typedValue(t, m.Type, m.Value)
+			}
+
+			b, err := protobufCodec{}.Marshal(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := hex.EncodeToString(b); got != v.Hex {
+				t.Errorf("encoded %s, want %s", got, v.Hex)
+			}
+		})
+	}
+}
+
+// typedValue 按向量中的类型还原采集到的指标值
+func typedValue(t *testing.T, typ string, raw json.RawMessage) interface{} {
+	t.Helper()
+
+	var v interface{}
+	if err := json.Unmarshal(raw, &v); err != nil {
+		t.Fatalf("invalid %s value %s: %v", typ, raw, err)
+	}
+	f, _ := v.(float64)
+	switch typ {
+	case "bool", "string":
+		return v
+	case "float64":
+		return f
+	case "float32":
+		return float32(f)
+	case "int64":
+		return int64(f)
+	case "uint32":
+		return uint32(f)
+	}
+	t.Fatalf("unknown type %s", typ)
+	return nil
+}
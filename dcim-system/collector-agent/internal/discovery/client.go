@@ -0,0 +1,109 @@
+package discovery
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// MgmtClient 采集管理服务接口客户端（设备发现、心跳）
+type MgmtClient struct {
+	baseURL    string
+	agentID    string
+	apiKey     string
+	httpClient *http.Client
+}
+
+// NewMgmtClient 创建采集管理服务客户端，apiKey为空时不发送认证信息
+func NewMgmtClient(baseURL, agentID, apiKey string) *MgmtClient {
+	return &MgmtClient{
+		baseURL:    baseURL,
+		agentID:    agentID,
+		apiKey:     apiKey,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// apiResponse 采集管理服务通用响应
+type apiResponse struct {
+	Success bool            `json:"success"`
+	Data    json.RawMessage `json:"data"`
+	Error   string          `json:"error"`
+}
+
+// PendingJobs 查询待执行的发现任务
+func (c *MgmtClient) PendingJobs(ctx context.Context) ([]*Job, error) {
+	query := url.Values{"agent_id": {c.agentID}, "status": {"pending"}}
+	var jobs []*Job
+	err := c.do(ctx, http.MethodGet, "/api/v1/discovery/jobs?"+query.Encode(), nil, &jobs)
+	return jobs, err
+}
+
+// ClaimJob 领取发现任务
+func (c *MgmtClient) ClaimJob(ctx context.Context, jobID string) (*Job, error) {
+	query := url.Values{"agent_id": {c.agentID}}
+	var job Job
+	path := fmt.Sprintf("/api/v1/discovery/jobs/%s/claim?%s", url.PathEscape(jobID), query.Encode())
+	if err := c.do(ctx, http.MethodPost, path, nil, &job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// ReportResult 上报发现结果
+func (c *MgmtClient) ReportResult(ctx context.Context, result *Result) error {
+	return c.do(ctx, http.MethodPost, "/api/v1/discovery/results", result, nil)
+}
+
+// SendHeartbeat 上报心跳
+func (c *MgmtClient) SendHeartbeat(ctx context.Context, heartbeat interface{}) error {
+	return c.do(ctx, http.MethodPost, "/api/v1/agents/heartbeat", heartbeat, nil)
+}
+
+// do 发送请求并解析响应data字段
+func (c *MgmtClient) do(ctx context.Context, method, path string, body, out interface{}) error {
+	var reader *bytes.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.apiKey != "" {
+		req.Header.Set("X-API-Key", c.apiKey)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var apiResp apiResponse
+	if err := json.NewDecoder(resp.Body).Decode(&apiResp); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK || !apiResp.Success {
+		return fmt.Errorf("%s %s failed: status %d: %s", method, path, resp.StatusCode, apiResp.Error)
+	}
+
+	if out != nil && len(apiResp.Data) > 0 {
+		return json.Unmarshal(apiResp.Data, out)
+	}
+
+	return nil
+}
@@ -0,0 +1,226 @@
+package discovery
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/dcim/collector-agent/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// 探测协议
+const (
+	ProtocolSNMP    = "snmp"
+	ProtocolModbus  = "modbus"
+	ProtocolOPCUA   = "opcua"
+	ProtocolRedfish = "redfish"
+)
+
+// 发现任务结果状态
+const (
+	StatusCompleted = "completed"
+	StatusFailed    = "failed"
+)
+
+// maxHosts 单个发现任务允许扫描的最大主机数（与采集管理服务保持一致）
+const maxHosts = 4096
+
+// Job 设备发现任务（由采集管理服务下发）
+type Job struct {
+	JobID         string   `json:"job_id"`
+	AgentID       string   `json:"agent_id"`
+	CIDR          string   `json:"cidr"`
+	Protocols     []string `json:"protocols"`       // 探测协议: snmp/modbus/opcua/redfish
+	SNMPCommunity string   `json:"snmp_community"`  // SNMP Community，默认public
+	ModbusUnitIDs []int    `json:"modbus_unit_ids"` // 探测的Modbus从站ID，默认1-16
+	Timeout       int      `json:"timeout"`         // 单次探测超时(秒)，默认2
+}
+
+// Fingerprint 设备指纹
+type Fingerprint struct {
+	Vendor     string `json:"vendor"`
+	Model      string `json:"model"`
+	DeviceType string `json:"device_type"` // 建议的设备类型
+}
+
+// Device 发现的设备
+type Device struct {
+	IP           string            `json:"ip"`
+	Port         int               `json:"port"`
+	Protocol     string            `json:"protocol"`
+	UnitID       int               `json:"unit_id,omitempty"` // Modbus从站ID
+	Fingerprint  Fingerprint       `json:"fingerprint"`
+	Details      map[string]string `json:"details,omitempty"` // 探测原始信息
+	DiscoveredAt int64             `json:"discovered_at"`
+}
+
+// Result 发现任务执行结果
+type Result struct {
+	JobID      string    `json:"job_id"`
+	AgentID    string    `json:"agent_id"`
+	Status     string    `json:"status"`
+	Error      string    `json:"error,omitempty"`
+	Devices    []*Device `json:"devices"`
+	StartedAt  int64     `json:"started_at"`
+	FinishedAt int64     `json:"finished_at"`
+}
+
+// prober 单协议探测函数，返回在该主机上发现的设备
+type prober func(ctx context.Context, ip string, job *Job) []*Device
+
+// probers 各协议的探测实现
+var probers = map[string]prober{
+	ProtocolSNMP:    probeSNMP,
+	ProtocolModbus:  probeModbus,
+	ProtocolOPCUA:   probeOPCUA,
+	ProtocolRedfish: probeRedfish,
+}
+
+// Scanner 设备发现扫描器
+type Scanner struct {
+	maxConcurrency int // 最大并发探测主机数
+}
+
+// NewScanner 创建扫描器
+func NewScanner(maxConcurrency int) *Scanner {
+	if maxConcurrency <= 0 {
+		maxConcurrency = 64
+	}
+	return &Scanner{maxConcurrency: maxConcurrency}
+}
+
+// Run 执行发现任务，扫描CIDR内所有主机
+func (s *Scanner) Run(ctx context.Context, job *Job) *Result {
+	result := &Result{
+		JobID:     job.JobID,
+		AgentID:   job.AgentID,
+		StartedAt: time.Now().Unix(),
+	}
+
+	hosts, err := expandCIDR(job.CIDR)
+	if err != nil {
+		result.Status = StatusFailed
+		result.Error = err.Error()
+		result.FinishedAt = time.Now().Unix()
+		return result
+	}
+
+	for _, p := range job.Protocols {
+		if _, ok := probers[p]; !ok {
+			result.Status = StatusFailed
+			result.Error = fmt.Sprintf("unsupported discovery protocol: %s", p)
+			result.FinishedAt = time.Now().Unix()
+			return result
+		}
+	}
+
+	logger.Log.Info("discovery job started",
+		zap.String("job_id", job.JobID),
+		zap.String("cidr", job.CIDR),
+		zap.Strings("protocols", job.Protocols),
+		zap.Int("hosts", len(hosts)))
+
+	var (
+		mu        sync.Mutex
+		wg        sync.WaitGroup
+		semaphore = make(chan struct{}, s.maxConcurrency)
+	)
+
+	for _, ip := range hosts {
+		if ctx.Err() != nil {
+			break
+		}
+
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func(ip string) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+
+			for _, p := range job.Protocols {
+				devices := probers[p](ctx, ip, job)
+				if len(devices) == 0 {
+					continue
+				}
+
+				mu.Lock()
+				result.Devices = append(result.Devices, devices...)
+				mu.Unlock()
+			}
+		}(ip)
+	}
+
+	wg.Wait()
+
+	result.FinishedAt = time.Now().Unix()
+	if err := ctx.Err(); err != nil {
+		result.Status = StatusFailed
+		result.Error = fmt.Sprintf("discovery interrupted: %v", err)
+	} else {
+		result.Status = StatusCompleted
+	}
+
+	logger.Log.Info("discovery job finished",
+		zap.String("job_id", job.JobID),
+		zap.String("status", result.Status),
+		zap.Int("devices", len(result.Devices)))
+
+	return result
+}
+
+// timeout 单次探测超时
+func (j *Job) timeout() time.Duration {
+	if j.Timeout <= 0 {
+		return 2 * time.Second
+	}
+	return time.Duration(j.Timeout) * time.Second
+}
+
+// expandCIDR 展开CIDR为主机地址列表（排除网络地址和广播地址）
+func expandCIDR(cidr string) ([]string, error) {
+	ip, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cidr: %w", err)
+	}
+
+	ip4 := ip.To4()
+	if ip4 == nil {
+		return nil, fmt.Errorf("only IPv4 cidr is supported: %s", cidr)
+	}
+
+	ones, bits := ipNet.Mask.Size()
+	size := 1 << (bits - ones)
+	if size > maxHosts {
+		return nil, fmt.Errorf("cidr %s is too large, at most %d hosts per job", cidr, maxHosts)
+	}
+
+	start := binary.BigEndian.Uint32(ipNet.IP.To4())
+	hosts := make([]string, 0, size)
+	for i := 0; i < size; i++ {
+		// /31和/32没有网络地址和广播地址
+		if size > 2 && (i == 0 || i == size-1) {
+			continue
+		}
+		addr := make(net.IP, 4)
+		binary.BigEndian.PutUint32(addr, start+uint32(i))
+		hosts = append(hosts, addr.String())
+	}
+
+	return hosts, nil
+}
+
+// newDevice 创建发现设备记录
+func newDevice(ip string, port int, protocol string, fp Fingerprint, details map[string]string) *Device {
+	return &Device{
+		IP:           ip,
+		Port:         port,
+		Protocol:     protocol,
+		Fingerprint:  fp,
+		Details:      details,
+		DiscoveredAt: time.Now().Unix(),
+	}
+}
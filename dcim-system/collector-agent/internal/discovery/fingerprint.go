@@ -0,0 +1,103 @@
+package discovery
+
+import (
+	"strings"
+)
+
+// enterpriseOIDPrefix SNMP私有企业OID前缀
+const enterpriseOIDPrefix = "1.3.6.1.4.1."
+
+// vendorProfile 厂商识别信息
+type vendorProfile struct {
+	Vendor     string
+	DeviceType string // 厂商主要产品对应的默认设备类型
+}
+
+// enterpriseVendors IANA私有企业编号 -> 厂商（数据中心常见设备厂商）
+var enterpriseVendors = map[string]vendorProfile{
+	"318":   {Vendor: "APC", DeviceType: "ups"},
+	"476":   {Vendor: "Vertiv/Liebert", DeviceType: "crac"},
+	"534":   {Vendor: "Eaton", DeviceType: "ups"},
+	"705":   {Vendor: "Schneider Electric", DeviceType: "ups"},
+	"935":   {Vendor: "Socomec", DeviceType: "ups"},
+	"3808":  {Vendor: "CyberPower", DeviceType: "ups"},
+	"13742": {Vendor: "Raritan", DeviceType: "pdu"},
+	"1718":  {Vendor: "Server Technology", DeviceType: "pdu"},
+	"30911": {Vendor: "Legrand", DeviceType: "pdu"},
+	"21239": {Vendor: "Vertiv/Geist", DeviceType: "sensor"},
+	"5528":  {Vendor: "Netbotz", DeviceType: "sensor"},
+	"2011":  {Vendor: "Huawei", DeviceType: "network"},
+	"25506": {Vendor: "H3C", DeviceType: "network"},
+	"9":     {Vendor: "Cisco", DeviceType: "network"},
+	"2636":  {Vendor: "Juniper", DeviceType: "network"},
+	"30065": {Vendor: "Arista", DeviceType: "network"},
+	"674":   {Vendor: "Dell", DeviceType: "server"},
+	"232":   {Vendor: "HPE", DeviceType: "server"},
+	"2":     {Vendor: "IBM", DeviceType: "server"},
+	"19046": {Vendor: "Lenovo", DeviceType: "server"},
+	"8072":  {Vendor: "Net-SNMP", DeviceType: "server"},
+	"311":   {Vendor: "Microsoft", DeviceType: "server"},
+}
+
+// descrKeywords sysDescr关键字 -> 设备类型（厂商编号无法区分产品线时使用）
+var descrKeywords = []struct {
+	Keyword    string
+	DeviceType string
+}{
+	{"ups", "ups"},
+	{"pdu", "pdu"},
+	{"rack power", "pdu"},
+	{"crac", "crac"},
+	{"air condition", "crac"},
+	{"cooling", "crac"},
+	{"environmental", "sensor"},
+	{"temperature", "sensor"},
+	{"switch", "network"},
+	{"router", "network"},
+	{"firewall", "network"},
+	{"linux", "server"},
+	{"windows", "server"},
+}
+
+// fingerprintSNMP 根据sysObjectID和sysDescr生成设备指纹
+func fingerprintSNMP(sysObjectID, sysDescr string) Fingerprint {
+	var fp Fingerprint
+
+	if strings.HasPrefix(sysObjectID, enterpriseOIDPrefix) {
+		enterprise := strings.SplitN(strings.TrimPrefix(sysObjectID, enterpriseOIDPrefix), ".", 2)[0]
+		if profile, ok := enterpriseVendors[enterprise]; ok {
+			fp.Vendor = profile.Vendor
+			fp.DeviceType = profile.DeviceType
+		}
+	}
+
+	// sysDescr中的产品关键字优先于厂商默认类型
+	descr := strings.ToLower(sysDescr)
+	for _, kw := range descrKeywords {
+		if strings.Contains(descr, kw.Keyword) {
+			fp.DeviceType = kw.DeviceType
+			break
+		}
+	}
+
+	fp.Model = modelFromDescr(sysDescr)
+
+	return fp
+}
+
+// modelFromDescr 取sysDescr首行（通常为产品型号）作为型号
+func modelFromDescr(sysDescr string) string {
+	model := strings.TrimSpace(sysDescr)
+	if i := strings.IndexAny(model, "\r\n"); i >= 0 {
+		model = model[:i]
+	}
+	if len(model) > 64 {
+		model = model[:64]
+	}
+	return model
+}
+
+// fingerprintModbus Modbus协议本身不携带设备标识，仅给出默认建议类型
+func fingerprintModbus() Fingerprint {
+	return Fingerprint{DeviceType: "modbus_device"}
+}
@@ -0,0 +1,134 @@
+package discovery
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+const (
+	modbusPort = 502
+
+	// 功能码: 读保持寄存器
+	modbusReadHoldingRegisters = 0x03
+	// 异常码: 网关目标设备无响应（说明该从站不存在）
+	modbusGatewayTargetFailed = 0x0B
+	modbusGatewayPathFailed   = 0x0A
+)
+
+// defaultModbusUnitIDs 默认探测的Modbus从站ID
+var defaultModbusUnitIDs = []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}
+
+// probeModbus 通过Modbus TCP逐个探测从站ID
+// 从站返回正常响应或非网关类异常响应时，认为该从站存在
+func probeModbus(ctx context.Context, ip string, job *Job) []*Device {
+	addr := net.JoinHostPort(ip, strconv.Itoa(modbusPort))
+	dialer := net.Dialer{Timeout: job.timeout()}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil
+	}
+	defer func() { conn.Close() }()
+
+	unitIDs := job.ModbusUnitIDs
+	if len(unitIDs) == 0 {
+		unitIDs = defaultModbusUnitIDs
+	}
+
+	var devices []*Device
+	for i, unitID := range unitIDs {
+		if ctx.Err() != nil {
+			break
+		}
+
+		conn.SetDeadline(time.Now().Add(job.timeout()))
+
+		ok, exception, err := modbusProbeUnit(conn, uint16(i+1), byte(unitID))
+		if err != nil {
+			var netErr net.Error
+			if !errors.As(err, &netErr) || !netErr.Timeout() {
+				// 连接异常后不再继续探测该主机
+				break
+			}
+
+			// 部分设备对不存在的从站不响应，超时后重建连接避免读到迟到的响应
+			next, err := dialer.DialContext(ctx, "tcp", addr)
+			if err != nil {
+				break
+			}
+			conn.Close()
+			conn = next
+			continue
+		}
+		if !ok {
+			continue
+		}
+
+		details := map[string]string{"unit_id": strconv.Itoa(unitID)}
+		if exception != 0 {
+			details["exception_code"] = fmt.Sprintf("0x%02X", exception)
+		}
+
+		device := newDevice(ip, modbusPort, ProtocolModbus, fingerprintModbus(), details)
+		device.UnitID = unitID
+		devices = append(devices, device)
+	}
+
+	return devices
+}
+
+// modbusProbeUnit 向指定从站发送读保持寄存器(地址0,数量1)请求
+// 返回从站是否存在以及异常码（正常响应为0）
+func modbusProbeUnit(conn net.Conn, transactionID uint16, unitID byte) (bool, byte, error) {
+	// MBAP头(7字节) + PDU(5字节)
+	req := make([]byte, 12)
+	binary.BigEndian.PutUint16(req[0:], transactionID)
+	binary.BigEndian.PutUint16(req[2:], 0) // 协议标识
+	binary.BigEndian.PutUint16(req[4:], 6) // 后续字节数
+	req[6] = unitID
+	req[7] = modbusReadHoldingRegisters
+	binary.BigEndian.PutUint16(req[8:], 0)  // 起始地址
+	binary.BigEndian.PutUint16(req[10:], 1) // 寄存器数量
+
+	if _, err := conn.Write(req); err != nil {
+		return false, 0, err
+	}
+
+	header := make([]byte, 7)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return false, 0, err
+	}
+
+	length := binary.BigEndian.Uint16(header[4:])
+	if length < 2 || length > 256 {
+		return false, 0, fmt.Errorf("invalid modbus response length: %d", length)
+	}
+
+	pdu := make([]byte, length-1)
+	if _, err := io.ReadFull(conn, pdu); err != nil {
+		return false, 0, err
+	}
+
+	if binary.BigEndian.Uint16(header[0:]) != transactionID || header[6] != unitID {
+		return false, 0, nil
+	}
+
+	if pdu[0] == modbusReadHoldingRegisters {
+		return true, 0, nil
+	}
+
+	if pdu[0] == modbusReadHoldingRegisters|0x80 && len(pdu) > 1 {
+		exception := pdu[1]
+		if exception == modbusGatewayTargetFailed || exception == modbusGatewayPathFailed {
+			return false, 0, nil
+		}
+		return true, exception, nil
+	}
+
+	return false, 0, nil
+}
@@ -0,0 +1,63 @@
+package discovery
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+const opcuaPort = 4840
+
+// probeOPCUA 发送OPC UA Hello消息，收到Acknowledge或Error消息即认为是OPC UA服务端
+func probeOPCUA(ctx context.Context, ip string, job *Job) []*Device {
+	addr := net.JoinHostPort(ip, strconv.Itoa(opcuaPort))
+	endpoint := fmt.Sprintf("opc.tcp://%s", addr)
+
+	dialer := net.Dialer{Timeout: job.timeout()}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(job.timeout()))
+
+	if _, err := conn.Write(opcuaHello(endpoint)); err != nil {
+		return nil
+	}
+
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return nil
+	}
+
+	msgType := string(header[0:3])
+	if msgType != "ACK" && msgType != "ERR" {
+		return nil
+	}
+
+	details := map[string]string{"endpoint": endpoint}
+	fp := Fingerprint{DeviceType: "plc"}
+	return []*Device{newDevice(ip, opcuaPort, ProtocolOPCUA, fp, details)}
+}
+
+// opcuaHello 构造OPC UA二进制协议Hello消息
+func opcuaHello(endpoint string) []byte {
+	body := make([]byte, 0, 32+len(endpoint))
+	body = binary.LittleEndian.AppendUint32(body, 0)     // ProtocolVersion
+	body = binary.LittleEndian.AppendUint32(body, 65536) // ReceiveBufferSize
+	body = binary.LittleEndian.AppendUint32(body, 65536) // SendBufferSize
+	body = binary.LittleEndian.AppendUint32(body, 0)     // MaxMessageSize
+	body = binary.LittleEndian.AppendUint32(body, 0)     // MaxChunkCount
+	body = binary.LittleEndian.AppendUint32(body, uint32(len(endpoint)))
+	body = append(body, endpoint...)
+
+	msg := make([]byte, 0, 8+len(body))
+	msg = append(msg, "HELF"...)
+	msg = binary.LittleEndian.AppendUint32(msg, uint32(8+len(body)))
+	return append(msg, body...)
+}
@@ -0,0 +1,60 @@
+package discovery
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// redfishServiceRoot Redfish服务根资源（仅解析识别所需字段）
+type redfishServiceRoot struct {
+	RedfishVersion string `json:"RedfishVersion"`
+	Vendor         string `json:"Vendor"`
+	Product        string `json:"Product"`
+	UUID           string `json:"UUID"`
+}
+
+// probeRedfish 访问 https://<ip>/redfish/v1/ 服务根识别BMC
+func probeRedfish(ctx context.Context, ip string, job *Job) []*Device {
+	client := &http.Client{
+		Timeout: job.timeout(),
+		Transport: &http.Transport{
+			// BMC普遍使用自签名证书
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		},
+	}
+	defer client.CloseIdleConnections()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("https://%s/redfish/v1/", ip), nil)
+	if err != nil {
+		return nil
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil
+	}
+
+	var root redfishServiceRoot
+	if err := json.NewDecoder(resp.Body).Decode(&root); err != nil || root.RedfishVersion == "" {
+		return nil
+	}
+
+	details := map[string]string{
+		"redfish_version": root.RedfishVersion,
+		"uuid":            root.UUID,
+	}
+	fp := Fingerprint{
+		Vendor:     root.Vendor,
+		Model:      root.Product,
+		DeviceType: "server",
+	}
+	return []*Device{newDevice(ip, 443, ProtocolRedfish, fp, details)}
+}
@@ -0,0 +1,76 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/gosnmp/gosnmp"
+)
+
+// SNMP系统组OID
+const (
+	oidSysDescr    = "1.3.6.1.2.1.1.1.0"
+	oidSysObjectID = "1.3.6.1.2.1.1.2.0"
+	oidSysName     = "1.3.6.1.2.1.1.5.0"
+)
+
+// probeSNMP 通过SNMP v2c读取sysDescr/sysObjectID识别设备
+func probeSNMP(ctx context.Context, ip string, job *Job) []*Device {
+	community := job.SNMPCommunity
+	if community == "" {
+		community = "public"
+	}
+
+	client := &gosnmp.GoSNMP{
+		Target:    ip,
+		Port:      161,
+		Version:   gosnmp.Version2c,
+		Community: community,
+		Timeout:   job.timeout(),
+		Retries:   0,
+		Context:   ctx,
+	}
+
+	if err := client.Connect(); err != nil {
+		return nil
+	}
+	defer client.Conn.Close()
+
+	result, err := client.Get([]string{oidSysDescr, oidSysObjectID, oidSysName})
+	if err != nil {
+		return nil
+	}
+
+	// Community属于凭据，不随发现结果上报，接入时由设备模板或操作人提供
+	details := map[string]string{"version": "v2c"}
+	for _, v := range result.Variables {
+		var value string
+		switch v.Type {
+		case gosnmp.OctetString:
+			value = string(v.Value.([]byte))
+		case gosnmp.ObjectIdentifier:
+			value = strings.TrimPrefix(v.Value.(string), ".")
+		case gosnmp.NoSuchObject, gosnmp.NoSuchInstance, gosnmp.Null:
+			continue
+		default:
+			value = fmt.Sprintf("%v", v.Value)
+		}
+
+		switch strings.TrimPrefix(v.Name, ".") {
+		case oidSysDescr:
+			details["sys_descr"] = value
+		case oidSysObjectID:
+			details["sys_object_id"] = value
+		case oidSysName:
+			details["sys_name"] = value
+		}
+	}
+
+	if details["sys_descr"] == "" && details["sys_object_id"] == "" {
+		return nil
+	}
+
+	fp := fingerprintSNMP(details["sys_object_id"], details["sys_descr"])
+	return []*Device{newDevice(ip, 161, ProtocolSNMP, fp, details)}
+}
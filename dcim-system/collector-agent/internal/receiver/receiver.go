@@ -100,11 +100,20 @@ func (r *Receiver) Stop() {
 	logger.Log.Info("receiver stopped")
 }
 
+// UpdateSubscribeTopics 更新MQTT接收器订阅的Topic列表（配置热加载）
+func (r *Receiver) UpdateSubscribeTopics(topics []string) error {
+	if r.mqttReceiver == nil {
+		return nil
+	}
+	return r.mqttReceiver.UpdateTopics(topics)
+}
+
 // MQTTReceiver MQTT接收器
 type MQTTReceiver struct {
 	config      config.MQTTReceiverConfig
 	client      mqtt.Client
 	dataHandler DataHandler
+	mu          sync.Mutex // 保护订阅Topic列表
 }
 
 // NewMQTTReceiver 创建MQTT接收器
@@ -131,14 +140,12 @@ func (m *MQTTReceiver) Start() error {
 	opts.SetOnConnectHandler(func(client mqtt.Client) {
 		logger.Log.Info("MQTT receiver connected")
 		// 订阅所有配置的Topic
-		for _, topic := range m.config.SubscribeTopics {
-			if token := client.Subscribe(topic, m.config.QoS, m.messageHandler); token.Wait() && token.Error() != nil {
-				logger.Log.Error("failed to subscribe topic",
-					zap.String("topic", topic),
-					zap.Error(token.Error()))
-			} else {
-				logger.Log.Info("subscribed to topic", zap.String("topic", topic))
-			}
+		m.mu.Lock()
+		topics := m.config.SubscribeTopics
+		m.mu.Unlock()
+
+		for _, topic := range topics {
+			m.subscribe(client, topic)
 		}
 	})
 
@@ -151,6 +158,64 @@ func (m *MQTTReceiver) Start() error {
 	return nil
 }
 
+// UpdateTopics 更新订阅的Topic列表，取消已移除的订阅并订阅新增的Topic
+func (m *MQTTReceiver) UpdateTopics(topics []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	current := make(map[string]bool, len(m.config.SubscribeTopics))
+	for _, topic := range m.config.SubscribeTopics {
+		current[topic] = true
+	}
+
+	wanted := make(map[string]bool, len(topics))
+	for _, topic := range topics {
+		wanted[topic] = true
+	}
+
+	var removed []string
+	for topic := range current {
+		if !wanted[topic] {
+			removed = append(removed, topic)
+		}
+	}
+
+	// 未连接时仅更新配置，连接建立后按新配置订阅
+	connected := m.client != nil && m.client.IsConnectionOpen()
+
+	// 取消订阅失败时保留原Topic列表，下次热加载时重试
+	if connected && len(removed) > 0 {
+		if token := m.client.Unsubscribe(removed...); token.Wait() && token.Error() != nil {
+			return fmt.Errorf("failed to unsubscribe topics: %w", token.Error())
+		}
+		logger.Log.Info("unsubscribed from topics", zap.Strings("topics", removed))
+	}
+
+	m.config.SubscribeTopics = topics
+	if !connected {
+		return nil
+	}
+
+	for _, topic := range topics {
+		if !current[topic] {
+			m.subscribe(m.client, topic)
+		}
+	}
+
+	return nil
+}
+
+// subscribe 订阅单个Topic
+func (m *MQTTReceiver) subscribe(client mqtt.Client, topic string) {
+	if token := client.Subscribe(topic, m.config.QoS, m.messageHandler); token.Wait() && token.Error() != nil {
+		logger.Log.Error("failed to subscribe topic",
+			zap.String("topic", topic),
+			zap.Error(token.Error()))
+	} else {
+		logger.Log.Info("subscribed to topic", zap.String("topic", topic))
+	}
+}
+
 // Stop 停止MQTT接收器
 func (m *MQTTReceiver) Stop() {
 	if m.client != nil {
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/dcim/collector-agent/internal/collector"
 	"github.com/dcim/collector-agent/internal/protocol"
@@ -20,6 +21,11 @@ type Scheduler struct {
 	mu        sync.RWMutex
 	ctx       context.Context
 	cancel    context.CancelFunc
+
+	// 采集耗时统计，CollectStats读取后清零
+	statsMu      sync.Mutex
+	collectCount int64
+	collectTotal time.Duration
 }
 
 // ScheduledTask 调度任务
@@ -68,8 +74,8 @@ func (s *Scheduler) AddTask(task *protocol.CollectTask) error {
 	// 生成cron表达式
 	cronExpr := task.CronExpr
 	if cronExpr == "" {
-		// 如果没有cron表达式，使用采集间隔生成
-		cronExpr = fmt.Sprintf("*/%d * * * * *", task.Interval)
+		// 如果没有cron表达式，使用采集间隔生成（秒字段的*/N在间隔超过59秒时无效，统一使用@every）
+		cronExpr = fmt.Sprintf("@every %ds", task.Interval)
 	}
 
 	// 添加定时任务
@@ -161,7 +167,9 @@ func (s *Scheduler) executeTask(task *protocol.CollectTask) {
 		zap.String("device_id", task.DeviceID))
 
 	// 执行采集
+	start := time.Now()
 	data, err := s.collector.Collect(s.ctx, task)
+	s.recordCollect(time.Since(start))
 	if err != nil {
 		logger.Log.Error("task execution failed",
 			zap.String("task_id", task.TaskID),
@@ -172,3 +180,30 @@ func (s *Scheduler) executeTask(task *protocol.CollectTask) {
 	// 数据处理逻辑（上报、缓存等）由Agent层处理
 	_ = data
 }
+
+// recordCollect 记录一次采集耗时
+func (s *Scheduler) recordCollect(d time.Duration) {
+	s.statsMu.Lock()
+	s.collectCount++
+	s.collectTotal += d
+	s.statsMu.Unlock()
+}
+
+// CollectStats 返回当前调度的任务数和上次调用以来单次采集的平均耗时(ms)
+func (s *Scheduler) CollectStats() (int, float64) {
+	s.mu.RLock()
+	taskCount := len(s.tasks)
+	s.mu.RUnlock()
+
+	s.statsMu.Lock()
+	defer s.statsMu.Unlock()
+
+	var avgMs float64
+	if s.collectCount > 0 {
+		avgMs = float64(s.collectTotal.Microseconds()) / float64(s.collectCount) / 1000
+	}
+	s.collectCount = 0
+	s.collectTotal = 0
+
+	return taskCount, avgMs
+}
@@ -1,6 +1,7 @@
 package config
 
 import (
+	"fmt"
 	"os"
 
 	"gopkg.in/yaml.v3"
@@ -8,11 +9,13 @@ import (
 
 // Config 采集Agent配置
 type Config struct {
-	Agent    AgentConfig    `yaml:"agent"`
-	MQTT     MQTTConfig     `yaml:"mqtt"`
-	GRPC     GRPCConfig     `yaml:"grpc"`
-	Cache    CacheConfig    `yaml:"cache"`
-	Receiver ReceiverConfig `yaml:"receiver"` // 被动接收配置
+	Agent     AgentConfig     `yaml:"agent"`
+	MQTT      MQTTConfig      `yaml:"mqtt"`
+	GRPC      GRPCConfig      `yaml:"grpc"`
+	Cache     CacheConfig     `yaml:"cache"`
+	Receiver  ReceiverConfig  `yaml:"receiver"`  // 被动接收配置
+	Log       LogConfig       `yaml:"log"`       // 日志配置
+	Discovery DiscoveryConfig `yaml:"discovery"` // 设备发现配置
 }
 
 // AgentConfig Agent基础配置
@@ -26,6 +29,12 @@ type AgentConfig struct {
 	CollectModes      []string `yaml:"collect_modes"`      // 采集模式: pull(主动拉取), push(被动接收)
 	EnablePullMode    bool     `yaml:"enable_pull_mode"`   // 启用主动拉取模式
 	EnablePushMode    bool     `yaml:"enable_push_mode"`   // 启用被动接收模式
+	// 配置文件变更检查间隔(秒)，文件变化时自动热加载
+	ConfigWatchInterval int `yaml:"config_watch_interval"`
+	// 采集管理服务HTTP地址，配置后心跳同时上报给采集管理服务，用于任务自动分配和故障转移；设备发现也使用该地址
+	MgmtURL string `yaml:"mgmt_url"`
+	// 采集管理服务启用认证时使用的API Key（心跳和设备发现共用）
+	MgmtAPIKey string `yaml:"mgmt_api_key"`
 }
 
 // MQTTConfig MQTT配置
@@ -36,6 +45,7 @@ type MQTTConfig struct {
 	Topic    string `yaml:"topic"`     // 数据上报Topic
 	QoS      byte   `yaml:"qos"`       // QoS级别
 	ClientID string `yaml:"client_id"` // 客户端ID
+	Encoding string `yaml:"encoding"`  // 数据编码: json(默认)/protobuf/cbor
 }
 
 // GRPCConfig gRPC配置
@@ -80,7 +90,21 @@ type ModbusReceiverConfig struct {
 	SlaveID    byte   `yaml:"slave_id"`    // 从站ID
 }
 
+// DiscoveryConfig 设备发现配置
+type DiscoveryConfig struct {
+	Enabled        bool   `yaml:"enabled"`         // 是否启用设备发现
+	MgmtURL        string `yaml:"mgmt_url"`        // 已废弃，使用agent.mgmt_url；仅在agent.mgmt_url为空时生效
+	PollInterval   int    `yaml:"poll_interval"`   // 轮询发现任务间隔(秒)
+	MaxConcurrency int    `yaml:"max_concurrency"` // 最大并发探测主机数
+}
+
+// LogConfig 日志配置
+type LogConfig struct {
+	Level string `yaml:"level"` // 日志级别: debug/info/warn/error
+}
+
 // LoadConfig 加载配置文件
+// 依次应用环境变量覆盖、默认值和校验，校验失败时返回所有错误
 func LoadConfig(path string) (*Config, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
@@ -92,5 +116,11 @@ func LoadConfig(path string) (*Config, error) {
 		return nil, err
 	}
 
+	config.applyEnvOverrides()
+
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+
 	return &config, nil
 }
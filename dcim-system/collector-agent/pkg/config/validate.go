@@ -0,0 +1,231 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// 默认配置值
+const (
+	DefaultMaxConcurrency      = 100
+	DefaultHeartbeatInterval   = 30
+	DefaultConfigWatchInterval = 10
+	DefaultMQTTTopic           = "dcim/collector/data"
+	DefaultCachePath           = "./data/cache"
+	DefaultMaxCacheTime        = 24
+	DefaultCleanInterval       = 10
+	DefaultModbusBaudRate      = 9600
+	DefaultLogLevel            = "info"
+	DefaultDiscoveryPoll       = 30
+	DefaultDiscoveryWorkers    = 64
+)
+
+// 环境变量覆盖（用于注入敏感信息，避免明文写入配置文件）
+const (
+	EnvMQTTUsername         = "DCIM_AGENT_MQTT_USERNAME"
+	EnvMQTTPassword         = "DCIM_AGENT_MQTT_PASSWORD"
+	EnvReceiverMQTTUsername = "DCIM_AGENT_RECEIVER_MQTT_USERNAME"
+	EnvReceiverMQTTPassword = "DCIM_AGENT_RECEIVER_MQTT_PASSWORD"
+	EnvMgmtAPIKey           = "DCIM_AGENT_MGMT_API_KEY"
+)
+
+// applyEnvOverrides 使用环境变量覆盖敏感配置
+func (c *Config) applyEnvOverrides() {
+	overrides := map[string]*string{
+		EnvMQTTUsername:         &c.MQTT.Username,
+		EnvMQTTPassword:         &c.MQTT.Password,
+		EnvReceiverMQTTUsername: &c.Receiver.MQTTReceiver.Username,
+		EnvReceiverMQTTPassword: &c.Receiver.MQTTReceiver.Password,
+		EnvMgmtAPIKey:           &c.Agent.MgmtAPIKey,
+	}
+
+	for env, field := range overrides {
+		if v, ok := os.LookupEnv(env); ok {
+			*field = v
+		}
+	}
+}
+
+// Validate 填充默认值并校验配置
+func (c *Config) Validate() error {
+	c.setDefaults()
+
+	var errs []error
+	addErr := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	// Agent配置
+	if c.Agent.ID == "" {
+		addErr("agent.id is required")
+	}
+	if c.Agent.MaxConcurrency < 0 {
+		addErr("agent.max_concurrency must be positive, got %d", c.Agent.MaxConcurrency)
+	}
+	if c.Agent.HeartbeatInterval < 0 {
+		addErr("agent.heartbeat_interval must be positive, got %d", c.Agent.HeartbeatInterval)
+	}
+	if c.Agent.ConfigWatchInterval < 0 {
+		addErr("agent.config_watch_interval must be positive, got %d", c.Agent.ConfigWatchInterval)
+	}
+	for _, mode := range c.Agent.CollectModes {
+		if mode != "pull" && mode != "push" {
+			addErr("agent.collect_modes: invalid mode %q, must be pull or push", mode)
+		}
+	}
+
+	// MQTT配置
+	if c.MQTT.Broker == "" {
+		addErr("mqtt.broker is required")
+	}
+	if c.MQTT.QoS > 2 {
+		addErr("mqtt.qos must be 0, 1 or 2, got %d", c.MQTT.QoS)
+	}
+	switch c.MQTT.Encoding {
+	case "json", "protobuf", "cbor":
+	default:
+		addErr("mqtt.encoding: unsupported encoding %q, must be json, protobuf or cbor", c.MQTT.Encoding)
+	}
+
+	// 缓存配置
+	if c.Cache.MaxCacheTime < 0 {
+		addErr("cache.max_cache_time must be positive, got %d", c.Cache.MaxCacheTime)
+	}
+	if c.Cache.CleanInterval < 0 {
+		addErr("cache.clean_interval must be positive, got %d", c.Cache.CleanInterval)
+	}
+
+	// 被动接收配置
+	if c.Agent.EnablePushMode && c.Receiver.Enabled {
+		errs = append(errs, c.Receiver.validate()...)
+	}
+
+	// 设备发现配置
+	if c.Discovery.Enabled && c.Agent.MgmtURL == "" {
+		addErr("agent.mgmt_url is required when discovery is enabled")
+	}
+	if c.Discovery.MgmtURL != "" && c.Discovery.MgmtURL != c.Agent.MgmtURL {
+		addErr("discovery.mgmt_url is deprecated and conflicts with agent.mgmt_url, remove it")
+	}
+	if c.Discovery.PollInterval < 0 {
+		addErr("discovery.poll_interval must be positive, got %d", c.Discovery.PollInterval)
+	}
+
+	// 日志配置
+	if _, err := zapcore.ParseLevel(c.Log.Level); err != nil {
+		addErr("log.level: %v", err)
+	}
+
+	return errors.Join(errs...)
+}
+
+// setDefaults 填充未配置项的默认值
+func (c *Config) setDefaults() {
+	if c.Agent.Name == "" {
+		c.Agent.Name = c.Agent.ID
+	}
+	if c.Agent.MaxConcurrency == 0 {
+		c.Agent.MaxConcurrency = DefaultMaxConcurrency
+	}
+	if c.Agent.HeartbeatInterval == 0 {
+		c.Agent.HeartbeatInterval = DefaultHeartbeatInterval
+	}
+	if c.Agent.ConfigWatchInterval == 0 {
+		c.Agent.ConfigWatchInterval = DefaultConfigWatchInterval
+	}
+
+	// collect_modes 与 enable_*_mode 开关等价；都未配置时默认启用主动拉取模式
+	for _, mode := range c.Agent.CollectModes {
+		switch mode {
+		case "pull":
+			c.Agent.EnablePullMode = true
+		case "push":
+			c.Agent.EnablePushMode = true
+		}
+	}
+	if !c.Agent.EnablePullMode && !c.Agent.EnablePushMode {
+		c.Agent.EnablePullMode = true
+	}
+
+	if c.MQTT.Topic == "" {
+		c.MQTT.Topic = DefaultMQTTTopic
+	}
+	if c.MQTT.ClientID == "" {
+		c.MQTT.ClientID = c.Agent.ID
+	}
+	if c.MQTT.Encoding == "" {
+		c.MQTT.Encoding = "json"
+	}
+
+	if c.Cache.Path == "" {
+		c.Cache.Path = DefaultCachePath
+	}
+	if c.Cache.MaxCacheTime == 0 {
+		c.Cache.MaxCacheTime = DefaultMaxCacheTime
+	}
+	if c.Cache.CleanInterval == 0 {
+		c.Cache.CleanInterval = DefaultCleanInterval
+	}
+
+	if c.Receiver.MQTTReceiver.ClientID == "" && c.Agent.ID != "" {
+		c.Receiver.MQTTReceiver.ClientID = c.Agent.ID + "-receiver"
+	}
+	if c.Receiver.ModbusReceiver.Mode == "" {
+		c.Receiver.ModbusReceiver.Mode = "tcp"
+	}
+	if c.Receiver.ModbusReceiver.BaudRate == 0 {
+		c.Receiver.ModbusReceiver.BaudRate = DefaultModbusBaudRate
+	}
+
+	// 兼容旧配置：discovery.mgmt_url已合并到agent.mgmt_url
+	if c.Agent.MgmtURL == "" {
+		c.Agent.MgmtURL = c.Discovery.MgmtURL
+	}
+	if c.Discovery.PollInterval == 0 {
+		c.Discovery.PollInterval = DefaultDiscoveryPoll
+	}
+	if c.Discovery.MaxConcurrency <= 0 {
+		c.Discovery.MaxConcurrency = DefaultDiscoveryWorkers
+	}
+
+	if c.Log.Level == "" {
+		c.Log.Level = DefaultLogLevel
+	}
+}
+
+// validate 校验被动接收配置
+func (r *ReceiverConfig) validate() []error {
+	var errs []error
+
+	if r.MQTTReceiver.Enabled {
+		if r.MQTTReceiver.Broker == "" {
+			errs = append(errs, errors.New("receiver.mqtt_receiver.broker is required"))
+		}
+		if len(r.MQTTReceiver.SubscribeTopics) == 0 {
+			errs = append(errs, errors.New("receiver.mqtt_receiver.subscribe_topics must not be empty"))
+		}
+		if r.MQTTReceiver.QoS > 2 {
+			errs = append(errs, fmt.Errorf("receiver.mqtt_receiver.qos must be 0, 1 or 2, got %d", r.MQTTReceiver.QoS))
+		}
+	}
+
+	if r.ModbusReceiver.Enabled {
+		switch r.ModbusReceiver.Mode {
+		case "tcp":
+			if r.ModbusReceiver.ListenAddr == "" {
+				errs = append(errs, errors.New("receiver.modbus_receiver.listen_addr is required in tcp mode"))
+			}
+		case "rtu":
+			if r.ModbusReceiver.SerialPort == "" {
+				errs = append(errs, errors.New("receiver.modbus_receiver.serial_port is required in rtu mode"))
+			}
+		default:
+			errs = append(errs, fmt.Errorf("receiver.modbus_receiver.mode: invalid mode %q, must be tcp or rtu", r.ModbusReceiver.Mode))
+		}
+	}
+
+	return errs
+}
@@ -0,0 +1,51 @@
+package config
+
+import (
+	"context"
+	"os"
+	"time"
+)
+
+// Watch 定期检查配置文件的修改时间，文件发生变化时通过返回的channel通知
+// ctx取消后停止检查并关闭channel
+func Watch(ctx context.Context, path string, interval time.Duration) <-chan struct{} {
+	changes := make(chan struct{}, 1)
+
+	go func() {
+		defer close(changes)
+
+		lastModTime := modTime(path)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				current := modTime(path)
+				if current.IsZero() || current.Equal(lastModTime) {
+					continue
+				}
+				lastModTime = current
+
+				// 合并尚未处理的通知
+				select {
+				case changes <- struct{}{}:
+				default:
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return changes
+}
+
+// modTime 获取文件修改时间，文件不存在时返回零值
+func modTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
@@ -7,9 +7,13 @@ import (
 
 var Log *zap.Logger
 
+// level 全局日志级别，支持运行时调整
+var level = zap.NewAtomicLevelAt(zap.InfoLevel)
+
 // InitLogger 初始化日志
 func InitLogger() error {
 	config := zap.NewProductionConfig()
+	config.Level = level
 	config.EncoderConfig.TimeKey = "timestamp"
 	config.EncoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
 
@@ -22,6 +26,16 @@ func InitLogger() error {
 	return nil
 }
 
+// SetLevel 设置日志级别（debug/info/warn/error）
+func SetLevel(text string) error {
+	l, err := zapcore.ParseLevel(text)
+	if err != nil {
+		return err
+	}
+	level.SetLevel(l)
+	return nil
+}
+
 // Sync 同步日志
 func Sync() {
 	if Log != nil {
@@ -1,14 +1,19 @@
 package main
 
 import (
+	"context"
+	"database/sql"
 	"flag"
 	"fmt"
+	"time"
 
+	"github.com/dcim/services/collector-mgmt/internal/auth"
 	"github.com/dcim/services/collector-mgmt/internal/handler"
 	"github.com/dcim/services/collector-mgmt/internal/service"
 	"github.com/dcim/services/collector-mgmt/pkg/config"
 	"github.com/gin-gonic/gin"
 	"github.com/go-redis/redis/v8"
+	_ "github.com/lib/pq"
 )
 
 var (
@@ -31,18 +36,79 @@ func main() {
 		DB:       cfg.Redis.DB,
 	})
 
+	// 连接PostgreSQL（设备台账）
+	var inventoryService *service.InventoryService
+	if cfg.Postgres.DSN != "" {
+		db, err := openInventoryDB(cfg.Postgres)
+		if err != nil {
+			panic(fmt.Sprintf("failed to open inventory database: %v", err))
+		}
+		defer db.Close()
+		inventoryService = service.NewInventoryService(db, redisClient)
+	}
+
 	// 创建服务
-	taskService := service.NewTaskService(redisClient)
+	profileService := service.NewProfileService(redisClient)
+	agentService := service.NewAgentService(redisClient, time.Duration(cfg.Assignment.OfflineAfter)*time.Second)
+	taskService := service.NewTaskService(redisClient, profileService, inventoryService, agentService)
+	discoveryService := service.NewDiscoveryService(redisClient, taskService)
+	auditService := service.NewAuditService(redisClient)
+
+	// 认证
+	authenticator, err := newAuthenticator(cfg.Auth)
+	if err != nil {
+		panic(fmt.Sprintf("failed to configure authentication: %v", err))
+	}
+
+	// 构建任务索引（从旧版本升级时迁移已有任务）
+	indexed, err := taskService.RebuildIndexes(context.Background())
+	if err != nil {
+		panic(fmt.Sprintf("failed to rebuild task indexes: %v", err))
+	}
+	if indexed > 0 {
+		fmt.Printf("已重建 %d 个任务的索引\n", indexed)
+	}
+
+	// 导入模板目录
+	if cfg.Profiles.Dir != "" {
+		if err := importProfiles(profileService, taskService, cfg.Profiles.Dir); err != nil {
+			panic(fmt.Sprintf("failed to import profiles: %v", err))
+		}
+	}
+
+	// Agent离线后转移任务，恢复后迁回
+	if cfg.Assignment.CheckInterval > 0 {
+		go rebalanceLoop(taskService, cfg.Assignment)
+	}
 
 	// 创建处理器
 	taskHandler := handler.NewTaskHandler(taskService)
+	agentHandler := handler.NewAgentHandler(agentService, taskService, time.Duration(cfg.Assignment.GracePeriod)*time.Second)
+	discoveryHandler := handler.NewDiscoveryHandler(discoveryService, taskService)
+	profileHandler := handler.NewProfileHandler(profileService, taskService)
+	auditHandler := handler.NewAuditHandler(auditService)
 
 	// 初始化Gin
 	gin.SetMode(cfg.Server.Mode)
 	router := gin.Default()
+	router.Use(handler.AuthMiddleware(authenticator, "/health"))
 
 	// 注册路由
 	taskHandler.RegisterRoutes(router)
+	agentHandler.RegisterRoutes(router)
+	discoveryHandler.RegisterRoutes(router)
+	profileHandler.RegisterRoutes(router)
+	auditHandler.RegisterRoutes(router)
+	if inventoryService != nil {
+		handler.NewInventoryHandler(inventoryService, taskService).RegisterRoutes(router)
+
+		capacityService := service.NewCapacityService(inventoryService, redisClient, service.CapacityThresholds{
+			Space:  service.CapacityThreshold(cfg.Capacity.Space),
+			Power:  service.CapacityThreshold(cfg.Capacity.Power),
+			Weight: service.CapacityThreshold(cfg.Capacity.Weight),
+		}, cfg.Capacity.PowerMetrics)
+		handler.NewCapacityHandler(capacityService, inventoryService).RegisterRoutes(router)
+	}
 
 	// 健康检查
 	router.GET("/health", func(c *gin.Context) {
@@ -56,3 +122,90 @@ func main() {
 		panic(err)
 	}
 }
+
+// importProfiles 导入模板目录，模板有变化时同步到引用的任务
+func importProfiles(profileService *service.ProfileService, taskService *service.TaskService, dir string) error {
+	ctx := context.Background()
+
+	profiles, err := service.LoadProfileDir(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, profile := range profiles {
+		changed, err := profileService.Save(ctx, profile)
+		if err != nil {
+			return fmt.Errorf("profile %s: %w", profile.ProfileID, err)
+		}
+		if !changed {
+			continue
+		}
+
+		updated, err := taskService.RolloutProfile(ctx, profile.ProfileID)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("模板 %s 已更新到版本 %d，同步任务 %d 个\n", profile.ProfileID, profile.Version, updated)
+	}
+
+	return nil
+}
+
+// rebalanceLoop 定期检查Agent在线状态并重新分配任务
+func rebalanceLoop(taskService *service.TaskService, cfg config.AssignmentConfig) {
+	ticker := time.NewTicker(time.Duration(cfg.CheckInterval) * time.Second)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		result, err := taskService.Rebalance(context.Background(), time.Duration(cfg.GracePeriod)*time.Second)
+		if err != nil {
+			fmt.Printf("任务重新分配失败: %v\n", err)
+			continue
+		}
+		if result.FailedOver > 0 || result.Restored > 0 || result.Stranded > 0 {
+			fmt.Printf("任务重新分配: 转移 %d 个，迁回 %d 个，无可用Agent %d 个\n",
+				result.FailedOver, result.Restored, result.Stranded)
+		}
+	}
+}
+
+// newAuthenticator 根据配置创建认证器，未启用认证时返回nil
+func newAuthenticator(cfg config.AuthConfig) (*auth.Authenticator, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	apiKeys := make([]auth.APIKey, 0, len(cfg.APIKeys))
+	for _, key := range cfg.APIKeys {
+		roles, err := auth.ParseRoles(key.Roles)
+		if err != nil {
+			return nil, fmt.Errorf("api key %s: %w", key.Name, err)
+		}
+		apiKeys = append(apiKeys, auth.APIKey{Name: key.Name, KeySHA256: key.KeySHA256, Roles: roles})
+	}
+
+	return auth.NewAuthenticator(cfg.JWTSecret, cfg.JWTIssuer, apiKeys)
+}
+
+// openInventoryDB 连接设备台账数据库并创建表结构
+func openInventoryDB(cfg config.PostgresConfig) (*sql.DB, error) {
+	db, err := sql.Open("postgres", cfg.DSN)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.MaxOpenConns > 0 {
+		db.SetMaxOpenConns(cfg.MaxOpenConns)
+	}
+
+	ctx := context.Background()
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := service.MigrateInventory(ctx, db); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
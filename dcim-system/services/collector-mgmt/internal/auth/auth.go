@@ -0,0 +1,214 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Role 角色，权限从低到高为viewer、operator、admin，高级角色包含低级角色的权限
+type Role string
+
+// 角色
+const (
+	RoleViewer   Role = "viewer"   // 只读
+	RoleOperator Role = "operator" // 管理采集任务、发现任务和设备台账
+	RoleAdmin    Role = "admin"    // 管理数据中心、设备模板、任务重新分配，查询审计日志
+)
+
+// AllDataCenters 授权范围为全部数据中心
+const AllDataCenters = "*"
+
+// 认证方式
+const (
+	MethodJWT    = "jwt"
+	MethodAPIKey = "api_key"
+	MethodNone   = "none" // 未启用认证
+)
+
+// APIKeyHeader API Key请求头
+const APIKeyHeader = "X-API-Key"
+
+// ErrUnauthenticated 未提供凭证或凭证无效
+var ErrUnauthenticated = errors.New("unauthenticated")
+
+// rank 角色级别，未知角色为0
+func (r Role) rank() int {
+	switch r {
+	case RoleViewer:
+		return 1
+	case RoleOperator:
+		return 2
+	case RoleAdmin:
+		return 3
+	}
+	return 0
+}
+
+// ParseRole 解析角色名
+func ParseRole(s string) (Role, error) {
+	role := Role(s)
+	if role.rank() == 0 {
+		return "", fmt.Errorf("unknown role %q (expected viewer, operator or admin)", s)
+	}
+	return role, nil
+}
+
+// ParseRoles 解析数据中心到角色的映射，数据中心为"*"表示全部数据中心
+func ParseRoles(roles map[string]string) (map[string]Role, error) {
+	parsed := make(map[string]Role, len(roles))
+	for dataCenter, name := range roles {
+		role, err := ParseRole(name)
+		if err != nil {
+			return nil, fmt.Errorf("data center %s: %w", dataCenter, err)
+		}
+		parsed[dataCenter] = role
+	}
+	return parsed, nil
+}
+
+// Principal 已认证的调用方
+type Principal struct {
+	Subject string          `json:"subject"`
+	Method  string          `json:"method"`
+	Roles   map[string]Role `json:"roles"` // 数据中心 -> 角色
+}
+
+// Allows 判断调用方在数据中心是否拥有角色，dataCenter为空表示不属于具体数据中心的资源，需要全部数据中心的授权
+func (p *Principal) Allows(dataCenter string, role Role) bool {
+	if p.Roles[AllDataCenters].rank() >= role.rank() {
+		return true
+	}
+	return dataCenter != "" && p.Roles[dataCenter].rank() >= role.rank()
+}
+
+// AllowsAny 判断调用方是否在任一数据中心拥有角色
+func (p *Principal) AllowsAny(role Role) bool {
+	for _, r := range p.Roles {
+		if r.rank() >= role.rank() {
+			return true
+		}
+	}
+	return false
+}
+
+// Anonymous 未启用认证时的调用方，拥有全部数据中心的管理员角色
+func Anonymous(subject string) *Principal {
+	return &Principal{
+		Subject: subject,
+		Method:  MethodNone,
+		Roles:   map[string]Role{AllDataCenters: RoleAdmin},
+	}
+}
+
+// APIKey API Key配置，只保存密钥的SHA-256摘要
+type APIKey struct {
+	Name      string
+	KeySHA256 string
+	Roles     map[string]Role
+}
+
+// Authenticator 请求认证：Authorization: Bearer <JWT> 或 X-API-Key: <key>
+type Authenticator struct {
+	jwtSecret []byte
+	jwtIssuer string
+	apiKeys   map[string]*APIKey // SHA-256摘要(hex) -> API Key
+}
+
+// NewAuthenticator 创建认证器，jwtSecret为空时不接受JWT
+func NewAuthenticator(jwtSecret, jwtIssuer string, apiKeys []APIKey) (*Authenticator, error) {
+	a := &Authenticator{
+		jwtSecret: []byte(jwtSecret),
+		jwtIssuer: jwtIssuer,
+		apiKeys:   make(map[string]*APIKey, len(apiKeys)),
+	}
+
+	for i := range apiKeys {
+		key := &apiKeys[i]
+		digest := strings.ToLower(key.KeySHA256)
+		if key.Name == "" {
+			return nil, fmt.Errorf("api key #%d: name is required", i+1)
+		}
+		if _, err := hex.DecodeString(digest); err != nil || len(digest) != sha256.Size*2 {
+			return nil, fmt.Errorf("api key %s: key_sha256 must be a hex encoded SHA-256 digest", key.Name)
+		}
+		if _, ok := a.apiKeys[digest]; ok {
+			return nil, fmt.Errorf("api key %s: duplicate key", key.Name)
+		}
+		a.apiKeys[digest] = key
+	}
+
+	if len(a.jwtSecret) == 0 && len(a.apiKeys) == 0 {
+		return nil, errors.New("authentication requires jwt_secret or at least one api key")
+	}
+	return a, nil
+}
+
+// claims JWT声明，roles为数据中心到角色的映射
+type claims struct {
+	Roles map[string]string `json:"roles"`
+	jwt.RegisteredClaims
+}
+
+// Authenticate 认证请求，凭证缺失或无效时返回ErrUnauthenticated
+func (a *Authenticator) Authenticate(r *http.Request) (*Principal, error) {
+	if key := r.Header.Get(APIKeyHeader); key != "" {
+		return a.authenticateAPIKey(key)
+	}
+
+	header := r.Header.Get("Authorization")
+	if token, ok := strings.CutPrefix(header, "Bearer "); ok && token != "" {
+		return a.authenticateJWT(token)
+	}
+
+	return nil, fmt.Errorf("missing credentials: %w", ErrUnauthenticated)
+}
+
+// authenticateAPIKey 按密钥摘要查找API Key
+func (a *Authenticator) authenticateAPIKey(key string) (*Principal, error) {
+	digest := sha256.Sum256([]byte(key))
+	apiKey, ok := a.apiKeys[hex.EncodeToString(digest[:])]
+	if !ok {
+		return nil, fmt.Errorf("invalid api key: %w", ErrUnauthenticated)
+	}
+
+	return &Principal{Subject: apiKey.Name, Method: MethodAPIKey, Roles: apiKey.Roles}, nil
+}
+
+// authenticateJWT 校验HS256签名和有效期，sub为用户名
+func (a *Authenticator) authenticateJWT(tokenString string) (*Principal, error) {
+	if len(a.jwtSecret) == 0 {
+		return nil, fmt.Errorf("jwt authentication is not enabled: %w", ErrUnauthenticated)
+	}
+
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithExpirationRequired(),
+	}
+	if a.jwtIssuer != "" {
+		opts = append(opts, jwt.WithIssuer(a.jwtIssuer))
+	}
+
+	var c claims
+	_, err := jwt.ParseWithClaims(tokenString, &c, func(*jwt.Token) (interface{}, error) {
+		return a.jwtSecret, nil
+	}, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("invalid token: %v: %w", err, ErrUnauthenticated)
+	}
+	if c.Subject == "" {
+		return nil, fmt.Errorf("invalid token: missing sub: %w", ErrUnauthenticated)
+	}
+
+	roles, err := ParseRoles(c.Roles)
+	if err != nil {
+		return nil, fmt.Errorf("invalid token: %v: %w", err, ErrUnauthenticated)
+	}
+
+	return &Principal{Subject: c.Subject, Method: MethodJWT, Roles: roles}, nil
+}
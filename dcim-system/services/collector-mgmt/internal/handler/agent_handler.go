@@ -0,0 +1,110 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/dcim/services/collector-mgmt/internal/auth"
+	"github.com/dcim/services/collector-mgmt/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+// AgentHandler Agent处理器
+type AgentHandler struct {
+	agentService *service.AgentService
+	taskService  *service.TaskService
+	gracePeriod  time.Duration
+}
+
+// NewAgentHandler 创建Agent处理器
+func NewAgentHandler(agentService *service.AgentService, taskService *service.TaskService, gracePeriod time.Duration) *AgentHandler {
+	return &AgentHandler{
+		agentService: agentService,
+		taskService:  taskService,
+		gracePeriod:  gracePeriod,
+	}
+}
+
+// Heartbeat 接收Agent心跳
+func (h *AgentHandler) Heartbeat(c *gin.Context) {
+	var hb service.AgentHeartbeat
+	if err := c.ShouldBindJSON(&hb); err != nil {
+		respondError(c, bindError(err))
+		return
+	}
+	// 已注册的Agent变更位置时需要同时拥有原数据中心的授权
+	dataCenters := []string{hb.DataCenter}
+	current, err := h.taskService.AgentDataCenter(c.Request.Context(), hb.AgentID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	if current != "" && current != hb.DataCenter {
+		dataCenters = append(dataCenters, current)
+	}
+	if !authorize(c, auth.RoleOperator, dataCenters...) {
+		return
+	}
+
+	status, err := h.agentService.RecordHeartbeat(c.Request.Context(), &hb, actorFromRequest(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    status,
+	})
+}
+
+// ListAgents 查询Agent列表，可按data_center/room筛选，只返回调用方有权查看的数据中心的Agent
+func (h *AgentHandler) ListAgents(c *gin.Context) {
+	agents, err := h.agentService.ListAgents(c.Request.Context(), c.Query("data_center"), c.Query("room"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	principal := principalFromRequest(c)
+	allowed := agents[:0]
+	for _, agent := range agents {
+		if principal.Allows(agent.DataCenter, auth.RoleViewer) {
+			allowed = append(allowed, agent)
+		}
+	}
+	agents = allowed
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    agents,
+	})
+}
+
+// Rebalance 立即执行一次任务重新分配，需要全部数据中心的管理员角色
+func (h *AgentHandler) Rebalance(c *gin.Context) {
+	if !authorize(c, auth.RoleAdmin) {
+		return
+	}
+
+	result, err := h.taskService.Rebalance(c.Request.Context(), h.gracePeriod)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    result,
+	})
+}
+
+// RegisterRoutes 注册路由
+func (h *AgentHandler) RegisterRoutes(router *gin.Engine) {
+	api := router.Group("/api/v1/agents")
+	{
+		api.POST("/heartbeat", h.Heartbeat)
+		api.GET("", h.ListAgents)
+		api.POST("/rebalance", h.Rebalance)
+	}
+}
@@ -0,0 +1,56 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/dcim/services/collector-mgmt/internal/auth"
+	"github.com/dcim/services/collector-mgmt/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+// AuditHandler 审计日志处理器
+type AuditHandler struct {
+	auditService *service.AuditService
+}
+
+// NewAuditHandler 创建审计日志处理器
+func NewAuditHandler(auditService *service.AuditService) *AuditHandler {
+	return &AuditHandler{
+		auditService: auditService,
+	}
+}
+
+// QueryAuditLog 按时间倒序查询审计日志
+// 需要管理员角色，只返回调用方拥有管理员角色的数据中心的条目
+func (h *AuditHandler) QueryAuditLog(c *gin.Context) {
+	principal := principalFromRequest(c)
+	if !principal.AllowsAny(auth.RoleAdmin) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "forbidden: admin role required"})
+		return
+	}
+
+	var query service.AuditQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		respondError(c, bindError(err))
+		return
+	}
+
+	page, err := h.auditService.Query(c.Request.Context(), &query, func(e *service.AuditEntry) bool {
+		return principal.Allows(e.DataCenter, auth.RoleAdmin)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":     true,
+		"data":        page.Entries,
+		"next_cursor": page.NextCursor,
+	})
+}
+
+// RegisterRoutes 注册路由
+func (h *AuditHandler) RegisterRoutes(router *gin.Engine) {
+	router.GET("/api/v1/audit", h.QueryAuditLog)
+}
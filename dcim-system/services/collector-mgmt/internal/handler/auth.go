@@ -0,0 +1,161 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/dcim/services/collector-mgmt/internal/auth"
+	"github.com/dcim/services/collector-mgmt/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+// principalKey gin上下文中保存调用方的key
+const principalKey = "principal"
+
+// AuthMiddleware 认证中间件，publicPaths中的路径不需要认证
+// authenticator为nil时不启用认证，调用方取X-Actor请求头并拥有全部权限；
+// 启用时GET请求需要在任一数据中心拥有viewer角色，其他请求需要operator角色，
+// 资源所在数据中心的授权由各处理器校验
+func AuthMiddleware(authenticator *auth.Authenticator, publicPaths ...string) gin.HandlerFunc {
+	public := make(map[string]bool, len(publicPaths))
+	for _, path := range publicPaths {
+		public[path] = true
+	}
+
+	return func(c *gin.Context) {
+		if public[c.Request.URL.Path] {
+			c.Next()
+			return
+		}
+
+		var principal *auth.Principal
+		if authenticator == nil {
+			principal = auth.Anonymous(legacyActor(c))
+		} else {
+			var err error
+			principal, err = authenticator.Authenticate(c.Request)
+			if err != nil {
+				c.Header("WWW-Authenticate", `Bearer realm="collector-mgmt"`)
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		role := auth.RoleOperator
+		if c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead {
+			role = auth.RoleViewer
+		}
+		if !principal.AllowsAny(role) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("forbidden: %s role required", role)})
+			return
+		}
+
+		c.Set(principalKey, principal)
+		c.Request = c.Request.WithContext(service.WithAuditSource(c.Request.Context(), service.AuditSource{
+			SourceIP:   c.ClientIP(),
+			AuthMethod: principal.Method,
+		}))
+		c.Next()
+	}
+}
+
+// principalFromRequest 获取请求的调用方，未经过认证中间件时视为未启用认证
+func principalFromRequest(c *gin.Context) *auth.Principal {
+	if value, ok := c.Get(principalKey); ok {
+		return value.(*auth.Principal)
+	}
+	return auth.Anonymous(legacyActor(c))
+}
+
+// authorize 校验调用方在资源所在的每个数据中心都拥有角色，未通过时返回403
+// 不指定数据中心（或数据中心为空）时需要全部数据中心的授权
+func authorize(c *gin.Context, role auth.Role, dataCenters ...string) bool {
+	principal := principalFromRequest(c)
+	if len(dataCenters) == 0 {
+		dataCenters = []string{""}
+	}
+
+	for _, dataCenter := range dataCenters {
+		if principal.Allows(dataCenter, role) {
+			continue
+		}
+		scope := "all data centers"
+		if dataCenter != "" {
+			scope = "data center " + dataCenter
+		}
+		c.JSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("forbidden: %s role required in %s", role, scope)})
+		return false
+	}
+	return true
+}
+
+// authorizeAgents 校验调用方在Agent所在的数据中心拥有角色，dataCenters为额外需要校验的数据中心
+// Agent的数据中心取自心跳，未上报过心跳的Agent需要全部数据中心的授权
+func authorizeAgents(c *gin.Context, taskService *service.TaskService, role auth.Role, agentIDs []string, dataCenters ...string) bool {
+	for _, agentID := range agentIDs {
+		dataCenter, err := taskService.AgentDataCenter(c.Request.Context(), agentID)
+		if err != nil {
+			respondError(c, err)
+			return false
+		}
+		dataCenters = append(dataCenters, dataCenter)
+	}
+	return authorize(c, role, dataCenters...)
+}
+
+// agentFilter 返回判断调用方能否以指定角色访问Agent的函数，用于按数据中心过滤列表
+// Agent的数据中心按需查询并缓存，拥有全部数据中心授权时不查询
+func agentFilter(c *gin.Context, taskService *service.TaskService, role auth.Role) func(agentID string) (bool, error) {
+	principal := principalFromRequest(c)
+	if principal.Allows("", role) {
+		return func(string) (bool, error) { return true, nil }
+	}
+
+	allowed := make(map[string]bool)
+	return func(agentID string) (bool, error) {
+		if ok, cached := allowed[agentID]; cached {
+			return ok, nil
+		}
+		dataCenter, err := taskService.AgentDataCenter(c.Request.Context(), agentID)
+		if err != nil {
+			return false, err
+		}
+		allowed[agentID] = principal.Allows(dataCenter, role)
+		return allowed[agentID], nil
+	}
+}
+
+// inventoryRef 台账资源引用，kind为data_center、room、rack或device
+type inventoryRef struct {
+	kind string
+	id   string
+}
+
+// authorizeInventory 校验调用方在台账资源所在的数据中心拥有角色
+// 资源不存在或设备未上架时不属于任何数据中心，需要全部数据中心的授权
+func authorizeInventory(c *gin.Context, inventory *service.InventoryService, role auth.Role, refs ...inventoryRef) bool {
+	ctx := c.Request.Context()
+
+	dataCenters := make([]string, 0, len(refs))
+	for _, ref := range refs {
+		var dataCenter string
+		var err error
+		switch ref.kind {
+		case "data_center":
+			dataCenter = ref.id
+		case "room":
+			dataCenter, err = inventory.RoomDataCenter(ctx, ref.id)
+		case "rack":
+			dataCenter, err = inventory.RackDataCenter(ctx, ref.id)
+		case "device":
+			dataCenter, _, err = inventory.DeviceLocation(ctx, ref.id)
+		}
+		if err != nil {
+			respondError(c, err)
+			return false
+		}
+		dataCenters = append(dataCenters, dataCenter)
+	}
+
+	return authorize(c, role, dataCenters...)
+}
@@ -0,0 +1,167 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/dcim/services/collector-mgmt/internal/auth"
+	"github.com/dcim/services/collector-mgmt/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+// CapacityHandler 容量规划处理器
+type CapacityHandler struct {
+	capacityService  *service.CapacityService
+	inventoryService *service.InventoryService
+}
+
+// NewCapacityHandler 创建容量规划处理器
+func NewCapacityHandler(capacityService *service.CapacityService, inventoryService *service.InventoryService) *CapacityHandler {
+	return &CapacityHandler{
+		capacityService:  capacityService,
+		inventoryService: inventoryService,
+	}
+}
+
+// ListRackCapacity 查询机柜容量，可按data_center_id/room_id筛选，只返回调用方有权查看的数据中心的机柜
+func (h *CapacityHandler) ListRackCapacity(c *gin.Context) {
+	var query service.CapacityQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		respondError(c, bindError(err))
+		return
+	}
+	if !h.authorizeQuery(c, &query) {
+		return
+	}
+
+	racks, err := h.capacityService.ListRackCapacity(c.Request.Context(), &query)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	principal := principalFromRequest(c)
+	allowed := racks[:0]
+	for _, rack := range racks {
+		if principal.Allows(rack.DataCenterID, auth.RoleViewer) {
+			allowed = append(allowed, rack)
+		}
+	}
+	racks = allowed
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    racks,
+	})
+}
+
+// GetRackCapacity 查询单个机柜容量
+func (h *CapacityHandler) GetRackCapacity(c *gin.Context) {
+	if !authorizeInventory(c, h.inventoryService, auth.RoleViewer, inventoryRef{"rack", c.Param("id")}) {
+		return
+	}
+
+	rack, err := h.capacityService.GetRackCapacity(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    rack,
+	})
+}
+
+// ListAlerts 查询容量告警，只返回调用方有权查看的数据中心的告警
+func (h *CapacityHandler) ListAlerts(c *gin.Context) {
+	var query service.CapacityQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		respondError(c, bindError(err))
+		return
+	}
+	if !h.authorizeQuery(c, &query) {
+		return
+	}
+
+	alerts, err := h.capacityService.ListAlerts(c.Request.Context(), &query)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	principal := principalFromRequest(c)
+	allowed := alerts[:0]
+	for _, alert := range alerts {
+		if principal.Allows(alert.DataCenterID, auth.RoleViewer) {
+			allowed = append(allowed, alert)
+		}
+	}
+	alerts = allowed
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    alerts,
+	})
+}
+
+// FindFit 搜索可放置设备的机柜位置
+// 按data_center_id/room_id限定范围时校验调用方在对应数据中心的权限，不限定时需要全部数据中心的授权
+func (h *CapacityHandler) FindFit(c *gin.Context) {
+	var req service.FitRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, bindError(err))
+		return
+	}
+
+	var refs []inventoryRef
+	if req.DataCenterID != "" {
+		refs = append(refs, inventoryRef{"data_center", req.DataCenterID})
+	}
+	if req.RoomID != "" {
+		refs = append(refs, inventoryRef{"room", req.RoomID})
+	}
+	if !authorizeInventory(c, h.inventoryService, auth.RoleViewer, refs...) {
+		return
+	}
+
+	candidates, err := h.capacityService.FindFit(c.Request.Context(), &req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    candidates,
+	})
+}
+
+// authorizeQuery 查询按数据中心、机房或机柜筛选时校验调用方在对应数据中心拥有viewer角色
+// 不筛选时不校验，由处理器按数据中心过滤结果
+func (h *CapacityHandler) authorizeQuery(c *gin.Context, query *service.CapacityQuery) bool {
+	var refs []inventoryRef
+	if query.DataCenterID != "" {
+		refs = append(refs, inventoryRef{"data_center", query.DataCenterID})
+	}
+	if query.RoomID != "" {
+		refs = append(refs, inventoryRef{"room", query.RoomID})
+	}
+	if query.RackID != "" {
+		refs = append(refs, inventoryRef{"rack", query.RackID})
+	}
+	if len(refs) == 0 {
+		return true
+	}
+	return authorizeInventory(c, h.inventoryService, auth.RoleViewer, refs...)
+}
+
+// RegisterRoutes 注册路由
+func (h *CapacityHandler) RegisterRoutes(router *gin.Engine) {
+	api := router.Group("/api/v1/capacity")
+	{
+		api.GET("/racks", h.ListRackCapacity)
+		api.GET("/racks/:id", h.GetRackCapacity)
+		api.GET("/alerts", h.ListAlerts)
+		api.POST("/fit", h.FindFit)
+	}
+}
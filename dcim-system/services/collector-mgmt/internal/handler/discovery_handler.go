@@ -0,0 +1,180 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/dcim/services/collector-mgmt/internal/auth"
+	"github.com/dcim/services/collector-mgmt/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+// DiscoveryHandler 设备发现处理器
+type DiscoveryHandler struct {
+	discoveryService *service.DiscoveryService
+	taskService      *service.TaskService
+}
+
+// NewDiscoveryHandler 创建设备发现处理器
+func NewDiscoveryHandler(discoveryService *service.DiscoveryService, taskService *service.TaskService) *DiscoveryHandler {
+	return &DiscoveryHandler{
+		discoveryService: discoveryService,
+		taskService:      taskService,
+	}
+}
+
+// CreateJob 创建发现任务
+func (h *DiscoveryHandler) CreateJob(c *gin.Context) {
+	var req service.CreateDiscoveryJobRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !authorizeAgents(c, h.taskService, auth.RoleOperator, []string{req.AgentID}) {
+		return
+	}
+
+	job, err := h.discoveryService.CreateJob(c.Request.Context(), &req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    job,
+	})
+}
+
+// ListJobs 查询发现任务列表（Agent通过status=pending轮询待执行任务）
+func (h *DiscoveryHandler) ListJobs(c *gin.Context) {
+	agentID := c.Query("agent_id")
+
+	if agentID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "agent_id不能为空"})
+		return
+	}
+	if !authorizeAgents(c, h.taskService, auth.RoleViewer, []string{agentID}) {
+		return
+	}
+
+	jobs, err := h.discoveryService.ListJobs(c.Request.Context(), agentID, c.Query("status"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    jobs,
+	})
+}
+
+// ClaimJob Agent领取发现任务
+func (h *DiscoveryHandler) ClaimJob(c *gin.Context) {
+	agentID := c.Query("agent_id")
+
+	if agentID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "agent_id不能为空"})
+		return
+	}
+
+	if !authorizeAgents(c, h.taskService, auth.RoleOperator, []string{agentID}) {
+		return
+	}
+
+	job, err := h.discoveryService.ClaimJob(c.Request.Context(), agentID, c.Param("id"))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    job,
+	})
+}
+
+// ReportResult Agent上报发现结果
+func (h *DiscoveryHandler) ReportResult(c *gin.Context) {
+	var req service.DiscoveryResultRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !authorizeAgents(c, h.taskService, auth.RoleOperator, []string{req.AgentID}) {
+		return
+	}
+
+	if err := h.discoveryService.ReportResult(c.Request.Context(), &req); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "发现结果上报成功",
+	})
+}
+
+// ListDevices 查询发现的设备
+func (h *DiscoveryHandler) ListDevices(c *gin.Context) {
+	agentID := c.Query("agent_id")
+
+	if agentID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "agent_id不能为空"})
+		return
+	}
+	if !authorizeAgents(c, h.taskService, auth.RoleViewer, []string{agentID}) {
+		return
+	}
+
+	devices, err := h.discoveryService.ListDevices(c.Request.Context(), agentID, c.Query("status"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    devices,
+	})
+}
+
+// AcceptDevice 将发现的设备接入为采集任务
+func (h *DiscoveryHandler) AcceptDevice(c *gin.Context) {
+	var req service.AcceptDeviceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !authorizeAgents(c, h.taskService, auth.RoleOperator, []string{req.AgentID}) {
+		return
+	}
+
+	device, err := h.discoveryService.AcceptDevice(c.Request.Context(), &req, actorFromRequest(c))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    device,
+	})
+}
+
+// RegisterRoutes 注册路由
+func (h *DiscoveryHandler) RegisterRoutes(router *gin.Engine) {
+	api := router.Group("/api/v1/discovery")
+	{
+		api.POST("/jobs", h.CreateJob)
+		api.GET("/jobs", h.ListJobs)
+		api.POST("/jobs/:id/claim", h.ClaimJob)
+		api.POST("/results", h.ReportResult)
+		api.GET("/devices", h.ListDevices)
+		api.POST("/devices/accept", h.AcceptDevice)
+	}
+}
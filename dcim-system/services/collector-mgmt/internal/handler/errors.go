@@ -0,0 +1,70 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/dcim/services/collector-mgmt/internal/service"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+func init() {
+	// 绑定校验错误使用json字段名，与业务校验的字段错误保持一致
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		v.RegisterTagNameFunc(func(field reflect.StructField) string {
+			name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+			if name == "" || name == "-" {
+				return field.Name
+			}
+			return name
+		})
+	}
+}
+
+// statusFromError 根据业务错误类型确定HTTP状态码
+func statusFromError(err error) int {
+	var validationErr *service.ValidationError
+	switch {
+	case errors.As(err, &validationErr):
+		return http.StatusBadRequest
+	case errors.Is(err, service.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrConflict):
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
+// respondError 返回错误响应，字段校验错误附带fields明细
+func respondError(c *gin.Context, err error) {
+	body := gin.H{"error": err.Error()}
+
+	var validationErr *service.ValidationError
+	if errors.As(err, &validationErr) {
+		body["fields"] = validationErr.Fields
+	}
+
+	c.JSON(statusFromError(err), body)
+}
+
+// bindError 将请求绑定的校验错误转换为字段错误
+func bindError(err error) error {
+	var bindingErrs validator.ValidationErrors
+	if !errors.As(err, &bindingErrs) {
+		return &service.ValidationError{Fields: []service.FieldError{{Field: "body", Message: err.Error()}}}
+	}
+
+	validationErr := &service.ValidationError{}
+	for _, fe := range bindingErrs {
+		if fe.Tag() == "required" {
+			validationErr.Add(fe.Field(), "is required")
+			continue
+		}
+		validationErr.Add(fe.Field(), "failed on the '%s' rule", fe.Tag())
+	}
+	return validationErr
+}
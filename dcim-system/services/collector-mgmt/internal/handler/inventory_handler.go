@@ -0,0 +1,574 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/dcim/services/collector-mgmt/internal/auth"
+	"github.com/dcim/services/collector-mgmt/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+// InventoryHandler 设备台账处理器
+type InventoryHandler struct {
+	inventoryService *service.InventoryService
+	taskService      *service.TaskService
+}
+
+// NewInventoryHandler 创建设备台账处理器
+func NewInventoryHandler(inventoryService *service.InventoryService, taskService *service.TaskService) *InventoryHandler {
+	return &InventoryHandler{
+		inventoryService: inventoryService,
+		taskService:      taskService,
+	}
+}
+
+// CreateDataCenter 创建数据中心
+func (h *InventoryHandler) CreateDataCenter(c *gin.Context) {
+	var dc service.DataCenter
+	if err := c.ShouldBindJSON(&dc); err != nil {
+		respondError(c, bindError(err))
+		return
+	}
+	if !authorize(c, auth.RoleAdmin) {
+		return
+	}
+
+	if err := h.inventoryService.CreateDataCenter(c.Request.Context(), &dc); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    dc,
+	})
+}
+
+// ListDataCenters 查询数据中心列表，只返回调用方有权查看的数据中心
+func (h *InventoryHandler) ListDataCenters(c *gin.Context) {
+	dcs, err := h.inventoryService.ListDataCenters(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	principal := principalFromRequest(c)
+	allowed := dcs[:0]
+	for _, dc := range dcs {
+		if principal.Allows(dc.ID, auth.RoleViewer) {
+			allowed = append(allowed, dc)
+		}
+	}
+	dcs = allowed
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    dcs,
+	})
+}
+
+// GetDataCenter 查询数据中心
+func (h *InventoryHandler) GetDataCenter(c *gin.Context) {
+	if !authorize(c, auth.RoleViewer, c.Param("id")) {
+		return
+	}
+
+	dc, err := h.inventoryService.GetDataCenter(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    dc,
+	})
+}
+
+// UpdateDataCenter 更新数据中心
+func (h *InventoryHandler) UpdateDataCenter(c *gin.Context) {
+	var dc service.DataCenter
+	if err := c.ShouldBindJSON(&dc); err != nil {
+		respondError(c, bindError(err))
+		return
+	}
+	dc.ID = c.Param("id")
+	if !authorize(c, auth.RoleAdmin, dc.ID) {
+		return
+	}
+
+	updated, err := h.inventoryService.UpdateDataCenter(c.Request.Context(), &dc)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    updated,
+	})
+}
+
+// DeleteDataCenter 删除数据中心
+func (h *InventoryHandler) DeleteDataCenter(c *gin.Context) {
+	if !authorize(c, auth.RoleAdmin, c.Param("id")) {
+		return
+	}
+
+	if err := h.inventoryService.DeleteDataCenter(c.Request.Context(), c.Param("id")); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "数据中心删除成功",
+	})
+}
+
+// CreateRoom 创建机房
+func (h *InventoryHandler) CreateRoom(c *gin.Context) {
+	var room service.Room
+	if err := c.ShouldBindJSON(&room); err != nil {
+		respondError(c, bindError(err))
+		return
+	}
+	if !authorize(c, auth.RoleOperator, room.DataCenterID) {
+		return
+	}
+
+	if err := h.inventoryService.CreateRoom(c.Request.Context(), &room); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    room,
+	})
+}
+
+// ListRooms 查询机房列表，可按data_center_id筛选，只返回调用方有权查看的数据中心的机房
+func (h *InventoryHandler) ListRooms(c *gin.Context) {
+	dataCenterID := c.Query("data_center_id")
+	if dataCenterID != "" && !authorize(c, auth.RoleViewer, dataCenterID) {
+		return
+	}
+
+	rooms, err := h.inventoryService.ListRooms(c.Request.Context(), dataCenterID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	principal := principalFromRequest(c)
+	allowed := rooms[:0]
+	for _, room := range rooms {
+		if principal.Allows(room.DataCenterID, auth.RoleViewer) {
+			allowed = append(allowed, room)
+		}
+	}
+	rooms = allowed
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    rooms,
+	})
+}
+
+// GetRoom 查询机房
+func (h *InventoryHandler) GetRoom(c *gin.Context) {
+	if !h.authorizeIn(c, auth.RoleViewer, inventoryRef{"room", c.Param("id")}) {
+		return
+	}
+
+	room, err := h.inventoryService.GetRoom(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    room,
+	})
+}
+
+// UpdateRoom 更新机房
+func (h *InventoryHandler) UpdateRoom(c *gin.Context) {
+	var room service.Room
+	if err := c.ShouldBindJSON(&room); err != nil {
+		respondError(c, bindError(err))
+		return
+	}
+	room.ID = c.Param("id")
+	if !h.authorizeIn(c, auth.RoleOperator, inventoryRef{"room", room.ID}, inventoryRef{"data_center", room.DataCenterID}) {
+		return
+	}
+
+	updated, err := h.inventoryService.UpdateRoom(c.Request.Context(), &room)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    updated,
+	})
+}
+
+// DeleteRoom 删除机房
+func (h *InventoryHandler) DeleteRoom(c *gin.Context) {
+	if !h.authorizeIn(c, auth.RoleOperator, inventoryRef{"room", c.Param("id")}) {
+		return
+	}
+
+	if err := h.inventoryService.DeleteRoom(c.Request.Context(), c.Param("id")); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "机房删除成功",
+	})
+}
+
+// CreateRack 创建机柜
+func (h *InventoryHandler) CreateRack(c *gin.Context) {
+	var rack service.Rack
+	if err := c.ShouldBindJSON(&rack); err != nil {
+		respondError(c, bindError(err))
+		return
+	}
+	if !h.authorizeIn(c, auth.RoleOperator, inventoryRef{"room", rack.RoomID}) {
+		return
+	}
+
+	if err := h.inventoryService.CreateRack(c.Request.Context(), &rack); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    rack,
+	})
+}
+
+// ListRacks 查询机柜列表，可按room_id筛选，只返回调用方有权查看的数据中心的机柜
+func (h *InventoryHandler) ListRacks(c *gin.Context) {
+	ctx := c.Request.Context()
+	roomID := c.Query("room_id")
+	if roomID != "" && !h.authorizeIn(c, auth.RoleViewer, inventoryRef{"room", roomID}) {
+		return
+	}
+
+	racks, err := h.inventoryService.ListRacks(ctx, roomID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 机柜的数据中心取自所在机房，按机房缓存
+	principal := principalFromRequest(c)
+	if !principal.Allows("", auth.RoleViewer) {
+		visible := make(map[string]bool)
+		allowed := racks[:0]
+		for _, rack := range racks {
+			ok, cached := visible[rack.RoomID]
+			if !cached {
+				dataCenter, err := h.inventoryService.RoomDataCenter(ctx, rack.RoomID)
+				if err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+					return
+				}
+				ok = principal.Allows(dataCenter, auth.RoleViewer)
+				visible[rack.RoomID] = ok
+			}
+			if ok {
+				allowed = append(allowed, rack)
+			}
+		}
+		racks = allowed
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    racks,
+	})
+}
+
+// GetRack 查询机柜
+func (h *InventoryHandler) GetRack(c *gin.Context) {
+	if !h.authorizeIn(c, auth.RoleViewer, inventoryRef{"rack", c.Param("id")}) {
+		return
+	}
+
+	rack, err := h.inventoryService.GetRack(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    rack,
+	})
+}
+
+// UpdateRack 更新机柜
+func (h *InventoryHandler) UpdateRack(c *gin.Context) {
+	var rack service.Rack
+	if err := c.ShouldBindJSON(&rack); err != nil {
+		respondError(c, bindError(err))
+		return
+	}
+	rack.ID = c.Param("id")
+	if !h.authorizeIn(c, auth.RoleOperator, inventoryRef{"rack", rack.ID}, inventoryRef{"room", rack.RoomID}) {
+		return
+	}
+
+	updated, err := h.inventoryService.UpdateRack(c.Request.Context(), &rack)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    updated,
+	})
+}
+
+// DeleteRack 删除机柜
+func (h *InventoryHandler) DeleteRack(c *gin.Context) {
+	if !h.authorizeIn(c, auth.RoleOperator, inventoryRef{"rack", c.Param("id")}) {
+		return
+	}
+
+	if err := h.inventoryService.DeleteRack(c.Request.Context(), c.Param("id")); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "机柜删除成功",
+	})
+}
+
+// CreateDevice 登记设备
+func (h *InventoryHandler) CreateDevice(c *gin.Context) {
+	var device service.Device
+	if err := c.ShouldBindJSON(&device); err != nil {
+		respondError(c, bindError(err))
+		return
+	}
+	if !h.authorizeIn(c, auth.RoleOperator, inventoryRef{"rack", device.RackID}) {
+		return
+	}
+
+	if err := h.inventoryService.CreateDevice(c.Request.Context(), &device, actorFromRequest(c)); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    device,
+	})
+}
+
+// ListDevices 分页查询设备列表
+// 按data_center_id/room_id/rack_id筛选时校验调用方在对应数据中心的权限，不筛选时需要全部数据中心的授权
+func (h *InventoryHandler) ListDevices(c *gin.Context) {
+	var query service.DeviceQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		respondError(c, bindError(err))
+		return
+	}
+
+	var refs []inventoryRef
+	if query.DataCenterID != "" {
+		refs = append(refs, inventoryRef{"data_center", query.DataCenterID})
+	}
+	if query.RoomID != "" {
+		refs = append(refs, inventoryRef{"room", query.RoomID})
+	}
+	if query.RackID != "" {
+		refs = append(refs, inventoryRef{"rack", query.RackID})
+	}
+	if !h.authorizeIn(c, auth.RoleViewer, refs...) {
+		return
+	}
+
+	page, err := h.inventoryService.ListDevices(c.Request.Context(), &query)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":     true,
+		"data":        page.Devices,
+		"next_cursor": page.NextCursor,
+	})
+}
+
+// GetDevice 查询设备
+func (h *InventoryHandler) GetDevice(c *gin.Context) {
+	if !h.authorizeIn(c, auth.RoleViewer, inventoryRef{"device", c.Param("id")}) {
+		return
+	}
+
+	device, err := h.inventoryService.GetDevice(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    device,
+	})
+}
+
+// UpdateDevice 更新设备属性和位置
+func (h *InventoryHandler) UpdateDevice(c *gin.Context) {
+	var device service.Device
+	if err := c.ShouldBindJSON(&device); err != nil {
+		respondError(c, bindError(err))
+		return
+	}
+	device.ID = c.Param("id")
+	if !h.authorizeIn(c, auth.RoleOperator, inventoryRef{"device", device.ID}, inventoryRef{"rack", device.RackID}) {
+		return
+	}
+
+	updated, err := h.inventoryService.UpdateDevice(c.Request.Context(), &device)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    updated,
+	})
+}
+
+// DeleteDevice 删除设备
+func (h *InventoryHandler) DeleteDevice(c *gin.Context) {
+	if !h.authorizeIn(c, auth.RoleOperator, inventoryRef{"device", c.Param("id")}) {
+		return
+	}
+
+	if err := h.inventoryService.DeleteDevice(c.Request.Context(), c.Param("id")); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "设备删除成功",
+	})
+}
+
+// ChangeLifecycle 变更设备生命周期状态
+func (h *InventoryHandler) ChangeLifecycle(c *gin.Context) {
+	var req service.ChangeLifecycleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, bindError(err))
+		return
+	}
+	if !h.authorizeIn(c, auth.RoleOperator, inventoryRef{"device", c.Param("id")}) {
+		return
+	}
+
+	device, err := h.inventoryService.ChangeLifecycle(c.Request.Context(), c.Param("id"), &req, actorFromRequest(c))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    device,
+	})
+}
+
+// ListLifecycleEvents 查询设备生命周期变更记录
+func (h *InventoryHandler) ListLifecycleEvents(c *gin.Context) {
+	if !h.authorizeIn(c, auth.RoleViewer, inventoryRef{"device", c.Param("id")}) {
+		return
+	}
+
+	events, err := h.inventoryService.ListLifecycleEvents(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    events,
+	})
+}
+
+// ListDeviceTasks 查询引用设备的采集任务
+func (h *InventoryHandler) ListDeviceTasks(c *gin.Context) {
+	if !h.authorizeIn(c, auth.RoleViewer, inventoryRef{"device", c.Param("id")}) {
+		return
+	}
+
+	tasks, err := h.taskService.ListDeviceTasks(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    tasks,
+	})
+}
+
+// authorizeIn 校验调用方在台账资源所在的数据中心拥有角色
+func (h *InventoryHandler) authorizeIn(c *gin.Context, role auth.Role, refs ...inventoryRef) bool {
+	return authorizeInventory(c, h.inventoryService, role, refs...)
+}
+
+// RegisterRoutes 注册路由
+func (h *InventoryHandler) RegisterRoutes(router *gin.Engine) {
+	api := router.Group("/api/v1/inventory")
+	{
+		api.POST("/datacenters", h.CreateDataCenter)
+		api.GET("/datacenters", h.ListDataCenters)
+		api.GET("/datacenters/:id", h.GetDataCenter)
+		api.PUT("/datacenters/:id", h.UpdateDataCenter)
+		api.DELETE("/datacenters/:id", h.DeleteDataCenter)
+
+		api.POST("/rooms", h.CreateRoom)
+		api.GET("/rooms", h.ListRooms)
+		api.GET("/rooms/:id", h.GetRoom)
+		api.PUT("/rooms/:id", h.UpdateRoom)
+		api.DELETE("/rooms/:id", h.DeleteRoom)
+
+		api.POST("/racks", h.CreateRack)
+		api.GET("/racks", h.ListRacks)
+		api.GET("/racks/:id", h.GetRack)
+		api.PUT("/racks/:id", h.UpdateRack)
+		api.DELETE("/racks/:id", h.DeleteRack)
+
+		api.POST("/devices", h.CreateDevice)
+		api.GET("/devices", h.ListDevices)
+		api.GET("/devices/:id", h.GetDevice)
+		api.PUT("/devices/:id", h.UpdateDevice)
+		api.DELETE("/devices/:id", h.DeleteDevice)
+		api.POST("/devices/:id/lifecycle", h.ChangeLifecycle)
+		api.GET("/devices/:id/lifecycle", h.ListLifecycleEvents)
+		api.GET("/devices/:id/tasks", h.ListDeviceTasks)
+	}
+}
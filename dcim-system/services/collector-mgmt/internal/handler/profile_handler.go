@@ -0,0 +1,211 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/dcim/services/collector-mgmt/internal/auth"
+	"github.com/dcim/services/collector-mgmt/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+// ProfileHandler 设备模板处理器
+type ProfileHandler struct {
+	profileService *service.ProfileService
+	taskService    *service.TaskService
+}
+
+// NewProfileHandler 创建设备模板处理器
+func NewProfileHandler(profileService *service.ProfileService, taskService *service.TaskService) *ProfileHandler {
+	return &ProfileHandler{
+		profileService: profileService,
+		taskService:    taskService,
+	}
+}
+
+// ListProfiles 查询模板列表
+func (h *ProfileHandler) ListProfiles(c *gin.Context) {
+	profiles, err := h.profileService.List(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    profiles,
+	})
+}
+
+// GetProfile 查询模板，可通过version查询历史版本
+func (h *ProfileHandler) GetProfile(c *gin.Context) {
+	version := 0
+	if v := c.Query("version"); v != "" {
+		var err error
+		if version, err = strconv.Atoi(v); err != nil || version < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "version必须为正整数"})
+			return
+		}
+	}
+
+	profile, err := h.profileService.Get(c.Request.Context(), c.Param("id"), version)
+	if err != nil {
+		c.JSON(statusFromError(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    profile,
+	})
+}
+
+// GetProfileHistory 查询模板的所有历史版本
+func (h *ProfileHandler) GetProfileHistory(c *gin.Context) {
+	profiles, err := h.profileService.History(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    profiles,
+	})
+}
+
+// SaveProfile 创建或更新模板，更新后同步到所有引用该模板的任务
+// 模板修改影响所有数据中心的任务，需要全部数据中心的管理员角色
+func (h *ProfileHandler) SaveProfile(c *gin.Context) {
+	if !authorize(c, auth.RoleAdmin) {
+		return
+	}
+
+	var profile service.DeviceProfile
+	if err := c.ShouldBindJSON(&profile); err != nil {
+		respondError(c, bindError(err))
+		return
+	}
+	profile.ProfileID = c.Param("id")
+
+	result, err := h.saveAndRollout(c, &profile)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    result,
+	})
+}
+
+// ImportProfiles 从YAML导入模板（请求体为单个模板或模板列表）
+func (h *ProfileHandler) ImportProfiles(c *gin.Context) {
+	if !authorize(c, auth.RoleAdmin) {
+		return
+	}
+
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	profiles, err := service.ParseProfiles(body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	results := make([]*profileSaveResult, 0, len(profiles))
+	for _, profile := range profiles {
+		result, err := h.saveAndRollout(c, profile)
+		if err != nil {
+			err = fmt.Errorf("profile %s: %w", profile.ProfileID, err)
+			body := gin.H{"error": err.Error(), "imported": results}
+			var validationErr *service.ValidationError
+			if errors.As(err, &validationErr) {
+				body["fields"] = validationErr.Fields
+			}
+			c.JSON(statusFromError(err), body)
+			return
+		}
+		results = append(results, result)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    results,
+	})
+}
+
+// DeleteProfile 删除模板（仍被任务引用时拒绝删除）
+func (h *ProfileHandler) DeleteProfile(c *gin.Context) {
+	if !authorize(c, auth.RoleAdmin) {
+		return
+	}
+
+	if err := h.profileService.Delete(c.Request.Context(), c.Param("id")); err != nil {
+		var inUse *service.ProfileInUseError
+		if errors.As(err, &inUse) {
+			c.JSON(http.StatusConflict, gin.H{"error": "模板仍被任务引用，无法删除", "task_count": inUse.TaskCount})
+			return
+		}
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "模板删除成功",
+	})
+}
+
+// profileSaveResult 模板保存结果
+type profileSaveResult struct {
+	ProfileID    string `json:"profile_id"`
+	Version      int    `json:"version"`
+	Changed      bool   `json:"changed"`
+	UpdatedTasks int    `json:"updated_tasks"`
+}
+
+// saveAndRollout 保存模板，内容有变化时同步到引用该模板的任务
+func (h *ProfileHandler) saveAndRollout(c *gin.Context, profile *service.DeviceProfile) (*profileSaveResult, error) {
+	ctx := c.Request.Context()
+
+	changed, err := h.profileService.Save(ctx, profile)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &profileSaveResult{
+		ProfileID: profile.ProfileID,
+		Version:   profile.Version,
+		Changed:   changed,
+	}
+
+	if changed {
+		if result.UpdatedTasks, err = h.taskService.RolloutProfile(ctx, profile.ProfileID); err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// RegisterRoutes 注册路由
+func (h *ProfileHandler) RegisterRoutes(router *gin.Engine) {
+	api := router.Group("/api/v1/profiles")
+	{
+		api.GET("", h.ListProfiles)
+		api.POST("/import", h.ImportProfiles)
+		api.GET("/:id", h.GetProfile)
+		api.GET("/:id/history", h.GetProfileHistory)
+		api.PUT("/:id", h.SaveProfile)
+		api.DELETE("/:id", h.DeleteProfile)
+	}
+}
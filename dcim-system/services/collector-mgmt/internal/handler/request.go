@@ -0,0 +1,50 @@
+package handler
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/dcim/services/collector-mgmt/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+// actorHeader 未启用认证时记录操作人的请求头
+const actorHeader = "X-Actor"
+
+// actorFromRequest 获取请求的操作人，即已认证的用户或API Key名称
+func actorFromRequest(c *gin.Context) string {
+	return principalFromRequest(c).Subject
+}
+
+// legacyActor 未启用认证时从X-Actor请求头获取操作人
+func legacyActor(c *gin.Context) string {
+	if actor := c.GetHeader(actorHeader); actor != "" {
+		return actor
+	}
+	return "anonymous"
+}
+
+// expectedVersion 获取期望的资源版本，优先使用If-Match请求头，其次为请求体中的version
+func expectedVersion(c *gin.Context, bodyVersion *int) (int, error) {
+	if etag := c.GetHeader("If-Match"); etag != "" {
+		version, err := strconv.Atoi(strings.Trim(strings.TrimPrefix(etag, "W/"), `"`))
+		if err != nil {
+			errs := &service.ValidationError{}
+			errs.Add("If-Match", "invalid version %q", etag)
+			return 0, errs
+		}
+		return version, nil
+	}
+
+	if bodyVersion == nil {
+		errs := &service.ValidationError{}
+		errs.Add("version", "is required (or set the If-Match header)")
+		return 0, errs
+	}
+	return *bodyVersion, nil
+}
+
+// setETag 设置资源版本的ETag响应头
+func setETag(c *gin.Context, version int) {
+	c.Header("ETag", strconv.Quote(strconv.Itoa(version)))
+}
@@ -3,6 +3,7 @@ package handler
 import (
 	"net/http"
 
+	"github.com/dcim/services/collector-mgmt/internal/auth"
 	"github.com/dcim/services/collector-mgmt/internal/service"
 	"github.com/gin-gonic/gin"
 )
@@ -19,37 +20,159 @@ func NewTaskHandler(taskService *service.TaskService) *TaskHandler {
 	}
 }
 
-// AddTaskRequest 添加任务请求
-type AddTaskRequest struct {
-	AgentID    string                 `json:"agent_id" binding:"required"`
-	TaskID     string                 `json:"task_id" binding:"required"`
-	DeviceID   string                 `json:"device_id" binding:"required"`
-	DeviceIP   string                 `json:"device_ip" binding:"required"`
-	DeviceType string                 `json:"device_type" binding:"required"`
-	Protocol   string                 `json:"protocol" binding:"required"`
-	Interval   int                    `json:"interval" binding:"required"`
-	Metrics    []string               `json:"metrics" binding:"required"`
-	Config     map[string]interface{} `json:"config"`
-	CronExpr   string                 `json:"cron_expr"`
-}
-
 // AddTask 添加采集任务
 func (h *TaskHandler) AddTask(c *gin.Context) {
-	var req AddTaskRequest
+	var req service.AddTaskRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondError(c, bindError(err))
+		return
+	}
+	if !h.authorizeTask(c, &req) {
 		return
 	}
 
-	err := h.taskService.AddTask(c.Request.Context(), &req)
+	task, err := h.taskService.AddTask(c.Request.Context(), &req, actorFromRequest(c))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondError(c, err)
 		return
 	}
 
+	setETag(c, task.Version)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "任务添加成功",
+		"data":    task,
+	})
+}
+
+// authorizeTask 校验新增任务的权限：指定Agent时校验Agent所在的数据中心，
+// 自动分配时校验请求中的data_center（未指定时需要全部数据中心的授权）
+func (h *TaskHandler) authorizeTask(c *gin.Context, req *service.AddTaskRequest) bool {
+	if req.AgentID != "" {
+		return authorizeAgents(c, h.taskService, auth.RoleOperator, []string{req.AgentID})
+	}
+	return authorize(c, auth.RoleOperator, req.DataCenter)
+}
+
+// GetTask 查询采集任务
+func (h *TaskHandler) GetTask(c *gin.Context) {
+	agentID := c.Query("agent_id")
+	if agentID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "agent_id不能为空"})
+		return
+	}
+	if !authorizeAgents(c, h.taskService, auth.RoleViewer, []string{agentID}) {
+		return
+	}
+
+	task, err := h.taskService.GetTask(c.Request.Context(), agentID, c.Param("id"))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	setETag(c, task.Version)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    task,
+	})
+}
+
+// UpdateTask 更新采集任务
+// 需通过If-Match请求头或请求体version指定当前版本，版本不一致时返回409
+func (h *TaskHandler) UpdateTask(c *gin.Context) {
+	agentID := c.Query("agent_id")
+	if agentID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "agent_id不能为空"})
+		return
+	}
+
+	var req service.UpdateTaskRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, bindError(err))
+		return
+	}
+
+	version, err := expectedVersion(c, req.Version)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	if !authorizeAgents(c, h.taskService, auth.RoleOperator, []string{agentID}) {
+		return
+	}
+
+	task, err := h.taskService.UpdateTask(c.Request.Context(), agentID, c.Param("id"), &req, version, actorFromRequest(c))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	setETag(c, task.Version)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "任务更新成功",
+		"data":    task,
+	})
+}
+
+// ListRevisions 查询任务修订历史
+func (h *TaskHandler) ListRevisions(c *gin.Context) {
+	agentID := c.Query("agent_id")
+	if agentID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "agent_id不能为空"})
+		return
+	}
+	if !authorizeAgents(c, h.taskService, auth.RoleViewer, []string{agentID}) {
+		return
+	}
+
+	revisions, err := h.taskService.ListRevisions(c.Request.Context(), agentID, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    revisions,
+	})
+}
+
+// RollbackTask 将任务回滚到指定修订版本
+func (h *TaskHandler) RollbackTask(c *gin.Context) {
+	agentID := c.Query("agent_id")
+	if agentID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "agent_id不能为空"})
+		return
+	}
+
+	var req service.RollbackTaskRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, bindError(err))
+		return
+	}
+
+	version, err := expectedVersion(c, req.Version)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	if !authorizeAgents(c, h.taskService, auth.RoleOperator, []string{agentID}) {
+		return
+	}
+
+	task, err := h.taskService.RollbackTask(c.Request.Context(), agentID, c.Param("id"), req.Revision, version, actorFromRequest(c))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	setETag(c, task.Version)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "任务回滚成功",
+		"data":    task,
 	})
 }
 
@@ -62,10 +185,13 @@ func (h *TaskHandler) RemoveTask(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "agent_id和task_id不能为空"})
 		return
 	}
+	if !authorizeAgents(c, h.taskService, auth.RoleOperator, []string{agentID}) {
+		return
+	}
 
-	err := h.taskService.RemoveTask(c.Request.Context(), agentID, taskID)
+	err := h.taskService.RemoveTask(c.Request.Context(), agentID, taskID, actorFromRequest(c))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondError(c, err)
 		return
 	}
 
@@ -75,24 +201,27 @@ func (h *TaskHandler) RemoveTask(c *gin.Context) {
 	})
 }
 
-// ListTasks 查询任务列表
+// ListTasks 分页查询任务列表
 func (h *TaskHandler) ListTasks(c *gin.Context) {
-	agentID := c.Query("agent_id")
-
-	if agentID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "agent_id不能为空"})
+	var req service.ListTasksRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		respondError(c, bindError(err))
+		return
+	}
+	if !authorizeAgents(c, h.taskService, auth.RoleViewer, []string{req.AgentID}) {
 		return
 	}
 
-	tasks, err := h.taskService.ListTasks(c.Request.Context(), agentID)
+	page, err := h.taskService.ListTasks(c.Request.Context(), &req)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"success": true,
-		"data":    tasks,
+		"success":     true,
+		"data":        page.Tasks,
+		"next_cursor": page.NextCursor,
 	})
 }
 
@@ -104,10 +233,13 @@ func (h *TaskHandler) GetAgentStatus(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "agent_id不能为空"})
 		return
 	}
+	if !authorizeAgents(c, h.taskService, auth.RoleViewer, []string{agentID}) {
+		return
+	}
 
 	status, err := h.taskService.GetAgentStatus(c.Request.Context(), agentID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondError(c, err)
 		return
 	}
 
@@ -124,6 +256,12 @@ func (h *TaskHandler) RegisterRoutes(router *gin.Engine) {
 		api.POST("/tasks", h.AddTask)
 		api.DELETE("/tasks", h.RemoveTask)
 		api.GET("/tasks", h.ListTasks)
+		api.POST("/tasks/import", h.ImportTasks)
+		api.GET("/tasks/export", h.ExportTasks)
+		api.GET("/tasks/:id", h.GetTask)
+		api.PUT("/tasks/:id", h.UpdateTask)
+		api.GET("/tasks/:id/revisions", h.ListRevisions)
+		api.POST("/tasks/:id/rollback", h.RollbackTask)
 		api.GET("/agent/status", h.GetAgentStatus)
 	}
 }
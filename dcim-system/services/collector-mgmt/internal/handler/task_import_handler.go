@@ -0,0 +1,118 @@
+package handler
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/dcim/services/collector-mgmt/internal/auth"
+	"github.com/dcim/services/collector-mgmt/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+// maxImportSize 批量导入请求体大小上限
+const maxImportSize = 32 << 20
+
+// ImportTasks 批量导入任务
+// 请求体为CSV或YAML，格式由format参数或Content-Type确定；dry_run=true时只校验不写入
+func (h *TaskHandler) ImportTasks(c *gin.Context) {
+	format := c.Query("format")
+	if format == "" {
+		format = service.DetectTaskFormat(c.ContentType())
+	}
+
+	dryRun, _ := strconv.ParseBool(c.Query("dry_run"))
+
+	body := http.MaxBytesReader(c.Writer, c.Request.Body, maxImportSize)
+	records, err := service.ParseTaskRecords(format, body)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	agentIDs, dataCenters := importScope(records)
+	if !authorizeAgents(c, h.taskService, auth.RoleOperator, agentIDs, dataCenters...) {
+		return
+	}
+
+	result, err := h.taskService.ImportTasks(c.Request.Context(), records, dryRun, actorFromRequest(c))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	if len(result.Errors) > 0 && !dryRun {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("%d rows failed validation, no tasks were imported", len(result.Errors)),
+			"data":  result,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    result,
+	})
+}
+
+// importScope 导入涉及的Agent，以及自动分配的记录指定的数据中心（与单个添加任务的授权一致）
+func importScope(records []service.TaskRecord) ([]string, []string) {
+	seen := make(map[string]bool)
+	var agentIDs, dataCenters []string
+	for _, record := range records {
+		switch {
+		case record.AgentID != "":
+			if !seen["agent/"+record.AgentID] {
+				seen["agent/"+record.AgentID] = true
+				agentIDs = append(agentIDs, record.AgentID)
+			}
+		case !seen["dc/"+record.DataCenter]:
+			seen["dc/"+record.DataCenter] = true
+			dataCenters = append(dataCenters, record.DataCenter)
+		}
+	}
+	return agentIDs, dataCenters
+}
+
+// ExportTasks 导出任务，格式与批量导入一致，agent_id为空时导出调用方有权查看的全部任务
+func (h *TaskHandler) ExportTasks(c *gin.Context) {
+	format := c.DefaultQuery("format", service.TaskFormatCSV)
+	agentID := c.Query("agent_id")
+	if agentID != "" && !authorizeAgents(c, h.taskService, auth.RoleViewer, []string{agentID}) {
+		return
+	}
+
+	records, err := h.taskService.ExportTasks(c.Request.Context(), agentID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	visible := agentFilter(c, h.taskService, auth.RoleViewer)
+	allowed := records[:0]
+	for _, record := range records {
+		ok, err := visible(record.AgentID)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		if ok {
+			allowed = append(allowed, record)
+		}
+	}
+	records = allowed
+
+	var buf bytes.Buffer
+	if err := service.WriteTaskRecords(format, &buf, records); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	contentType := "text/csv; charset=utf-8"
+	if format == service.TaskFormatYAML {
+		contentType = "application/yaml; charset=utf-8"
+	}
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=tasks.%s", format))
+	c.Data(http.StatusOK, contentType, buf.Bytes())
+}
@@ -0,0 +1,227 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Agent在线状态
+const (
+	AgentOnline  = "online"
+	AgentOffline = "offline"
+)
+
+// agentsKey 已上报心跳的Agent（ZSET，score为最近心跳时间）
+const agentsKey = "agents"
+
+// AgentService Agent注册与心跳服务
+type AgentService struct {
+	redis        *redis.Client
+	offlineAfter time.Duration
+}
+
+// NewAgentService 创建Agent服务，超过offlineAfter未收到心跳的Agent视为离线
+func NewAgentService(redisClient *redis.Client, offlineAfter time.Duration) *AgentService {
+	return &AgentService{
+		redis:        redisClient,
+		offlineAfter: offlineAfter,
+	}
+}
+
+// AgentHeartbeat Agent心跳
+type AgentHeartbeat struct {
+	AgentID        string  `json:"agent_id" binding:"required"`
+	AgentName      string  `json:"agent_name"`
+	DataCenter     string  `json:"data_center"` // 与设备台账的数据中心ID一致时参与就近分配
+	Room           string  `json:"room"`        // 与设备台账的机房ID一致时参与就近分配
+	Status         string  `json:"status"`
+	Timestamp      int64   `json:"timestamp"` // Agent本地时间，仅作参考，在线判断使用服务端收到心跳的时间
+	PullMode       bool    `json:"pull_mode"`
+	PushMode       bool    `json:"push_mode"`
+	ScheduledTasks int     `json:"scheduled_tasks"` // Agent上正在调度的任务数
+	AvgCollectMs   float64 `json:"avg_collect_ms"`  // 上个心跳周期内单次采集的平均耗时(ms)
+}
+
+// AgentStatus Agent状态
+type AgentStatus struct {
+	AgentID        string  `json:"agent_id"`
+	AgentName      string  `json:"agent_name"`
+	Status         string  `json:"status"`
+	LastHeartbeat  int64   `json:"last_heartbeat"`            // 服务端收到最近一次心跳的时间
+	AgentTimestamp int64   `json:"agent_timestamp,omitempty"` // 心跳中Agent上报的本地时间，可用于发现时钟偏差
+	TaskCount      int     `json:"task_count"`                // 分配给Agent的任务数
+	DataCenter     string  `json:"data_center"`
+	Room           string  `json:"room"`
+	ScheduledTasks int     `json:"scheduled_tasks"`
+	AvgCollectMs   float64 `json:"avg_collect_ms"`
+	Online         bool    `json:"online"`
+}
+
+// Load 负载评分：任务数按平均采集耗时（秒）加权，采集越慢的Agent单个任务的负载越高
+func (a *AgentStatus) Load() float64 {
+	return float64(a.TaskCount) * (1 + a.AvgCollectMs/1000)
+}
+
+// RecordHeartbeat 记录Agent心跳，actor为上报心跳的调用方
+// 心跳时间使用服务端时间，在线判断和故障转移不受Agent时钟偏差影响。
+// Agent首次注册或名称、位置变化时写入审计日志
+func (s *AgentService) RecordHeartbeat(ctx context.Context, hb *AgentHeartbeat, actor string) (*AgentStatus, error) {
+	now := time.Now().Unix()
+
+	previous, err := s.GetStatus(ctx, hb.AgentID)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return nil, err
+	}
+
+	status := &AgentStatus{
+		AgentID:        hb.AgentID,
+		AgentName:      hb.AgentName,
+		Status:         hb.Status,
+		LastHeartbeat:  now,
+		AgentTimestamp: hb.Timestamp,
+		DataCenter:     hb.DataCenter,
+		Room:           hb.Room,
+		ScheduledTasks: hb.ScheduledTasks,
+		AvgCollectMs:   hb.AvgCollectMs,
+	}
+	data, err := json.Marshal(status)
+	if err != nil {
+		return nil, err
+	}
+
+	pipe := s.redis.TxPipeline()
+	pipe.Set(ctx, agentStatusKey(hb.AgentID), data, 0)
+	pipe.ZAdd(ctx, agentsKey, &redis.Z{Score: float64(now), Member: hb.AgentID})
+	if changes := diffAgents(previous, status); previous == nil || len(changes) > 0 {
+		action := AgentActionUpdate
+		if previous == nil {
+			action = AgentActionRegister
+		}
+		err := appendAudit(ctx, pipe, &AuditEntry{
+			User:         actor,
+			ResourceType: AuditResourceAgent,
+			Action:       action,
+			AgentID:      hb.AgentID,
+			DataCenter:   hb.DataCenter,
+			Changes:      changes,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+
+	return s.GetStatus(ctx, hb.AgentID)
+}
+
+// GetStatus 查询Agent状态
+func (s *AgentService) GetStatus(ctx context.Context, agentID string) (*AgentStatus, error) {
+	statuses, err := s.getStatuses(ctx, []string{agentID})
+	if err != nil {
+		return nil, err
+	}
+	if statuses[0] == nil {
+		return nil, fmt.Errorf("agent %s %w", agentID, ErrNotFound)
+	}
+	return statuses[0], nil
+}
+
+// ListAgents 查询Agent状态，dataCenter/room为空时不筛选
+func (s *AgentService) ListAgents(ctx context.Context, dataCenter, room string) ([]*AgentStatus, error) {
+	agentIDs, err := s.redis.ZRange(ctx, agentsKey, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(agentIDs)
+
+	statuses, err := s.getStatuses(ctx, agentIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	agents := make([]*AgentStatus, 0, len(statuses))
+	for _, status := range statuses {
+		if status == nil {
+			continue
+		}
+		if (dataCenter != "" && status.DataCenter != dataCenter) || (room != "" && status.Room != room) {
+			continue
+		}
+		agents = append(agents, status)
+	}
+	return agents, nil
+}
+
+// getStatuses 批量查询Agent状态并统计分配的任务数，不存在的Agent对应位置为nil
+func (s *AgentService) getStatuses(ctx context.Context, agentIDs []string) ([]*AgentStatus, error) {
+	pipe := s.redis.Pipeline()
+	statusCmds := make([]*redis.StringCmd, len(agentIDs))
+	countCmds := make([]*redis.IntCmd, len(agentIDs))
+	for i, agentID := range agentIDs {
+		statusCmds[i] = pipe.Get(ctx, agentStatusKey(agentID))
+		countCmds[i] = pipe.ZCard(ctx, agentTasksKey(agentID))
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	statuses := make([]*AgentStatus, len(agentIDs))
+	for i, cmd := range statusCmds {
+		data, err := cmd.Bytes()
+		if err != nil {
+			continue
+		}
+
+		var status AgentStatus
+		if err := json.Unmarshal(data, &status); err != nil {
+			continue
+		}
+		status.TaskCount = int(countCmds[i].Val())
+		status.Online = now.Sub(time.Unix(status.LastHeartbeat, 0)) <= s.offlineAfter
+		if !status.Online {
+			status.Status = AgentOffline
+		}
+		statuses[i] = &status
+	}
+	return statuses, nil
+}
+
+// diffAgents 比较Agent的名称和位置，previous为nil时返回全部字段
+func diffAgents(previous, current *AgentStatus) []FieldChange {
+	var old AgentStatus
+	if previous != nil {
+		old = *previous
+	}
+
+	var changes []FieldChange
+	for _, f := range []struct {
+		field    string
+		old, new string
+	}{
+		{"agent_name", old.AgentName, current.AgentName},
+		{"data_center", old.DataCenter, current.DataCenter},
+		{"room", old.Room, current.Room},
+	} {
+		switch {
+		case previous == nil:
+			changes = append(changes, FieldChange{Field: f.field, New: f.new})
+		case f.old != f.new:
+			changes = append(changes, FieldChange{Field: f.field, Old: f.old, New: f.new})
+		}
+	}
+	return changes
+}
+
+// agentStatusKey Agent状态的key
+func agentStatusKey(agentID string) string {
+	return fmt.Sprintf("agent:status:%s", agentID)
+}
@@ -0,0 +1,189 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// auditLogKey 审计日志（Redis Stream，只追加）
+const auditLogKey = "audit:log"
+
+// 审计资源类型
+const (
+	AuditResourceTask  = "task"
+	AuditResourceAgent = "agent"
+)
+
+// Agent变更操作类型（任务变更的操作类型与修订记录一致）
+const (
+	AgentActionRegister = "register"
+	AgentActionUpdate   = "update"
+)
+
+// 审计日志分页大小
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+// AuditEntry 审计日志条目
+type AuditEntry struct {
+	ID           string        `json:"id"` // Stream条目ID，按时间递增
+	Timestamp    int64         `json:"timestamp"`
+	User         string        `json:"user"`
+	AuthMethod   string        `json:"auth_method,omitempty"`
+	SourceIP     string        `json:"source_ip,omitempty"`
+	ResourceType string        `json:"resource_type"`
+	Action       string        `json:"action"`
+	AgentID      string        `json:"agent_id"`
+	TaskID       string        `json:"task_id,omitempty"`
+	DataCenter   string        `json:"data_center,omitempty"` // Agent所在的数据中心
+	Version      int           `json:"version,omitempty"`     // 变更后的任务版本
+	Changes      []FieldChange `json:"changes"`
+}
+
+// AuditSource 请求来源，由HTTP层写入context，随变更记录到审计日志
+type AuditSource struct {
+	SourceIP   string
+	AuthMethod string
+}
+
+type auditSourceKey struct{}
+
+// WithAuditSource 在context中记录请求来源
+func WithAuditSource(ctx context.Context, source AuditSource) context.Context {
+	return context.WithValue(ctx, auditSourceKey{}, source)
+}
+
+// appendAudit 在事务管道中追加审计日志，与变更一起提交；来源取自context，后台任务没有来源
+func appendAudit(ctx context.Context, pipe redis.Pipeliner, entry *AuditEntry) error {
+	if source, ok := ctx.Value(auditSourceKey{}).(AuditSource); ok {
+		entry.SourceIP = source.SourceIP
+		entry.AuthMethod = source.AuthMethod
+	}
+	if entry.Timestamp == 0 {
+		entry.Timestamp = time.Now().Unix()
+	}
+	if entry.Changes == nil {
+		entry.Changes = []FieldChange{}
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	pipe.XAdd(ctx, &redis.XAddArgs{Stream: auditLogKey, Values: map[string]interface{}{"entry": data}})
+	return nil
+}
+
+// taskAudit 根据任务修订记录生成审计日志
+func taskAudit(rev *TaskRevision, agentID, taskID, dataCenter string) *AuditEntry {
+	return &AuditEntry{
+		Timestamp:    rev.Timestamp,
+		User:         rev.Actor,
+		ResourceType: AuditResourceTask,
+		Action:       rev.Action,
+		AgentID:      agentID,
+		TaskID:       taskID,
+		DataCenter:   dataCenter,
+		Version:      rev.Version,
+		Changes:      rev.Changes,
+	}
+}
+
+// AuditService 审计日志查询服务
+type AuditService struct {
+	redis *redis.Client
+}
+
+// NewAuditService 创建审计日志服务
+func NewAuditService(redisClient *redis.Client) *AuditService {
+	return &AuditService{redis: redisClient}
+}
+
+// AuditQuery 审计日志查询条件，为空的条件不筛选
+type AuditQuery struct {
+	User         string `form:"user"`
+	ResourceType string `form:"resource_type"`
+	Action       string `form:"action"`
+	AgentID      string `form:"agent_id"`
+	TaskID       string `form:"task_id"`
+	DataCenter   string `form:"data_center"`
+	Since        int64  `form:"since"`  // 起始时间（Unix秒，包含）
+	Until        int64  `form:"until"`  // 结束时间（Unix秒，包含）
+	Cursor       string `form:"cursor"` // 上一页返回的next_cursor
+	Limit        int    `form:"limit"`
+}
+
+// AuditPage 审计日志分页结果
+type AuditPage struct {
+	Entries    []*AuditEntry `json:"entries"`
+	NextCursor string        `json:"next_cursor,omitempty"`
+}
+
+// matches 判断条目是否满足查询条件
+func (q *AuditQuery) matches(e *AuditEntry) bool {
+	return (q.User == "" || e.User == q.User) &&
+		(q.ResourceType == "" || e.ResourceType == q.ResourceType) &&
+		(q.Action == "" || e.Action == q.Action) &&
+		(q.AgentID == "" || e.AgentID == q.AgentID) &&
+		(q.TaskID == "" || e.TaskID == q.TaskID) &&
+		(q.DataCenter == "" || e.DataCenter == q.DataCenter)
+}
+
+// Query 按时间倒序查询审计日志，visible用于按调用方的授权范围过滤条目（为nil时不过滤）
+func (s *AuditService) Query(ctx context.Context, q *AuditQuery, visible func(e *AuditEntry) bool) (*AuditPage, error) {
+	limit := q.Limit
+	if limit <= 0 {
+		limit = defaultAuditLimit
+	}
+	if limit > maxAuditLimit {
+		limit = maxAuditLimit
+	}
+
+	max, min := "+", "-"
+	if q.Until > 0 {
+		max = strconv.FormatInt((q.Until+1)*1000-1, 10)
+	}
+	if q.Cursor != "" {
+		max = "(" + q.Cursor
+	}
+	if q.Since > 0 {
+		min = strconv.FormatInt(q.Since*1000, 10)
+	}
+
+	page := &AuditPage{Entries: make([]*AuditEntry, 0)}
+	for {
+		messages, err := s.redis.XRevRangeN(ctx, auditLogKey, max, min, int64(limit)).Result()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, msg := range messages {
+			data, _ := msg.Values["entry"].(string)
+			var entry AuditEntry
+			if err := json.Unmarshal([]byte(data), &entry); err != nil {
+				continue
+			}
+			entry.ID = msg.ID
+
+			if !q.matches(&entry) || (visible != nil && !visible(&entry)) {
+				continue
+			}
+			page.Entries = append(page.Entries, &entry)
+			if len(page.Entries) == limit {
+				page.NextCursor = msg.ID
+				return page, nil
+			}
+		}
+
+		if len(messages) < limit {
+			return page, nil
+		}
+		max = "(" + messages[len(messages)-1].ID
+	}
+}
@@ -0,0 +1,486 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// 容量告警级别
+const (
+	CapacityWarning  = "warning"
+	CapacityCritical = "critical"
+)
+
+// 容量资源类型
+const (
+	CapacitySpace          = "space"           // U位
+	CapacityPowerAllocated = "power_allocated" // 铭牌功率合计
+	CapacityPowerMeasured  = "power_measured"  // 实测功率合计
+	CapacityWeight         = "weight"          // 承重
+)
+
+// defaultPowerMetrics 未配置时用于读取实测功率的指标名
+var defaultPowerMetrics = []string{"power", "active_power", "power_w"}
+
+// CapacityThreshold 容量告警阈值（使用率百分比，0表示不告警）
+type CapacityThreshold struct {
+	Warning  float64
+	Critical float64
+}
+
+// CapacityThresholds 各类资源的容量告警阈值
+type CapacityThresholds struct {
+	Space  CapacityThreshold
+	Power  CapacityThreshold // 同时用于铭牌功率和实测功率
+	Weight CapacityThreshold
+}
+
+// CapacityService 机柜容量规划服务
+// 分配容量来自设备台账（U位、铭牌功率、重量），实测功率来自data-processor缓存的 device:latest:<device>
+type CapacityService struct {
+	inventory    *InventoryService
+	redis        *redis.Client
+	thresholds   CapacityThresholds
+	powerMetrics []string
+}
+
+// NewCapacityService 创建容量规划服务，powerMetrics为空时使用默认功率指标名
+func NewCapacityService(inventory *InventoryService, redisClient *redis.Client, thresholds CapacityThresholds, powerMetrics []string) *CapacityService {
+	if len(powerMetrics) == 0 {
+		powerMetrics = defaultPowerMetrics
+	}
+	return &CapacityService{
+		inventory:    inventory,
+		redis:        redisClient,
+		thresholds:   thresholds,
+		powerMetrics: powerMetrics,
+	}
+}
+
+// URange 连续的U位区间
+type URange struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+	Size  int `json:"size"`
+}
+
+// CapacityAlert 容量告警
+type CapacityAlert struct {
+	RackID       string  `json:"rack_id"`
+	DataCenterID string  `json:"data_center_id"`
+	Resource     string  `json:"resource"`
+	Level        string  `json:"level"`
+	Percent      float64 `json:"percent"`   // 当前使用率
+	Threshold    float64 `json:"threshold"` // 触发的阈值
+	Message      string  `json:"message"`
+}
+
+// RackCapacity 机柜容量
+type RackCapacity struct {
+	RackID          string          `json:"rack_id"`
+	RackName        string          `json:"rack_name"`
+	RoomID          string          `json:"room_id"`
+	DataCenterID    string          `json:"data_center_id"`
+	UHeight         int             `json:"u_height"`
+	UsedU           int             `json:"used_u"`
+	FreeU           int             `json:"free_u"`
+	FreeRanges      []URange        `json:"free_ranges"`
+	PowerCapacityW  float64         `json:"power_capacity_w"`
+	AllocatedPowerW float64         `json:"allocated_power_w"`
+	MeasuredPowerW  float64         `json:"measured_power_w"`
+	MeasuredDevices int             `json:"measured_devices"` // 有实测功率的设备数
+	MaxWeightKg     float64         `json:"max_weight_kg"`
+	WeightKg        float64         `json:"weight_kg"`
+	Devices         int             `json:"devices"`
+	Alerts          []CapacityAlert `json:"alerts"`
+}
+
+// CapacityQuery 容量查询条件
+type CapacityQuery struct {
+	DataCenterID string `form:"data_center_id"`
+	RoomID       string `form:"room_id"`
+	RackID       string `form:"rack_id"`
+	Level        string `form:"level"` // 仅用于告警查询，critical时只返回严重告警
+}
+
+// FitRequest 设备放置位置搜索请求
+type FitRequest struct {
+	UHeight      int     `json:"u_height" binding:"required,min=1"`
+	PowerW       float64 `json:"power_w" binding:"min=0"`
+	WeightKg     float64 `json:"weight_kg" binding:"min=0"`
+	DataCenterID string  `json:"data_center_id"`
+	RoomID       string  `json:"room_id"`
+	Limit        int     `json:"limit"`
+}
+
+// FitCandidate 可放置设备的机柜位置
+type FitCandidate struct {
+	RackID           string  `json:"rack_id"`
+	RackName         string  `json:"rack_name"`
+	RoomID           string  `json:"room_id"`
+	DataCenterID     string  `json:"data_center_id"`
+	UPosition        int     `json:"u_position"`         // 建议放置的最低U位
+	FreeRange        URange  `json:"free_range"`         // 所在的空闲区间
+	PowerHeadroomW   float64 `json:"power_headroom_w"`   // 放置后剩余功率，机柜未配置功率容量时为0
+	PowerPercentPost float64 `json:"power_percent_post"` // 放置后功率使用率
+}
+
+// rackUsage 机柜及其上架设备
+type rackUsage struct {
+	rack         Rack
+	dataCenterID string
+	devices      []*Device
+}
+
+// ListRackCapacity 查询机柜容量
+func (s *CapacityService) ListRackCapacity(ctx context.Context, q *CapacityQuery) ([]*RackCapacity, error) {
+	usages, err := s.loadRacks(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+
+	measured, err := s.measuredPower(ctx, usages)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*RackCapacity, 0, len(usages))
+	for _, usage := range usages {
+		result = append(result, s.rackCapacity(usage, measured))
+	}
+	return result, nil
+}
+
+// GetRackCapacity 查询单个机柜容量
+func (s *CapacityService) GetRackCapacity(ctx context.Context, rackID string) (*RackCapacity, error) {
+	racks, err := s.ListRackCapacity(ctx, &CapacityQuery{RackID: rackID})
+	if err != nil {
+		return nil, err
+	}
+	if len(racks) == 0 {
+		return nil, fmt.Errorf("rack %s %w", rackID, ErrNotFound)
+	}
+	return racks[0], nil
+}
+
+// ListAlerts 查询超过阈值的容量告警
+func (s *CapacityService) ListAlerts(ctx context.Context, q *CapacityQuery) ([]CapacityAlert, error) {
+	racks, err := s.ListRackCapacity(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+
+	alerts := make([]CapacityAlert, 0)
+	for _, rack := range racks {
+		for _, alert := range rack.Alerts {
+			if q.Level == CapacityCritical && alert.Level != CapacityCritical {
+				continue
+			}
+			alerts = append(alerts, alert)
+		}
+	}
+	return alerts, nil
+}
+
+// FindFit 搜索可放置设备的机柜
+// 要求有足够的连续U位，且放置后铭牌功率和实测功率都不超过机柜功率容量、重量不超过承重；
+// 结果优先选择放置后剩余连续U位最少的机柜（减少碎片），其次按机柜ID排序
+func (s *CapacityService) FindFit(ctx context.Context, req *FitRequest) ([]*FitCandidate, error) {
+	racks, err := s.ListRackCapacity(ctx, &CapacityQuery{DataCenterID: req.DataCenterID, RoomID: req.RoomID})
+	if err != nil {
+		return nil, err
+	}
+
+	type scored struct {
+		candidate *FitCandidate
+		leftover  int
+	}
+	var matches []scored
+	for _, rack := range racks {
+		if rack.PowerCapacityW > 0 &&
+			maxFloat(rack.AllocatedPowerW, rack.MeasuredPowerW)+req.PowerW > rack.PowerCapacityW {
+			continue
+		}
+		if rack.MaxWeightKg > 0 && rack.WeightKg+req.WeightKg > rack.MaxWeightKg {
+			continue
+		}
+
+		best := -1
+		for i, r := range rack.FreeRanges {
+			if r.Size < req.UHeight {
+				continue
+			}
+			if best < 0 || r.Size < rack.FreeRanges[best].Size {
+				best = i
+			}
+		}
+		if best < 0 {
+			continue
+		}
+
+		candidate := &FitCandidate{
+			RackID:       rack.RackID,
+			RackName:     rack.RackName,
+			RoomID:       rack.RoomID,
+			DataCenterID: rack.DataCenterID,
+			UPosition:    rack.FreeRanges[best].Start,
+			FreeRange:    rack.FreeRanges[best],
+		}
+		if rack.PowerCapacityW > 0 {
+			used := maxFloat(rack.AllocatedPowerW, rack.MeasuredPowerW) + req.PowerW
+			candidate.PowerHeadroomW = rack.PowerCapacityW - used
+			candidate.PowerPercentPost = percent(used, rack.PowerCapacityW)
+		}
+		matches = append(matches, scored{candidate: candidate, leftover: rack.FreeRanges[best].Size - req.UHeight})
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].leftover != matches[j].leftover {
+			return matches[i].leftover < matches[j].leftover
+		}
+		return matches[i].candidate.RackID < matches[j].candidate.RackID
+	})
+
+	limit := req.Limit
+	if limit <= 0 {
+		limit = 10
+	}
+	candidates := make([]*FitCandidate, 0, limit)
+	for _, m := range matches {
+		if len(candidates) == limit {
+			break
+		}
+		candidates = append(candidates, m.candidate)
+	}
+	return candidates, nil
+}
+
+// loadRacks 查询机柜及其未退役的设备
+func (s *CapacityService) loadRacks(ctx context.Context, q *CapacityQuery) ([]*rackUsage, error) {
+	var (
+		conds []string
+		args  []interface{}
+	)
+	where := func(cond string, value string) {
+		if value == "" {
+			return
+		}
+		args = append(args, value)
+		conds = append(conds, fmt.Sprintf(cond, len(args)))
+	}
+	where("r.id = $%d", q.RackID)
+	where("r.room_id = $%d", q.RoomID)
+	where("m.data_center_id = $%d", q.DataCenterID)
+
+	filter := ""
+	if len(conds) > 0 {
+		filter = ` WHERE ` + strings.Join(conds, " AND ")
+	}
+
+	rows, err := s.inventory.db.QueryContext(ctx,
+		`SELECT r.id, r.room_id, r.name, r.u_height, r.power_capacity_w, r.max_weight_kg, r.created_at, r.updated_at, m.data_center_id
+		FROM racks r JOIN rooms m ON m.id = r.room_id`+filter+` ORDER BY r.id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var usages []*rackUsage
+	byID := make(map[string]*rackUsage)
+	for rows.Next() {
+		usage := &rackUsage{}
+		r := &usage.rack
+		if err := rows.Scan(&r.ID, &r.RoomID, &r.Name, &r.UHeight, &r.PowerCapacityW, &r.MaxWeightKg,
+			&r.CreatedAt, &r.UpdatedAt, &usage.dataCenterID); err != nil {
+			return nil, err
+		}
+		usages = append(usages, usage)
+		byID[r.ID] = usage
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(usages) == 0 {
+		return usages, nil
+	}
+
+	args = append(args, LifecycleRetired)
+	deviceFilter := fmt.Sprintf(` WHERE d.lifecycle_state <> $%d`, len(args))
+	if len(conds) > 0 {
+		deviceFilter += ` AND ` + strings.Join(conds, " AND ")
+	}
+	deviceRows, err := s.inventory.db.QueryContext(ctx,
+		`SELECT `+deviceColumns+` FROM devices d
+		JOIN racks r ON r.id = d.rack_id
+		JOIN rooms m ON m.id = r.room_id`+deviceFilter+` ORDER BY d.id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer deviceRows.Close()
+
+	for deviceRows.Next() {
+		device, err := scanDevice(deviceRows)
+		if err != nil {
+			return nil, err
+		}
+		if usage, ok := byID[device.RackID]; ok {
+			usage.devices = append(usage.devices, device)
+		}
+	}
+	return usages, deviceRows.Err()
+}
+
+// measuredPower 从data-processor的最新数据缓存读取设备实测功率，缓存过期或无功率指标的设备不计入
+func (s *CapacityService) measuredPower(ctx context.Context, usages []*rackUsage) (map[string]float64, error) {
+	var deviceIDs []string
+	for _, usage := range usages {
+		for _, device := range usage.devices {
+			deviceIDs = append(deviceIDs, device.ID)
+		}
+	}
+	if len(deviceIDs) == 0 {
+		return map[string]float64{}, nil
+	}
+
+	pipe := s.redis.Pipeline()
+	cmds := make([]*redis.StringCmd, len(deviceIDs))
+	for i, id := range deviceIDs {
+		cmds[i] = pipe.Get(ctx, deviceLatestKey(id))
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	measured := make(map[string]float64)
+	for i, cmd := range cmds {
+		data, err := cmd.Bytes()
+		if err != nil {
+			continue
+		}
+
+		var latest struct {
+			Metrics map[string]interface{} `json:"metrics"`
+		}
+		if err := json.Unmarshal(data, &latest); err != nil {
+			continue
+		}
+		for _, name := range s.powerMetrics {
+			if value, ok := latest.Metrics[name].(float64); ok {
+				measured[deviceIDs[i]] = value
+				break
+			}
+		}
+	}
+	return measured, nil
+}
+
+// rackCapacity 计算机柜容量和告警
+func (s *CapacityService) rackCapacity(usage *rackUsage, measured map[string]float64) *RackCapacity {
+	rack := usage.rack
+	capacity := &RackCapacity{
+		RackID:         rack.ID,
+		RackName:       rack.Name,
+		RoomID:         rack.RoomID,
+		DataCenterID:   usage.dataCenterID,
+		UHeight:        rack.UHeight,
+		PowerCapacityW: rack.PowerCapacityW,
+		MaxWeightKg:    rack.MaxWeightKg,
+		Devices:        len(usage.devices),
+		Alerts:         make([]CapacityAlert, 0),
+	}
+
+	occupied := make([]bool, rack.UHeight+1)
+	for _, device := range usage.devices {
+		capacity.AllocatedPowerW += device.RatedPowerW
+		capacity.WeightKg += device.WeightKg
+		if power, ok := measured[device.ID]; ok {
+			capacity.MeasuredPowerW += power
+			capacity.MeasuredDevices++
+		}
+		if device.UPosition == 0 {
+			continue
+		}
+		for u := device.UPosition; u < device.UPosition+device.UHeight && u <= rack.UHeight; u++ {
+			if !occupied[u] {
+				occupied[u] = true
+				capacity.UsedU++
+			}
+		}
+	}
+	capacity.FreeU = rack.UHeight - capacity.UsedU
+	capacity.FreeRanges = freeRanges(occupied)
+
+	s.checkThreshold(capacity, CapacitySpace, float64(capacity.UsedU), float64(rack.UHeight), s.thresholds.Space)
+	s.checkThreshold(capacity, CapacityPowerAllocated, capacity.AllocatedPowerW, rack.PowerCapacityW, s.thresholds.Power)
+	s.checkThreshold(capacity, CapacityPowerMeasured, capacity.MeasuredPowerW, rack.PowerCapacityW, s.thresholds.Power)
+	s.checkThreshold(capacity, CapacityWeight, capacity.WeightKg, rack.MaxWeightKg, s.thresholds.Weight)
+	return capacity
+}
+
+// checkThreshold 使用率超过阈值时添加告警，容量未配置时跳过
+func (s *CapacityService) checkThreshold(capacity *RackCapacity, resource string, used, total float64, threshold CapacityThreshold) {
+	if total <= 0 {
+		return
+	}
+
+	p := percent(used, total)
+	level, limit := "", 0.0
+	switch {
+	case threshold.Critical > 0 && p >= threshold.Critical:
+		level, limit = CapacityCritical, threshold.Critical
+	case threshold.Warning > 0 && p >= threshold.Warning:
+		level, limit = CapacityWarning, threshold.Warning
+	default:
+		return
+	}
+
+	capacity.Alerts = append(capacity.Alerts, CapacityAlert{
+		RackID:       capacity.RackID,
+		DataCenterID: capacity.DataCenterID,
+		Resource:     resource,
+		Level:        level,
+		Percent:      p,
+		Threshold:    limit,
+		Message:      fmt.Sprintf("rack %s %s usage %.1f%% exceeds %s threshold %.1f%%", capacity.RackID, resource, p, level, limit),
+	})
+}
+
+// freeRanges 计算空闲的连续U位区间，occupied下标为U位（从1开始）
+func freeRanges(occupied []bool) []URange {
+	ranges := make([]URange, 0)
+	start := 0
+	for u := 1; u <= len(occupied); u++ {
+		free := u < len(occupied) && !occupied[u]
+		if free && start == 0 {
+			start = u
+		}
+		if !free && start != 0 {
+			ranges = append(ranges, URange{Start: start, End: u - 1, Size: u - start})
+			start = 0
+		}
+	}
+	return ranges
+}
+
+// percent 计算使用率百分比，保留一位小数
+func percent(used, total float64) float64 {
+	return float64(int(used/total*1000+0.5)) / 10
+}
+
+// maxFloat 返回较大值
+func maxFloat(a, b float64) float64 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// deviceLatestKey data-processor缓存设备最新数据的key
+func deviceLatestKey(deviceID string) string {
+	return fmt.Sprintf("device:latest:%s", deviceID)
+}
@@ -0,0 +1,522 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// 发现任务状态
+const (
+	DiscoveryJobPending   = "pending"   // 等待Agent领取
+	DiscoveryJobRunning   = "running"   // Agent扫描中
+	DiscoveryJobCompleted = "completed" // 扫描完成
+	DiscoveryJobFailed    = "failed"    // 扫描失败
+)
+
+// 发现设备状态
+const (
+	DiscoveredDeviceNew      = "new"      // 新发现，待确认
+	DiscoveredDeviceAccepted = "accepted" // 已接入为采集任务
+)
+
+// maxDiscoveryHosts 单个发现任务允许扫描的最大主机数（/20）
+const maxDiscoveryHosts = 4096
+
+// DiscoveryService 设备发现服务
+type DiscoveryService struct {
+	redis       *redis.Client
+	taskService *TaskService
+}
+
+// NewDiscoveryService 创建设备发现服务
+func NewDiscoveryService(redisClient *redis.Client, taskService *TaskService) *DiscoveryService {
+	return &DiscoveryService{
+		redis:       redisClient,
+		taskService: taskService,
+	}
+}
+
+// DiscoveryJob 设备发现任务
+type DiscoveryJob struct {
+	JobID         string   `json:"job_id"`
+	AgentID       string   `json:"agent_id"`
+	CIDR          string   `json:"cidr"`
+	Protocols     []string `json:"protocols"`       // 探测协议: snmp/modbus/opcua/redfish
+	SNMPCommunity string   `json:"snmp_community"`  // SNMP Community
+	ModbusUnitIDs []int    `json:"modbus_unit_ids"` // 探测的Modbus从站ID
+	Timeout       int      `json:"timeout"`         // 单次探测超时(秒)
+	Status        string   `json:"status"`
+	Error         string   `json:"error,omitempty"`
+	DeviceCount   int      `json:"device_count"`
+	CreatedAt     int64    `json:"created_at"`
+	StartedAt     int64    `json:"started_at,omitempty"`
+	FinishedAt    int64    `json:"finished_at,omitempty"`
+}
+
+// Fingerprint 设备指纹
+type Fingerprint struct {
+	Vendor     string `json:"vendor"`
+	Model      string `json:"model"`
+	DeviceType string `json:"device_type"` // 建议的设备类型
+}
+
+// DiscoveredDevice 发现的设备
+type DiscoveredDevice struct {
+	AgentID      string            `json:"agent_id"`
+	JobID        string            `json:"job_id"`
+	IP           string            `json:"ip"`
+	Port         int               `json:"port"`
+	Protocol     string            `json:"protocol"`
+	UnitID       int               `json:"unit_id,omitempty"` // Modbus从站ID
+	Fingerprint  Fingerprint       `json:"fingerprint"`
+	Details      map[string]string `json:"details,omitempty"` // 探测原始信息(sysDescr等)
+	Status       string            `json:"status"`
+	TaskID       string            `json:"task_id,omitempty"` // 接入后的任务ID
+	DiscoveredAt int64             `json:"discovered_at"`
+}
+
+// Key 设备在发现结果中的唯一标识
+func (d *DiscoveredDevice) Key() string {
+	if d.UnitID > 0 {
+		return fmt.Sprintf("%s:%s:%d", d.Protocol, d.IP, d.UnitID)
+	}
+	return fmt.Sprintf("%s:%s", d.Protocol, d.IP)
+}
+
+// CreateDiscoveryJobRequest 创建发现任务请求
+type CreateDiscoveryJobRequest struct {
+	AgentID       string   `json:"agent_id" binding:"required"`
+	CIDR          string   `json:"cidr" binding:"required"`
+	Protocols     []string `json:"protocols"`
+	SNMPCommunity string   `json:"snmp_community"`
+	ModbusUnitIDs []int    `json:"modbus_unit_ids"`
+	Timeout       int      `json:"timeout"`
+}
+
+// DiscoveryResultRequest Agent上报发现结果请求
+type DiscoveryResultRequest struct {
+	JobID      string              `json:"job_id" binding:"required"`
+	AgentID    string              `json:"agent_id" binding:"required"`
+	Status     string              `json:"status" binding:"required"`
+	Error      string              `json:"error"`
+	Devices    []*DiscoveredDevice `json:"devices"`
+	StartedAt  int64               `json:"started_at"`
+	FinishedAt int64               `json:"finished_at"`
+}
+
+// AcceptDeviceRequest 将发现的设备接入为采集任务
+type AcceptDeviceRequest struct {
+	AgentID    string                 `json:"agent_id" binding:"required"`
+	DeviceKey  string                 `json:"device_key" binding:"required"`
+	TaskID     string                 `json:"task_id" binding:"required"`
+	DeviceID   string                 `json:"device_id" binding:"required"`
+	DeviceType string                 `json:"device_type"` // 为空时使用指纹建议的设备类型
+	ProfileID  string                 `json:"profile_id"`  // 设备模板，指定时interval/metrics/config作为模板覆盖项
+	Interval   int                    `json:"interval"`    // 未指定模板时必填
+	Metrics    []string               `json:"metrics"`     // 未指定模板时必填
+	Config     map[string]interface{} `json:"config"`      // SNMP的community等凭据由模板或此处提供
+	CronExpr   string                 `json:"cron_expr"`
+}
+
+// supportedDiscoveryProtocols 支持的探测协议
+var supportedDiscoveryProtocols = map[string]bool{
+	"snmp":    true,
+	"modbus":  true,
+	"opcua":   true,
+	"redfish": true,
+}
+
+// CreateJob 创建发现任务，等待Agent领取
+func (s *DiscoveryService) CreateJob(ctx context.Context, req *CreateDiscoveryJobRequest) (*DiscoveryJob, error) {
+	_, ipNet, err := net.ParseCIDR(req.CIDR)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cidr: %w", err)
+	}
+	if ipNet.IP.To4() == nil {
+		return nil, fmt.Errorf("only IPv4 cidr is supported: %s", req.CIDR)
+	}
+	ones, bits := ipNet.Mask.Size()
+	if 1<<(bits-ones) > maxDiscoveryHosts {
+		return nil, fmt.Errorf("cidr %s is too large, at most %d hosts per job", req.CIDR, maxDiscoveryHosts)
+	}
+
+	protocols := req.Protocols
+	if len(protocols) == 0 {
+		protocols = []string{"snmp", "modbus", "opcua", "redfish"}
+	}
+	for _, p := range protocols {
+		if !supportedDiscoveryProtocols[p] {
+			return nil, fmt.Errorf("unsupported discovery protocol: %s", p)
+		}
+	}
+
+	for _, id := range req.ModbusUnitIDs {
+		if id < 1 || id > 247 {
+			return nil, fmt.Errorf("invalid modbus unit id: %d", id)
+		}
+	}
+
+	job := &DiscoveryJob{
+		JobID:         fmt.Sprintf("disc-%d", time.Now().UnixNano()),
+		AgentID:       req.AgentID,
+		CIDR:          ipNet.String(),
+		Protocols:     protocols,
+		SNMPCommunity: req.SNMPCommunity,
+		ModbusUnitIDs: req.ModbusUnitIDs,
+		Timeout:       req.Timeout,
+		Status:        DiscoveryJobPending,
+		CreatedAt:     time.Now().Unix(),
+	}
+
+	if err := s.saveJob(ctx, job); err != nil {
+		return nil, err
+	}
+
+	return job, nil
+}
+
+// ListJobs 查询Agent的发现任务，status为空时返回全部
+func (s *DiscoveryService) ListJobs(ctx context.Context, agentID, status string) ([]*DiscoveryJob, error) {
+	values, err := s.redis.HVals(ctx, discoveryJobsKey(agentID)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	jobs := make([]*DiscoveryJob, 0, len(values))
+	for _, v := range values {
+		var job DiscoveryJob
+		if err := json.Unmarshal([]byte(v), &job); err != nil {
+			continue
+		}
+		if status != "" && job.Status != status {
+			continue
+		}
+		jobs = append(jobs, &job)
+	}
+
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].CreatedAt < jobs[j].CreatedAt })
+
+	return jobs, nil
+}
+
+// ClaimJob Agent领取发现任务，任务状态从pending变为running
+func (s *DiscoveryService) ClaimJob(ctx context.Context, agentID, jobID string) (*DiscoveryJob, error) {
+	key := discoveryJobsKey(agentID)
+
+	// WATCH任务Hash，多个Agent副本同时领取时只有一个成功
+	var claimed *DiscoveryJob
+	txf := func(tx *redis.Tx) error {
+		job, err := loadJob(ctx, tx, agentID, jobID)
+		if err != nil {
+			return err
+		}
+		if job.Status != DiscoveryJobPending {
+			return fmt.Errorf("discovery job %s is %s: %w", jobID, job.Status, ErrConflict)
+		}
+
+		job.Status = DiscoveryJobRunning
+		job.StartedAt = time.Now().Unix()
+
+		data, err := json.Marshal(job)
+		if err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.HSet(ctx, key, jobID, data)
+			return nil
+		})
+		claimed = job
+		return err
+	}
+
+	for i := 0; i < maxTaskTxRetries; i++ {
+		err := s.redis.Watch(ctx, txf, key)
+		if err == redis.TxFailedErr {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return claimed, nil
+	}
+
+	return nil, fmt.Errorf("discovery job %s was modified concurrently: %w", jobID, ErrConflict)
+}
+
+// ReportResult 保存Agent上报的发现结果
+// 只接受已领取（running）的任务的结果，任务已结束或未被领取时返回ErrConflict
+func (s *DiscoveryService) ReportResult(ctx context.Context, req *DiscoveryResultRequest) error {
+	if req.Status != DiscoveryJobCompleted && req.Status != DiscoveryJobFailed {
+		errs := &ValidationError{}
+		errs.Add("status", "invalid discovery job status %s, expected %s or %s", req.Status, DiscoveryJobCompleted, DiscoveryJobFailed)
+		return errs
+	}
+
+	jobsKey := discoveryJobsKey(req.AgentID)
+	devicesKey := discoveredDevicesKey(req.AgentID)
+
+	// WATCH任务和设备Hash，重复上报或与接入设备并发时只有一个成功
+	txf := func(tx *redis.Tx) error {
+		job, err := loadJob(ctx, tx, req.AgentID, req.JobID)
+		if err != nil {
+			return err
+		}
+		if job.Status != DiscoveryJobRunning {
+			return fmt.Errorf("discovery job %s is %s: %w", req.JobID, job.Status, ErrConflict)
+		}
+
+		existing, err := tx.HGetAll(ctx, devicesKey).Result()
+		if err != nil {
+			return err
+		}
+
+		fields := make(map[string]interface{}, len(req.Devices))
+		for _, device := range req.Devices {
+			device.AgentID = req.AgentID
+			device.JobID = req.JobID
+			device.Status = DiscoveredDeviceNew
+			// 旧版本Agent会上报SNMP community，凭据不落库
+			delete(device.Details, "community")
+
+			// 已接入的设备保留接入状态，仅刷新指纹信息
+			if data, ok := existing[device.Key()]; ok {
+				var prev DiscoveredDevice
+				if err := json.Unmarshal([]byte(data), &prev); err == nil && prev.Status == DiscoveredDeviceAccepted {
+					device.Status = prev.Status
+					device.TaskID = prev.TaskID
+				}
+			}
+
+			data, err := json.Marshal(device)
+			if err != nil {
+				return err
+			}
+			fields[device.Key()] = data
+		}
+
+		job.Status = req.Status
+		job.Error = req.Error
+		job.DeviceCount = len(req.Devices)
+		if req.StartedAt > 0 {
+			job.StartedAt = req.StartedAt
+		}
+		job.FinishedAt = req.FinishedAt
+		if job.FinishedAt == 0 {
+			job.FinishedAt = time.Now().Unix()
+		}
+		jobData, err := json.Marshal(job)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			if len(fields) > 0 {
+				pipe.HSet(ctx, devicesKey, fields)
+			}
+			pipe.HSet(ctx, jobsKey, req.JobID, jobData)
+			return nil
+		})
+		return err
+	}
+
+	for i := 0; i < maxTaskTxRetries; i++ {
+		err := s.redis.Watch(ctx, txf, jobsKey, devicesKey)
+		if err == redis.TxFailedErr {
+			continue
+		}
+		return err
+	}
+
+	return fmt.Errorf("discovery job %s was modified concurrently: %w", req.JobID, ErrConflict)
+}
+
+// ListDevices 查询Agent发现的设备，status为空时返回全部
+func (s *DiscoveryService) ListDevices(ctx context.Context, agentID, status string) ([]*DiscoveredDevice, error) {
+	values, err := s.redis.HVals(ctx, discoveredDevicesKey(agentID)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	devices := make([]*DiscoveredDevice, 0, len(values))
+	for _, v := range values {
+		var device DiscoveredDevice
+		if err := json.Unmarshal([]byte(v), &device); err != nil {
+			continue
+		}
+		if status != "" && device.Status != status {
+			continue
+		}
+		devices = append(devices, &device)
+	}
+
+	sort.Slice(devices, func(i, j int) bool { return devices[i].Key() < devices[j].Key() })
+
+	return devices, nil
+}
+
+// AcceptDevice 将发现的设备接入为采集任务，actor为操作人
+func (s *DiscoveryService) AcceptDevice(ctx context.Context, req *AcceptDeviceRequest, actor string) (*DiscoveredDevice, error) {
+	devicesKey := discoveredDevicesKey(req.AgentID)
+	device, err := loadDiscoveredDevice(ctx, s.redis, req.AgentID, req.DeviceKey)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkNotAccepted(device); err != nil {
+		return nil, err
+	}
+
+	deviceType := req.DeviceType
+	if deviceType == "" {
+		deviceType = device.Fingerprint.DeviceType
+	}
+	if deviceType == "" && req.ProfileID == "" {
+		return nil, fmt.Errorf("device_type is required: no suggestion in fingerprint")
+	}
+	if req.ProfileID != "" {
+		profile, err := s.taskService.profiles.Get(ctx, req.ProfileID, 0)
+		if err != nil && !isNotFound(err) {
+			return nil, err
+		}
+		// 模板不存在时由AddTask返回字段错误
+		if err == nil && profile.Protocol != device.Protocol {
+			errs := &ValidationError{}
+			errs.Add("profile_id", "profile %s uses protocol %s, device was discovered via %s", req.ProfileID, profile.Protocol, device.Protocol)
+			return nil, errs
+		}
+	}
+
+	// 合并探测得到的连接参数与请求中的配置
+	config := map[string]interface{}{"port": float64(device.Port)}
+	if device.UnitID > 0 {
+		config["unit_id"] = float64(device.UnitID)
+	}
+	// SNMP探测使用的版本，community不随发现结果上报
+	if v := device.Details["version"]; v != "" {
+		config["version"] = v
+	}
+	for k, v := range req.Config {
+		config[k] = v
+	}
+
+	taskReq := &AddTaskRequest{
+		AgentID: req.AgentID,
+		TaskID:  req.TaskID,
+		TaskSpec: TaskSpec{
+			DeviceID:   req.DeviceID,
+			DeviceIP:   device.IP,
+			DeviceType: deviceType,
+			ProfileID:  req.ProfileID,
+			Protocol:   device.Protocol,
+			Interval:   req.Interval,
+			Metrics:    req.Metrics,
+			Config:     config,
+			CronExpr:   req.CronExpr,
+		},
+	}
+
+	// 在创建任务的事务中WATCH设备Hash并重新检查接入状态，并发接入同一设备时只创建一个任务
+	var (
+		accepted *DiscoveredDevice
+		updated  []byte
+	)
+	hook := &taskTxHook{
+		watch: []string{devicesKey},
+		check: func(tx *redis.Tx) error {
+			current, err := loadDiscoveredDevice(ctx, tx, req.AgentID, req.DeviceKey)
+			if err != nil {
+				return err
+			}
+			if err := checkNotAccepted(current); err != nil {
+				return err
+			}
+
+			current.Status = DiscoveredDeviceAccepted
+			current.TaskID = req.TaskID
+			updated, err = json.Marshal(current)
+			accepted = current
+			return err
+		},
+		write: func(pipe redis.Pipeliner) {
+			pipe.HSet(ctx, devicesKey, req.DeviceKey, updated)
+		},
+	}
+	if _, err := s.taskService.addTask(ctx, taskReq, actor, hook); err != nil {
+		return nil, fmt.Errorf("failed to add task: %w", err)
+	}
+
+	return accepted, nil
+}
+
+// loadDiscoveredDevice 从Redis读取发现的设备，c可以是事务中的连接
+func loadDiscoveredDevice(ctx context.Context, c redis.Cmdable, agentID, deviceKey string) (*DiscoveredDevice, error) {
+	data, err := c.HGet(ctx, discoveredDevicesKey(agentID), deviceKey).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, fmt.Errorf("discovered device %s %w", deviceKey, ErrNotFound)
+		}
+		return nil, err
+	}
+
+	var device DiscoveredDevice
+	if err := json.Unmarshal([]byte(data), &device); err != nil {
+		return nil, err
+	}
+
+	return &device, nil
+}
+
+// checkNotAccepted 校验设备尚未接入
+func checkNotAccepted(device *DiscoveredDevice) error {
+	if device.Status == DiscoveredDeviceAccepted {
+		return fmt.Errorf("device %s already accepted as task %s: %w", device.Key(), device.TaskID, ErrConflict)
+	}
+	return nil
+}
+
+// getJob 查询发现任务
+func (s *DiscoveryService) getJob(ctx context.Context, agentID, jobID string) (*DiscoveryJob, error) {
+	return loadJob(ctx, s.redis, agentID, jobID)
+}
+
+// loadJob 从Redis读取发现任务，c可以是事务中的连接
+func loadJob(ctx context.Context, c redis.Cmdable, agentID, jobID string) (*DiscoveryJob, error) {
+	data, err := c.HGet(ctx, discoveryJobsKey(agentID), jobID).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, fmt.Errorf("discovery job %s %w", jobID, ErrNotFound)
+		}
+		return nil, err
+	}
+
+	var job DiscoveryJob
+	if err := json.Unmarshal([]byte(data), &job); err != nil {
+		return nil, err
+	}
+
+	return &job, nil
+}
+
+// saveJob 保存发现任务
+func (s *DiscoveryService) saveJob(ctx context.Context, job *DiscoveryJob) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	return s.redis.HSet(ctx, discoveryJobsKey(job.AgentID), job.JobID, data).Err()
+}
+
+// discoveryJobsKey Agent发现任务Hash的key
+func discoveryJobsKey(agentID string) string {
+	return fmt.Sprintf("discovery:jobs:%s", agentID)
+}
+
+// discoveredDevicesKey Agent发现设备Hash的key
+func discoveredDevicesKey(agentID string) string {
+	return fmt.Sprintf("discovery:devices:%s", agentID)
+}
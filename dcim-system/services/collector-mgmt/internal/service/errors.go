@@ -0,0 +1,14 @@
+package service
+
+import "errors"
+
+// ErrNotFound 资源不存在
+var ErrNotFound = errors.New("not found")
+
+// ErrConflict 资源已存在或版本冲突
+var ErrConflict = errors.New("conflict")
+
+// isNotFound 判断是否为资源不存在错误
+func isNotFound(err error) bool {
+	return errors.Is(err, ErrNotFound)
+}
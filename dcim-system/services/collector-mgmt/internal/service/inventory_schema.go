@@ -0,0 +1,78 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// inventorySchema 设备台账表结构
+// 层级关系：数据中心 -> 机房 -> 机柜 -> U位 -> 设备，设备未上架时rack_id/u_position为空
+var inventorySchema = []string{
+	`CREATE TABLE IF NOT EXISTS data_centers (
+		id         TEXT PRIMARY KEY,
+		name       TEXT NOT NULL,
+		location   TEXT NOT NULL DEFAULT '',
+		created_at BIGINT NOT NULL,
+		updated_at BIGINT NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS rooms (
+		id             TEXT PRIMARY KEY,
+		data_center_id TEXT NOT NULL REFERENCES data_centers(id) ON DELETE RESTRICT,
+		name           TEXT NOT NULL,
+		floor          TEXT NOT NULL DEFAULT '',
+		created_at     BIGINT NOT NULL,
+		updated_at     BIGINT NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS rooms_data_center_idx ON rooms (data_center_id)`,
+	`CREATE TABLE IF NOT EXISTS racks (
+		id               TEXT PRIMARY KEY,
+		room_id          TEXT NOT NULL REFERENCES rooms(id) ON DELETE RESTRICT,
+		name             TEXT NOT NULL,
+		u_height         INTEGER NOT NULL DEFAULT 42,
+		power_capacity_w DOUBLE PRECISION NOT NULL DEFAULT 0,
+		max_weight_kg    DOUBLE PRECISION NOT NULL DEFAULT 0,
+		created_at       BIGINT NOT NULL,
+		updated_at       BIGINT NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS racks_room_idx ON racks (room_id)`,
+	`CREATE TABLE IF NOT EXISTS devices (
+		id              TEXT PRIMARY KEY,
+		name            TEXT NOT NULL,
+		device_type     TEXT NOT NULL,
+		vendor          TEXT NOT NULL DEFAULT '',
+		model           TEXT NOT NULL DEFAULT '',
+		serial_number   TEXT NOT NULL DEFAULT '',
+		ip              TEXT NOT NULL DEFAULT '',
+		rack_id         TEXT REFERENCES racks(id) ON DELETE RESTRICT,
+		u_position      INTEGER,
+		u_height        INTEGER NOT NULL DEFAULT 1,
+		rated_power_w   DOUBLE PRECISION NOT NULL DEFAULT 0,
+		weight_kg       DOUBLE PRECISION NOT NULL DEFAULT 0,
+		lifecycle_state TEXT NOT NULL DEFAULT 'planned'
+			CHECK (lifecycle_state IN ('planned', 'installed', 'in_service', 'retired')),
+		created_at      BIGINT NOT NULL,
+		updated_at      BIGINT NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS devices_rack_idx ON devices (rack_id)`,
+	`CREATE INDEX IF NOT EXISTS devices_state_idx ON devices (lifecycle_state)`,
+	`CREATE TABLE IF NOT EXISTS device_lifecycle_events (
+		device_id  TEXT NOT NULL,
+		from_state TEXT NOT NULL,
+		to_state   TEXT NOT NULL,
+		actor      TEXT NOT NULL,
+		comment    TEXT NOT NULL DEFAULT '',
+		created_at BIGINT NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS device_lifecycle_events_device_idx ON device_lifecycle_events (device_id, created_at)`,
+}
+
+// MigrateInventory 创建设备台账表结构（可重复执行）
+func MigrateInventory(ctx context.Context, db *sql.DB) error {
+	for _, stmt := range inventorySchema {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to migrate inventory schema: %w", err)
+		}
+	}
+	return nil
+}
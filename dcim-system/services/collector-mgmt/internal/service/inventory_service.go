@@ -0,0 +1,980 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// 设备生命周期状态
+const (
+	LifecyclePlanned   = "planned"    // 规划中（可预占机柜U位）
+	LifecycleInstalled = "installed"  // 已上架
+	LifecycleInService = "in_service" // 运行中
+	LifecycleRetired   = "retired"    // 已退役（释放U位，不可再变更）
+)
+
+// lifecycleTransitions 允许的生命周期状态迁移
+var lifecycleTransitions = map[string][]string{
+	LifecyclePlanned:   {LifecycleInstalled, LifecycleRetired},
+	LifecycleInstalled: {LifecycleInService, LifecyclePlanned, LifecycleRetired},
+	LifecycleInService: {LifecycleInstalled, LifecycleRetired},
+	LifecycleRetired:   {},
+}
+
+// defaultRackUHeight 机柜默认U数
+const defaultRackUHeight = 42
+
+// InventoryService 设备台账服务
+type InventoryService struct {
+	db    *sql.DB
+	redis *redis.Client
+}
+
+// NewInventoryService 创建设备台账服务
+func NewInventoryService(db *sql.DB, redisClient *redis.Client) *InventoryService {
+	return &InventoryService{
+		db:    db,
+		redis: redisClient,
+	}
+}
+
+// DataCenter 数据中心
+type DataCenter struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Location  string `json:"location"`
+	CreatedAt int64  `json:"created_at"`
+	UpdatedAt int64  `json:"updated_at"`
+}
+
+// Room 机房
+type Room struct {
+	ID           string `json:"id"`
+	DataCenterID string `json:"data_center_id"`
+	Name         string `json:"name"`
+	Floor        string `json:"floor"`
+	CreatedAt    int64  `json:"created_at"`
+	UpdatedAt    int64  `json:"updated_at"`
+}
+
+// Rack 机柜
+type Rack struct {
+	ID             string  `json:"id"`
+	RoomID         string  `json:"room_id"`
+	Name           string  `json:"name"`
+	UHeight        int     `json:"u_height"`         // 机柜U数，默认42
+	PowerCapacityW float64 `json:"power_capacity_w"` // 额定供电容量(W)
+	MaxWeightKg    float64 `json:"max_weight_kg"`    // 最大承重(kg)
+	CreatedAt      int64   `json:"created_at"`
+	UpdatedAt      int64   `json:"updated_at"`
+}
+
+// Device 台账设备
+type Device struct {
+	ID           string  `json:"id"`
+	Name         string  `json:"name"`
+	DeviceType   string  `json:"device_type"`
+	Vendor       string  `json:"vendor"`
+	Model        string  `json:"model"`
+	SerialNumber string  `json:"serial_number"`
+	IP           string  `json:"ip"`
+	RackID       string  `json:"rack_id,omitempty"`
+	UPosition    int     `json:"u_position,omitempty"` // 设备最低U位（从1开始），0表示未上架
+	UHeight      int     `json:"u_height"`             // 设备高度(U)，默认1
+	RatedPowerW  float64 `json:"rated_power_w"`        // 铭牌功率(W)
+	WeightKg     float64 `json:"weight_kg"`
+	State        string  `json:"lifecycle_state"`
+	CreatedAt    int64   `json:"created_at"`
+	UpdatedAt    int64   `json:"updated_at"`
+}
+
+// LifecycleEvent 设备生命周期变更记录
+type LifecycleEvent struct {
+	DeviceID  string `json:"device_id"`
+	FromState string `json:"from_state"`
+	ToState   string `json:"to_state"`
+	Actor     string `json:"actor"`
+	Comment   string `json:"comment,omitempty"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+// ChangeLifecycleRequest 变更设备生命周期状态请求
+type ChangeLifecycleRequest struct {
+	State   string `json:"state" binding:"required"`
+	Comment string `json:"comment"`
+}
+
+// DeviceQuery 设备查询条件
+type DeviceQuery struct {
+	DataCenterID string `form:"data_center_id"`
+	RoomID       string `form:"room_id"`
+	RackID       string `form:"rack_id"`
+	State        string `form:"lifecycle_state"`
+	DeviceType   string `form:"device_type"`
+	Cursor       string `form:"cursor"` // 上一页返回的next_cursor
+	Limit        int    `form:"limit"`
+}
+
+// DevicePage 设备分页结果
+type DevicePage struct {
+	Devices    []*Device `json:"devices"`
+	NextCursor string    `json:"next_cursor,omitempty"`
+}
+
+// querier *sql.DB 与 *sql.Tx 的公共查询接口
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// validate 校验数据中心定义
+func (dc *DataCenter) validate() error {
+	errs := &ValidationError{}
+	if dc.ID == "" {
+		errs.Add("id", "is required")
+	}
+	if dc.Name == "" {
+		errs.Add("name", "is required")
+	}
+	return errs.Err()
+}
+
+// CreateDataCenter 创建数据中心
+func (s *InventoryService) CreateDataCenter(ctx context.Context, dc *DataCenter) error {
+	if err := dc.validate(); err != nil {
+		return err
+	}
+	if err := s.checkNotExists(ctx, s.db, "data_centers", "data center", dc.ID); err != nil {
+		return err
+	}
+
+	dc.CreatedAt = time.Now().Unix()
+	dc.UpdatedAt = dc.CreatedAt
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO data_centers (id, name, location, created_at, updated_at) VALUES ($1, $2, $3, $4, $5)`,
+		dc.ID, dc.Name, dc.Location, dc.CreatedAt, dc.UpdatedAt)
+	return err
+}
+
+// GetDataCenter 查询数据中心
+func (s *InventoryService) GetDataCenter(ctx context.Context, id string) (*DataCenter, error) {
+	var dc DataCenter
+	err := s.db.QueryRowContext(ctx,
+		`SELECT id, name, location, created_at, updated_at FROM data_centers WHERE id = $1`, id).
+		Scan(&dc.ID, &dc.Name, &dc.Location, &dc.CreatedAt, &dc.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("data center %s %w", id, ErrNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &dc, nil
+}
+
+// ListDataCenters 查询所有数据中心
+func (s *InventoryService) ListDataCenters(ctx context.Context) ([]*DataCenter, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT id, name, location, created_at, updated_at FROM data_centers ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	dcs := make([]*DataCenter, 0)
+	for rows.Next() {
+		var dc DataCenter
+		if err := rows.Scan(&dc.ID, &dc.Name, &dc.Location, &dc.CreatedAt, &dc.UpdatedAt); err != nil {
+			return nil, err
+		}
+		dcs = append(dcs, &dc)
+	}
+	return dcs, rows.Err()
+}
+
+// UpdateDataCenter 更新数据中心
+func (s *InventoryService) UpdateDataCenter(ctx context.Context, dc *DataCenter) (*DataCenter, error) {
+	if err := dc.validate(); err != nil {
+		return nil, err
+	}
+
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE data_centers SET name = $2, location = $3, updated_at = $4 WHERE id = $1`,
+		dc.ID, dc.Name, dc.Location, time.Now().Unix())
+	if err := checkAffected(res, err, "data center", dc.ID); err != nil {
+		return nil, err
+	}
+	return s.GetDataCenter(ctx, dc.ID)
+}
+
+// DeleteDataCenter 删除数据中心，存在机房时返回ErrConflict
+func (s *InventoryService) DeleteDataCenter(ctx context.Context, id string) error {
+	if err := s.checkNoChildren(ctx, "rooms", "data_center_id", id, "data center", "rooms"); err != nil {
+		return err
+	}
+	res, err := s.db.ExecContext(ctx, `DELETE FROM data_centers WHERE id = $1`, id)
+	return checkAffected(res, err, "data center", id)
+}
+
+// validate 校验机房定义
+func (r *Room) validate() error {
+	errs := &ValidationError{}
+	if r.ID == "" {
+		errs.Add("id", "is required")
+	}
+	if r.DataCenterID == "" {
+		errs.Add("data_center_id", "is required")
+	}
+	if r.Name == "" {
+		errs.Add("name", "is required")
+	}
+	return errs.Err()
+}
+
+// CreateRoom 创建机房
+func (s *InventoryService) CreateRoom(ctx context.Context, room *Room) error {
+	if err := room.validate(); err != nil {
+		return err
+	}
+	if err := s.checkNotExists(ctx, s.db, "rooms", "room", room.ID); err != nil {
+		return err
+	}
+	if err := s.checkParent(ctx, "data_centers", "data_center_id", room.DataCenterID); err != nil {
+		return err
+	}
+
+	room.CreatedAt = time.Now().Unix()
+	room.UpdatedAt = room.CreatedAt
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO rooms (id, data_center_id, name, floor, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6)`,
+		room.ID, room.DataCenterID, room.Name, room.Floor, room.CreatedAt, room.UpdatedAt)
+	return err
+}
+
+// GetRoom 查询机房
+func (s *InventoryService) GetRoom(ctx context.Context, id string) (*Room, error) {
+	var room Room
+	err := s.db.QueryRowContext(ctx,
+		`SELECT id, data_center_id, name, floor, created_at, updated_at FROM rooms WHERE id = $1`, id).
+		Scan(&room.ID, &room.DataCenterID, &room.Name, &room.Floor, &room.CreatedAt, &room.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("room %s %w", id, ErrNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &room, nil
+}
+
+// ListRooms 查询机房，dataCenterID为空时返回所有机房
+func (s *InventoryService) ListRooms(ctx context.Context, dataCenterID string) ([]*Room, error) {
+	query := `SELECT id, data_center_id, name, floor, created_at, updated_at FROM rooms`
+	var args []interface{}
+	if dataCenterID != "" {
+		query += ` WHERE data_center_id = $1`
+		args = append(args, dataCenterID)
+	}
+	query += ` ORDER BY id`
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rooms := make([]*Room, 0)
+	for rows.Next() {
+		var room Room
+		if err := rows.Scan(&room.ID, &room.DataCenterID, &room.Name, &room.Floor, &room.CreatedAt, &room.UpdatedAt); err != nil {
+			return nil, err
+		}
+		rooms = append(rooms, &room)
+	}
+	return rooms, rows.Err()
+}
+
+// UpdateRoom 更新机房
+func (s *InventoryService) UpdateRoom(ctx context.Context, room *Room) (*Room, error) {
+	if err := room.validate(); err != nil {
+		return nil, err
+	}
+	if err := s.checkParent(ctx, "data_centers", "data_center_id", room.DataCenterID); err != nil {
+		return nil, err
+	}
+
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE rooms SET data_center_id = $2, name = $3, floor = $4, updated_at = $5 WHERE id = $1`,
+		room.ID, room.DataCenterID, room.Name, room.Floor, time.Now().Unix())
+	if err := checkAffected(res, err, "room", room.ID); err != nil {
+		return nil, err
+	}
+	return s.GetRoom(ctx, room.ID)
+}
+
+// DeleteRoom 删除机房，存在机柜时返回ErrConflict
+func (s *InventoryService) DeleteRoom(ctx context.Context, id string) error {
+	if err := s.checkNoChildren(ctx, "racks", "room_id", id, "room", "racks"); err != nil {
+		return err
+	}
+	res, err := s.db.ExecContext(ctx, `DELETE FROM rooms WHERE id = $1`, id)
+	return checkAffected(res, err, "room", id)
+}
+
+// validate 校验机柜定义
+func (r *Rack) validate() error {
+	if r.UHeight == 0 {
+		r.UHeight = defaultRackUHeight
+	}
+
+	errs := &ValidationError{}
+	if r.ID == "" {
+		errs.Add("id", "is required")
+	}
+	if r.RoomID == "" {
+		errs.Add("room_id", "is required")
+	}
+	if r.Name == "" {
+		errs.Add("name", "is required")
+	}
+	if r.UHeight < 1 || r.UHeight > 60 {
+		errs.Add("u_height", "must be between 1 and 60")
+	}
+	if r.PowerCapacityW < 0 {
+		errs.Add("power_capacity_w", "must not be negative")
+	}
+	if r.MaxWeightKg < 0 {
+		errs.Add("max_weight_kg", "must not be negative")
+	}
+	return errs.Err()
+}
+
+// CreateRack 创建机柜
+func (s *InventoryService) CreateRack(ctx context.Context, rack *Rack) error {
+	if err := rack.validate(); err != nil {
+		return err
+	}
+	if err := s.checkNotExists(ctx, s.db, "racks", "rack", rack.ID); err != nil {
+		return err
+	}
+	if err := s.checkParent(ctx, "rooms", "room_id", rack.RoomID); err != nil {
+		return err
+	}
+
+	rack.CreatedAt = time.Now().Unix()
+	rack.UpdatedAt = rack.CreatedAt
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO racks (id, room_id, name, u_height, power_capacity_w, max_weight_kg, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		rack.ID, rack.RoomID, rack.Name, rack.UHeight, rack.PowerCapacityW, rack.MaxWeightKg, rack.CreatedAt, rack.UpdatedAt)
+	return err
+}
+
+// GetRack 查询机柜
+func (s *InventoryService) GetRack(ctx context.Context, id string) (*Rack, error) {
+	rack, err := scanRack(s.db.QueryRowContext(ctx, `SELECT `+rackColumns+` FROM racks WHERE id = $1`, id))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("rack %s %w", id, ErrNotFound)
+	}
+	return rack, err
+}
+
+// ListRacks 查询机柜，roomID为空时返回所有机柜
+func (s *InventoryService) ListRacks(ctx context.Context, roomID string) ([]*Rack, error) {
+	query := `SELECT ` + rackColumns + ` FROM racks`
+	var args []interface{}
+	if roomID != "" {
+		query += ` WHERE room_id = $1`
+		args = append(args, roomID)
+	}
+	query += ` ORDER BY id`
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	racks := make([]*Rack, 0)
+	for rows.Next() {
+		rack, err := scanRack(rows)
+		if err != nil {
+			return nil, err
+		}
+		racks = append(racks, rack)
+	}
+	return racks, rows.Err()
+}
+
+// UpdateRack 更新机柜，U数不能小于已上架设备占用的最高U位
+func (s *InventoryService) UpdateRack(ctx context.Context, rack *Rack) (*Rack, error) {
+	if err := rack.validate(); err != nil {
+		return nil, err
+	}
+	if _, err := s.GetRack(ctx, rack.ID); err != nil {
+		return nil, err
+	}
+	if err := s.checkParent(ctx, "rooms", "room_id", rack.RoomID); err != nil {
+		return nil, err
+	}
+
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		if err := lockRack(ctx, tx, rack.ID); err != nil {
+			return err
+		}
+
+		var top sql.NullInt64
+		err := tx.QueryRowContext(ctx,
+			`SELECT MAX(u_position + u_height - 1) FROM devices
+			WHERE rack_id = $1 AND u_position IS NOT NULL AND lifecycle_state <> $2`,
+			rack.ID, LifecycleRetired).Scan(&top)
+		if err != nil {
+			return err
+		}
+		if top.Valid && int(top.Int64) > rack.UHeight {
+			errs := &ValidationError{}
+			errs.Add("u_height", "devices occupy up to U%d", top.Int64)
+			return errs
+		}
+
+		_, err = tx.ExecContext(ctx,
+			`UPDATE racks SET room_id = $2, name = $3, u_height = $4, power_capacity_w = $5, max_weight_kg = $6, updated_at = $7
+			WHERE id = $1`,
+			rack.ID, rack.RoomID, rack.Name, rack.UHeight, rack.PowerCapacityW, rack.MaxWeightKg, time.Now().Unix())
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetRack(ctx, rack.ID)
+}
+
+// DeleteRack 删除机柜，存在设备时返回ErrConflict
+func (s *InventoryService) DeleteRack(ctx context.Context, id string) error {
+	if err := s.checkNoChildren(ctx, "devices", "rack_id", id, "rack", "devices"); err != nil {
+		return err
+	}
+	res, err := s.db.ExecContext(ctx, `DELETE FROM racks WHERE id = $1`, id)
+	return checkAffected(res, err, "rack", id)
+}
+
+const rackColumns = `id, room_id, name, u_height, power_capacity_w, max_weight_kg, created_at, updated_at`
+
+// scanRack 读取机柜记录
+func scanRack(row interface {
+	Scan(dest ...interface{}) error
+}) (*Rack, error) {
+	var rack Rack
+	err := row.Scan(&rack.ID, &rack.RoomID, &rack.Name, &rack.UHeight,
+		&rack.PowerCapacityW, &rack.MaxWeightKg, &rack.CreatedAt, &rack.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &rack, nil
+}
+
+// validate 校验设备定义
+func (d *Device) validate() error {
+	if d.UHeight == 0 {
+		d.UHeight = 1
+	}
+
+	errs := &ValidationError{}
+	if d.ID == "" {
+		errs.Add("id", "is required")
+	}
+	if d.Name == "" {
+		errs.Add("name", "is required")
+	}
+	if d.DeviceType == "" {
+		errs.Add("device_type", "is required")
+	}
+	if d.IP != "" && net.ParseIP(d.IP) == nil {
+		errs.Add("ip", "%q is not a valid IP address", d.IP)
+	}
+	if d.UHeight < 1 {
+		errs.Add("u_height", "must be at least 1")
+	}
+	if d.UPosition < 0 {
+		errs.Add("u_position", "must not be negative")
+	}
+	if d.UPosition > 0 && d.RackID == "" {
+		errs.Add("u_position", "requires rack_id")
+	}
+	if d.RatedPowerW < 0 {
+		errs.Add("rated_power_w", "must not be negative")
+	}
+	if d.WeightKg < 0 {
+		errs.Add("weight_kg", "must not be negative")
+	}
+
+	if _, ok := lifecycleTransitions[d.State]; !ok {
+		errs.Add("lifecycle_state", "invalid state %q, expected %s", d.State, lifecycleStates())
+	} else if (d.State == LifecycleInstalled || d.State == LifecycleInService) && (d.RackID == "" || d.UPosition == 0) {
+		errs.Add("u_position", "%s devices require rack_id and u_position", d.State)
+	}
+
+	return errs.Err()
+}
+
+// CreateDevice 创建设备，状态为空时为planned
+func (s *InventoryService) CreateDevice(ctx context.Context, device *Device, actor string) error {
+	if device.State == "" {
+		device.State = LifecyclePlanned
+	}
+	if err := device.validate(); err != nil {
+		return err
+	}
+	if device.State == LifecycleRetired {
+		errs := &ValidationError{}
+		errs.Add("lifecycle_state", "cannot create a retired device")
+		return errs
+	}
+
+	return s.withTx(ctx, func(tx *sql.Tx) error {
+		if err := s.checkNotExists(ctx, tx, "devices", "device", device.ID); err != nil {
+			return err
+		}
+		if err := checkPlacement(ctx, tx, device); err != nil {
+			return err
+		}
+
+		device.CreatedAt = time.Now().Unix()
+		device.UpdatedAt = device.CreatedAt
+		_, err := tx.ExecContext(ctx,
+			`INSERT INTO devices (id, name, device_type, vendor, model, serial_number, ip, rack_id, u_position, u_height,
+				rated_power_w, weight_kg, lifecycle_state, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)`,
+			device.ID, device.Name, device.DeviceType, device.Vendor, device.Model, device.SerialNumber, device.IP,
+			nullString(device.RackID), nullInt(device.UPosition), device.UHeight,
+			device.RatedPowerW, device.WeightKg, device.State, device.CreatedAt, device.UpdatedAt)
+		if err != nil {
+			return err
+		}
+
+		return insertLifecycleEvent(ctx, tx, &LifecycleEvent{
+			DeviceID:  device.ID,
+			ToState:   device.State,
+			Actor:     actor,
+			CreatedAt: device.CreatedAt,
+		})
+	})
+}
+
+// GetDevice 查询设备
+func (s *InventoryService) GetDevice(ctx context.Context, id string) (*Device, error) {
+	return getDevice(ctx, s.db, id)
+}
+
+// ListDevices 分页查询设备
+func (s *InventoryService) ListDevices(ctx context.Context, q *DeviceQuery) (*DevicePage, error) {
+	limit := q.Limit
+	if limit <= 0 {
+		limit = DefaultTaskPageSize
+	}
+	if limit > MaxTaskPageSize {
+		limit = MaxTaskPageSize
+	}
+
+	var (
+		conds []string
+		args  []interface{}
+	)
+	where := func(cond string, value string) {
+		if value == "" {
+			return
+		}
+		args = append(args, value)
+		conds = append(conds, fmt.Sprintf(cond, len(args)))
+	}
+	where("d.rack_id = $%d", q.RackID)
+	where("r.room_id = $%d", q.RoomID)
+	where("m.data_center_id = $%d", q.DataCenterID)
+	where("d.lifecycle_state = $%d", q.State)
+	where("d.device_type = $%d", q.DeviceType)
+	where("d.id > $%d", q.Cursor)
+
+	query := `SELECT ` + deviceColumns + ` FROM devices d
+		LEFT JOIN racks r ON r.id = d.rack_id
+		LEFT JOIN rooms m ON m.id = r.room_id`
+	if len(conds) > 0 {
+		query += ` WHERE ` + strings.Join(conds, " AND ")
+	}
+	query += fmt.Sprintf(` ORDER BY d.id LIMIT %d`, limit)
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	page := &DevicePage{Devices: make([]*Device, 0, limit)}
+	for rows.Next() {
+		device, err := scanDevice(rows)
+		if err != nil {
+			return nil, err
+		}
+		page.Devices = append(page.Devices, device)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(page.Devices) == limit {
+		page.NextCursor = page.Devices[len(page.Devices)-1].ID
+	}
+	return page, nil
+}
+
+// DeviceLocation 查询设备所在的数据中心和机房，设备不存在或未上架时返回空
+func (s *InventoryService) DeviceLocation(ctx context.Context, deviceID string) (string, string, error) {
+	var dataCenterID, roomID string
+	err := s.db.QueryRowContext(ctx,
+		`SELECT m.data_center_id, m.id FROM devices d
+		JOIN racks r ON r.id = d.rack_id
+		JOIN rooms m ON m.id = r.room_id
+		WHERE d.id = $1`, deviceID).Scan(&dataCenterID, &roomID)
+	if err != nil && err != sql.ErrNoRows {
+		return "", "", err
+	}
+	return dataCenterID, roomID, nil
+}
+
+// RoomDataCenter 查询机房所属的数据中心，机房不存在时返回空
+func (s *InventoryService) RoomDataCenter(ctx context.Context, roomID string) (string, error) {
+	var dataCenterID string
+	err := s.db.QueryRowContext(ctx, `SELECT data_center_id FROM rooms WHERE id = $1`, roomID).Scan(&dataCenterID)
+	if err != nil && err != sql.ErrNoRows {
+		return "", err
+	}
+	return dataCenterID, nil
+}
+
+// RackDataCenter 查询机柜所在的数据中心，机柜不存在时返回空
+func (s *InventoryService) RackDataCenter(ctx context.Context, rackID string) (string, error) {
+	var dataCenterID string
+	err := s.db.QueryRowContext(ctx,
+		`SELECT m.data_center_id FROM racks r
+		JOIN rooms m ON m.id = r.room_id
+		WHERE r.id = $1`, rackID).Scan(&dataCenterID)
+	if err != nil && err != sql.ErrNoRows {
+		return "", err
+	}
+	return dataCenterID, nil
+}
+
+// UpdateDevice 更新设备属性和位置，生命周期状态通过ChangeLifecycle变更
+func (s *InventoryService) UpdateDevice(ctx context.Context, device *Device) (*Device, error) {
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		current, err := getDevice(ctx, tx, device.ID)
+		if err != nil {
+			return err
+		}
+
+		device.State = current.State
+		if err := device.validate(); err != nil {
+			return err
+		}
+		if current.State != LifecycleRetired {
+			if err := checkPlacement(ctx, tx, device); err != nil {
+				return err
+			}
+		}
+
+		_, err = tx.ExecContext(ctx,
+			`UPDATE devices SET name = $2, device_type = $3, vendor = $4, model = $5, serial_number = $6, ip = $7,
+				rack_id = $8, u_position = $9, u_height = $10, rated_power_w = $11, weight_kg = $12, updated_at = $13
+			WHERE id = $1`,
+			device.ID, device.Name, device.DeviceType, device.Vendor, device.Model, device.SerialNumber, device.IP,
+			nullString(device.RackID), nullInt(device.UPosition), device.UHeight,
+			device.RatedPowerW, device.WeightKg, time.Now().Unix())
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetDevice(ctx, device.ID)
+}
+
+// DeleteDevice 删除设备，仍有采集任务引用时返回ErrConflict
+func (s *InventoryService) DeleteDevice(ctx context.Context, id string) error {
+	if err := s.checkNoTasks(ctx, id); err != nil {
+		return err
+	}
+	res, err := s.db.ExecContext(ctx, `DELETE FROM devices WHERE id = $1`, id)
+	return checkAffected(res, err, "device", id)
+}
+
+// ChangeLifecycle 变更设备生命周期状态并记录变更
+// 退役前需先删除引用该设备的采集任务
+func (s *InventoryService) ChangeLifecycle(ctx context.Context, id string, req *ChangeLifecycleRequest, actor string) (*Device, error) {
+	if req.State == LifecycleRetired {
+		if err := s.checkNoTasks(ctx, id); err != nil {
+			return nil, err
+		}
+	}
+
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		current, err := getDevice(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if current.State == req.State {
+			return nil
+		}
+
+		if !containsString(lifecycleTransitions[current.State], req.State) {
+			errs := &ValidationError{}
+			errs.Add("state", "cannot change lifecycle state from %s to %s", current.State, req.State)
+			return errs
+		}
+
+		next := *current
+		next.State = req.State
+		if err := next.validate(); err != nil {
+			return err
+		}
+
+		now := time.Now().Unix()
+		res, err := tx.ExecContext(ctx,
+			`UPDATE devices SET lifecycle_state = $2, updated_at = $3 WHERE id = $1 AND lifecycle_state = $4`,
+			id, req.State, now, current.State)
+		if err := checkAffected(res, err, "device", id); err != nil {
+			return err
+		}
+
+		return insertLifecycleEvent(ctx, tx, &LifecycleEvent{
+			DeviceID:  id,
+			FromState: current.State,
+			ToState:   req.State,
+			Actor:     actor,
+			Comment:   req.Comment,
+			CreatedAt: now,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetDevice(ctx, id)
+}
+
+// ListLifecycleEvents 查询设备生命周期变更记录
+func (s *InventoryService) ListLifecycleEvents(ctx context.Context, deviceID string) ([]*LifecycleEvent, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT device_id, from_state, to_state, actor, comment, created_at
+		FROM device_lifecycle_events WHERE device_id = $1 ORDER BY created_at`, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := make([]*LifecycleEvent, 0)
+	for rows.Next() {
+		var e LifecycleEvent
+		if err := rows.Scan(&e.DeviceID, &e.FromState, &e.ToState, &e.Actor, &e.Comment, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		events = append(events, &e)
+	}
+	return events, rows.Err()
+}
+
+const deviceColumns = `d.id, d.name, d.device_type, d.vendor, d.model, d.serial_number, d.ip, d.rack_id, d.u_position,
+	d.u_height, d.rated_power_w, d.weight_kg, d.lifecycle_state, d.created_at, d.updated_at`
+
+// scanDevice 读取设备记录
+func scanDevice(row interface {
+	Scan(dest ...interface{}) error
+}) (*Device, error) {
+	var (
+		device    Device
+		rackID    sql.NullString
+		uPosition sql.NullInt64
+	)
+	err := row.Scan(&device.ID, &device.Name, &device.DeviceType, &device.Vendor, &device.Model,
+		&device.SerialNumber, &device.IP, &rackID, &uPosition, &device.UHeight,
+		&device.RatedPowerW, &device.WeightKg, &device.State, &device.CreatedAt, &device.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	device.RackID = rackID.String
+	device.UPosition = int(uPosition.Int64)
+	return &device, nil
+}
+
+// getDevice 查询设备
+func getDevice(ctx context.Context, q querier, id string) (*Device, error) {
+	device, err := scanDevice(q.QueryRowContext(ctx, `SELECT `+deviceColumns+` FROM devices d WHERE d.id = $1`, id))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("device %s %w", id, ErrNotFound)
+	}
+	return device, err
+}
+
+// lockRack 锁定机柜行，串行化同一机柜的上架操作
+// 使用空更新而不是SELECT ... FOR UPDATE，机柜不存在时返回字段错误
+func lockRack(ctx context.Context, tx *sql.Tx, rackID string) error {
+	res, err := tx.ExecContext(ctx, `UPDATE racks SET updated_at = updated_at WHERE id = $1`, rackID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		errs := &ValidationError{}
+		errs.Add("rack_id", "rack %s not found", rackID)
+		return errs
+	}
+	return nil
+}
+
+// checkPlacement 校验设备占用的U位在机柜范围内且不与其他设备重叠（退役设备不占用U位）
+func checkPlacement(ctx context.Context, tx *sql.Tx, device *Device) error {
+	if device.RackID == "" {
+		return nil
+	}
+	if err := lockRack(ctx, tx, device.RackID); err != nil {
+		return err
+	}
+	if device.UPosition == 0 {
+		return nil
+	}
+
+	var rackHeight int
+	if err := tx.QueryRowContext(ctx, `SELECT u_height FROM racks WHERE id = $1`, device.RackID).Scan(&rackHeight); err != nil {
+		return err
+	}
+
+	top := device.UPosition + device.UHeight - 1
+	if top > rackHeight {
+		errs := &ValidationError{}
+		errs.Add("u_position", "device occupies U%d-U%d but rack %s has %dU", device.UPosition, top, device.RackID, rackHeight)
+		return errs
+	}
+
+	var (
+		otherID     string
+		otherPos    int
+		otherHeight int
+	)
+	err := tx.QueryRowContext(ctx,
+		`SELECT id, u_position, u_height FROM devices
+		WHERE rack_id = $1 AND id <> $2 AND lifecycle_state <> $3 AND u_position IS NOT NULL
+			AND u_position <= $4 AND u_position + u_height - 1 >= $5
+		ORDER BY u_position LIMIT 1`,
+		device.RackID, device.ID, LifecycleRetired, top, device.UPosition).Scan(&otherID, &otherPos, &otherHeight)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	errs := &ValidationError{}
+	errs.Add("u_position", "U%d-U%d overlaps device %s at U%d-U%d",
+		device.UPosition, top, otherID, otherPos, otherPos+otherHeight-1)
+	return errs
+}
+
+// insertLifecycleEvent 写入生命周期变更记录
+func insertLifecycleEvent(ctx context.Context, tx *sql.Tx, e *LifecycleEvent) error {
+	_, err := tx.ExecContext(ctx,
+		`INSERT INTO device_lifecycle_events (device_id, from_state, to_state, actor, comment, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)`,
+		e.DeviceID, e.FromState, e.ToState, e.Actor, e.Comment, e.CreatedAt)
+	return err
+}
+
+// checkNoTasks 校验设备没有被采集任务引用
+func (s *InventoryService) checkNoTasks(ctx context.Context, deviceID string) error {
+	n, err := s.redis.SCard(ctx, deviceTasksKey(deviceID)).Result()
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return fmt.Errorf("device %s is referenced by %d tasks: %w", deviceID, n, ErrConflict)
+	}
+	return nil
+}
+
+// withTx 在事务中执行fn，fn返回错误时回滚
+func (s *InventoryService) withTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// checkNotExists 校验记录不存在
+func (s *InventoryService) checkNotExists(ctx context.Context, q querier, table, kind, id string) error {
+	var n int
+	if err := q.QueryRowContext(ctx, `SELECT COUNT(*) FROM `+table+` WHERE id = $1`, id).Scan(&n); err != nil {
+		return err
+	}
+	if n > 0 {
+		return fmt.Errorf("%s %s already exists: %w", kind, id, ErrConflict)
+	}
+	return nil
+}
+
+// checkParent 校验上级记录存在
+func (s *InventoryService) checkParent(ctx context.Context, table, field, id string) error {
+	var n int
+	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM `+table+` WHERE id = $1`, id).Scan(&n); err != nil {
+		return err
+	}
+	if n == 0 {
+		errs := &ValidationError{}
+		errs.Add(field, "%s not found", id)
+		return errs
+	}
+	return nil
+}
+
+// checkNoChildren 校验没有下级记录
+func (s *InventoryService) checkNoChildren(ctx context.Context, table, field, id, kind, children string) error {
+	var n int
+	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM `+table+` WHERE `+field+` = $1`, id).Scan(&n); err != nil {
+		return err
+	}
+	if n > 0 {
+		return fmt.Errorf("%s %s still has %d %s: %w", kind, id, n, children, ErrConflict)
+	}
+	return nil
+}
+
+// checkAffected 根据影响行数判断记录是否存在
+func checkAffected(res sql.Result, err error, kind, id string) error {
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("%s %s %w", kind, id, ErrNotFound)
+	}
+	return nil
+}
+
+// lifecycleStates 返回所有生命周期状态
+func lifecycleStates() string {
+	return strings.Join([]string{LifecyclePlanned, LifecycleInstalled, LifecycleInService, LifecycleRetired}, "/")
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+func nullInt(n int) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(n), Valid: n != 0}
+}
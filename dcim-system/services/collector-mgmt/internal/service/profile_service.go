@@ -0,0 +1,415 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"gopkg.in/yaml.v3"
+)
+
+// profilesKey 设备模板Hash的key（模板ID -> 当前版本）
+const profilesKey = "profiles"
+
+// ProfileService 设备模板服务
+type ProfileService struct {
+	redis *redis.Client
+}
+
+// NewProfileService 创建设备模板服务
+func NewProfileService(redisClient *redis.Client) *ProfileService {
+	return &ProfileService{
+		redis: redisClient,
+	}
+}
+
+// MetricDefinition 指标定义
+type MetricDefinition struct {
+	Name     string  `json:"name" yaml:"name"`                               // 指标名称
+	Address  string  `json:"address" yaml:"address"`                         // OID或寄存器地址
+	Unit     string  `json:"unit,omitempty" yaml:"unit"`                     // 单位
+	Scale    float64 `json:"scale,omitempty" yaml:"scale"`                   // 缩放系数(实际值=原始值×scale)
+	DataType string  `json:"data_type,omitempty" yaml:"data_type,omitempty"` // 寄存器数据类型: int16/uint16/int32/float32等
+}
+
+// DeviceProfile 设备模板
+// 打包采集协议、指标定义和默认参数，任务通过profile_id引用并可覆盖部分参数
+type DeviceProfile struct {
+	ProfileID   string                 `json:"profile_id" yaml:"profile_id"`
+	Name        string                 `json:"name" yaml:"name"`
+	Vendor      string                 `json:"vendor" yaml:"vendor"`
+	Model       string                 `json:"model" yaml:"model"`
+	DeviceType  string                 `json:"device_type" yaml:"device_type"`
+	Protocol    string                 `json:"protocol" yaml:"protocol"`
+	Interval    int                    `json:"interval" yaml:"interval"` // 默认采集间隔(秒)
+	Config      map[string]interface{} `json:"config" yaml:"config"`     // 默认协议配置
+	Metrics     []MetricDefinition     `json:"metrics" yaml:"metrics"`
+	Description string                 `json:"description,omitempty" yaml:"description"`
+	Version     int                    `json:"version" yaml:"-"` // 每次修改自增
+	UpdatedAt   int64                  `json:"updated_at" yaml:"-"`
+}
+
+// Validate 校验模板定义，不合法时返回 *ValidationError
+func (p *DeviceProfile) Validate() error {
+	errs := &ValidationError{}
+
+	if p.ProfileID == "" {
+		errs.Add("profile_id", "is required")
+	}
+	if p.Name == "" {
+		errs.Add("name", "is required")
+	}
+	if p.Protocol == "" {
+		errs.Add("protocol", "is required")
+	} else if _, ok := protocolCapabilities[p.Protocol]; !ok {
+		errs.Add("protocol", "unsupported protocol %s, supported: %s", p.Protocol, supportedProtocols())
+	}
+	if p.Interval < 0 {
+		errs.Add("interval", "must be positive")
+	}
+	if len(p.Metrics) == 0 {
+		errs.Add("metrics", "at least one metric is required")
+	}
+
+	names := make(map[string]bool, len(p.Metrics))
+	for i, m := range p.Metrics {
+		if m.Name == "" || m.Address == "" {
+			errs.Add(fmt.Sprintf("metrics[%d]", i), "requires name and address")
+			continue
+		}
+		if names[m.Name] {
+			errs.Add(fmt.Sprintf("metrics[%d].name", i), "duplicate metric name %s", m.Name)
+		}
+		names[m.Name] = true
+	}
+
+	return errs.Err()
+}
+
+// ProfileInUseError 模板仍被任务引用，不能删除
+type ProfileInUseError struct {
+	ProfileID string
+	TaskCount int64
+}
+
+func (e *ProfileInUseError) Error() string {
+	return fmt.Sprintf("profile %s is still referenced by %d tasks", e.ProfileID, e.TaskCount)
+}
+
+// Unwrap 按资源冲突处理
+func (e *ProfileInUseError) Unwrap() error {
+	return ErrConflict
+}
+
+// Get 查询模板，version为0时返回当前版本
+func (s *ProfileService) Get(ctx context.Context, profileID string, version int) (*DeviceProfile, error) {
+	return loadProfile(ctx, s.redis, profileID, version)
+}
+
+// loadProfile 从Redis读取模板，c可以是事务中的连接
+func loadProfile(ctx context.Context, c redis.Cmdable, profileID string, version int) (*DeviceProfile, error) {
+	var (
+		data string
+		err  error
+	)
+	if version == 0 {
+		data, err = c.HGet(ctx, profilesKey, profileID).Result()
+	} else {
+		data, err = c.HGet(ctx, profileHistoryKey(profileID), strconv.Itoa(version)).Result()
+	}
+	if err != nil {
+		if err == redis.Nil {
+			return nil, fmt.Errorf("profile %s (version %d) %w", profileID, version, ErrNotFound)
+		}
+		return nil, err
+	}
+
+	var profile DeviceProfile
+	if err := json.Unmarshal([]byte(data), &profile); err != nil {
+		return nil, err
+	}
+
+	return &profile, nil
+}
+
+// List 查询所有模板的当前版本
+func (s *ProfileService) List(ctx context.Context) ([]*DeviceProfile, error) {
+	values, err := s.redis.HVals(ctx, profilesKey).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	profiles := make([]*DeviceProfile, 0, len(values))
+	for _, v := range values {
+		var profile DeviceProfile
+		if err := json.Unmarshal([]byte(v), &profile); err != nil {
+			continue
+		}
+		profiles = append(profiles, &profile)
+	}
+
+	sort.Slice(profiles, func(i, j int) bool { return profiles[i].ProfileID < profiles[j].ProfileID })
+
+	return profiles, nil
+}
+
+// History 查询模板的所有历史版本
+func (s *ProfileService) History(ctx context.Context, profileID string) ([]*DeviceProfile, error) {
+	values, err := s.redis.HVals(ctx, profileHistoryKey(profileID)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	profiles := make([]*DeviceProfile, 0, len(values))
+	for _, v := range values {
+		var profile DeviceProfile
+		if err := json.Unmarshal([]byte(v), &profile); err != nil {
+			continue
+		}
+		profiles = append(profiles, &profile)
+	}
+
+	sort.Slice(profiles, func(i, j int) bool { return profiles[i].Version < profiles[j].Version })
+
+	return profiles, nil
+}
+
+// Save 保存模板并生成新版本
+// 内容与当前版本相同时不生成新版本，返回的changed为false。
+// 以乐观锁方式保存：WATCH模板的历史版本key（每次保存和删除都会修改），并发保存时重试，避免生成相同的版本号
+func (s *ProfileService) Save(ctx context.Context, profile *DeviceProfile) (bool, error) {
+	if err := profile.Validate(); err != nil {
+		return false, err
+	}
+
+	var changed bool
+	txf := func(tx *redis.Tx) error {
+		current, err := loadProfile(ctx, tx, profile.ProfileID, 0)
+		if err != nil && !isNotFound(err) {
+			return err
+		}
+
+		if current != nil {
+			profile.Version = current.Version
+			profile.UpdatedAt = current.UpdatedAt
+			if profileEqual(current, profile) {
+				changed = false
+				return nil
+			}
+			profile.Version = current.Version + 1
+		} else {
+			profile.Version = 1
+		}
+		profile.UpdatedAt = time.Now().Unix()
+
+		data, err := json.Marshal(profile)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.HSet(ctx, profilesKey, profile.ProfileID, data)
+			pipe.HSet(ctx, profileHistoryKey(profile.ProfileID), strconv.Itoa(profile.Version), data)
+			return nil
+		})
+		changed = true
+		return err
+	}
+
+	for i := 0; i < maxTaskTxRetries; i++ {
+		err := s.redis.Watch(ctx, txf, profileHistoryKey(profile.ProfileID))
+		if err == redis.TxFailedErr {
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+		return changed, nil
+	}
+
+	return false, fmt.Errorf("profile %s was modified concurrently: %w", profile.ProfileID, ErrConflict)
+}
+
+// Delete 删除模板及其历史版本，仍被任务引用时返回 *ProfileInUseError
+// WATCH引用模板的任务集合，检查引用后有任务引用该模板时重试
+func (s *ProfileService) Delete(ctx context.Context, profileID string) error {
+	tasksKey := profileTasksKey(profileID)
+
+	txf := func(tx *redis.Tx) error {
+		count, err := tx.SCard(ctx, tasksKey).Result()
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return &ProfileInUseError{ProfileID: profileID, TaskCount: count}
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.HDel(ctx, profilesKey, profileID)
+			pipe.Del(ctx, profileHistoryKey(profileID))
+			return nil
+		})
+		return err
+	}
+
+	for i := 0; i < maxTaskTxRetries; i++ {
+		err := s.redis.Watch(ctx, txf, tasksKey)
+		if err == redis.TxFailedErr {
+			continue
+		}
+		return err
+	}
+
+	return fmt.Errorf("profile %s was modified concurrently: %w", profileID, ErrConflict)
+}
+
+// checkProfileExists 在WATCH事务中校验任务引用的模板存在
+// 同时WATCH模板的历史版本key，模板在提交前被删除时事务失败
+func checkProfileExists(ctx context.Context, tx *redis.Tx, profileID string) error {
+	if err := tx.Watch(ctx, profileHistoryKey(profileID)).Err(); err != nil {
+		return err
+	}
+	exists, err := tx.HExists(ctx, profilesKey, profileID).Result()
+	if err != nil {
+		return err
+	}
+	if !exists {
+		errs := &ValidationError{}
+		errs.Add("profile_id", "profile %s not found", profileID)
+		return errs
+	}
+	return nil
+}
+
+// ParseProfiles 解析YAML模板定义，支持单个模板或模板列表
+func ParseProfiles(data []byte) ([]*DeviceProfile, error) {
+	var list []*DeviceProfile
+	if err := yaml.Unmarshal(data, &list); err == nil {
+		return list, nil
+	}
+
+	var single DeviceProfile
+	if err := yaml.Unmarshal(data, &single); err != nil {
+		return nil, fmt.Errorf("invalid profile yaml: %w", err)
+	}
+
+	return []*DeviceProfile{&single}, nil
+}
+
+// LoadProfileDir 读取目录下所有 *.yaml / *.yml 模板文件
+func LoadProfileDir(dir string) ([]*DeviceProfile, error) {
+	var files []string
+	for _, pattern := range []string{"*.yaml", "*.yml"} {
+		matches, err := filepath.Glob(filepath.Join(dir, pattern))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, matches...)
+	}
+	sort.Strings(files)
+
+	var profiles []*DeviceProfile
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		parsed, err := ParseProfiles(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		profiles = append(profiles, parsed...)
+	}
+
+	return profiles, nil
+}
+
+// Apply 使用模板填充任务的采集参数，overrides中的非空字段优先
+func (p *DeviceProfile) Apply(task *Task, overrides *TaskOverrides) {
+	task.ProfileID = p.ProfileID
+	task.ProfileVersion = p.Version
+	task.Protocol = p.Protocol
+
+	if task.DeviceType == "" {
+		task.DeviceType = p.DeviceType
+	}
+
+	task.Interval = p.Interval
+	if overrides.Interval > 0 {
+		task.Interval = overrides.Interval
+	}
+
+	config := make(map[string]interface{}, len(p.Config)+len(overrides.Config))
+	for k, v := range p.Config {
+		config[k] = v
+	}
+	for k, v := range overrides.Config {
+		config[k] = v
+	}
+	task.Config = config
+
+	// 覆盖的指标列表按指标名称从模板中筛选
+	defs := p.Metrics
+	if len(overrides.Metrics) > 0 {
+		wanted := make(map[string]bool, len(overrides.Metrics))
+		for _, name := range overrides.Metrics {
+			wanted[name] = true
+		}
+		defs = make([]MetricDefinition, 0, len(overrides.Metrics))
+		for _, m := range p.Metrics {
+			if wanted[m.Name] {
+				defs = append(defs, m)
+			}
+		}
+	}
+
+	task.MetricDefs = defs
+	task.Metrics = make([]string, 0, len(defs))
+	for _, m := range defs {
+		task.Metrics = append(task.Metrics, m.Address)
+	}
+}
+
+// unknownMetrics 返回模板中未定义的指标名称
+func (p *DeviceProfile) unknownMetrics(names []string) []string {
+	defined := make(map[string]bool, len(p.Metrics))
+	for _, m := range p.Metrics {
+		defined[m.Name] = true
+	}
+
+	var unknown []string
+	for _, name := range names {
+		if !defined[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	return unknown
+}
+
+// profileEqual 比较模板内容（忽略版本和更新时间）
+func profileEqual(a, b *DeviceProfile) bool {
+	x, y := *a, *b
+	x.Version, y.Version = 0, 0
+	x.UpdatedAt, y.UpdatedAt = 0, 0
+
+	dx, err1 := json.Marshal(x)
+	dy, err2 := json.Marshal(y)
+	return err1 == nil && err2 == nil && string(dx) == string(dy)
+}
+
+// profileHistoryKey 模板历史版本Hash的key
+func profileHistoryKey(profileID string) string {
+	return fmt.Sprintf("profile:history:%s", profileID)
+}
+
+// profileTasksKey 引用模板的任务集合的key
+func profileTasksKey(profileID string) string {
+	return fmt.Sprintf("profile:tasks:%s", profileID)
+}
@@ -0,0 +1,313 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// assignmentActor 自动分配和故障转移写入修订记录的操作人
+const assignmentActor = "assignment"
+
+// RebalanceResult 任务重新分配结果
+type RebalanceResult struct {
+	FailedOver int `json:"failed_over"` // 从离线Agent转移出的任务数
+	Restored   int `json:"restored"`    // 迁回已恢复Agent的任务数
+	Stranded   int `json:"stranded"`    // 同机房没有可用Agent、仍留在离线Agent上的任务数
+}
+
+// assignAgent 为新任务选择Agent
+func (s *TaskService) assignAgent(ctx context.Context, req *AddTaskRequest) (string, error) {
+	agents, err := s.agents.ListAgents(ctx, "", "")
+	if err != nil {
+		return "", err
+	}
+	return s.pickAgent(ctx, agents, req, nil)
+}
+
+// pickAgent 从agents中为任务选择Agent，选中的Agent任务数加1以便连续分配时均衡负载
+// 位置优先取请求中的data_center/room，其次取设备台账中设备所在机柜的位置；
+// 依次在同机房、同数据中心、全部在线Agent中选择负载最低、且未采集该设备的一个，
+// 请求中指定data_center时只在该数据中心内选择。
+// taken记录本批次已分配的"Agent/设备"，可为nil
+func (s *TaskService) pickAgent(ctx context.Context, agents []*AgentStatus, req *AddTaskRequest, taken map[string]bool) (string, error) {
+	dataCenter, room := req.DataCenter, req.Room
+	if dataCenter == "" && room == "" {
+		var err error
+		dataCenter, room, err = s.deviceLocation(ctx, req.DeviceID)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	for _, tier := range []func(a *AgentStatus) bool{
+		func(a *AgentStatus) bool {
+			return room != "" && a.Room == room && (dataCenter == "" || a.DataCenter == dataCenter)
+		},
+		func(a *AgentStatus) bool { return dataCenter != "" && a.DataCenter == dataCenter },
+		func(a *AgentStatus) bool { return req.DataCenter == "" },
+	} {
+		for _, agent := range leastLoaded(agents, tier) {
+			if taken[agent.AgentID+"/"+req.DeviceID] {
+				continue
+			}
+			owner, err := s.redis.HGet(ctx, agentDevicesKey(agent.AgentID), req.DeviceID).Result()
+			if err != nil && err != redis.Nil {
+				return "", err
+			}
+			if owner == "" {
+				agent.TaskCount++
+				return agent.AgentID, nil
+			}
+		}
+	}
+
+	errs := &ValidationError{}
+	errs.Add("agent_id", "no online agent available for automatic assignment")
+	return "", errs
+}
+
+// deviceLocation 查询设备在台账中的数据中心和机房，未启用台账或设备未上架时返回空
+func (s *TaskService) deviceLocation(ctx context.Context, deviceID string) (string, string, error) {
+	if s.inventory == nil {
+		return "", "", nil
+	}
+
+	return s.inventory.DeviceLocation(ctx, deviceID)
+}
+
+// Rebalance 重新分配任务
+// 离线超过gracePeriod的Agent的任务转移到同机房负载最低的在线Agent，并记录原Agent；
+// 原Agent恢复在线后，转移出去的任务迁回
+func (s *TaskService) Rebalance(ctx context.Context, gracePeriod time.Duration) (*RebalanceResult, error) {
+	agents, err := s.agents.ListAgents(ctx, "", "")
+	if err != nil {
+		return nil, err
+	}
+
+	result := &RebalanceResult{}
+	now := time.Now()
+	for _, agent := range agents {
+		if agent.Online {
+			restored, err := s.restoreTasks(ctx, agent.AgentID)
+			result.Restored += restored
+			if err != nil {
+				return result, err
+			}
+			continue
+		}
+
+		offlineSince := time.Unix(agent.LastHeartbeat, 0).Add(s.agents.offlineAfter)
+		if now.Sub(offlineSince) < gracePeriod {
+			continue
+		}
+		moved, stranded, err := s.failoverTasks(ctx, agent, agents)
+		result.FailedOver += moved
+		result.Stranded += stranded
+		if err != nil {
+			return result, err
+		}
+	}
+
+	return result, nil
+}
+
+// failoverTasks 将离线Agent的任务转移到同机房的在线Agent
+func (s *TaskService) failoverTasks(ctx context.Context, offline *AgentStatus, agents []*AgentStatus) (int, int, error) {
+	taskIDs, err := s.redis.ZRange(ctx, agentTasksKey(offline.AgentID), 0, -1).Result()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	sameRoom := func(a *AgentStatus) bool {
+		return a.Room == offline.Room && a.DataCenter == offline.DataCenter
+	}
+
+	moved, stranded := 0, 0
+	for _, taskID := range taskIDs {
+		task, err := s.getTask(ctx, taskKey(offline.AgentID, taskID))
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			return moved, stranded, err
+		}
+
+		home := task.HomeAgentID
+		if home == "" {
+			home = offline.AgentID
+		}
+
+		target := ""
+		for _, agent := range leastLoaded(agents, sameRoom) {
+			if agent.AgentID == home {
+				continue
+			}
+			err := s.moveTask(ctx, task, agent.AgentID, home)
+			if errors.Is(err, ErrConflict) {
+				continue
+			}
+			if err != nil {
+				return moved, stranded, err
+			}
+			target = agent.AgentID
+			agent.TaskCount++
+			break
+		}
+
+		if target == "" {
+			stranded++
+			continue
+		}
+		moved++
+	}
+
+	return moved, stranded, nil
+}
+
+// restoreTasks 将转移出去的任务迁回已恢复的Agent
+func (s *TaskService) restoreTasks(ctx context.Context, agentID string) (int, error) {
+	keys, err := s.redis.SMembers(ctx, agentFailoverKey(agentID)).Result()
+	if err != nil {
+		return 0, err
+	}
+	sort.Strings(keys)
+
+	restored := 0
+	for _, key := range keys {
+		task, err := s.getTask(ctx, key)
+		if err == redis.Nil || (err == nil && task.HomeAgentID != agentID) {
+			s.redis.SRem(ctx, agentFailoverKey(agentID), key)
+			continue
+		}
+		if err != nil {
+			return restored, err
+		}
+
+		err = s.moveTask(ctx, task, agentID, "")
+		if errors.Is(err, ErrConflict) {
+			// 原Agent上已有同名任务或同一设备的任务，保留在当前Agent上
+			continue
+		}
+		if err != nil {
+			return restored, err
+		}
+		restored++
+	}
+
+	return restored, nil
+}
+
+// moveTask 将任务迁移到目标Agent，home为任务的原Agent（迁回时为空）
+// 目标Agent上已存在同ID任务或同一设备的任务时返回ErrConflict；修订历史随任务迁移
+func (s *TaskService) moveTask(ctx context.Context, task *Task, toAgent, home string) error {
+	fromKey := taskKey(task.AgentID, task.TaskID)
+	toKey := taskKey(toAgent, task.TaskID)
+	fromRevisions := taskRevisionsKey(task.AgentID, task.TaskID)
+	toRevisions := taskRevisionsKey(toAgent, task.TaskID)
+	dataCenter, err := s.AgentDataCenter(ctx, toAgent)
+	if err != nil {
+		return err
+	}
+
+	txf := func(tx *redis.Tx) error {
+		current, err := loadTask(ctx, tx, fromKey)
+		if err == redis.Nil {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if n, err := tx.Exists(ctx, toKey).Result(); err != nil {
+			return err
+		} else if n > 0 {
+			return fmt.Errorf("task %s already exists on agent %s: %w", task.TaskID, toAgent, ErrConflict)
+		}
+		owner, err := tx.HGet(ctx, agentDevicesKey(toAgent), current.DeviceID).Result()
+		if err != nil && err != redis.Nil {
+			return err
+		}
+		if owner != "" {
+			return fmt.Errorf("device %s is already collected by task %s on agent %s: %w", current.DeviceID, owner, toAgent, ErrConflict)
+		}
+
+		revisions, err := tx.HGetAll(ctx, fromRevisions).Result()
+		if err != nil {
+			return err
+		}
+
+		moved := *current
+		moved.AgentID = toAgent
+		moved.HomeAgentID = home
+		moved.Version = current.Version + 1
+		moved.UpdatedAt = time.Now().Unix()
+		moved.UpdatedBy = assignmentActor
+
+		rev := &TaskRevision{
+			Version:   moved.Version,
+			Action:    TaskActionReassign,
+			Actor:     assignmentActor,
+			Timestamp: moved.UpdatedAt,
+			Changes:   diffTasks(current, &moved),
+			Task:      &moved,
+		}
+
+		data, err := json.Marshal(&moved)
+		if err != nil {
+			return err
+		}
+		revData, err := json.Marshal(rev)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			unindexTask(ctx, pipe, current)
+			pipe.Del(ctx, fromKey, fromRevisions)
+			pipe.Set(ctx, toKey, data, 0)
+			indexTask(ctx, pipe, &moved)
+			for version, value := range revisions {
+				pipe.HSet(ctx, toRevisions, version, value)
+			}
+			pipe.HSet(ctx, toRevisions, strconv.Itoa(moved.Version), revData)
+			return appendAudit(ctx, pipe, taskAudit(rev, toAgent, moved.TaskID, dataCenter))
+		})
+		return err
+	}
+
+	for i := 0; i < maxTaskTxRetries; i++ {
+		err := s.redis.Watch(ctx, txf, fromKey, toKey, agentDevicesKey(toAgent))
+		if err == redis.TxFailedErr {
+			continue
+		}
+		return err
+	}
+
+	return fmt.Errorf("task %s was modified concurrently: %w", task.TaskID, ErrConflict)
+}
+
+// leastLoaded 返回满足条件的在线Agent，按负载从低到高排序
+func leastLoaded(agents []*AgentStatus, match func(a *AgentStatus) bool) []*AgentStatus {
+	var candidates []*AgentStatus
+	for _, agent := range agents {
+		if agent.Online && match(agent) {
+			candidates = append(candidates, agent)
+		}
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		li, lj := candidates[i].Load(), candidates[j].Load()
+		if li != lj {
+			return li < lj
+		}
+		return candidates[i].AgentID < candidates[j].AgentID
+	})
+	return candidates
+}
@@ -0,0 +1,551 @@
+package service
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"gopkg.in/yaml.v3"
+)
+
+// 批量导入导出格式
+const (
+	TaskFormatCSV  = "csv"
+	TaskFormatYAML = "yaml"
+)
+
+// TaskRecord 批量导入导出的任务记录
+// 引用模板的任务导出profile_id和覆盖项（interval/metrics/config），不导出protocol；
+// CSV中metrics以分号分隔，config为JSON对象
+type TaskRecord struct {
+	AgentID    string                 `json:"agent_id" yaml:"agent_id,omitempty"` // 为空时自动分配
+	TaskID     string                 `json:"task_id" yaml:"task_id"`
+	DeviceID   string                 `json:"device_id" yaml:"device_id"`
+	DeviceIP   string                 `json:"device_ip" yaml:"device_ip"`
+	DeviceType string                 `json:"device_type" yaml:"device_type,omitempty"`
+	ProfileID  string                 `json:"profile_id" yaml:"profile_id,omitempty"`
+	Protocol   string                 `json:"protocol" yaml:"protocol,omitempty"`
+	Mode       string                 `json:"mode" yaml:"mode,omitempty"`
+	Interval   int                    `json:"interval" yaml:"interval,omitempty"`
+	CronExpr   string                 `json:"cron_expr" yaml:"cron_expr,omitempty"`
+	Status     string                 `json:"status" yaml:"status,omitempty"`
+	Metrics    []string               `json:"metrics" yaml:"metrics,omitempty"`
+	Config     map[string]interface{} `json:"config" yaml:"config,omitempty"`
+	DataCenter string                 `json:"data_center" yaml:"data_center,omitempty"` // 仅用于自动分配
+	Room       string                 `json:"room" yaml:"room,omitempty"`               // 仅用于自动分配
+}
+
+// taskRecordColumns CSV列，导出时按此顺序输出，导入时按表头识别（可省略部分列）
+var taskRecordColumns = []string{
+	"agent_id", "task_id", "device_id", "device_ip", "device_type", "profile_id", "protocol", "mode",
+	"interval", "cron_expr", "status", "metrics", "config", "data_center", "room",
+}
+
+// taskRecordFile YAML文件结构
+type taskRecordFile struct {
+	Tasks []TaskRecord `yaml:"tasks"`
+}
+
+// ImportRowError 导入记录的校验错误，row从1开始（CSV不含表头）
+type ImportRowError struct {
+	Row     int          `json:"row"`
+	AgentID string       `json:"agent_id,omitempty"`
+	TaskID  string       `json:"task_id,omitempty"`
+	Fields  []FieldError `json:"fields"`
+}
+
+// ImportResult 批量导入结果
+// 存在校验错误时不写入任何任务；dry_run时只校验并统计将要创建/更新的任务数
+type ImportResult struct {
+	DryRun    bool             `json:"dry_run"`
+	Applied   bool             `json:"applied"`
+	Total     int              `json:"total"`
+	Created   int              `json:"created"`
+	Updated   int              `json:"updated"`
+	Unchanged int              `json:"unchanged"`
+	Errors    []ImportRowError `json:"errors"`
+}
+
+// importPlan 待写入的任务
+type importPlan struct {
+	task    *Task
+	current *Task // 导入前的任务，新建时为nil
+	changes []FieldChange
+}
+
+// ParseTaskRecords 解析CSV或YAML格式的任务记录，格式错误时返回 *ValidationError
+func ParseTaskRecords(format string, r io.Reader) ([]TaskRecord, error) {
+	switch format {
+	case TaskFormatCSV:
+		return parseTaskCSV(r)
+	case TaskFormatYAML:
+		var file taskRecordFile
+		if err := yaml.NewDecoder(r).Decode(&file); err != nil && err != io.EOF {
+			errs := &ValidationError{}
+			errs.Add("body", "invalid YAML: %v", err)
+			return nil, errs
+		}
+		return file.Tasks, nil
+	}
+
+	errs := &ValidationError{}
+	errs.Add("format", "unsupported format %q, expected csv or yaml", format)
+	return nil, errs
+}
+
+// parseTaskCSV 解析CSV任务记录，第一行为表头
+func parseTaskCSV(r io.Reader) ([]TaskRecord, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	errs := &ValidationError{}
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		errs.Add("body", "invalid CSV: %v", err)
+		return nil, errs
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		name = strings.TrimSpace(name)
+		if !containsString(taskRecordColumns, name) {
+			errs.Add("header", "unknown column %q", name)
+			continue
+		}
+		columns[name] = i
+	}
+	if err := errs.Err(); err != nil {
+		return nil, err
+	}
+
+	var records []TaskRecord
+	for row := 1; ; row++ {
+		fields, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			errs.Add(fmt.Sprintf("rows[%d]", row), "invalid CSV: %v", err)
+			return nil, errs
+		}
+
+		get := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(fields) {
+				return strings.TrimSpace(fields[i])
+			}
+			return ""
+		}
+
+		record := TaskRecord{
+			AgentID:    get("agent_id"),
+			TaskID:     get("task_id"),
+			DeviceID:   get("device_id"),
+			DeviceIP:   get("device_ip"),
+			DeviceType: get("device_type"),
+			ProfileID:  get("profile_id"),
+			Protocol:   get("protocol"),
+			Mode:       get("mode"),
+			CronExpr:   get("cron_expr"),
+			Status:     get("status"),
+			DataCenter: get("data_center"),
+			Room:       get("room"),
+		}
+		if v := get("interval"); v != "" {
+			interval, err := strconv.Atoi(v)
+			if err != nil {
+				errs.Add(fmt.Sprintf("rows[%d].interval", row), "invalid integer %q", v)
+			}
+			record.Interval = interval
+		}
+		if v := get("metrics"); v != "" {
+			for _, m := range strings.Split(v, ";") {
+				if m = strings.TrimSpace(m); m != "" {
+					record.Metrics = append(record.Metrics, m)
+				}
+			}
+		}
+		if v := get("config"); v != "" {
+			if err := json.Unmarshal([]byte(v), &record.Config); err != nil {
+				errs.Add(fmt.Sprintf("rows[%d].config", row), "invalid JSON object: %v", err)
+			}
+		}
+		records = append(records, record)
+	}
+
+	return records, errs.Err()
+}
+
+// WriteTaskRecords 按CSV或YAML格式输出任务记录
+func WriteTaskRecords(format string, w io.Writer, records []TaskRecord) error {
+	switch format {
+	case TaskFormatYAML:
+		if records == nil {
+			records = []TaskRecord{}
+		}
+		encoder := yaml.NewEncoder(w)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(&taskRecordFile{Tasks: records}); err != nil {
+			return err
+		}
+		return encoder.Close()
+	case TaskFormatCSV:
+		writer := csv.NewWriter(w)
+		if err := writer.Write(taskRecordColumns); err != nil {
+			return err
+		}
+		for _, record := range records {
+			config := ""
+			if len(record.Config) > 0 {
+				data, err := json.Marshal(record.Config)
+				if err != nil {
+					return err
+				}
+				config = string(data)
+			}
+			interval := ""
+			if record.Interval > 0 {
+				interval = strconv.Itoa(record.Interval)
+			}
+			if err := writer.Write([]string{
+				record.AgentID, record.TaskID, record.DeviceID, record.DeviceIP, record.DeviceType,
+				record.ProfileID, record.Protocol, record.Mode, interval, record.CronExpr, record.Status,
+				strings.Join(record.Metrics, ";"), config, record.DataCenter, record.Room,
+			}); err != nil {
+				return err
+			}
+		}
+		writer.Flush()
+		return writer.Error()
+	}
+
+	errs := &ValidationError{}
+	errs.Add("format", "unsupported format %q, expected csv or yaml", format)
+	return errs
+}
+
+// ImportTasks 批量导入任务：不存在的任务新建，已存在的任务更新
+// 先逐条校验（与单个添加任务的校验一致，另外检查文件内任务ID和设备重复），
+// 全部通过且非dryRun时在一个Redis事务中写入；导入期间任务被并发修改时返回ErrConflict
+func (s *TaskService) ImportTasks(ctx context.Context, records []TaskRecord, dryRun bool, actor string) (*ImportResult, error) {
+	result := &ImportResult{DryRun: dryRun, Total: len(records), Errors: make([]ImportRowError, 0)}
+
+	var agents []*AgentStatus
+	seenTasks := make(map[string]int)
+	takenDevices := make(map[string]bool)
+	deviceRows := make(map[string]int)
+	plans := make([]*importPlan, 0, len(records))
+
+	for i := range records {
+		row := i + 1
+		record := &records[i]
+		req := &AddTaskRequest{
+			AgentID:    record.AgentID,
+			TaskID:     record.TaskID,
+			DataCenter: record.DataCenter,
+			Room:       record.Room,
+			TaskSpec: TaskSpec{
+				DeviceID:   record.DeviceID,
+				DeviceIP:   record.DeviceIP,
+				DeviceType: record.DeviceType,
+				ProfileID:  record.ProfileID,
+				Protocol:   record.Protocol,
+				Mode:       record.Mode,
+				Interval:   record.Interval,
+				Metrics:    record.Metrics,
+				Config:     record.Config,
+				CronExpr:   record.CronExpr,
+				Status:     record.Status,
+			},
+		}
+
+		plan, err := s.planImport(ctx, req, &agents, seenTasks, deviceRows, takenDevices, row)
+		var validationErr *ValidationError
+		if errors.As(err, &validationErr) {
+			result.Errors = append(result.Errors, ImportRowError{
+				Row:     row,
+				AgentID: req.AgentID,
+				TaskID:  req.TaskID,
+				Fields:  validationErr.Fields,
+			})
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case plan.current == nil:
+			result.Created++
+		case len(plan.changes) == 0:
+			result.Unchanged++
+			continue
+		default:
+			result.Updated++
+		}
+		plans = append(plans, plan)
+	}
+
+	if len(result.Errors) > 0 || dryRun {
+		return result, nil
+	}
+
+	if err := s.applyImport(ctx, plans, actor); err != nil {
+		return nil, err
+	}
+	result.Applied = true
+	return result, nil
+}
+
+// planImport 校验一条导入记录并生成写入计划
+func (s *TaskService) planImport(ctx context.Context, req *AddTaskRequest, agents *[]*AgentStatus,
+	seenTasks, deviceRows map[string]int, takenDevices map[string]bool, row int) (*importPlan, error) {
+	errs := &ValidationError{}
+	if req.TaskID == "" {
+		errs.Add("task_id", "is required")
+	}
+	if req.DeviceID == "" {
+		errs.Add("device_id", "is required")
+	}
+	if req.DeviceIP == "" {
+		errs.Add("device_ip", "is required")
+	}
+	if err := errs.Err(); err != nil {
+		return nil, err
+	}
+
+	if req.AgentID == "" {
+		if *agents == nil {
+			list, err := s.agents.ListAgents(ctx, "", "")
+			if err != nil {
+				return nil, err
+			}
+			*agents = list
+		}
+		agentID, err := s.pickAgent(ctx, *agents, req, takenDevices)
+		if err != nil {
+			return nil, err
+		}
+		req.AgentID = agentID
+	}
+
+	key := taskKey(req.AgentID, req.TaskID)
+	if prev, ok := seenTasks[key]; ok {
+		errs.Add("task_id", "duplicate of row %d", prev)
+		return nil, errs
+	}
+	seenTasks[key] = row
+
+	device := req.AgentID + "/" + req.DeviceID
+	if prev, ok := deviceRows[device]; ok {
+		errs.Add("device_id", "device %s is already used by row %d on agent %s", req.DeviceID, prev, req.AgentID)
+		return nil, errs
+	}
+	deviceRows[device] = row
+	takenDevices[device] = true
+
+	task, err := s.buildTask(ctx, req.AgentID, req.TaskID, &req.TaskSpec)
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := s.getTask(ctx, key)
+	if err == redis.Nil {
+		return &importPlan{task: task}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	task.CreatedAt = current.CreatedAt
+	task.HomeAgentID = current.HomeAgentID
+	return &importPlan{task: task, current: current, changes: diffTasks(current, task)}, nil
+}
+
+// applyImport 在一个事务中写入所有任务，WATCH的任务在校验后被修改时返回ErrConflict
+func (s *TaskService) applyImport(ctx context.Context, plans []*importPlan, actor string) error {
+	if len(plans) == 0 {
+		return nil
+	}
+
+	keys := make([]string, 0, len(plans))
+	agentKeys := make(map[string]bool)
+	dataCenters := make(map[string]string)
+	for _, plan := range plans {
+		keys = append(keys, taskKey(plan.task.AgentID, plan.task.TaskID))
+		agentKeys[agentDevicesKey(plan.task.AgentID)] = true
+		if _, ok := dataCenters[plan.task.AgentID]; !ok {
+			dataCenter, err := s.AgentDataCenter(ctx, plan.task.AgentID)
+			if err != nil {
+				return err
+			}
+			dataCenters[plan.task.AgentID] = dataCenter
+		}
+	}
+	watched := append([]string{}, keys...)
+	for key := range agentKeys {
+		watched = append(watched, key)
+	}
+
+	txf := func(tx *redis.Tx) error {
+		for i, plan := range plans {
+			current, err := loadTask(ctx, tx, keys[i])
+			if err != nil && err != redis.Nil {
+				return err
+			}
+			if (current == nil) != (plan.current == nil) || (current != nil && current.Version != plan.current.Version) {
+				return fmt.Errorf("task %s on agent %s was modified during import: %w", plan.task.TaskID, plan.task.AgentID, ErrConflict)
+			}
+		}
+
+		now := time.Now().Unix()
+		_, err := tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			for i, plan := range plans {
+				task := plan.task
+				task.Version = 1
+				if plan.current != nil {
+					task.Version = plan.current.Version + 1
+					unindexTask(ctx, pipe, plan.current)
+				}
+				task.UpdatedAt = now
+				task.UpdatedBy = actor
+
+				changes := plan.changes
+				if plan.current == nil {
+					changes = diffTasks(nil, task)
+				}
+				rev := &TaskRevision{
+					Version:   task.Version,
+					Action:    TaskActionImport,
+					Actor:     actor,
+					Timestamp: now,
+					Changes:   changes,
+					Task:      task,
+				}
+
+				data, err := json.Marshal(task)
+				if err != nil {
+					return err
+				}
+				revData, err := json.Marshal(rev)
+				if err != nil {
+					return err
+				}
+
+				pipe.Set(ctx, keys[i], data, 0)
+				indexTask(ctx, pipe, task)
+				pipe.HSet(ctx, taskRevisionsKey(task.AgentID, task.TaskID), strconv.Itoa(task.Version), revData)
+				if err := appendAudit(ctx, pipe, taskAudit(rev, task.AgentID, task.TaskID, dataCenters[task.AgentID])); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		return err
+	}
+
+	err := s.redis.Watch(ctx, txf, watched...)
+	if err == redis.TxFailedErr {
+		return fmt.Errorf("tasks were modified during import: %w", ErrConflict)
+	}
+	return err
+}
+
+// ExportTasks 导出任务记录，agentID为空时导出所有Agent的任务
+func (s *TaskService) ExportTasks(ctx context.Context, agentID string) ([]TaskRecord, error) {
+	var keys []string
+	if agentID != "" {
+		taskIDs, err := s.redis.ZRange(ctx, agentTasksKey(agentID), 0, -1).Result()
+		if err != nil {
+			return nil, err
+		}
+		for _, taskID := range taskIDs {
+			keys = append(keys, taskKey(agentID, taskID))
+		}
+	} else {
+		var cursor uint64
+		for {
+			batch, next, err := s.redis.Scan(ctx, cursor, "task:*", taskScanCount).Result()
+			if err != nil {
+				return nil, err
+			}
+			keys = append(keys, batch...)
+			cursor = next
+			if cursor == 0 {
+				break
+			}
+		}
+	}
+
+	tasks, err := s.getTasks(ctx, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]TaskRecord, 0, len(tasks))
+	for _, task := range tasks {
+		if task != nil {
+			records = append(records, taskRecord(task))
+		}
+	}
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].AgentID != records[j].AgentID {
+			return records[i].AgentID < records[j].AgentID
+		}
+		return records[i].TaskID < records[j].TaskID
+	})
+
+	return records, nil
+}
+
+// taskRecord 将任务转换为导出记录，重新导入后生成相同的任务
+func taskRecord(task *Task) TaskRecord {
+	record := TaskRecord{
+		AgentID:    task.AgentID,
+		TaskID:     task.TaskID,
+		DeviceID:   task.DeviceID,
+		DeviceIP:   task.DeviceIP,
+		DeviceType: task.DeviceType,
+		Mode:       task.Mode,
+		CronExpr:   task.CronExpr,
+		Status:     task.Status,
+	}
+
+	if task.ProfileID == "" {
+		record.Protocol = task.Protocol
+		record.Interval = task.Interval
+		record.Metrics = task.Metrics
+		record.Config = task.Config
+		return record
+	}
+
+	record.ProfileID = task.ProfileID
+	if task.Overrides != nil {
+		record.Interval = task.Overrides.Interval
+		record.Metrics = task.Overrides.Metrics
+		record.Config = task.Overrides.Config
+	}
+	return record
+}
+
+// DetectTaskFormat 根据Content-Type推断导入格式，无法识别时返回空
+func DetectTaskFormat(contentType string) string {
+	contentType = strings.ToLower(contentType)
+	switch {
+	case strings.Contains(contentType, "csv"):
+		return TaskFormatCSV
+	case strings.Contains(contentType, "yaml"), strings.Contains(contentType, "yml"):
+		return TaskFormatYAML
+	}
+	return ""
+}
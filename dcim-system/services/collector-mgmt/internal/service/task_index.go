@@ -0,0 +1,346 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// 任务数据保存在 task:<agent>:<task>，按Agent维护以下索引，查询时不再使用KEYS扫描：
+//   agent:tasks:<agent>                  全部任务ID（ZSET，score均为0，按任务ID字典序分页）
+//   agent:tasks:<agent>:<field>:<value>  按device_type/protocol/status筛选的任务ID（ZSET）
+//   agent:devices:<agent>                设备ID -> 任务ID（Hash，用于设备唯一性校验）
+//   device:tasks:<device>                引用台账设备的任务key（Set）
+//   agent:failover:<agent>               从该Agent转移出去、待迁回的任务key（Set）
+
+const (
+	// DefaultTaskPageSize 任务列表默认分页大小
+	DefaultTaskPageSize = 100
+	// MaxTaskPageSize 任务列表最大分页大小
+	MaxTaskPageSize = 1000
+
+	// taskIndexVersionKey 记录已构建的索引版本，版本变化时启动时重建索引
+	taskIndexVersionKey = "task_index:version"
+	taskIndexVersion    = 2
+	taskScanCount       = 500
+)
+
+// ListTasksRequest 查询任务列表请求
+type ListTasksRequest struct {
+	AgentID    string `form:"agent_id" binding:"required"`
+	DeviceType string `form:"device_type"`
+	Protocol   string `form:"protocol"`
+	Status     string `form:"status"`
+	Cursor     string `form:"cursor"` // 上一页返回的next_cursor，为空时从头查询
+	Limit      int    `form:"limit"`
+}
+
+// TaskPage 任务分页结果
+type TaskPage struct {
+	Tasks      []*Task `json:"tasks"`
+	NextCursor string  `json:"next_cursor,omitempty"` // 为空表示没有更多数据
+}
+
+// taskFilter 任务筛选条件
+type taskFilter struct {
+	field string
+	value string
+}
+
+// match 判断任务是否满足筛选条件
+func (f taskFilter) match(task *Task) bool {
+	switch f.field {
+	case "device_type":
+		return task.DeviceType == f.value
+	case "protocol":
+		return task.Protocol == f.value
+	case "status":
+		return task.Status == f.value
+	}
+	return false
+}
+
+// filters 返回请求中的筛选条件
+func (r *ListTasksRequest) filters() []taskFilter {
+	var filters []taskFilter
+	for _, f := range []taskFilter{
+		{field: "device_type", value: r.DeviceType},
+		{field: "protocol", value: r.Protocol},
+		{field: "status", value: r.Status},
+	} {
+		if f.value != "" {
+			filters = append(filters, f)
+		}
+	}
+	return filters
+}
+
+// ListTasks 分页查询任务列表
+// 有筛选条件时遍历第一个条件的索引，其余条件在读取任务后过滤
+func (s *TaskService) ListTasks(ctx context.Context, req *ListTasksRequest) (*TaskPage, error) {
+	limit := req.Limit
+	if limit <= 0 {
+		limit = DefaultTaskPageSize
+	}
+	if limit > MaxTaskPageSize {
+		limit = MaxTaskPageSize
+	}
+
+	filters := req.filters()
+	source := agentTasksKey(req.AgentID)
+	if len(filters) > 0 {
+		source = agentTaskFilterKey(req.AgentID, filters[0].field, filters[0].value)
+	}
+
+	min := "-"
+	if req.Cursor != "" {
+		min = "(" + req.Cursor
+	}
+
+	page := &TaskPage{Tasks: make([]*Task, 0, limit)}
+	for {
+		taskIDs, err := s.redis.ZRangeByLex(ctx, source, &redis.ZRangeBy{
+			Min:   min,
+			Max:   "+",
+			Count: int64(limit),
+		}).Result()
+		if err != nil {
+			return nil, err
+		}
+		if len(taskIDs) == 0 {
+			return page, nil
+		}
+
+		keys := make([]string, len(taskIDs))
+		for i, taskID := range taskIDs {
+			keys[i] = taskKey(req.AgentID, taskID)
+		}
+		tasks, err := s.getTasks(ctx, keys)
+		if err != nil {
+			return nil, err
+		}
+
+		for i, task := range tasks {
+			min = "(" + taskIDs[i]
+			if task == nil || !matchFilters(filters, task) {
+				continue
+			}
+
+			page.Tasks = append(page.Tasks, task)
+			if len(page.Tasks) == limit {
+				page.NextCursor = taskIDs[i]
+				return page, nil
+			}
+		}
+
+		if len(taskIDs) < limit {
+			return page, nil
+		}
+	}
+}
+
+// RebuildIndexes 使用SCAN遍历已有任务并重建索引（用于从旧版本升级），索引已是当前版本时跳过
+// 返回重建索引的任务数
+func (s *TaskService) RebuildIndexes(ctx context.Context) (int, error) {
+	version, err := s.redis.Get(ctx, taskIndexVersionKey).Int()
+	if err != nil && err != redis.Nil {
+		return 0, err
+	}
+	if err == nil && version >= taskIndexVersion {
+		return 0, nil
+	}
+
+	count := 0
+	var cursor uint64
+	for {
+		keys, next, err := s.redis.Scan(ctx, cursor, "task:*", taskScanCount).Result()
+		if err != nil {
+			return count, err
+		}
+
+		tasks, err := s.getTasks(ctx, keys)
+		if err != nil {
+			return count, err
+		}
+
+		pipe := s.redis.Pipeline()
+		for i, task := range tasks {
+			if task == nil {
+				continue
+			}
+			agentID, taskID, ok := parseTaskKey(keys[i])
+			if !ok {
+				continue
+			}
+
+			// 旧版本任务没有agent_id和状态字段，agent_id和task_id从key补全
+			if task.AgentID == "" || task.TaskID == "" || task.Status == "" {
+				if task.AgentID == "" {
+					task.AgentID = agentID
+				}
+				if task.TaskID == "" {
+					task.TaskID = taskID
+				}
+				if task.Status == "" {
+					task.Status = TaskStatusActive
+				}
+				data, err := json.Marshal(task)
+				if err != nil {
+					return count, err
+				}
+				pipe.Set(ctx, keys[i], data, 0)
+			}
+			indexTask(ctx, pipe, task)
+			count++
+		}
+		if _, err := pipe.Exec(ctx); err != nil {
+			return count, err
+		}
+
+		cursor = next
+		if cursor == 0 {
+			break
+		}
+	}
+
+	if err := s.redis.Set(ctx, taskIndexVersionKey, taskIndexVersion, 0).Err(); err != nil {
+		return count, err
+	}
+
+	return count, nil
+}
+
+// ListDeviceTasks 查询引用设备的采集任务
+func (s *TaskService) ListDeviceTasks(ctx context.Context, deviceID string) ([]*Task, error) {
+	keys, err := s.redis.SMembers(ctx, deviceTasksKey(deviceID)).Result()
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(keys)
+
+	tasks, err := s.getTasks(ctx, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*Task, 0, len(tasks))
+	for _, task := range tasks {
+		if task != nil {
+			result = append(result, task)
+		}
+	}
+	return result, nil
+}
+
+// getTasks 使用pipeline批量查询任务，不存在或无法解析的任务对应位置为nil
+func (s *TaskService) getTasks(ctx context.Context, keys []string) ([]*Task, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+
+	pipe := s.redis.Pipeline()
+	cmds := make([]*redis.StringCmd, len(keys))
+	for i, key := range keys {
+		cmds[i] = pipe.Get(ctx, key)
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	tasks := make([]*Task, len(keys))
+	for i, cmd := range cmds {
+		data, err := cmd.Bytes()
+		if err != nil {
+			continue
+		}
+
+		var task Task
+		if err := json.Unmarshal(data, &task); err != nil {
+			continue
+		}
+		tasks[i] = &task
+	}
+
+	return tasks, nil
+}
+
+// indexTask 将任务加入索引
+func indexTask(ctx context.Context, pipe redis.Pipeliner, task *Task) {
+	member := &redis.Z{Member: task.TaskID}
+	pipe.ZAdd(ctx, agentTasksKey(task.AgentID), member)
+	for _, f := range taskIndexFilters(task) {
+		pipe.ZAdd(ctx, agentTaskFilterKey(task.AgentID, f.field, f.value), member)
+	}
+	pipe.HSet(ctx, agentDevicesKey(task.AgentID), task.DeviceID, task.TaskID)
+	pipe.SAdd(ctx, deviceTasksKey(task.DeviceID), taskKey(task.AgentID, task.TaskID))
+	if task.ProfileID != "" {
+		pipe.SAdd(ctx, profileTasksKey(task.ProfileID), taskKey(task.AgentID, task.TaskID))
+	}
+	if task.HomeAgentID != "" {
+		pipe.SAdd(ctx, agentFailoverKey(task.HomeAgentID), taskKey(task.AgentID, task.TaskID))
+	}
+}
+
+// unindexTask 将任务移出索引
+func unindexTask(ctx context.Context, pipe redis.Pipeliner, task *Task) {
+	pipe.ZRem(ctx, agentTasksKey(task.AgentID), task.TaskID)
+	for _, f := range taskIndexFilters(task) {
+		pipe.ZRem(ctx, agentTaskFilterKey(task.AgentID, f.field, f.value), task.TaskID)
+	}
+	pipe.HDel(ctx, agentDevicesKey(task.AgentID), task.DeviceID)
+	pipe.SRem(ctx, deviceTasksKey(task.DeviceID), taskKey(task.AgentID, task.TaskID))
+	if task.ProfileID != "" {
+		pipe.SRem(ctx, profileTasksKey(task.ProfileID), taskKey(task.AgentID, task.TaskID))
+	}
+	if task.HomeAgentID != "" {
+		pipe.SRem(ctx, agentFailoverKey(task.HomeAgentID), taskKey(task.AgentID, task.TaskID))
+	}
+}
+
+// taskIndexFilters 返回任务所属的筛选索引
+func taskIndexFilters(task *Task) []taskFilter {
+	req := &ListTasksRequest{
+		DeviceType: task.DeviceType,
+		Protocol:   task.Protocol,
+		Status:     task.Status,
+	}
+	return req.filters()
+}
+
+// matchFilters 判断任务是否满足所有筛选条件
+func matchFilters(filters []taskFilter, task *Task) bool {
+	for _, f := range filters {
+		if !f.match(task) {
+			return false
+		}
+	}
+	return true
+}
+
+// agentTasksKey Agent任务索引的key
+func agentTasksKey(agentID string) string {
+	return fmt.Sprintf("agent:tasks:%s", agentID)
+}
+
+// agentTaskFilterKey Agent任务筛选索引的key
+func agentTaskFilterKey(agentID, field, value string) string {
+	return fmt.Sprintf("agent:tasks:%s:%s:%s", agentID, field, value)
+}
+
+// agentDevicesKey Agent设备索引的key（设备ID -> 任务ID）
+func agentDevicesKey(agentID string) string {
+	return fmt.Sprintf("agent:devices:%s", agentID)
+}
+
+// deviceTasksKey 引用台账设备的任务集合的key
+func deviceTasksKey(deviceID string) string {
+	return fmt.Sprintf("device:tasks:%s", deviceID)
+}
+
+// agentFailoverKey 从Agent转移出去的任务集合的key
+func agentFailoverKey(agentID string) string {
+	return fmt.Sprintf("agent:failover:%s", agentID)
+}
@@ -0,0 +1,313 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// 任务修订操作类型
+const (
+	TaskActionCreate         = "create"
+	TaskActionUpdate         = "update"
+	TaskActionRollback       = "rollback"
+	TaskActionProfileRollout = "profile_rollout"
+	TaskActionReassign       = "reassign"
+	TaskActionImport         = "import"
+	TaskActionDelete         = "delete" // 只记录在审计日志中，删除任务时修订历史一并删除
+)
+
+// maxTaskTxRetries WATCH事务因并发修改失败时的重试次数
+const maxTaskTxRetries = 3
+
+// FieldChange 字段变更
+type FieldChange struct {
+	Field string      `json:"field"`
+	Old   interface{} `json:"old"`
+	New   interface{} `json:"new"`
+}
+
+// TaskRevision 任务修订记录
+type TaskRevision struct {
+	Version    int           `json:"version"`
+	Action     string        `json:"action"`
+	Actor      string        `json:"actor"`
+	Timestamp  int64         `json:"timestamp"`
+	Changes    []FieldChange `json:"changes"`
+	RollbackTo int           `json:"rollback_to,omitempty"` // 回滚的目标修订版本
+	Task       *Task         `json:"task"`                  // 该版本的任务快照
+}
+
+// RollbackTaskRequest 回滚任务请求
+type RollbackTaskRequest struct {
+	Revision int  `json:"revision" binding:"required"`
+	Version  *int `json:"version"` // 期望的当前版本，也可通过If-Match请求头指定
+}
+
+// UpdateTask 更新任务，expectedVersion与当前版本不一致时返回ErrConflict
+func (s *TaskService) UpdateTask(ctx context.Context, agentID, taskID string, req *UpdateTaskRequest, expectedVersion int, actor string) (*Task, error) {
+	task, err := s.buildTask(ctx, agentID, taskID, &req.TaskSpec)
+	if err != nil {
+		return nil, err
+	}
+
+	revision := &TaskRevision{Action: TaskActionUpdate, Actor: actor}
+	return s.mutateTask(ctx, agentID, taskID, revision, func(current *Task) (*Task, error) {
+		if err := checkTaskVersion(agentID, taskID, current, expectedVersion); err != nil {
+			return nil, err
+		}
+		task.CreatedAt = current.CreatedAt
+		task.HomeAgentID = current.HomeAgentID
+		return task, nil
+	})
+}
+
+// RollbackTask 将任务回滚到指定修订版本，回滚结果作为新版本保存
+func (s *TaskService) RollbackTask(ctx context.Context, agentID, taskID string, revision, expectedVersion int, actor string) (*Task, error) {
+	target, err := s.getRevision(ctx, agentID, taskID, revision)
+	if err != nil {
+		return nil, err
+	}
+
+	// 任务可能已被迁移到其他Agent，快照中的Agent以当前为准
+	task := *target.Task
+	task.AgentID = agentID
+	if err := task.Validate(); err != nil {
+		return nil, err
+	}
+	if err := checkDeviceUnique(ctx, s.redis, &task); err != nil {
+		return nil, err
+	}
+
+	rev := &TaskRevision{Action: TaskActionRollback, Actor: actor, RollbackTo: revision}
+	return s.mutateTask(ctx, agentID, taskID, rev, func(current *Task) (*Task, error) {
+		if err := checkTaskVersion(agentID, taskID, current, expectedVersion); err != nil {
+			return nil, err
+		}
+		task.CreatedAt = current.CreatedAt
+		task.HomeAgentID = current.HomeAgentID
+		return &task, nil
+	})
+}
+
+// ListRevisions 查询任务的修订历史
+func (s *TaskService) ListRevisions(ctx context.Context, agentID, taskID string) ([]*TaskRevision, error) {
+	values, err := s.redis.HVals(ctx, taskRevisionsKey(agentID, taskID)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	revisions := make([]*TaskRevision, 0, len(values))
+	for _, v := range values {
+		var revision TaskRevision
+		if err := json.Unmarshal([]byte(v), &revision); err != nil {
+			continue
+		}
+		revisions = append(revisions, &revision)
+	}
+
+	sort.Slice(revisions, func(i, j int) bool { return revisions[i].Version < revisions[j].Version })
+
+	return revisions, nil
+}
+
+// getRevision 查询指定修订版本
+func (s *TaskService) getRevision(ctx context.Context, agentID, taskID string, version int) (*TaskRevision, error) {
+	data, err := s.redis.HGet(ctx, taskRevisionsKey(agentID, taskID), strconv.Itoa(version)).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, fmt.Errorf("revision %d of task %s %w", version, taskID, ErrNotFound)
+		}
+		return nil, err
+	}
+
+	var revision TaskRevision
+	if err := json.Unmarshal([]byte(data), &revision); err != nil {
+		return nil, err
+	}
+	if revision.Task == nil {
+		return nil, fmt.Errorf("revision %d of task %s has no snapshot", version, taskID)
+	}
+
+	return &revision, nil
+}
+
+// taskTxHook 在任务修改事务中附加的读写操作，用于与任务一起原子地修改其他数据
+// watch为额外WATCH的key；check在事务中读取并校验，返回错误时放弃修改；write追加写入操作
+type taskTxHook struct {
+	watch []string
+	check func(tx *redis.Tx) error
+	write func(pipe redis.Pipeliner)
+}
+
+// mutateTask 以乐观锁方式修改任务
+// WATCH任务key后读取当前任务（不存在时为nil），由fn生成新任务；fn返回nil表示无需修改。
+// 新任务的版本号自增，保存时同时更新索引并写入修订记录；内容未变化时不生成新版本。
+// 同时WATCH Agent的设备索引并在事务中重新校验设备ID唯一，避免并发请求为同一设备创建多个任务；
+// 引用模板的任务还会WATCH模板，避免与删除模板并发时引用已删除的模板
+func (s *TaskService) mutateTask(ctx context.Context, agentID, taskID string, revision *TaskRevision, fn func(current *Task) (*Task, error)) (*Task, error) {
+	return s.mutateTaskTx(ctx, agentID, taskID, revision, nil, fn)
+}
+
+// mutateTaskTx 与mutateTask相同，hook不为nil时在同一事务中执行附加的读写操作
+// 任务内容未变化时不执行hook的写入操作
+func (s *TaskService) mutateTaskTx(ctx context.Context, agentID, taskID string, revision *TaskRevision, hook *taskTxHook, fn func(current *Task) (*Task, error)) (*Task, error) {
+	key := taskKey(agentID, taskID)
+	dataCenter, err := s.AgentDataCenter(ctx, agentID)
+	if err != nil {
+		return nil, err
+	}
+
+	var saved *Task
+	txf := func(tx *redis.Tx) error {
+		current, err := loadTask(ctx, tx, key)
+		if err != nil && err != redis.Nil {
+			return err
+		}
+		if hook != nil && hook.check != nil {
+			if err := hook.check(tx); err != nil {
+				return err
+			}
+		}
+
+		task, err := fn(current)
+		if err != nil || task == nil {
+			saved = nil
+			return err
+		}
+		if err := checkDeviceUnique(ctx, tx, task); err != nil {
+			return err
+		}
+		if task.ProfileID != "" {
+			if err := checkProfileExists(ctx, tx, task.ProfileID); err != nil {
+				return err
+			}
+		}
+
+		changes := diffTasks(current, task)
+		if current != nil && len(changes) == 0 {
+			saved = current
+			return nil
+		}
+
+		now := time.Now().Unix()
+		task.Version = 1
+		if current != nil {
+			task.Version = current.Version + 1
+		}
+		task.UpdatedAt = now
+		task.UpdatedBy = revision.Actor
+
+		rev := *revision
+		rev.Version = task.Version
+		rev.Timestamp = now
+		rev.Changes = changes
+		rev.Task = task
+
+		data, err := json.Marshal(task)
+		if err != nil {
+			return err
+		}
+		revData, err := json.Marshal(&rev)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			if current != nil {
+				unindexTask(ctx, pipe, current)
+			}
+			pipe.Set(ctx, key, data, 0)
+			indexTask(ctx, pipe, task)
+			pipe.HSet(ctx, taskRevisionsKey(agentID, taskID), strconv.Itoa(task.Version), revData)
+			if hook != nil && hook.write != nil {
+				hook.write(pipe)
+			}
+			return appendAudit(ctx, pipe, taskAudit(&rev, agentID, taskID, dataCenter))
+		})
+		saved = task
+		return err
+	}
+
+	watched := []string{key, agentDevicesKey(agentID)}
+	if hook != nil {
+		watched = append(watched, hook.watch...)
+	}
+	for i := 0; i < maxTaskTxRetries; i++ {
+		err := s.redis.Watch(ctx, txf, watched...)
+		if err == redis.TxFailedErr {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return saved, nil
+	}
+
+	return nil, fmt.Errorf("task %s was modified concurrently: %w", taskID, ErrConflict)
+}
+
+// checkTaskVersion 校验任务存在且版本与期望一致
+func checkTaskVersion(agentID, taskID string, current *Task, expectedVersion int) error {
+	if current == nil {
+		return fmt.Errorf("task %s on agent %s %w", taskID, agentID, ErrNotFound)
+	}
+	if current.Version != expectedVersion {
+		return fmt.Errorf("task %s is at version %d, expected %d: %w", taskID, current.Version, expectedVersion, ErrConflict)
+	}
+	return nil
+}
+
+// diffTasks 比较两个任务的字段差异（忽略版本、时间等元数据）
+func diffTasks(old, new *Task) []FieldChange {
+	a, b := taskFields(old), taskFields(new)
+
+	fields := make([]string, 0, len(b))
+	for field := range a {
+		if _, ok := b[field]; !ok {
+			fields = append(fields, field)
+		}
+	}
+	for field := range b {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	var changes []FieldChange
+	for _, field := range fields {
+		switch field {
+		case "version", "created_at", "updated_at", "updated_by":
+			continue
+		}
+		if !reflect.DeepEqual(a[field], b[field]) {
+			changes = append(changes, FieldChange{Field: field, Old: a[field], New: b[field]})
+		}
+	}
+	return changes
+}
+
+// taskFields 将任务转换为字段名到值的映射
+func taskFields(task *Task) map[string]interface{} {
+	fields := make(map[string]interface{})
+	if task == nil {
+		return fields
+	}
+
+	data, err := json.Marshal(task)
+	if err != nil {
+		return fields
+	}
+	json.Unmarshal(data, &fields)
+	return fields
+}
+
+// taskRevisionsKey 任务修订历史Hash的key（版本号 -> 修订记录）
+func taskRevisionsKey(agentID, taskID string) string {
+	return fmt.Sprintf("task_revisions:%s:%s", agentID, taskID)
+}
@@ -3,122 +3,386 @@ package service
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
-	"github.com/dcim/services/collector-mgmt/internal/handler"
 	"github.com/go-redis/redis/v8"
 )
 
 // TaskService 任务服务
 type TaskService struct {
-	redis *redis.Client
+	redis     *redis.Client
+	profiles  *ProfileService
+	inventory *InventoryService
+	agents    *AgentService
 }
 
 // NewTaskService 创建任务服务
-func NewTaskService(redisClient *redis.Client) *TaskService {
+// inventory为nil时（未配置设备台账）不校验任务引用的设备，自动分配Agent时也不使用设备位置
+func NewTaskService(redisClient *redis.Client, profiles *ProfileService, inventory *InventoryService, agents *AgentService) *TaskService {
 	return &TaskService{
-		redis: redisClient,
+		redis:     redisClient,
+		profiles:  profiles,
+		inventory: inventory,
+		agents:    agents,
 	}
 }
 
 // Task 任务信息
 type Task struct {
+	AgentID    string                 `json:"agent_id"`
 	TaskID     string                 `json:"task_id"`
 	DeviceID   string                 `json:"device_id"`
 	DeviceIP   string                 `json:"device_ip"`
 	DeviceType string                 `json:"device_type"`
 	Protocol   string                 `json:"protocol"`
+	Mode       string                 `json:"mode"` // 采集模式: pull/push
 	Interval   int                    `json:"interval"`
 	Metrics    []string               `json:"metrics"`
 	Config     map[string]interface{} `json:"config"`
 	CronExpr   string                 `json:"cron_expr"`
+	Status     string                 `json:"status"` // 任务状态: active/paused
 	CreatedAt  int64                  `json:"created_at"`
+	Version    int                    `json:"version"` // 每次修改自增，用于乐观并发控制
+	UpdatedAt  int64                  `json:"updated_at"`
+	UpdatedBy  string                 `json:"updated_by,omitempty"`
+	// Agent离线后任务被转移时记录原Agent，原Agent恢复后任务迁回
+	HomeAgentID string `json:"home_agent_id,omitempty"`
+
+	// 引用设备模板的任务：采集参数由模板版本和覆盖项共同生成
+	ProfileID      string             `json:"profile_id,omitempty"`
+	ProfileVersion int                `json:"profile_version,omitempty"`
+	MetricDefs     []MetricDefinition `json:"metric_defs,omitempty"`
+	Overrides      *TaskOverrides     `json:"overrides,omitempty"`
+}
+
+// TaskOverrides 任务对设备模板的覆盖项
+type TaskOverrides struct {
+	Interval int                    `json:"interval,omitempty"` // 覆盖默认采集间隔
+	Metrics  []string               `json:"metrics,omitempty"`  // 按指标名称筛选模板指标
+	Config   map[string]interface{} `json:"config,omitempty"`   // 与模板默认配置合并
+}
+
+// TaskSpec 任务采集参数
+// 指定profile_id时，protocol由模板决定，interval/metrics/config作为模板覆盖项（metrics为指标名称）
+type TaskSpec struct {
+	DeviceID   string                 `json:"device_id" binding:"required"`
+	DeviceIP   string                 `json:"device_ip" binding:"required"`
+	DeviceType string                 `json:"device_type"`
+	ProfileID  string                 `json:"profile_id"`
+	Protocol   string                 `json:"protocol"`
+	Mode       string                 `json:"mode"` // 为空时使用协议支持的第一种模式
+	Interval   int                    `json:"interval"`
+	Metrics    []string               `json:"metrics"`
+	Config     map[string]interface{} `json:"config"`
+	CronExpr   string                 `json:"cron_expr"`
+	Status     string                 `json:"status"` // 为空时为active
 }
 
-// AgentStatus Agent状态
-type AgentStatus struct {
-	AgentID       string `json:"agent_id"`
-	AgentName     string `json:"agent_name"`
-	Status        string `json:"status"`
-	LastHeartbeat int64  `json:"last_heartbeat"`
-	TaskCount     int    `json:"task_count"`
-	DataCenter    string `json:"data_center"`
-	Room          string `json:"room"`
+// AddTaskRequest 添加任务请求
+// agent_id为空时按设备所在机房/数据中心和Agent负载自动分配
+type AddTaskRequest struct {
+	AgentID    string `json:"agent_id"`
+	TaskID     string `json:"task_id" binding:"required"`
+	DataCenter string `json:"data_center"` // 自动分配时的数据中心，为空时取设备台账中的位置
+	Room       string `json:"room"`        // 自动分配时的机房，为空时取设备台账中的位置
+	TaskSpec
 }
 
-// AddTask 添加任务
-func (s *TaskService) AddTask(ctx context.Context, req *handler.AddTaskRequest) error {
+// UpdateTaskRequest 更新任务请求
+type UpdateTaskRequest struct {
+	TaskSpec
+	Version *int `json:"version"` // 期望的当前版本，也可通过If-Match请求头指定
+}
+
+// AddTask 添加任务，任务已存在时返回ErrConflict（修改已有任务使用UpdateTask）
+// 参数不合法时返回 *ValidationError
+func (s *TaskService) AddTask(ctx context.Context, req *AddTaskRequest, actor string) (*Task, error) {
+	return s.addTask(ctx, req, actor, nil)
+}
+
+// addTask 添加任务，hook不为nil时在创建任务的事务中执行附加的读写操作
+func (s *TaskService) addTask(ctx context.Context, req *AddTaskRequest, actor string, hook *taskTxHook) (*Task, error) {
+	if req.AgentID == "" {
+		agentID, err := s.assignAgent(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		req.AgentID = agentID
+	}
+
+	task, err := s.buildTask(ctx, req.AgentID, req.TaskID, &req.TaskSpec)
+	if err != nil {
+		return nil, err
+	}
+
+	revision := &TaskRevision{Action: TaskActionCreate, Actor: actor}
+	return s.mutateTaskTx(ctx, req.AgentID, req.TaskID, revision, hook, func(current *Task) (*Task, error) {
+		if current != nil {
+			return nil, fmt.Errorf("task %s already exists on agent %s: %w", req.TaskID, req.AgentID, ErrConflict)
+		}
+		return task, nil
+	})
+}
+
+// buildTask 根据采集参数生成任务并校验
+func (s *TaskService) buildTask(ctx context.Context, agentID, taskID string, spec *TaskSpec) (*Task, error) {
 	task := &Task{
-		TaskID:     req.TaskID,
-		DeviceID:   req.DeviceID,
-		DeviceIP:   req.DeviceIP,
-		DeviceType: req.DeviceType,
-		Protocol:   req.Protocol,
-		Interval:   req.Interval,
-		Metrics:    req.Metrics,
-		Config:     req.Config,
-		CronExpr:   req.CronExpr,
+		AgentID:    agentID,
+		TaskID:     taskID,
+		DeviceID:   spec.DeviceID,
+		DeviceIP:   spec.DeviceIP,
+		DeviceType: spec.DeviceType,
+		Protocol:   spec.Protocol,
+		Mode:       spec.Mode,
+		Interval:   spec.Interval,
+		Metrics:    spec.Metrics,
+		Config:     spec.Config,
+		CronExpr:   spec.CronExpr,
+		Status:     spec.Status,
 		CreatedAt:  time.Now().Unix(),
 	}
+	if task.Status == "" {
+		task.Status = TaskStatusActive
+	}
 
-	// 保存到Redis
-	key := fmt.Sprintf("task:%s:%s", req.AgentID, req.TaskID)
-	data, err := json.Marshal(task)
+	if spec.ProfileID != "" {
+		profile, err := s.profiles.Get(ctx, spec.ProfileID, 0)
+		if err != nil {
+			if isNotFound(err) {
+				errs := &ValidationError{}
+				errs.Add("profile_id", "profile %s not found", spec.ProfileID)
+				return nil, errs
+			}
+			return nil, err
+		}
+		if unknown := profile.unknownMetrics(spec.Metrics); len(unknown) > 0 {
+			errs := &ValidationError{}
+			errs.Add("metrics", "metrics %v not defined in profile %s", unknown, spec.ProfileID)
+			return nil, errs
+		}
+		task.Overrides = &TaskOverrides{
+			Interval: spec.Interval,
+			Metrics:  spec.Metrics,
+			Config:   spec.Config,
+		}
+		profile.Apply(task, task.Overrides)
+	}
+
+	if task.Mode == "" {
+		if capability, ok := protocolCapabilities[task.Protocol]; ok {
+			task.Mode = capability.modes[0]
+		}
+	}
+
+	if err := task.Validate(); err != nil {
+		return nil, err
+	}
+	if err := checkDeviceUnique(ctx, s.redis, task); err != nil {
+		return nil, err
+	}
+	if err := s.checkInventoryDevice(ctx, task); err != nil {
+		return nil, err
+	}
+
+	return task, nil
+}
+
+// checkInventoryDevice 校验任务引用的设备已登记在设备台账中且未退役
+func (s *TaskService) checkInventoryDevice(ctx context.Context, task *Task) error {
+	if s.inventory == nil {
+		return nil
+	}
+
+	device, err := s.inventory.GetDevice(ctx, task.DeviceID)
 	if err != nil {
+		if isNotFound(err) {
+			errs := &ValidationError{}
+			errs.Add("device_id", "device %s is not registered in inventory", task.DeviceID)
+			return errs
+		}
 		return err
 	}
+	if device.State == LifecycleRetired {
+		errs := &ValidationError{}
+		errs.Add("device_id", "device %s is retired", task.DeviceID)
+		return errs
+	}
+	return nil
+}
 
-	return s.redis.Set(ctx, key, data, 0).Err()
+// checkDeviceUnique 校验同一Agent下设备ID唯一，c可以是WATCH事务中的连接
+func checkDeviceUnique(ctx context.Context, c redis.Cmdable, task *Task) error {
+	owner, err := c.HGet(ctx, agentDevicesKey(task.AgentID), task.DeviceID).Result()
+	if err != nil && err != redis.Nil {
+		return err
+	}
+	if owner != "" && owner != task.TaskID {
+		errs := &ValidationError{}
+		errs.Add("device_id", "device %s is already collected by task %s on agent %s", task.DeviceID, owner, task.AgentID)
+		return errs
+	}
+	return nil
 }
 
-// RemoveTask 删除任务
-func (s *TaskService) RemoveTask(ctx context.Context, agentID, taskID string) error {
-	key := fmt.Sprintf("task:%s:%s", agentID, taskID)
-	return s.redis.Del(ctx, key).Err()
+// RemoveTask 删除任务，actor为操作人，任务不存在时返回ErrNotFound
+func (s *TaskService) RemoveTask(ctx context.Context, agentID, taskID, actor string) error {
+	key := taskKey(agentID, taskID)
+	dataCenter, err := s.AgentDataCenter(ctx, agentID)
+	if err != nil {
+		return err
+	}
+
+	// WATCH任务key，读取后被修改时重试，避免按旧快照删除索引
+	txf := func(tx *redis.Tx) error {
+		task, err := loadTask(ctx, tx, key)
+		if err == redis.Nil {
+			return fmt.Errorf("task %s on agent %s %w", taskID, agentID, ErrNotFound)
+		}
+		if err != nil {
+			return err
+		}
+
+		rev := &TaskRevision{
+			Version:   task.Version,
+			Action:    TaskActionDelete,
+			Actor:     actor,
+			Timestamp: time.Now().Unix(),
+			Changes:   diffTasks(task, nil),
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Del(ctx, key, taskRevisionsKey(agentID, taskID))
+			unindexTask(ctx, pipe, task)
+			return appendAudit(ctx, pipe, taskAudit(rev, agentID, taskID, dataCenter))
+		})
+		return err
+	}
+
+	for i := 0; i < maxTaskTxRetries; i++ {
+		err := s.redis.Watch(ctx, txf, key)
+		if err == redis.TxFailedErr {
+			continue
+		}
+		return err
+	}
+
+	return fmt.Errorf("task %s was modified concurrently: %w", taskID, ErrConflict)
 }
 
-// ListTasks 查询任务列表
-func (s *TaskService) ListTasks(ctx context.Context, agentID string) ([]*Task, error) {
-	pattern := fmt.Sprintf("task:%s:*", agentID)
-	keys, err := s.redis.Keys(ctx, pattern).Result()
+// RolloutProfile 将模板的当前版本应用到所有引用该模板的任务，返回更新的任务数
+func (s *TaskService) RolloutProfile(ctx context.Context, profileID string) (int, error) {
+	profile, err := s.profiles.Get(ctx, profileID, 0)
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
 
-	var tasks []*Task
+	keys, err := s.redis.SMembers(ctx, profileTasksKey(profileID)).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	updated := 0
 	for _, key := range keys {
-		data, err := s.redis.Get(ctx, key).Result()
-		if err != nil {
+		task, err := s.getTask(ctx, key)
+		if err == redis.Nil || (err == nil && task.ProfileID != profileID) {
+			// 任务已删除或不再引用该模板
+			s.redis.SRem(ctx, profileTasksKey(profileID), key)
 			continue
 		}
+		if err != nil {
+			return updated, err
+		}
 
-		var task Task
-		if err := json.Unmarshal([]byte(data), &task); err != nil {
+		if task.ProfileVersion == profile.Version {
 			continue
 		}
 
-		tasks = append(tasks, &task)
+		revision := &TaskRevision{Action: TaskActionProfileRollout, Actor: "profile:" + profileID}
+		saved, err := s.mutateTask(ctx, task.AgentID, task.TaskID, revision, func(current *Task) (*Task, error) {
+			if current == nil || current.ProfileID != profileID || current.ProfileVersion == profile.Version {
+				return nil, nil
+			}
+
+			next := *current
+			overrides := next.Overrides
+			if overrides == nil {
+				overrides = &TaskOverrides{}
+			}
+			profile.Apply(&next, overrides)
+			return &next, nil
+		})
+		if err != nil {
+			return updated, err
+		}
+		if saved != nil {
+			updated++
+		}
 	}
 
-	return tasks, nil
+	return updated, nil
 }
 
-// GetAgentStatus 查询Agent状态
-func (s *TaskService) GetAgentStatus(ctx context.Context, agentID string) (*AgentStatus, error) {
-	key := fmt.Sprintf("agent:status:%s", agentID)
-	data, err := s.redis.Get(ctx, key).Result()
+// GetTask 查询任务
+func (s *TaskService) GetTask(ctx context.Context, agentID, taskID string) (*Task, error) {
+	task, err := s.getTask(ctx, taskKey(agentID, taskID))
+	if err == redis.Nil {
+		return nil, fmt.Errorf("task %s on agent %s %w", taskID, agentID, ErrNotFound)
+	}
+	return task, err
+}
+
+// getTask 按key查询任务
+func (s *TaskService) getTask(ctx context.Context, key string) (*Task, error) {
+	return loadTask(ctx, s.redis, key)
+}
+
+// loadTask 使用指定的客户端（或WATCH事务）读取任务
+func loadTask(ctx context.Context, c redis.Cmdable, key string) (*Task, error) {
+	data, err := c.Get(ctx, key).Result()
 	if err != nil {
-		if err == redis.Nil {
-			return nil, fmt.Errorf("agent not found: %s", agentID)
-		}
 		return nil, err
 	}
 
-	var status AgentStatus
-	if err := json.Unmarshal([]byte(data), &status); err != nil {
+	var task Task
+	if err := json.Unmarshal([]byte(data), &task); err != nil {
 		return nil, err
 	}
 
-	return &status, nil
+	return &task, nil
+}
+
+// taskKey 任务的Redis key
+func taskKey(agentID, taskID string) string {
+	return fmt.Sprintf("task:%s:%s", agentID, taskID)
+}
+
+// parseTaskKey 从任务的Redis key解析Agent ID和任务ID
+func parseTaskKey(key string) (agentID, taskID string, ok bool) {
+	if !strings.HasPrefix(key, "task:") {
+		return "", "", false
+	}
+	parts := strings.SplitN(strings.TrimPrefix(key, "task:"), ":", 2)
+	if len(parts) != 2 {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
+
+// AgentDataCenter 查询Agent上报的数据中心，Agent未上报过心跳时返回空
+func (s *TaskService) AgentDataCenter(ctx context.Context, agentID string) (string, error) {
+	status, err := s.agents.GetStatus(ctx, agentID)
+	if errors.Is(err, ErrNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return status.DataCenter, nil
+}
+
+// GetAgentStatus 查询Agent状态
+func (s *TaskService) GetAgentStatus(ctx context.Context, agentID string) (*AgentStatus, error) {
+	return s.agents.GetStatus(ctx, agentID)
 }
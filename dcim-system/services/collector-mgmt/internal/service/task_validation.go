@@ -0,0 +1,214 @@
+package service
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/robfig/cron/v3"
+)
+
+// 采集模式（与Agent protocol.CollectMode 保持一致）
+const (
+	CollectModePull = "pull"
+	CollectModePush = "push"
+)
+
+// 任务状态
+const (
+	TaskStatusActive = "active"
+	TaskStatusPaused = "paused"
+)
+
+// cronParser 与Agent调度器一致的cron解析器（支持秒级字段和@every等描述符）
+var cronParser = cron.NewParser(cron.Second | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+// FieldError 字段校验错误
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError 请求校验错误，包含所有不合法的字段
+type ValidationError struct {
+	Fields []FieldError `json:"fields"`
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, 0, len(e.Fields))
+	for _, f := range e.Fields {
+		msgs = append(msgs, f.Field+": "+f.Message)
+	}
+	return "validation failed: " + strings.Join(msgs, "; ")
+}
+
+// Add 追加字段错误
+func (e *ValidationError) Add(field, format string, args ...interface{}) {
+	e.Fields = append(e.Fields, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// Err 存在字段错误时返回自身，否则返回nil
+func (e *ValidationError) Err() error {
+	if len(e.Fields) == 0 {
+		return nil
+	}
+	return e
+}
+
+// protocolCapability 协议能力
+// 与Agent协议插件的 SupportedModes / Validate 规则保持一致，Agent新增协议时需同步更新
+type protocolCapability struct {
+	modes    []string
+	validate func(config map[string]interface{}, errs *ValidationError)
+}
+
+// protocolCapabilities 支持的采集协议
+var protocolCapabilities = map[string]protocolCapability{
+	"snmp":    {modes: []string{CollectModePull}, validate: validateSNMPConfig},
+	"modbus":  {modes: []string{CollectModePull, CollectModePush}, validate: validateModbusConfig},
+	"opcua":   {modes: []string{CollectModePull}, validate: validatePortConfig},
+	"redfish": {modes: []string{CollectModePull}, validate: validatePortConfig},
+}
+
+// supportedProtocols 返回支持的协议名称列表
+func supportedProtocols() string {
+	names := make([]string, 0, len(protocolCapabilities))
+	for name := range protocolCapabilities {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// Validate 校验任务参数，返回包含所有字段错误的 *ValidationError
+func (t *Task) Validate() error {
+	errs := &ValidationError{}
+
+	if t.DeviceType == "" {
+		errs.Add("device_type", "is required")
+	}
+	if net.ParseIP(t.DeviceIP) == nil {
+		errs.Add("device_ip", "%q is not a valid IP address", t.DeviceIP)
+	}
+	if t.Status != TaskStatusActive && t.Status != TaskStatusPaused {
+		errs.Add("status", "invalid status %q, expected %s/%s", t.Status, TaskStatusActive, TaskStatusPaused)
+	}
+
+	if t.Protocol == "" {
+		errs.Add("protocol", "is required")
+		return errs.Err()
+	}
+	capability, ok := protocolCapabilities[t.Protocol]
+	if !ok {
+		errs.Add("protocol", "unsupported protocol %q, supported: %s", t.Protocol, supportedProtocols())
+		return errs.Err()
+	}
+
+	if !containsString(capability.modes, t.Mode) {
+		errs.Add("mode", "protocol %s does not support %q mode, supported: %s",
+			t.Protocol, t.Mode, strings.Join(capability.modes, ", "))
+	}
+
+	switch t.Mode {
+	case CollectModePull:
+		if t.CronExpr == "" && t.Interval <= 0 {
+			errs.Add("interval", "must be positive when cron_expr is empty")
+		}
+		if t.Interval < 0 {
+			errs.Add("interval", "must not be negative")
+		}
+		if t.CronExpr != "" {
+			if _, err := cronParser.Parse(t.CronExpr); err != nil {
+				errs.Add("cron_expr", "invalid cron expression: %v", err)
+			}
+		}
+		if len(t.Metrics) == 0 {
+			errs.Add("metrics", "at least one metric is required in pull mode")
+		}
+	case CollectModePush:
+		// 被动接收模式由设备推送数据，调度参数无意义
+		if t.Interval != 0 {
+			errs.Add("interval", "must be empty in push mode")
+		}
+		if t.CronExpr != "" {
+			errs.Add("cron_expr", "must be empty in push mode")
+		}
+	}
+
+	capability.validate(t.Config, errs)
+
+	return errs.Err()
+}
+
+// validateSNMPConfig 校验SNMP配置（对应Agent SNMPProtocol.Validate）
+func validateSNMPConfig(config map[string]interface{}, errs *ValidationError) {
+	version, _ := config["version"].(string)
+	if version != "v1" && version != "v2c" && version != "v3" {
+		errs.Add("config.version", "invalid SNMP version %q, expected v1/v2c/v3", version)
+	}
+
+	community, _ := config["community"].(string)
+	if community == "" && version != "v3" {
+		errs.Add("config.community", "is required for SNMP %s", version)
+	}
+
+	validatePortConfig(config, errs)
+	validateIntRange(config, "timeout", 0, 300, errs)
+	validateIntRange(config, "retries", 0, 10, errs)
+}
+
+// validateModbusConfig 校验Modbus配置
+func validateModbusConfig(config map[string]interface{}, errs *ValidationError) {
+	validatePortConfig(config, errs)
+	validateIntRange(config, "unit_id", 0, 247, errs)
+}
+
+// validatePortConfig 校验端口配置
+func validatePortConfig(config map[string]interface{}, errs *ValidationError) {
+	validateIntRange(config, "port", 1, 65535, errs)
+}
+
+// validateIntRange 校验可选的整数配置项
+func validateIntRange(config map[string]interface{}, key string, min, max int, errs *ValidationError) {
+	value, exists := config[key]
+	if !exists {
+		return
+	}
+
+	n, ok := configInt(value)
+	if !ok {
+		errs.Add("config."+key, "must be an integer")
+		return
+	}
+	if n < min || n > max {
+		errs.Add("config."+key, "must be between %d and %d", min, max)
+	}
+}
+
+// configInt 将配置值转换为整数（JSON数字为float64，YAML为int）
+func configInt(value interface{}) (int, bool) {
+	switch v := value.(type) {
+	case int:
+		return v, true
+	case int64:
+		return int(v), true
+	case float64:
+		if v != math.Trunc(v) {
+			return 0, false
+		}
+		return int(v), true
+	default:
+		return 0, false
+	}
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
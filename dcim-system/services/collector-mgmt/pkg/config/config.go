@@ -1,15 +1,20 @@
 package config
 
 import (
-	"os"
 	"gopkg.in/yaml.v3"
+	"os"
 )
 
 // Config 服务配置
 type Config struct {
-	Server ServerConfig `yaml:"server"`
-	GRPC   GRPCConfig   `yaml:"grpc"`
-	Redis  RedisConfig  `yaml:"redis"`
+	Server     ServerConfig     `yaml:"server"`
+	GRPC       GRPCConfig       `yaml:"grpc"`
+	Redis      RedisConfig      `yaml:"redis"`
+	Profiles   ProfilesConfig   `yaml:"profiles"`
+	Postgres   PostgresConfig   `yaml:"postgres"`
+	Capacity   CapacityConfig   `yaml:"capacity"`
+	Assignment AssignmentConfig `yaml:"assignment"`
+	Auth       AuthConfig       `yaml:"auth"`
 }
 
 // ServerConfig HTTP服务配置
@@ -20,8 +25,8 @@ type ServerConfig struct {
 
 // GRPCConfig gRPC服务配置
 type GRPCConfig struct {
-	Port    int  `yaml:"port"`
-	UseTLS  bool `yaml:"use_tls"`
+	Port     int    `yaml:"port"`
+	UseTLS   bool   `yaml:"use_tls"`
 	CertFile string `yaml:"cert_file"`
 	KeyFile  string `yaml:"key_file"`
 }
@@ -33,6 +38,53 @@ type RedisConfig struct {
 	DB       int    `yaml:"db"`
 }
 
+// ProfilesConfig 设备模板配置
+type ProfilesConfig struct {
+	Dir string `yaml:"dir"` // 启动时导入的模板YAML目录(可选)
+}
+
+// PostgresConfig PostgreSQL配置（设备台账）
+type PostgresConfig struct {
+	DSN          string `yaml:"dsn"`            // 连接串，为空时不启用设备台账
+	MaxOpenConns int    `yaml:"max_open_conns"` // 最大连接数
+}
+
+// CapacityConfig 容量规划配置（需启用设备台账）
+type CapacityConfig struct {
+	PowerMetrics []string        `yaml:"power_metrics"` // 读取实测功率(W)的指标名，按顺序取第一个存在的
+	Space        ThresholdConfig `yaml:"space"`         // U位使用率阈值
+	Power        ThresholdConfig `yaml:"power"`         // 功率使用率阈值（铭牌功率和实测功率）
+	Weight       ThresholdConfig `yaml:"weight"`        // 承重使用率阈值
+}
+
+// ThresholdConfig 告警阈值（使用率百分比，0表示不告警）
+type ThresholdConfig struct {
+	Warning  float64 `yaml:"warning"`
+	Critical float64 `yaml:"critical"`
+}
+
+// AssignmentConfig Agent分配与故障转移配置（单位：秒）
+type AssignmentConfig struct {
+	OfflineAfter  int `yaml:"offline_after"`  // 超过该时间未收到心跳的Agent视为离线
+	GracePeriod   int `yaml:"grace_period"`   // Agent离线超过该时间后将任务转移到同机房的其他Agent
+	CheckInterval int `yaml:"check_interval"` // 检查间隔，0表示不自动转移
+}
+
+// AuthConfig 认证配置
+type AuthConfig struct {
+	Enabled   bool           `yaml:"enabled"`    // 为false时不认证，操作人取X-Actor请求头
+	JWTSecret string         `yaml:"jwt_secret"` // HS256签名密钥，为空时不接受JWT
+	JWTIssuer string         `yaml:"jwt_issuer"` // 非空时校验JWT的iss
+	APIKeys   []APIKeyConfig `yaml:"api_keys"`
+}
+
+// APIKeyConfig API Key配置
+type APIKeyConfig struct {
+	Name      string            `yaml:"name"`       // 记录到审计日志的调用方名称
+	KeySHA256 string            `yaml:"key_sha256"` // 密钥的SHA-256摘要(hex)
+	Roles     map[string]string `yaml:"roles"`      // 数据中心 -> 角色(viewer/operator/admin)，"*"表示全部数据中心
+}
+
 // LoadConfig 加载配置文件
 func LoadConfig(path string) (*Config, error) {
 	data, err := os.ReadFile(path)
@@ -40,7 +92,18 @@ func LoadConfig(path string) (*Config, error) {
 		return nil, err
 	}
 
-	var config Config
+	config := Config{
+		Capacity: CapacityConfig{
+			Space:  ThresholdConfig{Warning: 80, Critical: 95},
+			Power:  ThresholdConfig{Warning: 80, Critical: 90},
+			Weight: ThresholdConfig{Warning: 80, Critical: 95},
+		},
+		Assignment: AssignmentConfig{
+			OfflineAfter:  90,
+			GracePeriod:   300,
+			CheckInterval: 30,
+		},
+	}
 	if err := yaml.Unmarshal(data, &config); err != nil {
 		return nil, err
 	}
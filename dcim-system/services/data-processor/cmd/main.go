@@ -2,14 +2,29 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
 	"time"
 
+	"github.com/dcim/services/data-processor/internal/alarm"
+	"github.com/dcim/services/data-processor/internal/api"
+	"github.com/dcim/services/data-processor/internal/availability"
+	"github.com/dcim/services/data-processor/internal/deadletter"
+	"github.com/dcim/services/data-processor/internal/energy"
+	"github.com/dcim/services/data-processor/internal/fields"
+	"github.com/dcim/services/data-processor/internal/kafka"
+	"github.com/dcim/services/data-processor/internal/notify"
 	"github.com/dcim/services/data-processor/internal/processor"
+	"github.com/dcim/services/data-processor/internal/rollup"
+	"github.com/dcim/services/data-processor/internal/stream"
+	"github.com/dcim/services/data-processor/internal/virtual"
+	"github.com/dcim/services/data-processor/internal/writer"
 	"github.com/dcim/services/data-processor/pkg/config"
 	mqtt "github.com/eclipse/paho.mqtt.golang"
 	"github.com/go-redis/redis/v8"
@@ -38,6 +53,12 @@ func main() {
 	influxClient := influxdb2.NewClient(cfg.InfluxDB.URL, cfg.InfluxDB.Token)
 	defer influxClient.Close()
 
+	// 批量写入InfluxDB，与MQTT消息处理解耦
+	influxWriter, err := createInfluxWriter(influxClient, cfg.InfluxDB, logger)
+	if err != nil {
+		logger.Fatal("failed to create influxdb writer", zap.Error(err))
+	}
+
 	// 连接Redis
 	redisClient := redis.NewClient(&redis.Options{
 		Addr:     cfg.Redis.Addr,
@@ -46,23 +67,222 @@ func main() {
 	})
 	defer redisClient.Close()
 
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// 创建告警规则引擎
+	var alarmEngine *alarm.Engine
+	if cfg.Alarm.Enabled {
+		alarmEngine, err = createAlarmEngine(ctx, cfg.Alarm, redisClient, logger)
+		if err != nil {
+			logger.Fatal("failed to create alarm engine", zap.Error(err))
+		}
+	}
+
+	// 创建设备可用性跟踪，启用告警时设备不可达作为告警产生
+	var tracker *availability.Tracker
+	if cfg.Availability.Enabled {
+		tracker, err = createTracker(ctx, cfg.Availability, influxWriter, redisClient, alarmEngine, logger)
+		if err != nil {
+			logger.Fatal("failed to create availability tracker", zap.Error(err))
+		}
+		if cfg.Availability.CheckInterval > 0 {
+			go tracker.Run(ctx, time.Duration(cfg.Availability.CheckInterval)*time.Second)
+		}
+		// 多副本时设备数据可能转由其他副本处理，按各副本共享的最近收到时间判断数据缺失
+		if alarmEngine != nil {
+			alarmEngine.SetSeenLookup(tracker)
+		}
+	}
+
+	// 创建指标字段类型规范化，避免同一字段类型不一致导致InfluxDB拒绝写入
+	normalizer, err := createNormalizer(ctx, cfg.Fields, redisClient, logger)
+	if err != nil {
+		logger.Fatal("failed to create field normalizer", zap.Error(err))
+	}
+
+	// 历史数据降采样，启动时同步各层级的桶和InfluxDB任务；未启用时只查询原始数据
+	tiers := []rollup.Tier{{Name: "raw", Bucket: cfg.InfluxDB.Bucket}}
+	if cfg.Rollup.Enabled {
+		rollupManager, err := createRollupManager(cfg.Rollup, cfg.InfluxDB, influxClient, redisClient, logger)
+		if err != nil {
+			logger.Fatal("failed to create rollup manager", zap.Error(err))
+		}
+		tiers = rollupManager.Tiers()
+		go rollupManager.Run(ctx, 30*time.Second)
+	}
+
+	// 历史数据查询，按时间范围选择数据层级，结果缓存到Redis
+	var querier *rollup.Querier
+	if cfg.Query.Enabled {
+		querier = rollup.NewQuerier(influxClient.QueryAPI(cfg.InfluxDB.Org), tiers, cfg.Query.MaxPoints, cfg.Query.MaxTotalPoints, logger)
+		querier.SetCache(redisClient, time.Duration(cfg.Query.CacheTTL)*time.Second)
+	}
+
 	// 创建数据处理器
 	dataProcessor := processor.NewDataProcessor(
-		influxClient,
-		cfg.InfluxDB.Org,
-		cfg.InfluxDB.Bucket,
+		influxWriter,
 		redisClient,
+		alarmEngine,
+		tracker,
+		normalizer,
+		time.Duration(cfg.MQTT.DedupWindow)*time.Second,
 		logger,
 	)
 
+	// 设备最新数据通过Redis频道分发到各副本，再推送给WebSocket/SSE客户端
+	var hub *stream.Hub
+	if cfg.Stream.Enabled {
+		// 推送间隔和心跳间隔用于创建ticker，必须大于0
+		if cfg.Stream.MinInterval <= 0 || cfg.Stream.Heartbeat <= 0 {
+			logger.Fatal("stream.min_interval and stream.heartbeat must be positive",
+				zap.Int("min_interval_ms", cfg.Stream.MinInterval),
+				zap.Int("heartbeat", cfg.Stream.Heartbeat))
+		}
+		hub = stream.NewHub(
+			redisClient,
+			cfg.Stream.DeviceRooms,
+			time.Duration(cfg.Stream.MinInterval)*time.Millisecond,
+			time.Duration(cfg.Stream.Heartbeat)*time.Second,
+			cfg.Stream.MaxClients,
+			cfg.Stream.AllowedOrigins,
+			logger,
+		)
+		dataProcessor.SetBroadcaster(hub)
+		go hub.Run(ctx)
+
+		logger.Info("stream enabled",
+			zap.Int("min_interval_ms", cfg.Stream.MinInterval),
+			zap.Int("max_clients", cfg.Stream.MaxClients))
+	}
+
+	// 能耗分析，按供电拓扑计算PUE和机柜用电量
+	var energyAnalyzer *energy.Analyzer
+	if cfg.Energy.Enabled {
+		energyAnalyzer, err = createEnergyAnalyzer(cfg.Energy, influxWriter, redisClient, logger)
+		if err != nil {
+			logger.Fatal("failed to create energy analyzer", zap.Error(err))
+		}
+		dataProcessor.SetEnergy(energyAnalyzer)
+		go energyAnalyzer.Run(ctx)
+	}
+
+	// 虚拟设备，依赖的设备数据处理完成后按表达式计算
+	if cfg.Virtual.Enabled {
+		engine, err := createVirtualEngine(cfg.Virtual, redisClient, logger)
+		if err != nil {
+			logger.Fatal("failed to create virtual devices", zap.Error(err))
+		}
+		dataProcessor.SetVirtual(engine)
+	}
+
 	// 创建MQTT客户端
 	mqttClient := createMQTTClient(cfg.MQTT, dataProcessor, logger)
 
+	// 无法处理的消息写入死信（本地文件和/或DLQ Topic）
+	var deadLetters *deadletter.FileStore
+	if cfg.DeadLetter.Enabled {
+		var sinks deadletter.Sinks
+		if cfg.DeadLetter.Dir != "" {
+			deadLetters, err = deadletter.NewFileStore(cfg.DeadLetter.Dir, int64(cfg.DeadLetter.MaxFileMB)<<20, cfg.DeadLetter.MaxFiles)
+			if err != nil {
+				logger.Fatal("failed to create dead letter store", zap.Error(err))
+			}
+			defer deadLetters.Close()
+			sinks = append(sinks, deadLetters)
+		}
+		if cfg.DeadLetter.Topic != "" {
+			sinks = append(sinks, deadletter.NewMQTTSink(mqttClient, cfg.DeadLetter.Topic, cfg.DeadLetter.QoS, logger))
+		}
+		if len(sinks) == 0 {
+			logger.Fatal("dead_letter requires dir or topic")
+		}
+		dataProcessor.SetDeadLetter(sinks)
+		// 被InfluxDB拒绝的批次（包括可用性、能耗等其他模块写入的数据）以行协议写入死信
+		influxWriter.SetRejectHandler(dataProcessor.WriteRejected)
+
+		logger.Info("dead letter enabled",
+			zap.String("dir", cfg.DeadLetter.Dir),
+			zap.String("topic", cfg.DeadLetter.Topic))
+	}
+
+	// 告警通过同一MQTT连接发布，启用通知时同时发送到通知渠道
+	var notifierDone chan struct{}
+	if alarmEngine != nil {
+		publishers := alarm.Publishers{alarm.NewMQTTPublisher(mqttClient, cfg.Alarm.Topic, cfg.Alarm.QoS, logger)}
+		if cfg.Notify.Enabled {
+			notifier, err := createNotifier(ctx, cfg.Notify, alarmEngine.Store(), redisClient, logger)
+			if err != nil {
+				logger.Fatal("failed to create notifier", zap.Error(err))
+			}
+			publishers = append(publishers, notifier)
+
+			notifierDone = make(chan struct{})
+			go func() {
+				notifier.Run(ctx)
+				close(notifierDone)
+			}()
+		}
+		alarmEngine.SetPublisher(publishers)
+
+		if cfg.Alarm.CheckInterval > 0 {
+			go alarmEngine.Run(ctx, time.Duration(cfg.Alarm.CheckInterval)*time.Second)
+		}
+	}
+
+	// 消费opc-collector写入Kafka的数据，与MQTT数据使用同一处理流程
+	var kafkaConsumer *kafka.Consumer
+	var kafkaDone chan struct{}
+	if cfg.Kafka.Enabled {
+		kafkaConsumer, err = kafka.NewConsumer(kafka.Options{
+			Brokers:        cfg.Kafka.Brokers,
+			Topic:          cfg.Kafka.Topic,
+			Group:          cfg.Kafka.Group,
+			Version:        cfg.Kafka.Version,
+			InitialOffset:  cfg.Kafka.InitialOffset,
+			CommitInterval: time.Duration(cfg.Kafka.CommitInterval) * time.Second,
+			Encoding:       processor.EncodingOPC,
+		}, dataProcessor, influxWriter, logger)
+		if err != nil {
+			logger.Fatal("failed to create kafka consumer", zap.Error(err))
+		}
+
+		kafkaDone = make(chan struct{})
+		go func() {
+			kafkaConsumer.Run(ctx)
+			close(kafkaDone)
+		}()
+		logger.Info("kafka input enabled",
+			zap.Strings("brokers", cfg.Kafka.Brokers),
+			zap.String("topic", cfg.Kafka.Topic),
+			zap.String("group", cfg.Kafka.Group))
+	}
+
 	// 连接MQTT
 	if token := mqttClient.Connect(); token.Wait() && token.Error() != nil {
 		logger.Fatal("failed to connect MQTT", zap.Error(token.Error()))
 	}
 
+	if cfg.Notify.Enabled && alarmEngine == nil {
+		logger.Warn("alarm notification requires alarm.enabled, notifications disabled")
+	}
+
+	// 启动HTTP接口
+	var httpServer *http.Server
+	if cfg.Server.Port > 0 {
+		handler := api.NewServer(alarmEngine, normalizer, deadLetters, dataProcessor,
+			querier, time.Duration(cfg.Query.Timeout)*time.Second, hub, energyAnalyzer, logger)
+		httpServer = &http.Server{
+			Addr:    fmt.Sprintf(":%d", cfg.Server.Port),
+			Handler: handler,
+		}
+		go func() {
+			if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				logger.Fatal("failed to start HTTP server", zap.Error(err))
+			}
+		}()
+	}
+
 	logger.Info("数据处理服务已启动",
 		zap.String("mqtt_broker", cfg.MQTT.Broker),
 		zap.String("mqtt_topic", cfg.MQTT.Topic))
@@ -75,28 +295,393 @@ func main() {
 
 	// 优雅退出
 	logger.Info("shutting down...")
+	cancel()
+	if httpServer != nil {
+		shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
+		httpServer.Shutdown(shutdownCtx)
+		shutdownCancel()
+	}
 	mqttClient.Disconnect(250)
+	if kafkaConsumer != nil {
+		// 等待已处理的数据写入并提交offset后离开消费组
+		<-kafkaDone
+		kafkaConsumer.Close()
+	}
+	if notifierDone != nil {
+		<-notifierDone
+	}
+	influxWriter.Close()
 	logger.Info("shutdown complete")
 }
 
+// createAlarmEngine 加载告警规则并恢复未恢复的告警
+func createAlarmEngine(ctx context.Context, cfg config.AlarmConfig, redisClient *redis.Client, logger *zap.Logger) (*alarm.Engine, error) {
+	rules, err := alarm.LoadRules(cfg.RulesFile)
+	if err != nil {
+		return nil, err
+	}
+
+	store := alarm.NewStore(redisClient, time.Duration(cfg.RetentionHours)*time.Hour)
+	engine := alarm.NewEngine(rules, store, nil, logger)
+	restored, err := engine.Restore(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to restore alarms: %w", err)
+	}
+
+	logger.Info("alarm engine enabled",
+		zap.String("rules_file", cfg.RulesFile),
+		zap.Int("rules", len(rules.Rules)),
+		zap.Int("restored_alarms", restored))
+	return engine, nil
+}
+
+// createInfluxWriter 创建InfluxDB批量写入器
+func createInfluxWriter(influxClient influxdb2.Client, cfg config.InfluxDBConfig, logger *zap.Logger) (*writer.BatchWriter, error) {
+	return writer.NewBatchWriter(influxClient.WriteAPIBlocking(cfg.Org, cfg.Bucket), writer.Options{
+		BatchSize:        cfg.Write.BatchSize,
+		FlushInterval:    time.Duration(cfg.Write.FlushInterval) * time.Millisecond,
+		Workers:          cfg.Write.Workers,
+		QueueSize:        cfg.Write.QueueSize,
+		MaxRetries:       cfg.Write.MaxRetries,
+		RetryInterval:    time.Duration(cfg.Write.RetryInterval) * time.Millisecond,
+		MaxRetryInterval: time.Duration(cfg.Write.MaxRetryInterval) * time.Millisecond,
+		SpillDir:         cfg.Write.SpillDir,
+		MaxSpillBytes:    int64(cfg.Write.MaxSpillMB) << 20,
+		ReplayInterval:   time.Duration(cfg.Write.ReplayInterval) * time.Second,
+	}, logger)
+}
+
+// createTracker 创建设备可用性跟踪并从Redis恢复设备状态
+func createTracker(ctx context.Context, cfg config.AvailabilityConfig, influxWriter *writer.BatchWriter, redisClient *redis.Client, alarmEngine *alarm.Engine, logger *zap.Logger) (*availability.Tracker, error) {
+	var listener availability.Listener
+	if alarmEngine != nil {
+		severity := alarm.Severity(cfg.AlarmSeverity)
+		if severity.Rank() == 0 {
+			return nil, fmt.Errorf("unknown availability.alarm_severity %q", cfg.AlarmSeverity)
+		}
+		listener = availability.NewAlarmListener(alarmEngine, severity)
+	}
+
+	tracker := availability.NewTracker(
+		redisClient,
+		influxWriter,
+		cfg.FailureThreshold,
+		cfg.MissedIntervals,
+		time.Duration(cfg.DefaultInterval)*time.Second,
+		listener,
+		logger,
+	)
+	restored, err := tracker.Restore(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to restore device availability: %w", err)
+	}
+
+	logger.Info("availability tracking enabled", zap.Int("restored_devices", restored))
+	return tracker, nil
+}
+
+// createNormalizer 校验配置的字段类型并从Redis加载已推断的字段类型
+func createNormalizer(ctx context.Context, cfg config.FieldsConfig, redisClient *redis.Client, logger *zap.Logger) (*fields.Normalizer, error) {
+	schema := make(map[string]fields.Type, len(cfg.Types))
+	for metric, t := range cfg.Types {
+		if !fields.Type(t).Valid() {
+			return nil, fmt.Errorf("fields.types %s: unknown type %q", metric, t)
+		}
+		schema[metric] = fields.Type(t)
+	}
+	if cfg.Errors != "route" && cfg.Errors != "drop" {
+		return nil, fmt.Errorf("unknown fields.errors %q", cfg.Errors)
+	}
+
+	normalizer := fields.NewNormalizer(schema, cfg.Errors == "route", redisClient, logger)
+	restored, err := normalizer.Restore(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to restore field types: %w", err)
+	}
+
+	logger.Info("field normalization enabled",
+		zap.Int("schema_fields", len(schema)),
+		zap.Int("restored_fields", restored),
+		zap.String("errors", cfg.Errors))
+	return normalizer, nil
+}
+
+// createRollupManager 根据配置创建数据层级（第一个为原始数据）和降采样管理
+func createRollupManager(cfg config.RollupConfig, influxCfg config.InfluxDBConfig, influxClient influxdb2.Client, redisClient *redis.Client, logger *zap.Logger) (*rollup.Manager, error) {
+	if len(cfg.Measurements) == 0 {
+		return nil, errors.New("rollup.measurements is required")
+	}
+
+	tiers := []rollup.Tier{{
+		Name:      "raw",
+		Bucket:    influxCfg.Bucket,
+		Retention: time.Duration(cfg.RawRetention) * time.Hour,
+	}}
+	for _, t := range cfg.Tiers {
+		bucket := t.Bucket
+		if bucket == "" {
+			bucket = influxCfg.Bucket + "_" + t.Name
+		}
+		tiers = append(tiers, rollup.Tier{
+			Name:      t.Name,
+			Every:     time.Duration(t.Every) * time.Second,
+			Bucket:    bucket,
+			Retention: time.Duration(t.Retention) * time.Hour,
+		})
+	}
+	if err := rollup.Validate(tiers); err != nil {
+		return nil, fmt.Errorf("rollup: %w", err)
+	}
+
+	names := make([]string, len(tiers))
+	for i, t := range tiers {
+		names[i] = t.Name
+	}
+	logger.Info("rollup enabled",
+		zap.Strings("tiers", names),
+		zap.Strings("measurements", cfg.Measurements))
+	return rollup.NewManager(influxClient, influxCfg.Org, tiers, cfg.Measurements,
+		time.Duration(cfg.Offset)*time.Second, redisClient, logger), nil
+}
+
+// createEnergyAnalyzer 根据配置创建供电拓扑和能耗分析
+func createEnergyAnalyzer(cfg config.EnergyConfig, influxWriter *writer.BatchWriter, redisClient *redis.Client, logger *zap.Logger) (*energy.Analyzer, error) {
+	if cfg.Interval <= 0 || cfg.StaleAfter <= 0 {
+		return nil, errors.New("energy.interval and energy.stale_after must be positive")
+	}
+	location := time.Local
+	if cfg.Timezone != "" {
+		var err error
+		if location, err = time.LoadLocation(cfg.Timezone); err != nil {
+			return nil, fmt.Errorf("energy.timezone: %w", err)
+		}
+	}
+
+	topology := &energy.Topology{
+		Utility: energySources(cfg.Utility),
+		UPS:     energySources(cfg.UPS),
+		Cooling: energySources(cfg.Cooling),
+	}
+	for _, r := range cfg.Racks {
+		topology.Racks = append(topology.Racks, energy.Rack{ID: r.ID, Room: r.Room, Sources: energySources(r.Sources)})
+	}
+	if err := topology.Validate(); err != nil {
+		return nil, fmt.Errorf("energy: %w", err)
+	}
+
+	logger.Info("energy analysis enabled",
+		zap.Int("utility", len(topology.Utility)),
+		zap.Int("ups", len(topology.UPS)),
+		zap.Int("cooling", len(topology.Cooling)),
+		zap.Int("racks", len(topology.Racks)),
+		zap.Int("interval", cfg.Interval))
+	return energy.NewAnalyzer(
+		topology,
+		redisClient,
+		influxWriter,
+		time.Duration(cfg.Interval)*time.Second,
+		time.Duration(cfg.StaleAfter)*time.Second,
+		time.Duration(cfg.Retention)*24*time.Hour,
+		location,
+		logger,
+	), nil
+}
+
+// energySources 转换功率读数来源，未配置scale时读数即为kW
+func energySources(cfgs []config.EnergySourceConfig) []energy.Source {
+	sources := make([]energy.Source, len(cfgs))
+	for i, c := range cfgs {
+		sources[i] = energy.Source{DeviceID: c.DeviceID, Metric: c.Metric, Scale: c.Scale}
+		if sources[i].Scale == 0 {
+			sources[i].Scale = 1
+		}
+	}
+	return sources
+}
+
+// createVirtualEngine 根据配置创建虚拟设备并校验表达式
+func createVirtualEngine(cfg config.VirtualConfig, redisClient *redis.Client, logger *zap.Logger) (*virtual.Engine, error) {
+	devices := make([]*virtual.Device, len(cfg.Devices))
+	for i, c := range cfg.Devices {
+		d := &virtual.Device{
+			DeviceID:   c.DeviceID,
+			DeviceType: c.DeviceType,
+			Tags:       c.Tags,
+			Inputs:     make(map[string]virtual.Input, len(c.Inputs)),
+		}
+		for name, in := range c.Inputs {
+			d.Inputs[name] = virtual.Input{DeviceID: in.DeviceID, Metric: in.Metric}
+		}
+		for _, m := range c.Metrics {
+			d.Metrics = append(d.Metrics, &virtual.Metric{
+				Name:       m.Name,
+				Expression: m.Expression,
+				Unit:       m.Unit,
+				StaleAfter: time.Duration(m.StaleAfter) * time.Second,
+			})
+		}
+		devices[i] = d
+	}
+	if err := virtual.Validate(devices); err != nil {
+		return nil, fmt.Errorf("virtual: %w", err)
+	}
+
+	logger.Info("virtual devices enabled",
+		zap.Int("devices", len(devices)),
+		zap.Int("stale_after", cfg.StaleAfter))
+	return virtual.NewEngine(devices, redisClient, time.Duration(cfg.StaleAfter)*time.Second, logger), nil
+}
+
+// createNotifier 根据配置创建通知渠道和路由，并恢复未确认告警的升级状态
+func createNotifier(ctx context.Context, cfg config.NotifyConfig, store *alarm.Store, redisClient *redis.Client, logger *zap.Logger) (*notify.Notifier, error) {
+	channels := make(map[string]notify.Channel, len(cfg.Channels))
+	for _, c := range cfg.Channels {
+		if c.Name == "" {
+			return nil, errors.New("notify channel name is required")
+		}
+		if _, ok := channels[c.Name]; ok {
+			return nil, fmt.Errorf("duplicate notify channel %s", c.Name)
+		}
+
+		switch c.Type {
+		case "webhook":
+			channels[c.Name] = notify.NewWebhookChannel(c.Name, c.URL, c.Headers)
+		case "chat":
+			ch, err := notify.NewChatChannel(c.Name, c.URL, c.Template)
+			if err != nil {
+				return nil, fmt.Errorf("notify channel %s: %w", c.Name, err)
+			}
+			channels[c.Name] = ch
+		case "email":
+			if c.SMTPAddr == "" || c.From == "" || len(c.To) == 0 {
+				return nil, fmt.Errorf("notify channel %s: smtp_addr, from and to are required", c.Name)
+			}
+			channels[c.Name] = notify.NewEmailChannel(c.Name, c.SMTPAddr, c.Username, c.Password, c.From, c.To)
+		default:
+			return nil, fmt.Errorf("notify channel %s: unknown type %q", c.Name, c.Type)
+		}
+	}
+
+	lookup := func(route string, names []string) ([]notify.Channel, error) {
+		result := make([]notify.Channel, 0, len(names))
+		for _, name := range names {
+			ch, ok := channels[name]
+			if !ok {
+				return nil, fmt.Errorf("notify route %s: unknown channel %s", route, name)
+			}
+			result = append(result, ch)
+		}
+		return result, nil
+	}
+
+	routes := make([]*notify.Route, 0, len(cfg.Routes))
+	seen := make(map[string]bool)
+	for _, r := range cfg.Routes {
+		if r.Name == "" || seen[r.Name] {
+			return nil, fmt.Errorf("notify route name %q is empty or duplicated", r.Name)
+		}
+		seen[r.Name] = true
+
+		route := &notify.Route{Name: r.Name, Sites: r.Sites}
+		for _, s := range r.Severities {
+			severity := alarm.Severity(s)
+			if severity.Rank() == 0 {
+				return nil, fmt.Errorf("notify route %s: unknown severity %q", r.Name, s)
+			}
+			route.Severities = append(route.Severities, severity)
+		}
+
+		var err error
+		if route.Channels, err = lookup(r.Name, r.Channels); err != nil {
+			return nil, err
+		}
+		if q := r.QuietHours; q != nil {
+			if q.MinSeverity != "" && alarm.Severity(q.MinSeverity).Rank() == 0 {
+				return nil, fmt.Errorf("notify route %s: unknown quiet_hours.min_severity %q", r.Name, q.MinSeverity)
+			}
+			if route.QuietHours, err = notify.NewQuietHours(q.Start, q.End, q.Timezone, alarm.Severity(q.MinSeverity)); err != nil {
+				return nil, fmt.Errorf("notify route %s: %w", r.Name, err)
+			}
+		}
+		for _, e := range r.Escalations {
+			escalation := notify.Escalation{After: time.Duration(e.After) * time.Minute}
+			if n := len(route.Escalations); e.After <= 0 || (n > 0 && escalation.After <= route.Escalations[n-1].After) {
+				return nil, fmt.Errorf("notify route %s: escalation after must be positive and increasing", r.Name)
+			}
+			if escalation.Channels, err = lookup(r.Name, e.Channels); err != nil {
+				return nil, err
+			}
+			route.Escalations = append(route.Escalations, escalation)
+		}
+		routes = append(routes, route)
+	}
+
+	notifier := notify.NewNotifier(routes, redisClient,
+		time.Duration(cfg.GroupWait)*time.Second,
+		time.Duration(cfg.FlapWindow)*time.Second,
+		cfg.FlapThreshold,
+		logger)
+	// 告警可能在其他副本确认，升级前以Store中的状态为准
+	notifier.SetAlarmLookup(store)
+
+	active, err := store.ListActive(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load active alarms: %w", err)
+	}
+	if err := notifier.Restore(ctx, active); err != nil {
+		return nil, fmt.Errorf("failed to restore escalations: %w", err)
+	}
+
+	logger.Info("alarm notification enabled",
+		zap.Int("channels", len(channels)),
+		zap.Int("routes", len(routes)))
+	return notifier, nil
+}
+
+// mqttClientID 展开客户端ID中的环境变量，为空时使用data-processor-<主机名>，保证多副本的客户端ID不冲突
+func mqttClientID(clientID string) string {
+	if clientID = os.ExpandEnv(clientID); clientID != "" {
+		return clientID
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = strconv.Itoa(os.Getpid())
+	}
+	return "data-processor-" + hostname
+}
+
 // createMQTTClient 创建MQTT客户端
-func createMQTTClient(cfg config.MQTTConfig, processor *processor.DataProcessor, logger *zap.Logger) mqtt.Client {
+func createMQTTClient(cfg config.MQTTConfig, dataProcessor *processor.DataProcessor, logger *zap.Logger) mqtt.Client {
+	clientID := mqttClientID(cfg.ClientID)
+
 	opts := mqtt.NewClientOptions()
 	opts.AddBroker(cfg.Broker)
-	opts.SetClientID(cfg.ClientID)
+	opts.SetClientID(clientID)
 	opts.SetUsername(cfg.Username)
 	opts.SetPassword(cfg.Password)
 	opts.SetAutoReconnect(true)
 
 	opts.SetOnConnectHandler(func(client mqtt.Client) {
-		logger.Info("MQTT connected, subscribing to topic", zap.String("topic", cfg.Topic))
+		logger.Info("MQTT connected, subscribing to topic",
+			zap.String("client_id", clientID),
+			zap.String("topic", cfg.Topic),
+			zap.String("shared_group", cfg.SharedGroup))
+
+		// 订阅数据Topic（含各编码格式的后缀Topic），配置共享订阅组时各副本分摊消息
+		filters := make(map[string]byte)
+		for _, topic := range processor.DataTopics(cfg.Topic) {
+			if cfg.SharedGroup != "" {
+				topic = fmt.Sprintf("$share/%s/%s", cfg.SharedGroup, topic)
+			}
+			filters[topic] = cfg.QoS
+		}
 
-		// 订阅数据Topic
-		token := client.Subscribe(cfg.Topic, cfg.QoS, func(client mqtt.Client, msg mqtt.Message) {
+		token := client.SubscribeMultiple(filters, func(client mqtt.Client, msg mqtt.Message) {
 			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 			defer cancel()
 
-			if err := processor.Process(ctx, msg.Payload()); err != nil {
+			encoding := processor.EncodingFromTopic(cfg.Topic, msg.Topic())
+			if err := dataProcessor.Process(ctx, encoding, msg.Payload()); err != nil {
 				logger.Error("failed to process message", zap.Error(err))
 			}
 		})
@@ -0,0 +1,251 @@
+package alarm
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// 告警状态
+const (
+	StateRaised       = "raised"
+	StateAcknowledged = "acknowledged"
+	StateCleared      = "cleared"
+)
+
+// Redis key
+const (
+	alarmKeyPrefix  = "alarm:"
+	activeAlarmsKey = "alarms:active"  // 未恢复的告警（ZSET，score为产生时间）
+	alarmHistoryKey = "alarms:history" // 已恢复的告警（ZSET，score为恢复时间）
+)
+
+var (
+	// ErrNotFound 告警不存在
+	ErrNotFound = errors.New("alarm not found")
+	// ErrInvalidState 告警当前状态不允许该操作
+	ErrInvalidState = errors.New("invalid alarm state")
+)
+
+// Alarm 告警
+type Alarm struct {
+	ID             string            `json:"id"`
+	RuleID         string            `json:"rule_id"`
+	RuleName       string            `json:"rule_name"`
+	Type           RuleType          `json:"type"`
+	Severity       Severity          `json:"severity"`
+	DeviceID       string            `json:"device_id"`
+	DeviceType     string            `json:"device_type"`
+	DeviceIP       string            `json:"device_ip"`
+	Tags           map[string]string `json:"tags,omitempty"` // 规则文件中定义的设备标签
+	Metric         string            `json:"metric,omitempty"`
+	Value          interface{}       `json:"value,omitempty"` // 触发告警的指标值（变化率规则为每秒变化量）
+	Message        string            `json:"message"`
+	State          string            `json:"state"`
+	RaisedAt       int64             `json:"raised_at"`
+	AcknowledgedAt int64             `json:"acknowledged_at,omitempty"`
+	AcknowledgedBy string            `json:"acknowledged_by,omitempty"`
+	ClearedAt      int64             `json:"cleared_at,omitempty"`
+	ClearValue     interface{}       `json:"clear_value,omitempty"` // 恢复时的指标值
+}
+
+// Active 告警是否未恢复
+func (a *Alarm) Active() bool {
+	return a.State != StateCleared
+}
+
+// stateKey 告警对应的规则和设备
+func (a *Alarm) stateKey() string {
+	return stateKey(a.RuleID, a.DeviceID)
+}
+
+// Query 告警查询条件
+type Query struct {
+	Active   bool   // true查询未恢复的告警，false查询已恢复的告警
+	DeviceID string // 为空时不筛选
+	Severity string // 为空时不筛选
+	Limit    int    // 默认100
+}
+
+// Store 告警存储（Redis）
+type Store struct {
+	redis     *redis.Client
+	retention time.Duration
+}
+
+// NewStore 创建告警存储，已恢复的告警保留retention（0表示永久保留）
+func NewStore(redisClient *redis.Client, retention time.Duration) *Store {
+	return &Store{redis: redisClient, retention: retention}
+}
+
+// Save 保存告警并维护未恢复/已恢复索引
+func (s *Store) Save(ctx context.Context, a *Alarm) error {
+	data, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+
+	key := alarmKeyPrefix + a.ID
+	pipe := s.redis.TxPipeline()
+	if a.Active() {
+		pipe.Set(ctx, key, data, 0)
+		pipe.ZAdd(ctx, activeAlarmsKey, &redis.Z{Score: float64(a.RaisedAt), Member: a.ID})
+	} else {
+		pipe.Set(ctx, key, data, s.retention)
+		pipe.ZRem(ctx, activeAlarmsKey, a.ID)
+		pipe.ZAdd(ctx, alarmHistoryKey, &redis.Z{Score: float64(a.ClearedAt), Member: a.ID})
+		if s.retention > 0 {
+			expired := time.Unix(a.ClearedAt, 0).Add(-s.retention).Unix()
+			pipe.ZRemRangeByScore(ctx, alarmHistoryKey, "-inf", "("+strconv.FormatInt(expired, 10))
+		}
+	}
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// Get 查询告警
+func (s *Store) Get(ctx context.Context, id string) (*Alarm, error) {
+	data, err := s.redis.Get(ctx, alarmKeyPrefix+id).Bytes()
+	if err == redis.Nil {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var a Alarm
+	if err := json.Unmarshal(data, &a); err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// List 查询告警，未恢复的告警按级别和产生时间排序，已恢复的告警按恢复时间倒序
+func (s *Store) List(ctx context.Context, q Query) ([]*Alarm, error) {
+	limit := q.Limit
+	if limit <= 0 {
+		limit = 100
+	}
+
+	index := alarmHistoryKey
+	if q.Active {
+		index = activeAlarmsKey
+	}
+	ids, err := s.redis.ZRevRange(ctx, index, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	// 未恢复的告警数量有限，全部读取后按级别排序；已恢复的告警按时间分批读取到limit条为止
+	want := limit
+	if q.Active {
+		want = len(ids)
+	}
+
+	alarms := make([]*Alarm, 0)
+	for start := 0; start < len(ids) && len(alarms) < want; start += limit {
+		end := start + limit
+		if end > len(ids) {
+			end = len(ids)
+		}
+		batch, err := s.getMany(ctx, ids[start:end])
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range batch {
+			if (q.DeviceID != "" && a.DeviceID != q.DeviceID) || (q.Severity != "" && string(a.Severity) != q.Severity) {
+				continue
+			}
+			alarms = append(alarms, a)
+		}
+	}
+
+	if q.Active {
+		sort.SliceStable(alarms, func(i, j int) bool {
+			return alarms[i].Severity.Rank() > alarms[j].Severity.Rank()
+		})
+	}
+	if len(alarms) > limit {
+		alarms = alarms[:limit]
+	}
+	return alarms, nil
+}
+
+// ListActive 读取全部未恢复的告警
+func (s *Store) ListActive(ctx context.Context) ([]*Alarm, error) {
+	ids, err := s.redis.ZRange(ctx, activeAlarmsKey, 0, -1).Result()
+	if err != nil || len(ids) == 0 {
+		return nil, err
+	}
+	return s.getMany(ctx, ids)
+}
+
+// FindActive 查询规则在设备上未恢复的告警，不存在时返回nil
+func (s *Store) FindActive(ctx context.Context, ruleID, deviceID string) (*Alarm, error) {
+	alarms, err := s.ListActive(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range alarms {
+		if a.RuleID == ruleID && a.DeviceID == deviceID {
+			return a, nil
+		}
+	}
+	return nil, nil
+}
+
+// getMany 批量读取告警，已过期的告警跳过
+func (s *Store) getMany(ctx context.Context, ids []string) ([]*Alarm, error) {
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = alarmKeyPrefix + id
+	}
+	values, err := s.redis.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	alarms := make([]*Alarm, 0, len(values))
+	for _, value := range values {
+		data, ok := value.(string)
+		if !ok {
+			continue
+		}
+		var a Alarm
+		if err := json.Unmarshal([]byte(data), &a); err != nil {
+			continue
+		}
+		alarms = append(alarms, &a)
+	}
+	return alarms, nil
+}
+
+// Rank 告警级别排序值，级别越高值越大
+func (s Severity) Rank() int {
+	switch s {
+	case SeverityCritical:
+		return 4
+	case SeverityMajor:
+		return 3
+	case SeverityWarning:
+		return 2
+	case SeverityInfo:
+		return 1
+	}
+	return 0
+}
+
+// newAlarmID 生成告警ID
+func newAlarmID(at time.Time) string {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return strconv.FormatInt(at.UnixMilli(), 36) + hex.EncodeToString(b)
+}
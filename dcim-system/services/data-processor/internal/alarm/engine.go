@@ -0,0 +1,535 @@
+package alarm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/dcim/services/data-processor/internal/fields"
+	"go.uber.org/zap"
+)
+
+// Sample 一次成功采集的设备数据
+type Sample struct {
+	DeviceID   string
+	DeviceType string
+	DeviceIP   string
+	Timestamp  time.Time
+	Metrics    map[string]interface{}
+}
+
+// Publisher 告警状态变化的发布接口
+type Publisher interface {
+	PublishAlarm(ctx context.Context, a *Alarm) error
+}
+
+// Publishers 依次调用多个发布器
+type Publishers []Publisher
+
+// PublishAlarm 发布到全部发布器，返回第一个错误
+func (ps Publishers) PublishAlarm(ctx context.Context, a *Alarm) error {
+	var first error
+	for _, p := range ps {
+		if err := p.PublishAlarm(ctx, a); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// SeenLookup 查询任一副本最近一次收到设备数据的时间
+type SeenLookup interface {
+	LastSeen(ctx context.Context, deviceID string) (time.Time, bool)
+}
+
+// Condition 由其他模块检测的告警条件
+type Condition struct {
+	RuleID     string
+	RuleName   string
+	Severity   Severity
+	DeviceID   string
+	DeviceType string
+	DeviceIP   string
+	Value      interface{}
+	Message    string
+}
+
+// ruleState 规则在单个设备上的评估状态
+type ruleState struct {
+	pendingSince time.Time // 条件开始满足的时间，未满足时为零值
+	alarm        *Alarm    // 未恢复的告警
+
+	// rate_of_change：上一个样本
+	prevValue float64
+	prevTime  time.Time
+	hasPrev   bool
+}
+
+// alarmChange 待保存和发布的告警状态变化
+type alarmChange struct {
+	alarm  Alarm      // 状态变化时的告警副本
+	st     *ruleState // 产生告警时的评估状态，保存后可能需要修正；恢复告警时为nil
+	raised *Alarm
+}
+
+// stateFixup 保存产生的告警后对评估状态的修正：保存失败时撤销（current为nil），
+// 其他副本已产生同一规则在同一设备上的告警时改为沿用该告警（current）
+type stateFixup struct {
+	st      *ruleState
+	raised  *Alarm
+	current *Alarm
+}
+
+// deviceSeen 设备最近一次上报数据的情况（missing_data）
+type deviceSeen struct {
+	deviceType string
+	deviceIP   string
+	at         time.Time
+	metrics    map[string]time.Time // 指标 -> 最近一次出现的时间
+}
+
+// Engine 告警规则引擎
+// 每个样本按作用范围匹配规则并评估，条件持续for后产生告警，条件不再满足时恢复；
+// missing_data规则由CheckMissing定期检查。状态变化写入Store并通过Publisher发布，
+// 保存和发布在释放mu后按状态变化的顺序执行，不阻塞其他样本的评估。
+// 多副本部署时设备可能转由其他副本处理，告警也可能在其他副本确认，保存前以Store中的告警为准
+type Engine struct {
+	mu         sync.Mutex
+	saveMu     sync.Mutex // 保证状态变化按产生的顺序保存和发布
+	rules      []*Rule
+	deviceTags map[string]map[string]string
+	store      *Store
+	publisher  Publisher
+	seen       SeenLookup // 可为nil
+	logger     *zap.Logger
+
+	states  map[string]*ruleState  // 规则|设备 -> 评估状态
+	devices map[string]*deviceSeen // 设备 -> 最近上报
+	changes []alarmChange          // 持有mu期间产生、尚未保存的状态变化
+	now     func() time.Time
+}
+
+// NewEngine 创建告警规则引擎，publisher可为nil
+func NewEngine(rules *RuleSet, store *Store, publisher Publisher, logger *zap.Logger) *Engine {
+	return &Engine{
+		rules:      rules.Rules,
+		deviceTags: rules.DeviceTags,
+		store:      store,
+		publisher:  publisher,
+		logger:     logger,
+		states:     make(map[string]*ruleState),
+		devices:    make(map[string]*deviceSeen),
+		now:        time.Now,
+	}
+}
+
+// SetPublisher 设置告警发布器，需在开始评估前调用
+func (e *Engine) SetPublisher(publisher Publisher) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.publisher = publisher
+}
+
+// SetSeenLookup 设置设备最近收到数据时间的查询，多副本共享订阅时用于判断设备是否已转由其他副本处理
+func (e *Engine) SetSeenLookup(seen SeenLookup) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.seen = seen
+}
+
+// Restore 从Store恢复未恢复的告警，规则已删除的告警直接恢复（外部告警除外）
+func (e *Engine) Restore(ctx context.Context) (int, error) {
+	alarms, err := e.store.ListActive(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	e.mu.Lock()
+	defer e.unlock(ctx)
+
+	rules := make(map[string]bool, len(e.rules))
+	for _, rule := range e.rules {
+		rules[rule.ID] = true
+	}
+
+	restored := 0
+	for _, a := range alarms {
+		if !rules[a.RuleID] && a.Type != RuleExternal {
+			e.clear(ctx, a, nil, e.now())
+			continue
+		}
+		e.state(a.RuleID, a.DeviceID).alarm = a
+		restored++
+	}
+	return restored, nil
+}
+
+// Evaluate 评估一个样本
+func (e *Engine) Evaluate(ctx context.Context, s *Sample) {
+	at := s.Timestamp
+	if at.IsZero() {
+		at = e.now()
+	}
+
+	e.mu.Lock()
+	defer e.unlock(ctx)
+
+	e.recordSeen(s, e.now())
+
+	tags := e.deviceTags[s.DeviceID]
+	for _, rule := range e.rules {
+		if !rule.matches(s.DeviceID, s.DeviceType, tags) {
+			continue
+		}
+
+		st := e.state(rule.ID, s.DeviceID)
+		value, present := s.Metrics[rule.Metric]
+
+		switch rule.Type {
+		case RuleThreshold:
+			v, ok := fields.Number(value)
+			if !ok {
+				continue
+			}
+			e.apply(ctx, rule, st, s, rule.exceeds(v, st.alarm != nil), v, at)
+
+		case RuleRateOfChange:
+			v, ok := fields.Number(value)
+			if !ok {
+				continue
+			}
+			if st.hasPrev && at.After(st.prevTime) {
+				rate := (v - st.prevValue) / at.Sub(st.prevTime).Seconds()
+				e.apply(ctx, rule, st, s, rule.exceeds(rate, st.alarm != nil), rate, at)
+			}
+			st.prevValue, st.prevTime, st.hasPrev = v, at, true
+
+		case RuleStateEquals:
+			if !present {
+				continue
+			}
+			e.apply(ctx, rule, st, s, equalValue(value, rule.Value), value, at)
+
+		case RuleMissingData:
+			if rule.Metric == "" || present {
+				e.apply(ctx, rule, st, s, false, nil, at)
+			}
+		}
+	}
+}
+
+// SetCondition 产生（active为true）或恢复外部检测的告警，不经过for延迟
+func (e *Engine) SetCondition(ctx context.Context, c Condition, active bool) {
+	e.mu.Lock()
+	defer e.unlock(ctx)
+
+	rule := &Rule{
+		ID:       c.RuleID,
+		Name:     c.RuleName,
+		Type:     RuleExternal,
+		Severity: c.Severity,
+		Message:  c.Message,
+	}
+	s := &Sample{DeviceID: c.DeviceID, DeviceType: c.DeviceType, DeviceIP: c.DeviceIP}
+	e.apply(ctx, rule, e.state(c.RuleID, c.DeviceID), s, active, c.Value, e.now())
+}
+
+// CheckMissing 检查missing_data规则，对已上报过数据的设备判断是否超时未收到数据
+func (e *Engine) CheckMissing(ctx context.Context) {
+	e.mu.Lock()
+	defer e.unlock(ctx)
+
+	now := e.now()
+	for deviceID, seen := range e.devices {
+		s := &Sample{DeviceID: deviceID, DeviceType: seen.deviceType, DeviceIP: seen.deviceIP}
+		tags := e.deviceTags[deviceID]
+
+		for _, rule := range e.rules {
+			if rule.Type != RuleMissingData || !rule.matches(deviceID, seen.deviceType, tags) {
+				continue
+			}
+
+			last := seen.at
+			if rule.Metric != "" {
+				var ok bool
+				if last, ok = seen.metrics[rule.Metric]; !ok {
+					continue // 从未上报过该指标的设备不检查
+				}
+			}
+
+			if now.Sub(last) <= rule.Timeout {
+				continue
+			}
+			if e.handedOff(ctx, deviceID, seen) {
+				break
+			}
+			e.apply(ctx, rule, e.state(rule.ID, deviceID), s, true, nil, now)
+		}
+	}
+}
+
+// handedOff 设备的数据已由其他副本收到时不再在本副本检查数据缺失，调用方需持有锁
+func (e *Engine) handedOff(ctx context.Context, deviceID string, seen *deviceSeen) bool {
+	if e.seen == nil {
+		return false
+	}
+	lastSeen, ok := e.seen.LastSeen(ctx, deviceID)
+	if !ok || lastSeen.Unix() <= seen.at.Unix() {
+		return false
+	}
+
+	delete(e.devices, deviceID)
+	e.logger.Info("device handed off to another replica, skip missing data check",
+		zap.String("device_id", deviceID),
+		zap.Time("last_seen", lastSeen))
+	return true
+}
+
+// Run 定期执行CheckMissing，直到ctx结束
+func (e *Engine) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			e.CheckMissing(ctx)
+		}
+	}
+}
+
+// Acknowledge 确认告警，只有raised状态的告警可以确认
+// 先等待已产生的状态变化保存完成，再以Store中的告警为准确认
+func (e *Engine) Acknowledge(ctx context.Context, id, user string) (*Alarm, error) {
+	e.mu.Lock()
+	e.saveMu.Lock()
+	e.mu.Unlock()
+
+	a, err := e.acknowledge(ctx, id, user)
+	e.saveMu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	e.mu.Lock()
+	if st, ok := e.states[a.stateKey()]; ok && st.alarm != nil && st.alarm.ID == id {
+		st.alarm.State = a.State
+		st.alarm.AcknowledgedAt = a.AcknowledgedAt
+		st.alarm.AcknowledgedBy = a.AcknowledgedBy
+	}
+	e.mu.Unlock()
+	return a, nil
+}
+
+// acknowledge 在Store中确认告警并发布，调用方需持有saveMu
+func (e *Engine) acknowledge(ctx context.Context, id, user string) (*Alarm, error) {
+	a, err := e.store.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if a.State != StateRaised {
+		return nil, fmt.Errorf("%w: alarm %s is %s", ErrInvalidState, id, a.State)
+	}
+
+	a.State = StateAcknowledged
+	a.AcknowledgedAt = e.now().Unix()
+	a.AcknowledgedBy = user
+	if err := e.store.Save(ctx, a); err != nil {
+		return nil, err
+	}
+	e.publish(ctx, a)
+	return a, nil
+}
+
+// Store 告警存储
+func (e *Engine) Store() *Store {
+	return e.store
+}
+
+// unlock 释放mu，并保存和发布持有mu期间产生的状态变化
+// 先取得saveMu再释放mu，使不同调用产生的状态变化按顺序保存；产生告警保存失败时撤销，下一个样本重新产生
+func (e *Engine) unlock(ctx context.Context) {
+	changes := e.changes
+	e.changes = nil
+	if len(changes) == 0 {
+		e.mu.Unlock()
+		return
+	}
+
+	e.saveMu.Lock()
+	e.mu.Unlock()
+
+	var fixups []stateFixup
+	for _, c := range changes {
+		if c.st == nil {
+			e.saveCleared(ctx, &c.alarm)
+			continue
+		}
+		if existing, ok := e.saveRaised(ctx, &c.alarm); !ok {
+			fixups = append(fixups, stateFixup{st: c.st, raised: c.raised, current: existing})
+		}
+	}
+	e.saveMu.Unlock()
+
+	if len(fixups) == 0 {
+		return
+	}
+	e.mu.Lock()
+	for _, f := range fixups {
+		switch {
+		case f.st.alarm == f.raised:
+			f.st.alarm = f.current
+		case f.current != nil && f.st.alarm == nil:
+			// 沿用已有告警之前条件已经恢复
+			e.clear(ctx, f.current, nil, e.now())
+		}
+	}
+	e.unlock(ctx)
+}
+
+// saveRaised 保存并发布产生的告警，返回是否保存成功
+// 同一规则在同一设备上已有未恢复的告警时（设备此前由其他副本处理）不再保存，返回已有的告警
+func (e *Engine) saveRaised(ctx context.Context, a *Alarm) (*Alarm, bool) {
+	existing, err := e.store.FindActive(ctx, a.RuleID, a.DeviceID)
+	if err != nil {
+		e.logger.Warn("failed to check existing alarm", zap.String("rule_id", a.RuleID), zap.String("device_id", a.DeviceID), zap.Error(err))
+	}
+	if existing != nil {
+		e.logger.Info("alarm already raised, taking over",
+			zap.String("alarm_id", existing.ID),
+			zap.String("rule_id", a.RuleID),
+			zap.String("device_id", a.DeviceID))
+		return existing, false
+	}
+
+	if err := e.store.Save(ctx, a); err != nil {
+		e.logger.Error("failed to save alarm", zap.String("rule_id", a.RuleID), zap.String("device_id", a.DeviceID), zap.Error(err))
+		return nil, false
+	}
+	e.logger.Warn("alarm raised",
+		zap.String("alarm_id", a.ID),
+		zap.String("rule_id", a.RuleID),
+		zap.String("severity", string(a.Severity)),
+		zap.String("device_id", a.DeviceID))
+	e.publish(ctx, a)
+	return nil, true
+}
+
+// saveCleared 保存并发布恢复的告警，保留Store中的确认信息（告警可能在其他副本确认）；
+// 告警已恢复或不存在（产生时保存失败）时不再保存
+func (e *Engine) saveCleared(ctx context.Context, a *Alarm) {
+	stored, err := e.store.Get(ctx, a.ID)
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return
+	case err != nil:
+		e.logger.Warn("failed to load alarm", zap.String("alarm_id", a.ID), zap.Error(err))
+	case !stored.Active():
+		return
+	default:
+		a.AcknowledgedAt = stored.AcknowledgedAt
+		a.AcknowledgedBy = stored.AcknowledgedBy
+	}
+
+	if err := e.store.Save(ctx, a); err != nil {
+		e.logger.Error("failed to save alarm", zap.String("alarm_id", a.ID), zap.Error(err))
+		return
+	}
+	e.logger.Info("alarm cleared", zap.String("alarm_id", a.ID), zap.String("device_id", a.DeviceID))
+	e.publish(ctx, a)
+}
+
+// apply 根据条件是否满足推进告警状态，调用方需持有mu
+func (e *Engine) apply(ctx context.Context, rule *Rule, st *ruleState, s *Sample, triggered bool, value interface{}, at time.Time) {
+	if !triggered {
+		st.pendingSince = time.Time{}
+		if st.alarm != nil {
+			e.clear(ctx, st.alarm, value, at)
+			st.alarm = nil
+		}
+		return
+	}
+
+	if st.alarm != nil {
+		return
+	}
+	if st.pendingSince.IsZero() {
+		st.pendingSince = at
+	}
+	if at.Sub(st.pendingSince) < rule.For {
+		return
+	}
+
+	a := &Alarm{
+		ID:         newAlarmID(at),
+		RuleID:     rule.ID,
+		RuleName:   rule.Name,
+		Type:       rule.Type,
+		Severity:   rule.Severity,
+		DeviceID:   s.DeviceID,
+		DeviceType: s.DeviceType,
+		DeviceIP:   s.DeviceIP,
+		Tags:       e.deviceTags[s.DeviceID],
+		Metric:     rule.Metric,
+		Value:      value,
+		Message:    rule.description(),
+		State:      StateRaised,
+		RaisedAt:   at.Unix(),
+	}
+	st.alarm = a
+	st.pendingSince = time.Time{}
+	e.changes = append(e.changes, alarmChange{alarm: *a, st: st, raised: a})
+}
+
+// clear 恢复告警，调用方需持有mu
+func (e *Engine) clear(ctx context.Context, a *Alarm, value interface{}, at time.Time) {
+	a.State = StateCleared
+	a.ClearedAt = at.Unix()
+	a.ClearValue = value
+	e.changes = append(e.changes, alarmChange{alarm: *a})
+}
+
+// publish 发布告警状态变化，失败只记录日志
+func (e *Engine) publish(ctx context.Context, a *Alarm) {
+	if e.publisher == nil {
+		return
+	}
+	if err := e.publisher.PublishAlarm(ctx, a); err != nil {
+		e.logger.Error("failed to publish alarm", zap.String("alarm_id", a.ID), zap.Error(err))
+	}
+}
+
+// recordSeen 记录设备和指标最近上报的时间（按接收时间，不受设备时钟影响）
+func (e *Engine) recordSeen(s *Sample, at time.Time) {
+	seen, ok := e.devices[s.DeviceID]
+	if !ok {
+		seen = &deviceSeen{metrics: make(map[string]time.Time)}
+		e.devices[s.DeviceID] = seen
+	}
+	seen.deviceType = s.DeviceType
+	seen.deviceIP = s.DeviceIP
+	seen.at = at
+	for name := range s.Metrics {
+		seen.metrics[name] = at
+	}
+}
+
+// state 获取规则在设备上的评估状态
+func (e *Engine) state(ruleID, deviceID string) *ruleState {
+	key := stateKey(ruleID, deviceID)
+	st, ok := e.states[key]
+	if !ok {
+		st = &ruleState{}
+		e.states[key] = st
+	}
+	return st
+}
+
+// stateKey 规则与设备的组合key
+func stateKey(ruleID, deviceID string) string {
+	return ruleID + "|" + deviceID
+}
@@ -0,0 +1,275 @@
+package alarm
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+)
+
+// recordPublisher 记录发布的告警状态变化
+type recordPublisher struct {
+	mu     sync.Mutex
+	alarms []Alarm
+}
+
+func (p *recordPublisher) PublishAlarm(ctx context.Context, a *Alarm) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.alarms = append(p.alarms, *a)
+	return nil
+}
+
+// take 取出已发布的状态变化
+func (p *recordPublisher) take() []Alarm {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	alarms := p.alarms
+	p.alarms = nil
+	return alarms
+}
+
+var testStart = time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+// newTestEngine 使用miniredis和固定时钟创建引擎
+func newTestEngine(t *testing.T, rules ...*Rule) (*Engine, *recordPublisher) {
+	t.Helper()
+
+	mr := miniredis.RunT(t)
+	redisClient := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { redisClient.Close() })
+
+	return newReplicaEngine(t, redisClient, rules...)
+}
+
+// newReplicaEngine 创建使用指定Redis的引擎，多个引擎共用一个Redis时模拟多副本部署
+func newReplicaEngine(t *testing.T, redisClient *redis.Client, rules ...*Rule) (*Engine, *recordPublisher) {
+	t.Helper()
+
+	set := &RuleSet{Rules: rules}
+	if err := set.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	publisher := &recordPublisher{}
+	e := NewEngine(set, NewStore(redisClient, time.Hour), publisher, zap.NewNop())
+	e.now = func() time.Time { return testStart }
+	return e, publisher
+}
+
+func TestEngineEvaluate(t *testing.T) {
+	type step struct {
+		after time.Duration // 相对testStart的采集时间
+		value float64
+		want  string // 该样本处理后发布的状态变化，为空表示没有变化
+	}
+
+	tests := []struct {
+		name  string
+		rule  *Rule
+		steps []step
+	}{
+		{
+			name: "raise after for",
+			rule: &Rule{ID: "temp", Type: RuleThreshold, Metric: "temperature", Operator: ">", Value: 30, For: 30 * time.Second},
+			steps: []step{
+				{0, 31, ""},
+				{10 * time.Second, 32, ""},
+				{20 * time.Second, 29, ""}, // 条件中断，重新计时
+				{30 * time.Second, 31, ""},
+				{50 * time.Second, 31, ""},
+				{60 * time.Second, 31, StateRaised},
+				{70 * time.Second, 33, ""},
+			},
+		},
+		{
+			name: "clear after crossing hysteresis",
+			rule: &Rule{ID: "temp", Type: RuleThreshold, Metric: "temperature", Operator: ">", Value: 30, Hysteresis: 2},
+			steps: []step{
+				{0, 31, StateRaised},
+				{10 * time.Second, 30, ""},
+				{20 * time.Second, 28.5, ""},
+				{30 * time.Second, 28, StateCleared},
+				{40 * time.Second, 29, ""},
+				{50 * time.Second, 30.5, StateRaised},
+			},
+		},
+		{
+			name: "clear below threshold for less than",
+			rule: &Rule{ID: "humidity", Type: RuleThreshold, Metric: "humidity", Operator: "<", Value: 20, Hysteresis: 5},
+			steps: []step{
+				{0, 19, StateRaised},
+				{10 * time.Second, 24, ""},
+				{20 * time.Second, 25.5, StateCleared},
+			},
+		},
+		{
+			name: "rate from consecutive samples",
+			rule: &Rule{ID: "rise", Type: RuleRateOfChange, Metric: "temperature", Operator: ">", Value: 1},
+			steps: []step{
+				{0, 20, ""},                          // 第一个样本没有变化率
+				{10 * time.Second, 25, ""},           // 0.5/s
+				{20 * time.Second, 40, StateRaised},  // 1.5/s
+				{30 * time.Second, 45, StateCleared}, // 0.5/s，只与上一个样本比较
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, publisher := newTestEngine(t, tt.rule)
+			ctx := context.Background()
+
+			for i, s := range tt.steps {
+				e.Evaluate(ctx, &Sample{
+					DeviceID:  "dev-1",
+					Timestamp: testStart.Add(s.after),
+					Metrics:   map[string]interface{}{tt.rule.Metric: s.value},
+				})
+
+				var got string
+				if published := publisher.take(); len(published) > 1 {
+					t.Fatalf("step %d: published %d changes", i, len(published))
+				} else if len(published) == 1 {
+					got = published[0].State
+				}
+				if got != s.want {
+					t.Fatalf("step %d (%v at +%s): got %q, want %q", i, s.value, s.after, got, s.want)
+				}
+
+				active, err := e.Store().ListActive(ctx)
+				if err != nil {
+					t.Fatal(err)
+				}
+				st := e.state(tt.rule.ID, "dev-1")
+				if (len(active) == 1) != (st.alarm != nil) || len(active) > 1 {
+					t.Fatalf("step %d: %d active alarms in store, engine state %v", i, len(active), st.alarm != nil)
+				}
+			}
+		})
+	}
+}
+
+func TestEngineRateValue(t *testing.T) {
+	e, publisher := newTestEngine(t, &Rule{ID: "rise", Type: RuleRateOfChange, Metric: "temperature", Operator: ">", Value: 1})
+	ctx := context.Background()
+
+	e.Evaluate(ctx, &Sample{DeviceID: "dev-1", Timestamp: testStart, Metrics: map[string]interface{}{"temperature": 20}})
+	e.Evaluate(ctx, &Sample{DeviceID: "dev-1", Timestamp: testStart.Add(4 * time.Second), Metrics: map[string]interface{}{"temperature": 30}})
+
+	published := publisher.take()
+	if len(published) != 1 || published[0].Value != 2.5 {
+		t.Fatalf("published %+v, want one alarm with rate 2.5", published)
+	}
+}
+
+func TestEngineRestore(t *testing.T) {
+	e, publisher := newTestEngine(t, &Rule{ID: "temp", Type: RuleThreshold, Metric: "temperature", Operator: ">", Value: 30})
+	ctx := context.Background()
+
+	raised := testStart.Add(-time.Hour).Unix()
+	for _, a := range []*Alarm{
+		{ID: "kept", RuleID: "temp", Type: RuleThreshold, DeviceID: "dev-1", State: StateRaised, RaisedAt: raised},
+		{ID: "deleted", RuleID: "removed", Type: RuleThreshold, DeviceID: "dev-1", State: StateAcknowledged, RaisedAt: raised},
+		{ID: "external", RuleID: "unreachable", Type: RuleExternal, DeviceID: "dev-1", State: StateRaised, RaisedAt: raised},
+	} {
+		if err := e.Store().Save(ctx, a); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	restored, err := e.Restore(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored != 2 {
+		t.Errorf("restored %d alarms, want 2", restored)
+	}
+
+	// 规则已删除的告警恢复，外部告警保留
+	deleted, err := e.Store().Get(ctx, "deleted")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted.State != StateCleared || deleted.ClearedAt != testStart.Unix() {
+		t.Errorf("alarm of deleted rule: state %s cleared_at %d, want cleared at %d", deleted.State, deleted.ClearedAt, testStart.Unix())
+	}
+	if published := publisher.take(); len(published) != 1 || published[0].ID != "deleted" {
+		t.Errorf("published %+v, want only the cleared alarm", published)
+	}
+	if st := e.state("unreachable", "dev-1"); st.alarm == nil || st.alarm.ID != "external" {
+		t.Error("external alarm not restored")
+	}
+
+	// 恢复的告警在条件不再满足时恢复，不会重复产生
+	e.Evaluate(ctx, &Sample{DeviceID: "dev-1", Timestamp: testStart, Metrics: map[string]interface{}{"temperature": 35}})
+	if published := publisher.take(); len(published) != 0 {
+		t.Fatalf("restored alarm raised again: %+v", published)
+	}
+	e.Evaluate(ctx, &Sample{DeviceID: "dev-1", Timestamp: testStart.Add(time.Minute), Metrics: map[string]interface{}{"temperature": 25}})
+	if published := publisher.take(); len(published) != 1 || published[0].ID != "kept" || published[0].State != StateCleared {
+		t.Fatalf("published %+v, want kept cleared", published)
+	}
+}
+
+func TestEngineReplicas(t *testing.T) {
+	mr := miniredis.RunT(t)
+	redisClient := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { redisClient.Close() })
+
+	rule := func() *Rule {
+		return &Rule{ID: "temp", Type: RuleThreshold, Metric: "temperature", Operator: ">", Value: 30}
+	}
+	a, publishedA := newReplicaEngine(t, redisClient, rule())
+	b, publishedB := newReplicaEngine(t, redisClient, rule())
+	ctx := context.Background()
+	sample := func(after time.Duration, value float64) *Sample {
+		return &Sample{DeviceID: "dev-1", Timestamp: testStart.Add(after), Metrics: map[string]interface{}{"temperature": value}}
+	}
+
+	a.Evaluate(ctx, sample(0, 35))
+	raised := publishedA.take()
+	if len(raised) != 1 {
+		t.Fatalf("replica a published %d changes, want 1", len(raised))
+	}
+	id := raised[0].ID
+
+	// 在副本b确认
+	if _, err := b.Acknowledge(ctx, id, "ops-zhang"); err != nil {
+		t.Fatal(err)
+	}
+	publishedB.take()
+
+	// 设备转由副本b处理时沿用已有的告警，不重复产生
+	b.Evaluate(ctx, sample(time.Minute, 36))
+	if published := publishedB.take(); len(published) != 0 {
+		t.Fatalf("replica b raised a duplicate alarm: %+v", published)
+	}
+	if active, err := b.Store().ListActive(ctx); err != nil || len(active) != 1 {
+		t.Fatalf("active alarms = %d (%v), want 1", len(active), err)
+	}
+
+	// 副本b恢复告警，保留确认信息
+	b.Evaluate(ctx, sample(2*time.Minute, 25))
+	cleared := publishedB.take()
+	if len(cleared) != 1 || cleared[0].ID != id || cleared[0].State != StateCleared || cleared[0].AcknowledgedBy != "ops-zhang" {
+		t.Fatalf("replica b published %+v, want %s cleared with acknowledgement", cleared, id)
+	}
+
+	// 副本a的过期状态不会再次恢复同一告警
+	a.Evaluate(ctx, sample(3*time.Minute, 25))
+	if published := publishedA.take(); len(published) != 0 {
+		t.Fatalf("replica a cleared the alarm again: %+v", published)
+	}
+	stored, err := a.Store().Get(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.ClearedAt != testStart.Add(2*time.Minute).Unix() || stored.AcknowledgedBy != "ops-zhang" {
+		t.Errorf("stored alarm = %+v", stored)
+	}
+}
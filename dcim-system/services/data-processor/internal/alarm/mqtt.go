@@ -0,0 +1,40 @@
+package alarm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"go.uber.org/zap"
+)
+
+// MQTTPublisher 将告警状态变化发布到 <topic>/<device_id>
+type MQTTPublisher struct {
+	client mqtt.Client
+	topic  string
+	qos    byte
+	logger *zap.Logger
+}
+
+// NewMQTTPublisher 创建MQTT告警发布器
+func NewMQTTPublisher(client mqtt.Client, topic string, qos byte, logger *zap.Logger) *MQTTPublisher {
+	return &MQTTPublisher{client: client, topic: topic, qos: qos, logger: logger}
+}
+
+// PublishAlarm 发布告警（raised/acknowledged/cleared状态的完整告警内容）
+// 告警在MQTT消息回调中产生，等待QoS>0的发布确认会阻塞客户端的消息处理，因此异步等待并只记录失败
+func (p *MQTTPublisher) PublishAlarm(ctx context.Context, a *Alarm) error {
+	payload, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+
+	token := p.client.Publish(fmt.Sprintf("%s/%s", p.topic, a.DeviceID), p.qos, false, payload)
+	go func() {
+		if token.Wait(); token.Error() != nil {
+			p.logger.Error("failed to publish alarm", zap.String("alarm_id", a.ID), zap.Error(token.Error()))
+		}
+	}()
+	return nil
+}
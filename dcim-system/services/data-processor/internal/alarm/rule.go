@@ -0,0 +1,256 @@
+package alarm
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/dcim/services/data-processor/internal/fields"
+	"gopkg.in/yaml.v3"
+)
+
+// RuleType 告警规则类型
+type RuleType string
+
+const (
+	// RuleThreshold 指标超过阈值
+	RuleThreshold RuleType = "threshold"
+	// RuleRateOfChange 指标变化率（每秒）超过阈值
+	RuleRateOfChange RuleType = "rate_of_change"
+	// RuleMissingData 超过timeout未收到设备数据（或指定指标）
+	RuleMissingData RuleType = "missing_data"
+	// RuleStateEquals 指标等于指定状态值
+	RuleStateEquals RuleType = "state_equals"
+	// RuleExternal 由其他模块检测产生的告警（如设备不可达），不能在规则文件中配置
+	RuleExternal RuleType = "external"
+)
+
+// Severity 告警级别
+type Severity string
+
+const (
+	SeverityInfo     Severity = "info"
+	SeverityWarning  Severity = "warning"
+	SeverityMajor    Severity = "major"
+	SeverityCritical Severity = "critical"
+)
+
+// Scope 规则作用范围，各条件之间为"与"关系，为空的条件不限制
+type Scope struct {
+	DeviceIDs   []string          `yaml:"device_ids"`
+	DeviceTypes []string          `yaml:"device_types"`
+	Tags        map[string]string `yaml:"tags"` // 设备标签，取自规则文件的device_tags
+}
+
+// Rule 告警规则
+type Rule struct {
+	ID         string        `yaml:"id"`
+	Name       string        `yaml:"name"`
+	Type       RuleType      `yaml:"type"`
+	Severity   Severity      `yaml:"severity"`
+	Scope      Scope         `yaml:"scope"`
+	Metric     string        `yaml:"metric"`     // missing_data为空时检查设备是否有数据
+	Operator   string        `yaml:"operator"`   // threshold/rate_of_change: >, >=, <, <=, ==, !=
+	Value      interface{}   `yaml:"value"`      // 阈值（数值），state_equals为状态值
+	Hysteresis float64       `yaml:"hysteresis"` // 回差：告警后指标需越过阈值该幅度才恢复
+	For        time.Duration `yaml:"for"`        // 条件持续该时间后才产生告警
+	Timeout    time.Duration `yaml:"timeout"`    // missing_data：超过该时间未收到数据视为缺失
+	Message    string        `yaml:"message"`    // 告警描述，为空时自动生成
+
+	threshold float64
+}
+
+// RuleSet 告警规则文件
+type RuleSet struct {
+	Rules      []*Rule                      `yaml:"rules"`
+	DeviceTags map[string]map[string]string `yaml:"device_tags"` // 设备ID -> 标签
+}
+
+// LoadRules 加载并校验告警规则文件
+func LoadRules(path string) (*RuleSet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var set RuleSet
+	if err := yaml.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if err := set.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid rules in %s: %w", path, err)
+	}
+	return &set, nil
+}
+
+// Validate 校验规则，并解析数值阈值
+func (s *RuleSet) Validate() error {
+	seen := make(map[string]bool)
+	var errs []error
+	for i, rule := range s.Rules {
+		if err := rule.validate(); err != nil {
+			errs = append(errs, fmt.Errorf("rule #%d %s: %w", i+1, rule.ID, err))
+			continue
+		}
+		if seen[rule.ID] {
+			errs = append(errs, fmt.Errorf("rule #%d: duplicate id %s", i+1, rule.ID))
+		}
+		seen[rule.ID] = true
+	}
+	return errors.Join(errs...)
+}
+
+// validate 校验单条规则
+func (r *Rule) validate() error {
+	if r.ID == "" {
+		return errors.New("id is required")
+	}
+	if strings.ContainsAny(r.ID, "|/") {
+		return errors.New("id must not contain '|' or '/'")
+	}
+
+	switch r.Severity {
+	case SeverityInfo, SeverityWarning, SeverityMajor, SeverityCritical:
+	case "":
+		r.Severity = SeverityWarning
+	default:
+		return fmt.Errorf("unknown severity %q", r.Severity)
+	}
+
+	switch r.Type {
+	case RuleThreshold, RuleRateOfChange:
+		if r.Metric == "" {
+			return errors.New("metric is required")
+		}
+		if !validOperator(r.Operator) {
+			return fmt.Errorf("unknown operator %q", r.Operator)
+		}
+		threshold, ok := fields.Number(r.Value)
+		if !ok {
+			return fmt.Errorf("value must be a number, got %v", r.Value)
+		}
+		r.threshold = threshold
+		if r.Hysteresis < 0 {
+			return errors.New("hysteresis must not be negative")
+		}
+	case RuleStateEquals:
+		if r.Metric == "" {
+			return errors.New("metric is required")
+		}
+		if r.Value == nil {
+			return errors.New("value is required")
+		}
+	case RuleMissingData:
+		if r.Timeout <= 0 {
+			return errors.New("timeout is required")
+		}
+	default:
+		return fmt.Errorf("unknown type %q", r.Type)
+	}
+
+	if r.For < 0 {
+		return errors.New("for must not be negative")
+	}
+	return nil
+}
+
+// matches 判断设备是否在规则作用范围内
+func (r *Rule) matches(deviceID, deviceType string, tags map[string]string) bool {
+	if len(r.Scope.DeviceIDs) > 0 && !contains(r.Scope.DeviceIDs, deviceID) {
+		return false
+	}
+	if len(r.Scope.DeviceTypes) > 0 && !contains(r.Scope.DeviceTypes, deviceType) {
+		return false
+	}
+	for key, value := range r.Scope.Tags {
+		if tags[key] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// description 告警描述
+func (r *Rule) description() string {
+	if r.Message != "" {
+		return r.Message
+	}
+
+	switch r.Type {
+	case RuleThreshold:
+		return fmt.Sprintf("%s %s %v", r.Metric, r.Operator, r.Value)
+	case RuleRateOfChange:
+		return fmt.Sprintf("%s rate %s %v/s", r.Metric, r.Operator, r.Value)
+	case RuleStateEquals:
+		return fmt.Sprintf("%s == %v", r.Metric, r.Value)
+	case RuleMissingData:
+		if r.Metric != "" {
+			return fmt.Sprintf("no %s data for %s", r.Metric, r.Timeout)
+		}
+		return fmt.Sprintf("no data for %s", r.Timeout)
+	}
+	return r.ID
+}
+
+// exceeds 判断value是否满足阈值条件；active为true（已告警）时阈值按回差放宽，避免在阈值附近反复告警和恢复
+func (r *Rule) exceeds(value float64, active bool) bool {
+	threshold := r.threshold
+	if active {
+		switch r.Operator {
+		case ">", ">=":
+			threshold -= r.Hysteresis
+		case "<", "<=":
+			threshold += r.Hysteresis
+		}
+	}
+	return compare(value, r.Operator, threshold)
+}
+
+// validOperator 判断比较运算符是否支持
+func validOperator(op string) bool {
+	switch op {
+	case ">", ">=", "<", "<=", "==", "!=":
+		return true
+	}
+	return false
+}
+
+// compare 按运算符比较数值
+func compare(value float64, op string, threshold float64) bool {
+	switch op {
+	case ">":
+		return value > threshold
+	case ">=":
+		return value >= threshold
+	case "<":
+		return value < threshold
+	case "<=":
+		return value <= threshold
+	case "==":
+		return value == threshold
+	case "!=":
+		return value != threshold
+	}
+	return false
+}
+
+// equalValue 比较指标值与状态值，数值统一按float64比较
+func equalValue(value, expected interface{}) bool {
+	if a, ok := fields.Number(value); ok {
+		b, ok := fields.Number(expected)
+		return ok && a == b
+	}
+	return fmt.Sprint(value) == fmt.Sprint(expected)
+}
+
+// contains 判断字符串是否在列表中
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,69 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/dcim/services/data-processor/internal/energy"
+	"go.uber.org/zap"
+)
+
+// currentEnergy GET /api/v1/energy/current 最近一个计算周期的功率、电量和PUE
+func (s *Server) currentEnergy(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	current, err := s.energy.Current(r.Context())
+	if err != nil {
+		s.logger.Error("failed to get current energy", zap.Error(err))
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if current == nil {
+		writeError(w, http.StatusNotFound, "energy not computed yet")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"success": true, "data": current})
+}
+
+// energyReports GET /api/v1/energy/reports?period=daily|monthly&from=&to=
+// 按日时from/to为YYYY-MM-DD，按月时为YYYY-MM，默认为当天或当月
+func (s *Server) energyReports(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	params := r.URL.Query()
+	period := params.Get("period")
+	if period == "" {
+		period = energy.PeriodDaily
+	}
+	layout := "2006-01-02"
+	if period == energy.PeriodMonthly {
+		layout = "2006-01"
+	}
+	to := params.Get("to")
+	if to == "" {
+		to = time.Now().In(s.energy.Location()).Format(layout)
+	}
+	from := params.Get("from")
+	if from == "" {
+		from = to
+	}
+
+	reports, err := s.energy.Reports(r.Context(), period, from, to)
+	switch {
+	case errors.Is(err, energy.ErrInvalidReport):
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	case err != nil:
+		s.logger.Error("failed to get energy reports", zap.Error(err))
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"success": true, "data": reports})
+}
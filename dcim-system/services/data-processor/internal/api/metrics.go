@@ -0,0 +1,198 @@
+package api
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dcim/services/data-processor/internal/rollup"
+	"go.uber.org/zap"
+)
+
+// 历史数据查询的默认值
+const (
+	defaultMeasurement = "device_metrics"
+	defaultRange       = time.Hour
+	defaultAggregate   = rollup.AggAvg
+)
+
+// queryMetrics GET /api/v1/metrics/query?device_id=&tag=key:value&metric=&start=&stop=&step=&agg=&format=json|csv
+// device_id、tag、metric可以重复或以逗号分隔，start/stop为RFC3339、Unix秒或相对当前的时长（如-6h、-7d）
+func (s *Server) queryMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	params := r.URL.Query()
+	format := params.Get("format")
+	if format == "" {
+		format = "json"
+	}
+	if format != "json" && format != "csv" {
+		writeError(w, http.StatusBadRequest, "format must be json or csv")
+		return
+	}
+
+	q, err := parseMetricsQuery(params, time.Now())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), s.queryTimeout)
+	defer cancel()
+	result, err := s.querier.Query(ctx, q)
+	switch {
+	case errors.Is(err, rollup.ErrInvalidQuery), errors.Is(err, rollup.ErrTooManyPoints):
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	case err != nil:
+		s.logger.Error("failed to query metrics", zap.Error(err))
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+
+	if format == "csv" {
+		writeCSV(w, result)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"success": true, "data": result})
+}
+
+// parseMetricsQuery 解析历史数据查询参数，至少需要一个指标和一个设备ID或tag条件
+func parseMetricsQuery(params url.Values, now time.Time) (*rollup.Query, error) {
+	q := &rollup.Query{
+		Measurement: params.Get("measurement"),
+		Fields:      listParam(params, "metric"),
+		Tags:        make(map[string][]string),
+		Aggregate:   params.Get("agg"),
+	}
+	if q.Measurement == "" {
+		q.Measurement = defaultMeasurement
+	}
+	if q.Aggregate == "" {
+		q.Aggregate = defaultAggregate
+	}
+	if len(q.Fields) == 0 {
+		return nil, errors.New("metric is required")
+	}
+
+	if ids := listParam(params, "device_id"); len(ids) > 0 {
+		q.Tags["device_id"] = ids
+	}
+	for _, selector := range listParam(params, "tag") {
+		key, value, ok := strings.Cut(selector, ":")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid tag selector %q, expected key:value", selector)
+		}
+		q.Tags[key] = append(q.Tags[key], value)
+	}
+	if len(q.Tags) == 0 {
+		return nil, errors.New("device_id or tag is required")
+	}
+
+	var err error
+	q.Stop = now
+	if v := params.Get("stop"); v != "" {
+		if q.Stop, err = parseTime(v, now); err != nil {
+			return nil, fmt.Errorf("invalid stop: %w", err)
+		}
+	}
+	q.Start = q.Stop.Add(-defaultRange)
+	if v := params.Get("start"); v != "" {
+		if q.Start, err = parseTime(v, now); err != nil {
+			return nil, fmt.Errorf("invalid start: %w", err)
+		}
+	}
+	if v := params.Get("step"); v != "" {
+		if q.Step, err = parseDuration(v); err != nil || q.Step <= 0 {
+			return nil, fmt.Errorf("invalid step %q", v)
+		}
+	}
+	return q, nil
+}
+
+// listParam 可重复、以逗号分隔的参数
+func listParam(params url.Values, name string) []string {
+	var list []string
+	for _, v := range params[name] {
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+	}
+	return list
+}
+
+// parseTime 解析RFC3339、Unix秒或相对当前的时长（-6h）
+func parseTime(v string, now time.Time) (time.Time, error) {
+	if strings.HasPrefix(v, "-") {
+		d, err := parseDuration(v[1:])
+		if err != nil {
+			return time.Time{}, err
+		}
+		return now.Add(-d), nil
+	}
+	if sec, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return time.Unix(sec, 0), nil
+	}
+	return time.Parse(time.RFC3339, v)
+}
+
+// parseDuration 解析时长，支持Go时长格式、天（7d）和秒数
+func parseDuration(v string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(v, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	if sec, err := strconv.Atoi(v); err == nil {
+		return time.Duration(sec) * time.Second, nil
+	}
+	return time.ParseDuration(v)
+}
+
+// writeCSV 以CSV返回查询结果，每行一个数据点，tag各占一列
+func writeCSV(w http.ResponseWriter, result *rollup.Result) {
+	tagSet := make(map[string]bool)
+	for _, s := range result.Series {
+		for k := range s.Tags {
+			tagSet[k] = true
+		}
+	}
+	tags := make([]string, 0, len(tagSet))
+	for k := range tagSet {
+		tags = append(tags, k)
+	}
+	sort.Strings(tags)
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="metrics.csv"`)
+	w.WriteHeader(http.StatusOK)
+
+	cw := csv.NewWriter(w)
+	header := append([]string{"time", "measurement", "field"}, tags...)
+	cw.Write(append(header, "value"))
+	for _, s := range result.Series {
+		row := make([]string, 0, len(header)+1)
+		for _, p := range s.Points {
+			row = append(row[:0], p.Time.UTC().Format(time.RFC3339), s.Measurement, s.Field)
+			for _, k := range tags {
+				row = append(row, s.Tags[k])
+			}
+			cw.Write(append(row, strconv.FormatFloat(p.Value, 'f', -1, 64)))
+		}
+	}
+	cw.Flush()
+}
@@ -0,0 +1,323 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dcim/services/data-processor/internal/alarm"
+	"github.com/dcim/services/data-processor/internal/deadletter"
+	"github.com/dcim/services/data-processor/internal/energy"
+	"github.com/dcim/services/data-processor/internal/fields"
+	"github.com/dcim/services/data-processor/internal/rollup"
+	"github.com/dcim/services/data-processor/internal/stream"
+	"go.uber.org/zap"
+)
+
+// Replayer 重放死信消息
+type Replayer interface {
+	Replay(ctx context.Context, m *deadletter.Message) error
+}
+
+// Server 数据处理服务HTTP接口
+type Server struct {
+	alarms       *alarm.Engine
+	fields       *fields.Normalizer
+	deadLetters  *deadletter.FileStore
+	replayer     Replayer
+	querier      *rollup.Querier
+	queryTimeout time.Duration
+	energy       *energy.Analyzer
+	logger       *zap.Logger
+	mux          *http.ServeMux
+}
+
+// NewServer 创建HTTP接口，alarms为nil时不提供告警接口，normalizer为nil时不提供字段接口，
+// deadLetters为nil时不提供死信接口，querier为nil时不提供历史数据查询接口，hub为nil时不提供实时推送接口，
+// analyzer为nil时不提供能耗接口
+func NewServer(
+	alarms *alarm.Engine,
+	normalizer *fields.Normalizer,
+	deadLetters *deadletter.FileStore,
+	replayer Replayer,
+	querier *rollup.Querier,
+	queryTimeout time.Duration,
+	hub *stream.Hub,
+	analyzer *energy.Analyzer,
+	logger *zap.Logger,
+) *Server {
+	s := &Server{
+		alarms:       alarms,
+		fields:       normalizer,
+		deadLetters:  deadLetters,
+		replayer:     replayer,
+		querier:      querier,
+		queryTimeout: queryTimeout,
+		energy:       analyzer,
+		logger:       logger,
+		mux:          http.NewServeMux(),
+	}
+
+	s.mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"status": "ok"})
+	})
+	if alarms != nil {
+		s.mux.HandleFunc("/api/v1/alarms", s.listAlarms)
+		s.mux.HandleFunc("/api/v1/alarms/", s.alarm)
+	}
+	if normalizer != nil {
+		s.mux.HandleFunc("/api/v1/fields", s.listFields)
+	}
+	if deadLetters != nil {
+		s.mux.HandleFunc("/api/v1/deadletters", s.listDeadLetters)
+		s.mux.HandleFunc("/api/v1/deadletters/replay", s.replayDeadLetters)
+		s.mux.HandleFunc("/api/v1/deadletters/", s.deadLetter)
+	}
+	if querier != nil {
+		s.mux.HandleFunc("/api/v1/metrics/query", s.queryMetrics)
+	}
+	if hub != nil {
+		s.mux.HandleFunc("/api/v1/stream", hub.ServeSSE)
+		s.mux.HandleFunc("/api/v1/stream/ws", hub.ServeWS)
+	}
+	if analyzer != nil {
+		s.mux.HandleFunc("/api/v1/energy/current", s.currentEnergy)
+		s.mux.HandleFunc("/api/v1/energy/reports", s.energyReports)
+	}
+	return s
+}
+
+// ServeHTTP 实现http.Handler
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// ackRequest 确认告警请求
+type ackRequest struct {
+	User string `json:"user"`
+}
+
+// replayRequest 重放死信请求
+type replayRequest struct {
+	IDs []string `json:"ids"` // 为空时重放全部
+}
+
+// replayResult 重放结果
+type replayResult struct {
+	Replayed int      `json:"replayed"`
+	Failed   []string `json:"failed"` // 重放失败的消息ID，已重新进入死信（新的ID）
+}
+
+// listAlarms GET /api/v1/alarms?state=active|cleared&device_id=&severity=&limit=
+func (s *Server) listAlarms(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	query := r.URL.Query()
+	q := alarm.Query{
+		Active:   query.Get("state") != alarm.StateCleared,
+		DeviceID: query.Get("device_id"),
+		Severity: query.Get("severity"),
+	}
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n <= 0 {
+			writeError(w, http.StatusBadRequest, "invalid limit")
+			return
+		}
+		q.Limit = n
+	}
+
+	alarms, err := s.alarms.Store().List(r.Context(), q)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"success": true, "data": alarms})
+}
+
+// alarm GET /api/v1/alarms/{id}，POST /api/v1/alarms/{id}/ack
+func (s *Server) alarm(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/api/v1/alarms/")
+	id, action, _ := strings.Cut(path, "/")
+	if id == "" {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		a, err := s.alarms.Store().Get(r.Context(), id)
+		if err != nil {
+			writeAlarmError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"success": true, "data": a})
+
+	case action == "ack" && r.Method == http.MethodPost:
+		var req ackRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.User == "" {
+			writeError(w, http.StatusBadRequest, "user is required")
+			return
+		}
+		a, err := s.alarms.Acknowledge(r.Context(), id, req.User)
+		if err != nil {
+			writeAlarmError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"success": true, "data": a})
+
+	default:
+		writeError(w, http.StatusNotFound, "not found")
+	}
+}
+
+// listFields GET /api/v1/fields 指标字段类型及丢弃统计
+func (s *Server) listFields(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	infos, err := s.fields.Fields(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"success": true, "data": infos})
+}
+
+// listDeadLetters GET /api/v1/deadletters?reason=&device_id=&limit=
+func (s *Server) listDeadLetters(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	query := r.URL.Query()
+	q := deadletter.Query{
+		Reason:   query.Get("reason"),
+		DeviceID: query.Get("device_id"),
+	}
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n <= 0 {
+			writeError(w, http.StatusBadRequest, "invalid limit")
+			return
+		}
+		q.Limit = n
+	}
+
+	messages, err := s.deadLetters.List(q)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"success": true, "data": messages})
+}
+
+// deadLetter GET /api/v1/deadletters/{id}，DELETE /api/v1/deadletters/{id}
+func (s *Server) deadLetter(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/api/v1/deadletters/")
+	if id == "" || strings.Contains(id, "/") {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		m, err := s.deadLetters.Get(id)
+		if errors.Is(err, deadletter.ErrNotFound) {
+			writeError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"success": true, "data": m})
+
+	case http.MethodDelete:
+		taken, err := s.deadLetters.Take([]string{id})
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if len(taken) == 0 {
+			writeError(w, http.StatusNotFound, deadletter.ErrNotFound.Error())
+			return
+		}
+		s.logger.Info("dead letter deleted", zap.String("id", id))
+		writeJSON(w, http.StatusOK, map[string]interface{}{"success": true})
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// replayDeadLetters POST /api/v1/deadletters/replay 重放死信，请求体为空时重放全部
+func (s *Server) replayDeadLetters(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var req replayRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+	}
+
+	messages, err := s.deadLetters.Take(req.IDs)
+	if err != nil && len(messages) == 0 {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// 重放失败的消息由处理器重新写入死信
+	result := replayResult{Failed: []string{}}
+	for _, m := range messages {
+		if err := s.replayer.Replay(r.Context(), m); err != nil {
+			result.Failed = append(result.Failed, m.ID)
+			continue
+		}
+		result.Replayed++
+	}
+
+	s.logger.Info("dead letters replayed",
+		zap.Int("replayed", result.Replayed),
+		zap.Int("failed", len(result.Failed)))
+	writeJSON(w, http.StatusOK, map[string]interface{}{"success": true, "data": result})
+}
+
+// writeAlarmError 根据告警错误类型返回状态码
+func writeAlarmError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, alarm.ErrNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, alarm.ErrInvalidState):
+		writeError(w, http.StatusConflict, err.Error())
+	default:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// writeError 返回错误响应
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]interface{}{"error": message})
+}
+
+// writeJSON 返回JSON响应
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,48 @@
+package availability
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/dcim/services/data-processor/internal/alarm"
+)
+
+// AlarmRuleID 设备不可达告警的规则ID
+const AlarmRuleID = "device_unreachable"
+
+// AlarmListener 将设备不可达作为告警产生和恢复
+type AlarmListener struct {
+	engine   *alarm.Engine
+	severity alarm.Severity
+}
+
+// NewAlarmListener 创建设备不可达告警
+func NewAlarmListener(engine *alarm.Engine, severity alarm.Severity) *AlarmListener {
+	return &AlarmListener{engine: engine, severity: severity}
+}
+
+// StatusChanged 设备不可达时产生告警，恢复在线时恢复告警
+func (l *AlarmListener) StatusChanged(ctx context.Context, d *Device) {
+	l.engine.SetCondition(ctx, alarm.Condition{
+		RuleID:     AlarmRuleID,
+		RuleName:   "设备不可达",
+		Severity:   l.severity,
+		DeviceID:   d.DeviceID,
+		DeviceType: d.DeviceType,
+		DeviceIP:   d.DeviceIP,
+		Value:      d.ConsecutiveFailures,
+		Message:    describe(d),
+	}, d.Status == StatusUnreachable)
+}
+
+// describe 不可达原因描述
+func describe(d *Device) string {
+	if d.Reason == ReasonSilent {
+		return fmt.Sprintf("no data for %s", time.Duration(d.Since-d.LastSeen)*time.Second)
+	}
+	if d.LastError != "" {
+		return fmt.Sprintf("%d consecutive collection failures: %s", d.ConsecutiveFailures, d.LastError)
+	}
+	return fmt.Sprintf("%d consecutive collection failures", d.ConsecutiveFailures)
+}
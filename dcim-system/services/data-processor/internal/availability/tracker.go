@@ -0,0 +1,395 @@
+package availability
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
+	"github.com/influxdata/influxdb-client-go/v2/api"
+	"go.uber.org/zap"
+)
+
+// Status 设备可用状态
+type Status string
+
+const (
+	StatusOnline      Status = "online"
+	StatusUnreachable Status = "unreachable"
+)
+
+// 不可达原因
+const (
+	ReasonFailed = "failed" // 连续采集失败
+	ReasonSilent = "silent" // 超过N个采集间隔未收到数据
+)
+
+// Redis key
+const (
+	deviceKeyPrefix = "device:availability:" // 设备可用状态（JSON）
+	devicesKey      = "devices:availability" // 设备索引（ZSET，score为最近一次收到数据的时间）
+)
+
+// measurement InfluxDB中的可用性数据，up为1表示采集成功
+const measurement = "device_availability"
+
+// Device 设备可用状态
+type Device struct {
+	DeviceID            string  `json:"device_id"`
+	DeviceIP            string  `json:"device_ip"`
+	DeviceType          string  `json:"device_type"`
+	Status              Status  `json:"status"`
+	Reason              string  `json:"reason,omitempty"` // 不可达原因
+	Since               int64   `json:"since"`            // 进入当前状态的时间
+	LastSeen            int64   `json:"last_seen"`        // 最近一次收到采集结果的时间
+	LastSuccess         int64   `json:"last_success,omitempty"`
+	LastFailure         int64   `json:"last_failure,omitempty"`
+	LastError           string  `json:"last_error,omitempty"`
+	ConsecutiveFailures int     `json:"consecutive_failures"`
+	IntervalSeconds     float64 `json:"interval_seconds,omitempty"` // 估计的采集间隔
+}
+
+// Result 一次采集结果
+type Result struct {
+	DeviceID   string
+	DeviceIP   string
+	DeviceType string
+	Success    bool
+	Error      string
+}
+
+// Listener 设备可用状态变化的通知接口
+type Listener interface {
+	StatusChanged(ctx context.Context, d *Device)
+}
+
+// deviceState 设备的跟踪状态
+type deviceState struct {
+	device   Device
+	lastSeen time.Time
+	interval time.Duration
+	saveMu   sync.Mutex // 保证同一设备的状态按变化的顺序通知和保存
+}
+
+// pendingUpdate 持有mu期间记录的设备状态，释放mu后通知、保存并写入数据点
+type pendingUpdate struct {
+	st      *deviceState
+	device  Device
+	up      bool
+	at      time.Time
+	changed bool // 状态发生变化，需要通知listener
+	save    bool // 需要保存到Redis
+}
+
+// Tracker 设备可用性跟踪
+// 按收到采集结果的时间记录每台设备最近一次成功的时间和连续失败次数，连续失败达到failureThreshold次，
+// 或超过missedIntervals个采集间隔（按收到结果的间隔估计）未收到数据时判定为不可达。
+// 状态保存到Redis供监控大屏读取，每次采集结果写入InfluxDB用于可用率统计。
+// mu只保护内存中的状态，Redis和InfluxDB的写入在释放mu后按设备顺序执行
+type Tracker struct {
+	mu               sync.Mutex
+	devices          map[string]*deviceState
+	redis            *redis.Client
+	influxWriter     api.WriteAPIBlocking
+	failureThreshold int
+	missedIntervals  int
+	defaultInterval  time.Duration
+	listener         Listener
+	logger           *zap.Logger
+	now              func() time.Time
+}
+
+// NewTracker 创建设备可用性跟踪，defaultInterval用于尚未估计出采集间隔的设备，listener可为nil
+func NewTracker(
+	redisClient *redis.Client,
+	influxWriter api.WriteAPIBlocking,
+	failureThreshold int,
+	missedIntervals int,
+	defaultInterval time.Duration,
+	listener Listener,
+	logger *zap.Logger,
+) *Tracker {
+	return &Tracker{
+		devices:          make(map[string]*deviceState),
+		redis:            redisClient,
+		influxWriter:     influxWriter,
+		failureThreshold: failureThreshold,
+		missedIntervals:  missedIntervals,
+		defaultInterval:  defaultInterval,
+		listener:         listener,
+		logger:           logger,
+		now:              time.Now,
+	}
+}
+
+// Restore 从Redis恢复设备状态
+func (t *Tracker) Restore(ctx context.Context) (int, error) {
+	ids, err := t.redis.ZRange(ctx, devicesKey, 0, -1).Result()
+	if err != nil || len(ids) == 0 {
+		return 0, err
+	}
+
+	devices, err := t.getMany(ctx, ids)
+	if err != nil {
+		return 0, err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, d := range devices {
+		t.devices[d.DeviceID] = &deviceState{
+			device:   *d,
+			lastSeen: time.Unix(d.LastSeen, 0),
+			interval: time.Duration(d.IntervalSeconds * float64(time.Second)),
+		}
+	}
+	return len(devices), nil
+}
+
+// Record 记录一次采集结果
+func (t *Tracker) Record(ctx context.Context, r *Result) {
+	t.mu.Lock()
+
+	now := t.now()
+	st, ok := t.devices[r.DeviceID]
+	if !ok {
+		st = &deviceState{device: Device{DeviceID: r.DeviceID, Status: StatusOnline, Since: now.Unix()}}
+		t.devices[r.DeviceID] = st
+	}
+	st.observeInterval(now, t.missedIntervals)
+
+	d := &st.device
+	d.DeviceIP = r.DeviceIP
+	d.DeviceType = r.DeviceType
+	d.LastSeen = now.Unix()
+
+	changed := false
+	if r.Success {
+		d.LastSuccess = now.Unix()
+		d.ConsecutiveFailures = 0
+		if d.Status != StatusOnline {
+			t.transition(st, StatusOnline, "", now)
+			changed = true
+		}
+	} else {
+		d.LastFailure = now.Unix()
+		d.LastError = r.Error
+		d.ConsecutiveFailures++
+		if d.Status == StatusOnline && t.failureThreshold > 0 && d.ConsecutiveFailures >= t.failureThreshold {
+			t.transition(st, StatusUnreachable, ReasonFailed, now)
+			changed = true
+		}
+	}
+
+	u := t.pending(st, r.Success, changed, true, now)
+	t.mu.Unlock()
+
+	t.flush(ctx, u)
+}
+
+// Check 检查超过missedIntervals个采集间隔未收到数据的设备；已因此不可达的设备每次检查写入一个不可用的数据点
+func (t *Tracker) Check(ctx context.Context) {
+	t.mu.Lock()
+
+	now := t.now()
+	var updates []*pendingUpdate
+	for _, st := range t.devices {
+		d := &st.device
+		if d.Status == StatusUnreachable {
+			if d.Reason == ReasonSilent {
+				updates = append(updates, t.pending(st, false, false, false, now))
+			}
+			continue
+		}
+
+		if t.missedIntervals <= 0 || now.Sub(st.lastSeen) <= time.Duration(t.missedIntervals)*st.expectedInterval(t.defaultInterval) {
+			continue
+		}
+		if t.handedOff(ctx, st) {
+			continue
+		}
+		t.transition(st, StatusUnreachable, ReasonSilent, now)
+		updates = append(updates, t.pending(st, false, true, true, now))
+	}
+	t.mu.Unlock()
+
+	for _, u := range updates {
+		t.flush(ctx, u)
+	}
+}
+
+// LastSeen 任一副本最近一次收到设备数据的时间
+func (t *Tracker) LastSeen(ctx context.Context, deviceID string) (time.Time, bool) {
+	score, err := t.redis.ZScore(ctx, devicesKey, deviceID).Result()
+	if err != nil {
+		if err != redis.Nil {
+			t.logger.Warn("failed to load device last seen", zap.String("device_id", deviceID), zap.Error(err))
+		}
+		return time.Time{}, false
+	}
+	return time.Unix(int64(score), 0), true
+}
+
+// Run 定期执行Check，直到ctx结束
+func (t *Tracker) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			t.Check(ctx)
+		}
+	}
+}
+
+// transition 切换设备状态，由flush通知listener，调用方需持有mu
+func (t *Tracker) transition(st *deviceState, status Status, reason string, now time.Time) {
+	d := &st.device
+	d.Status = status
+	d.Reason = reason
+	d.Since = now.Unix()
+
+	if status == StatusUnreachable {
+		t.logger.Warn("device unreachable",
+			zap.String("device_id", d.DeviceID),
+			zap.String("reason", reason),
+			zap.Int("consecutive_failures", d.ConsecutiveFailures),
+			zap.String("last_error", d.LastError))
+	} else {
+		t.logger.Info("device reachable again", zap.String("device_id", d.DeviceID))
+	}
+}
+
+// pending 记录设备当前状态并取得设备的保存锁，调用方需持有mu；返回值需交给flush
+// 在释放mu之前取得保存锁，使同一设备的状态按变化的顺序保存
+func (t *Tracker) pending(st *deviceState, up, changed, save bool, at time.Time) *pendingUpdate {
+	st.saveMu.Lock()
+	return &pendingUpdate{st: st, device: st.device, up: up, at: at, changed: changed, save: save}
+}
+
+// flush 通知状态变化、保存状态并写入数据点，完成后释放设备的保存锁
+func (t *Tracker) flush(ctx context.Context, u *pendingUpdate) {
+	defer u.st.saveMu.Unlock()
+
+	if u.changed && t.listener != nil {
+		event := u.device
+		t.listener.StatusChanged(ctx, &event)
+	}
+	if u.save {
+		t.save(ctx, &u.device)
+	}
+	t.writePoint(ctx, &u.device, u.up, u.at)
+}
+
+// handedOff 多副本共享订阅时设备的数据可能转由其他副本处理：Redis中的最近收到时间晚于本副本时
+// 不再在本副本跟踪该设备，由收到数据的副本负责判定
+func (t *Tracker) handedOff(ctx context.Context, st *deviceState) bool {
+	lastSeen, ok := t.LastSeen(ctx, st.device.DeviceID)
+	if !ok || lastSeen.Unix() <= st.lastSeen.Unix() {
+		return false
+	}
+
+	delete(t.devices, st.device.DeviceID)
+	t.logger.Info("device handed off to another replica",
+		zap.String("device_id", st.device.DeviceID),
+		zap.Time("last_seen", lastSeen))
+	return true
+}
+
+// save 保存设备状态到Redis，失败只记录日志
+func (t *Tracker) save(ctx context.Context, d *Device) {
+	data, err := json.Marshal(d)
+	if err != nil {
+		return
+	}
+
+	pipe := t.redis.TxPipeline()
+	pipe.Set(ctx, deviceKeyPrefix+d.DeviceID, data, 0)
+	pipe.ZAdd(ctx, devicesKey, &redis.Z{Score: float64(d.LastSeen), Member: d.DeviceID})
+	if _, err := pipe.Exec(ctx); err != nil {
+		t.logger.Error("failed to save device availability", zap.String("device_id", d.DeviceID), zap.Error(err))
+	}
+}
+
+// writePoint 写入可用性数据点，失败只记录日志
+func (t *Tracker) writePoint(ctx context.Context, d *Device, up bool, at time.Time) {
+	value := 0
+	if up {
+		value = 1
+	}
+
+	point := influxdb2.NewPoint(
+		measurement,
+		map[string]string{
+			"device_id":   d.DeviceID,
+			"device_ip":   d.DeviceIP,
+			"device_type": d.DeviceType,
+		},
+		map[string]interface{}{
+			"up":                   value,
+			"consecutive_failures": d.ConsecutiveFailures,
+		},
+		at,
+	)
+	if err := t.influxWriter.WritePoint(ctx, point); err != nil {
+		t.logger.Error("failed to write availability", zap.String("device_id", d.DeviceID), zap.Error(err))
+	}
+}
+
+// getMany 批量读取设备状态
+func (t *Tracker) getMany(ctx context.Context, ids []string) ([]*Device, error) {
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = deviceKeyPrefix + id
+	}
+	values, err := t.redis.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	devices := make([]*Device, 0, len(values))
+	for i, value := range values {
+		data, ok := value.(string)
+		if !ok {
+			continue
+		}
+		var d Device
+		if err := json.Unmarshal([]byte(data), &d); err != nil {
+			return nil, fmt.Errorf("invalid availability of %s: %w", ids[i], err)
+		}
+		devices = append(devices, &d)
+	}
+	return devices, nil
+}
+
+// observeInterval 根据收到结果的间隔估计采集间隔（指数移动平均），超过missedIntervals倍的间隔视为中断不计入
+func (st *deviceState) observeInterval(now time.Time, missedIntervals int) {
+	if gap := now.Sub(st.lastSeen); !st.lastSeen.IsZero() && gap > 0 {
+		switch {
+		case st.interval == 0:
+			st.interval = gap
+		case missedIntervals > 0 && gap > time.Duration(missedIntervals)*st.interval:
+			// 中断后恢复，不更新估计
+		default:
+			st.interval = (st.interval*3 + gap) / 4
+		}
+	}
+
+	st.lastSeen = now
+	st.device.IntervalSeconds = st.interval.Seconds()
+}
+
+// expectedInterval 设备的采集间隔，尚未估计出时使用默认值
+func (st *deviceState) expectedInterval(defaultInterval time.Duration) time.Duration {
+	if st.interval > 0 {
+		return st.interval
+	}
+	return defaultInterval
+}
@@ -0,0 +1,295 @@
+package deadletter
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNotFound 死信消息不存在
+var ErrNotFound = errors.New("dead letter not found")
+
+const (
+	currentFile = "deadletter.jsonl"
+	filePrefix  = "deadletter-"
+	fileExt     = ".jsonl"
+)
+
+// Query 死信查询条件
+type Query struct {
+	Reason   string
+	DeviceID string
+	Limit    int // 0表示不限制
+}
+
+// FileStore 本地死信文件，每行一条JSON消息
+// 当前文件超过maxBytes后轮转为 deadletter-<时间>.jsonl，超过maxFiles个文件时删除最早的文件
+type FileStore struct {
+	mu       sync.Mutex
+	dir      string
+	maxBytes int64
+	maxFiles int
+	file     *os.File // 当前文件，首次写入时打开
+	size     int64
+}
+
+// NewFileStore 创建本地死信文件，maxBytes为0时不轮转，maxFiles为0时不删除
+func NewFileStore(dir string, maxBytes int64, maxFiles int) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create dead letter dir: %w", err)
+	}
+	return &FileStore{dir: dir, maxBytes: maxBytes, maxFiles: maxFiles}, nil
+}
+
+// Send 追加一条死信消息，实现Sink
+func (s *FileStore) Send(ctx context.Context, m *Message) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		if err := s.open(); err != nil {
+			return err
+		}
+	}
+	n, err := s.file.Write(append(data, '\n'))
+	s.size += int64(n)
+	if err != nil {
+		return err
+	}
+
+	if s.maxBytes > 0 && s.size >= s.maxBytes {
+		return s.rotate()
+	}
+	return nil
+}
+
+// List 按进入死信的时间倒序查询
+func (s *FileStore) List(q Query) ([]*Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	files, err := s.files()
+	if err != nil {
+		return nil, err
+	}
+
+	var result []*Message
+	for i := len(files) - 1; i >= 0; i-- {
+		messages, err := readFile(files[i])
+		if err != nil {
+			return nil, err
+		}
+		for j := len(messages) - 1; j >= 0; j-- {
+			m := messages[j]
+			if (q.Reason != "" && m.Reason != q.Reason) || (q.DeviceID != "" && m.DeviceID != q.DeviceID) {
+				continue
+			}
+			result = append(result, m)
+			if q.Limit > 0 && len(result) >= q.Limit {
+				return result, nil
+			}
+		}
+	}
+	return result, nil
+}
+
+// Get 查询单条死信消息
+func (s *FileStore) Get(id string) (*Message, error) {
+	messages, err := s.List(Query{})
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range messages {
+		if m.ID == id {
+			return m, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// Take 取出（并从文件中删除）指定ID的死信消息，ids为空时取出全部，按进入死信的时间排序
+func (s *FileStore) Take(ids []string) ([]*Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	want := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		want[id] = true
+	}
+
+	// 关闭当前文件，之后的写入重新打开
+	if s.file != nil {
+		s.file.Close()
+		s.file = nil
+	}
+
+	files, err := s.files()
+	if err != nil {
+		return nil, err
+	}
+
+	var taken []*Message
+	for _, path := range files {
+		messages, err := readFile(path)
+		if err != nil {
+			return taken, err
+		}
+
+		var keep, take []*Message
+		for _, m := range messages {
+			if len(want) == 0 || want[m.ID] {
+				take = append(take, m)
+			} else {
+				keep = append(keep, m)
+			}
+		}
+		if len(take) == 0 {
+			continue
+		}
+		if err := writeFile(path, keep); err != nil {
+			return taken, err
+		}
+		taken = append(taken, take...)
+	}
+	return taken, nil
+}
+
+// Close 关闭当前文件
+func (s *FileStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+// open 打开当前文件，调用方需持有锁
+func (s *FileStore) open() error {
+	f, err := os.OpenFile(filepath.Join(s.dir, currentFile), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	s.file = f
+	s.size = info.Size()
+	return nil
+}
+
+// rotate 轮转当前文件并删除超出数量的旧文件，调用方需持有锁
+func (s *FileStore) rotate() error {
+	s.file.Close()
+	s.file = nil
+
+	rotated := filepath.Join(s.dir, fmt.Sprintf("%s%020d%s", filePrefix, time.Now().UnixNano(), fileExt))
+	if err := os.Rename(filepath.Join(s.dir, currentFile), rotated); err != nil {
+		return err
+	}
+	if s.maxFiles <= 0 {
+		return nil
+	}
+
+	files, err := s.files()
+	if err != nil {
+		return err
+	}
+	// files不含尚未创建的当前文件，为其保留一个位置
+	for i := 0; i < len(files)-(s.maxFiles-1); i++ {
+		if err := os.Remove(files[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// files 按写入顺序列出死信文件，当前文件在最后，调用方需持有锁
+func (s *FileStore) files() ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var rotated []string
+	current := ""
+	for _, entry := range entries {
+		name := entry.Name()
+		switch {
+		case entry.IsDir():
+		case name == currentFile:
+			current = filepath.Join(s.dir, name)
+		case strings.HasPrefix(name, filePrefix) && filepath.Ext(name) == fileExt:
+			rotated = append(rotated, filepath.Join(s.dir, name))
+		}
+	}
+	sort.Strings(rotated)
+	if current != "" {
+		rotated = append(rotated, current)
+	}
+	return rotated, nil
+}
+
+// readFile 读取死信文件，跳过无法解析的行
+func readFile(path string) ([]*Message, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var messages []*Message
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		var m Message
+		if err := json.Unmarshal(scanner.Bytes(), &m); err != nil {
+			continue
+		}
+		messages = append(messages, &m)
+	}
+	return messages, scanner.Err()
+}
+
+// writeFile 重写死信文件，先写临时文件再重命名；没有剩余消息时删除文件
+func writeFile(path string, messages []*Message) error {
+	if len(messages) == 0 {
+		return os.Remove(path)
+	}
+
+	var buf bytes.Buffer
+	for _, m := range messages {
+		data, err := json.Marshal(m)
+		if err != nil {
+			return err
+		}
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0644); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
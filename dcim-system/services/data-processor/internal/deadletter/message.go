@@ -0,0 +1,63 @@
+package deadletter
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strconv"
+	"time"
+)
+
+// 进入死信的原因
+const (
+	ReasonDecode   = "decode"   // 载荷无法解码
+	ReasonRejected = "rejected" // 部分指标类型不符被丢弃
+	ReasonWrite    = "write"    // 写入InfluxDB失败
+)
+
+// Message 死信消息，保存原始载荷，修复后可以重放
+type Message struct {
+	ID       string `json:"id"`
+	Time     int64  `json:"time"`     // 进入死信的时间
+	Encoding string `json:"encoding"` // 载荷编码格式
+	DeviceID string `json:"device_id,omitempty"`
+	Reason   string `json:"reason"`
+	Error    string `json:"error"`
+	Payload  []byte `json:"payload"` // 原始载荷（JSON中为base64）
+}
+
+// NewMessage 创建死信消息，deviceID在载荷无法解码时为空
+func NewMessage(encoding, deviceID, reason string, err error, payload []byte) *Message {
+	now := time.Now()
+	b := make([]byte, 4)
+	rand.Read(b)
+
+	return &Message{
+		ID:       strconv.FormatInt(now.UnixMilli(), 36) + hex.EncodeToString(b),
+		Time:     now.Unix(),
+		Encoding: encoding,
+		DeviceID: deviceID,
+		Reason:   reason,
+		Error:    err.Error(),
+		Payload:  payload,
+	}
+}
+
+// Sink 死信输出
+type Sink interface {
+	Send(ctx context.Context, m *Message) error
+}
+
+// Sinks 依次输出到多个Sink
+type Sinks []Sink
+
+// Send 输出到全部Sink，返回第一个错误
+func (s Sinks) Send(ctx context.Context, m *Message) error {
+	var first error
+	for _, sink := range s {
+		if err := sink.Send(ctx, m); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
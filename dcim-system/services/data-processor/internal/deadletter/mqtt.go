@@ -0,0 +1,38 @@
+package deadletter
+
+import (
+	"context"
+	"encoding/json"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"go.uber.org/zap"
+)
+
+// MQTTSink 将死信消息发布到DLQ Topic，由外部系统消费
+type MQTTSink struct {
+	client mqtt.Client
+	topic  string
+	qos    byte
+	logger *zap.Logger
+}
+
+// NewMQTTSink 创建MQTT死信输出
+func NewMQTTSink(client mqtt.Client, topic string, qos byte, logger *zap.Logger) *MQTTSink {
+	return &MQTTSink{client: client, topic: topic, qos: qos, logger: logger}
+}
+
+// Send 发布死信消息，在MQTT消息回调中调用，异步等待发布确认并只记录失败
+func (s *MQTTSink) Send(ctx context.Context, m *Message) error {
+	payload, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	token := s.client.Publish(s.topic, s.qos, false, payload)
+	go func() {
+		if token.Wait(); token.Error() != nil {
+			s.logger.Error("failed to publish dead letter", zap.String("id", m.ID), zap.Error(token.Error()))
+		}
+	}()
+	return nil
+}
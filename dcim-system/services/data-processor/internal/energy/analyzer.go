@@ -0,0 +1,377 @@
+package energy
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dcim/services/data-processor/internal/fields"
+	"github.com/go-redis/redis/v8"
+	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
+	"github.com/influxdata/influxdb-client-go/v2/api"
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+	"go.uber.org/zap"
+)
+
+// Redis key
+const (
+	lastKey        = "energy:last"     // 读数来源 -> 最近一次读数（<毫秒时间戳>:<读数>）
+	totalKey       = "energy:total"    // 读数来源 -> 累计积分（读数×小时，乘以Scale为kWh）
+	snapshotKey    = "energy:snapshot" // 读数来源 -> 上一个计算周期结束时的累计积分
+	currentKey     = "energy:current"  // 最近一个计算周期的结果（JSON）
+	dailyKeyPrefix = "energy:daily:"   // 按日累计电量（HASH，分组 -> kWh），energy:daily:<YYYY-MM-DD>
+	tickLockPrefix = "energy:tick:"    // 计算周期锁，多副本时每个周期只由一个副本计算
+)
+
+// InfluxDB measurement
+const (
+	siteMeasurement = "datacenter_energy" // 全站功率、电量和PUE
+	rackMeasurement = "rack_energy"       // 机柜功率和电量，tag rack_id、room
+)
+
+// integrateScript 记录读数并按梯形法把与上一次读数之间的电量累加到累计积分，
+// 乱序的旧读数忽略，与上一次读数间隔超过ARGV[4]毫秒时不积分（视为数据中断）
+var integrateScript = redis.NewScript(`
+local prev = redis.call('HGET', KEYS[1], ARGV[1])
+local ts = tonumber(ARGV[2])
+local value = tonumber(ARGV[3])
+if prev then
+	local sep = string.find(prev, ':', 1, true)
+	local prevTs = tonumber(string.sub(prev, 1, sep - 1))
+	local prevValue = tonumber(string.sub(prev, sep + 1))
+	if ts <= prevTs then
+		return 0
+	end
+	if ts - prevTs <= tonumber(ARGV[4]) then
+		redis.call('HINCRBYFLOAT', KEYS[2], ARGV[1], (prevValue + value) / 2 * (ts - prevTs) / 3600000)
+	end
+end
+redis.call('HSET', KEYS[1], ARGV[1], ARGV[2] .. ':' .. ARGV[3])
+return 1
+`)
+
+// Current 最近一个计算周期的功率和PUE，读数缺失或过期的分组不输出功率
+type Current struct {
+	Time       int64        `json:"time"`
+	PUE        *float64     `json:"pue,omitempty"`
+	FacilityKW *float64     `json:"facility_kw,omitempty"`
+	ITKW       *float64     `json:"it_kw,omitempty"`
+	CoolingKW  *float64     `json:"cooling_kw,omitempty"`
+	Racks      []RackPower  `json:"racks,omitempty"`
+	Interval   IntervalData `json:"interval"`
+}
+
+// RackPower 机柜实时功率
+type RackPower struct {
+	RackID  string   `json:"rack_id"`
+	Room    string   `json:"room,omitempty"`
+	PowerKW *float64 `json:"power_kw,omitempty"`
+}
+
+// IntervalData 一个计算周期内的电量和PUE
+type IntervalData struct {
+	Seconds     int64    `json:"seconds"`
+	FacilityKWh float64  `json:"facility_kwh"`
+	ITKWh       float64  `json:"it_kwh"`
+	CoolingKWh  float64  `json:"cooling_kwh,omitempty"`
+	PUE         *float64 `json:"pue,omitempty"`
+}
+
+// reading 读数来源的最近一次读数
+type reading struct {
+	time  time.Time
+	value float64
+}
+
+// Analyzer 能耗分析
+// 数据处理器把拓扑中设备的功率读数交给Observe，按梯形法积分为电量累计到Redis，多副本处理同一拓扑的不同设备时共享累计值。
+// 每个计算周期由一个副本汇总各分组的实时功率和周期电量，计算实时PUE（设施总功率/IT功率）和周期PUE（设施电量/IT电量），
+// 写入InfluxDB并按日累计电量用于日报和月报
+type Analyzer struct {
+	topology     *Topology
+	groups       []group
+	sources      map[string][]Source
+	redis        *redis.Client
+	influxWriter api.WriteAPIBlocking
+	interval     time.Duration
+	staleAfter   time.Duration
+	retention    time.Duration
+	location     *time.Location
+	logger       *zap.Logger
+}
+
+// NewAnalyzer 创建能耗分析，interval为计算周期，读数超过staleAfter未更新时视为缺失，
+// retention为按日累计电量的保留时长，location为日报和月报划分日期的时区
+func NewAnalyzer(
+	topology *Topology,
+	redisClient *redis.Client,
+	influxWriter api.WriteAPIBlocking,
+	interval time.Duration,
+	staleAfter time.Duration,
+	retention time.Duration,
+	location *time.Location,
+	logger *zap.Logger,
+) *Analyzer {
+	return &Analyzer{
+		topology:     topology,
+		groups:       topology.groups(),
+		sources:      topology.sources(),
+		redis:        redisClient,
+		influxWriter: influxWriter,
+		interval:     interval,
+		staleAfter:   staleAfter,
+		retention:    retention,
+		location:     location,
+		logger:       logger,
+	}
+}
+
+// Observe 记录设备的功率读数，不在拓扑中的设备和指标忽略，失败只记录日志
+func (a *Analyzer) Observe(ctx context.Context, deviceID string, timestamp time.Time, metrics map[string]interface{}) {
+	sources, ok := a.sources[deviceID]
+	if !ok {
+		return
+	}
+	if timestamp.IsZero() {
+		timestamp = time.Now()
+	}
+
+	for _, s := range sources {
+		value, ok := fields.Number(metrics[s.Metric])
+		if !ok {
+			continue
+		}
+		err := integrateScript.Run(ctx, a.redis, []string{lastKey, totalKey},
+			s.key(),
+			timestamp.UnixMilli(),
+			strconv.FormatFloat(value, 'f', -1, 64),
+			a.staleAfter.Milliseconds(),
+		).Err()
+		if err != nil {
+			a.logger.Warn("failed to record power reading",
+				zap.String("device_id", deviceID),
+				zap.String("metric", s.Metric),
+				zap.Error(err))
+		}
+	}
+}
+
+// Run 每个计算周期（按周期对齐）汇总一次，直到ctx结束
+func (a *Analyzer) Run(ctx context.Context) {
+	for {
+		next := time.Now().Truncate(a.interval).Add(a.interval)
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		if err := a.Compute(ctx, next); err != nil {
+			a.logger.Error("failed to compute energy", zap.Time("time", next), zap.Error(err))
+		}
+	}
+}
+
+// Compute 汇总截至now的计算周期，同一周期已由其他副本计算时跳过
+func (a *Analyzer) Compute(ctx context.Context, now time.Time) error {
+	locked, err := a.redis.SetNX(ctx, tickLockPrefix+strconv.FormatInt(now.Unix(), 10), 1, 2*a.interval).Result()
+	if err != nil {
+		return err
+	}
+	if !locked {
+		return nil
+	}
+
+	pipe := a.redis.Pipeline()
+	lastCmd := pipe.HGetAll(ctx, lastKey)
+	totalCmd := pipe.HGetAll(ctx, totalKey)
+	snapshotCmd := pipe.HGetAll(ctx, snapshotKey)
+	currentCmd := pipe.Get(ctx, currentKey)
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return err
+	}
+
+	readings := parseReadings(lastCmd.Val())
+	totals := parseFloats(totalCmd.Val())
+	snapshot := parseFloats(snapshotCmd.Val())
+
+	current := &Current{Time: now.Unix()}
+	var previous Current
+	if err := json.Unmarshal([]byte(currentCmd.Val()), &previous); err == nil && previous.Time > 0 && previous.Time < current.Time {
+		current.Interval.Seconds = current.Time - previous.Time
+	}
+
+	// 周期电量为累计积分与上一周期结束时的差，首次计算时没有周期电量
+	deltas := make(map[string]float64, len(totals))
+	if current.Interval.Seconds > 0 {
+		for k, total := range totals {
+			if d := total - snapshot[k]; d > 0 {
+				deltas[k] = d
+			}
+		}
+	}
+
+	power := make(map[string]*float64, len(a.groups))
+	energy := make(map[string]float64, len(a.groups))
+	for _, g := range a.groups {
+		power[g.name] = a.power(g, readings, now)
+		for _, s := range g.sources {
+			energy[g.name] += deltas[s.key()] * s.Scale
+		}
+	}
+
+	current.FacilityKW, current.ITKW, current.CoolingKW = power[GroupFacility], power[GroupIT], power[GroupCooling]
+	current.PUE = ratio(current.FacilityKW, current.ITKW)
+	current.Interval.FacilityKWh = energy[GroupFacility]
+	current.Interval.ITKWh = energy[GroupIT]
+	current.Interval.CoolingKWh = energy[GroupCooling]
+	current.Interval.PUE = ratio(&current.Interval.FacilityKWh, &current.Interval.ITKWh)
+	for _, r := range a.topology.Racks {
+		current.Racks = append(current.Racks, RackPower{RackID: r.ID, Room: r.Room, PowerKW: power[rackPrefix+r.ID]})
+	}
+
+	if err := a.writeInfluxDB(ctx, current, energy, now); err != nil {
+		a.logger.Error("failed to write energy to influxdb", zap.Error(err))
+	}
+	return a.save(ctx, current, totals, energy, now)
+}
+
+// power 分组的实时功率（kW），任一读数缺失或过期时返回nil
+func (a *Analyzer) power(g group, readings map[string]reading, now time.Time) *float64 {
+	var sum float64
+	for _, s := range g.sources {
+		r, ok := readings[s.key()]
+		if !ok || now.Sub(r.time) > a.staleAfter {
+			return nil
+		}
+		sum += r.value * s.Scale
+	}
+	return &sum
+}
+
+// writeInfluxDB 写入全站和机柜的功率、周期电量和PUE
+func (a *Analyzer) writeInfluxDB(ctx context.Context, c *Current, energy map[string]float64, now time.Time) error {
+	site := map[string]interface{}{
+		"facility_kwh": c.Interval.FacilityKWh,
+		"it_kwh":       c.Interval.ITKWh,
+	}
+	setField(site, "facility_kw", c.FacilityKW)
+	setField(site, "it_kw", c.ITKW)
+	setField(site, "pue", c.PUE)
+	setField(site, "pue_interval", c.Interval.PUE)
+	if len(a.topology.Cooling) > 0 {
+		site["cooling_kwh"] = c.Interval.CoolingKWh
+		setField(site, "cooling_kw", c.CoolingKW)
+	}
+
+	points := []*write.Point{influxdb2.NewPoint(siteMeasurement, map[string]string{}, site, now)}
+	for _, r := range c.Racks {
+		fields := map[string]interface{}{"energy_kwh": energy[rackPrefix+r.RackID]}
+		setField(fields, "power_kw", r.PowerKW)
+		tags := map[string]string{"rack_id": r.RackID}
+		if r.Room != "" {
+			tags["room"] = r.Room
+		}
+		points = append(points, influxdb2.NewPoint(rackMeasurement, tags, fields, now))
+	}
+	return a.influxWriter.WritePoint(ctx, points...)
+}
+
+// save 保存本周期的累计积分快照和结果，周期电量累计到所在日期
+func (a *Analyzer) save(ctx context.Context, c *Current, totals, energy map[string]float64, now time.Time) error {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+
+	// 周期电量属于周期结束前的时刻所在的日期
+	dailyKey := dailyKeyPrefix + now.Add(-time.Nanosecond).In(a.location).Format(dateLayout)
+
+	pipe := a.redis.TxPipeline()
+	pipe.Set(ctx, currentKey, data, 0)
+	if len(totals) > 0 {
+		snapshot := make(map[string]interface{}, len(totals))
+		for k, v := range totals {
+			snapshot[k] = v
+		}
+		pipe.HSet(ctx, snapshotKey, snapshot)
+	}
+	for name, kwh := range energy {
+		if kwh > 0 {
+			pipe.HIncrByFloat(ctx, dailyKey, name, kwh)
+		}
+	}
+	pipe.Expire(ctx, dailyKey, a.retention)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// Location 日报和月报划分日期的时区
+func (a *Analyzer) Location() *time.Location {
+	return a.location
+}
+
+// Current 最近一个计算周期的结果，尚未计算时返回nil
+func (a *Analyzer) Current(ctx context.Context) (*Current, error) {
+	data, err := a.redis.Get(ctx, currentKey).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var c Current
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// parseReadings 解析最近一次读数
+func parseReadings(values map[string]string) map[string]reading {
+	readings := make(map[string]reading, len(values))
+	for k, v := range values {
+		ts, value, ok := strings.Cut(v, ":")
+		if !ok {
+			continue
+		}
+		ms, err1 := strconv.ParseInt(ts, 10, 64)
+		f, err2 := strconv.ParseFloat(value, 64)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		readings[k] = reading{time: time.UnixMilli(ms), value: f}
+	}
+	return readings
+}
+
+// parseFloats 解析HASH中的数值
+func parseFloats(values map[string]string) map[string]float64 {
+	floats := make(map[string]float64, len(values))
+	for k, v := range values {
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			floats[k] = f
+		}
+	}
+	return floats
+}
+
+// ratio a/b，任一为nil或b不大于0时返回nil
+func ratio(a, b *float64) *float64 {
+	if a == nil || b == nil || *b <= 0 {
+		return nil
+	}
+	r := *a / *b
+	return &r
+}
+
+// setField v不为nil时写入字段
+func setField(fields map[string]interface{}, name string, v *float64) {
+	if v != nil {
+		fields[name] = *v
+	}
+}
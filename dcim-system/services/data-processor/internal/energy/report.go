@@ -0,0 +1,135 @@
+package energy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// 报表周期
+const (
+	PeriodDaily   = "daily"
+	PeriodMonthly = "monthly"
+)
+
+// 日期格式
+const (
+	dateLayout  = "2006-01-02"
+	monthLayout = "2006-01"
+)
+
+// 单次报表的最大周期数
+const (
+	maxDays   = 366
+	maxMonths = 36
+)
+
+// ErrInvalidReport 报表参数无效
+var ErrInvalidReport = errors.New("invalid energy report")
+
+// Report 一天或一个月的用电量
+type Report struct {
+	Period      string       `json:"period"` // YYYY-MM-DD或YYYY-MM
+	FacilityKWh float64      `json:"facility_kwh"`
+	ITKWh       float64      `json:"it_kwh"`
+	CoolingKWh  float64      `json:"cooling_kwh,omitempty"`
+	PUE         *float64     `json:"pue,omitempty"`
+	Rooms       []RoomEnergy `json:"rooms,omitempty"`
+	Racks       []RackEnergy `json:"racks,omitempty"`
+}
+
+// RoomEnergy 机房用电量（机房内各机柜之和）
+type RoomEnergy struct {
+	Room string  `json:"room"`
+	KWh  float64 `json:"kwh"`
+}
+
+// RackEnergy 机柜用电量
+type RackEnergy struct {
+	RackID string  `json:"rack_id"`
+	Room   string  `json:"room,omitempty"`
+	KWh    float64 `json:"kwh"`
+}
+
+// Reports 按日（from/to为YYYY-MM-DD）或按月（from/to为YYYY-MM）统计用电量，包含from和to
+func (a *Analyzer) Reports(ctx context.Context, period, from, to string) ([]*Report, error) {
+	layout, step, limit := dateLayout, func(t time.Time) time.Time { return t.AddDate(0, 0, 1) }, maxDays
+	if period == PeriodMonthly {
+		layout, step, limit = monthLayout, func(t time.Time) time.Time { return t.AddDate(0, 1, 0) }, maxMonths
+	} else if period != PeriodDaily {
+		return nil, fmt.Errorf("%w: period must be %s or %s", ErrInvalidReport, PeriodDaily, PeriodMonthly)
+	}
+
+	start, err := time.ParseInLocation(layout, from, a.location)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid from %q", ErrInvalidReport, from)
+	}
+	end, err := time.ParseInLocation(layout, to, a.location)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid to %q", ErrInvalidReport, to)
+	}
+	if end.Before(start) {
+		return nil, fmt.Errorf("%w: from is after to", ErrInvalidReport)
+	}
+
+	var periods []time.Time
+	for t := start; !t.After(end); t = step(t) {
+		if len(periods) == limit {
+			return nil, fmt.Errorf("%w: at most %d periods per report", ErrInvalidReport, limit)
+		}
+		periods = append(periods, t)
+	}
+
+	// 按月统计时读取月内每一天的累计电量
+	pipe := a.redis.Pipeline()
+	days := make([][]*redis.StringStringMapCmd, len(periods))
+	for i, t := range periods {
+		for day := t; day.Before(step(t)); day = day.AddDate(0, 0, 1) {
+			days[i] = append(days[i], pipe.HGetAll(ctx, dailyKeyPrefix+day.Format(dateLayout)))
+		}
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+
+	reports := make([]*Report, len(periods))
+	for i, t := range periods {
+		totals := make(map[string]float64)
+		for _, cmd := range days[i] {
+			for k, v := range parseFloats(cmd.Val()) {
+				totals[k] += v
+			}
+		}
+		reports[i] = a.report(t.Format(layout), totals)
+	}
+	return reports, nil
+}
+
+// report 由分组电量生成报表，拓扑中的机柜都会列出
+func (a *Analyzer) report(period string, totals map[string]float64) *Report {
+	r := &Report{
+		Period:      period,
+		FacilityKWh: totals[GroupFacility],
+		ITKWh:       totals[GroupIT],
+		CoolingKWh:  totals[GroupCooling],
+	}
+	r.PUE = ratio(&r.FacilityKWh, &r.ITKWh)
+
+	rooms := make(map[string]float64)
+	for _, rack := range a.topology.Racks {
+		kwh := totals[rackPrefix+rack.ID]
+		r.Racks = append(r.Racks, RackEnergy{RackID: rack.ID, Room: rack.Room, KWh: kwh})
+		if rack.Room != "" {
+			rooms[rack.Room] += kwh
+		}
+	}
+	for room, kwh := range rooms {
+		r.Rooms = append(r.Rooms, RoomEnergy{Room: room, KWh: kwh})
+	}
+	sort.Slice(r.Rooms, func(i, j int) bool { return r.Rooms[i].Room < r.Rooms[j].Room })
+	return r
+}
@@ -0,0 +1,113 @@
+package energy
+
+import (
+	"errors"
+	"fmt"
+)
+
+// 能耗分组，日报中按分组累计电量
+const (
+	GroupFacility = "facility" // 设施总功率（市电进线）
+	GroupIT       = "it"       // IT功率（UPS输出，未配置UPS时为各机柜PDU之和）
+	GroupCooling  = "cooling"  // 制冷功率
+	rackPrefix    = "rack:"    // 机柜分组，rack:<机柜ID>
+)
+
+// Source 功率读数来源：设备的一个指标，读数乘以Scale换算为kW
+type Source struct {
+	DeviceID string
+	Metric   string
+	Scale    float64
+}
+
+// key 读数来源在Redis中的标识
+func (s Source) key() string {
+	return s.DeviceID + "/" + s.Metric
+}
+
+// Rack 机柜及其PDU
+type Rack struct {
+	ID      string
+	Room    string
+	Sources []Source
+}
+
+// Topology 供电拓扑
+type Topology struct {
+	Utility []Source // 市电进线
+	UPS     []Source // UPS输出
+	Cooling []Source // 制冷设备
+	Racks   []Rack
+}
+
+// Validate 校验拓扑：需要市电进线，以及UPS输出或机柜PDU作为IT功率
+func (t *Topology) Validate() error {
+	if len(t.Utility) == 0 {
+		return errors.New("utility sources are required")
+	}
+	if len(t.UPS) == 0 && len(t.Racks) == 0 {
+		return errors.New("ups or rack sources are required for IT power")
+	}
+
+	racks := make(map[string]bool)
+	for _, r := range t.Racks {
+		if r.ID == "" || racks[r.ID] {
+			return fmt.Errorf("rack id %q is empty or duplicated", r.ID)
+		}
+		racks[r.ID] = true
+		if len(r.Sources) == 0 {
+			return fmt.Errorf("rack %s: sources are required", r.ID)
+		}
+	}
+	for _, group := range t.groups() {
+		for _, s := range group.sources {
+			if s.DeviceID == "" || s.Metric == "" || s.Scale == 0 {
+				return fmt.Errorf("%s: device_id, metric and non-zero scale are required", group.name)
+			}
+		}
+	}
+	return nil
+}
+
+// group 能耗分组及其读数来源
+type group struct {
+	name    string
+	room    string // 机柜分组所在机房
+	sources []Source
+}
+
+// groups 全部能耗分组，IT功率未配置UPS时取各机柜PDU之和
+func (t *Topology) groups() []group {
+	groups := []group{{name: GroupFacility, sources: t.Utility}}
+
+	it := t.UPS
+	if len(it) == 0 {
+		for _, r := range t.Racks {
+			it = append(it, r.Sources...)
+		}
+	}
+	groups = append(groups, group{name: GroupIT, sources: it})
+
+	if len(t.Cooling) > 0 {
+		groups = append(groups, group{name: GroupCooling, sources: t.Cooling})
+	}
+	for _, r := range t.Racks {
+		groups = append(groups, group{name: rackPrefix + r.ID, room: r.Room, sources: r.Sources})
+	}
+	return groups
+}
+
+// sources 设备ID -> 该设备的读数来源（去重）
+func (t *Topology) sources() map[string][]Source {
+	seen := make(map[string]bool)
+	byDevice := make(map[string][]Source)
+	for _, g := range t.groups() {
+		for _, s := range g.sources {
+			if !seen[s.key()] {
+				seen[s.key()] = true
+				byDevice[s.DeviceID] = append(byDevice[s.DeviceID], s)
+			}
+		}
+	}
+	return byDevice
+}
@@ -0,0 +1,272 @@
+package fields
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+)
+
+// Redis key
+const (
+	typesKey    = "metrics:field_types"     // 指标字段类型（HASH，指标 -> 类型），首次收到时写入，各副本共享
+	rejectedKey = "metrics:rejected_fields" // 类型不符被丢弃的次数（HASH，指标 -> 次数）
+	errorsKey   = "metrics:error_fields"    // 采集错误的次数（HASH，指标 -> 次数）
+	unitsKey    = "metrics:units"           // 指标单位（HASH，指标 -> 单位），由上报单位的采集端（如opc-collector）提供
+)
+
+// errorPrefix 采集端在单个指标采集失败时写入的错误值前缀，如SNMP的"error: timeout"
+const errorPrefix = "error:"
+
+// 字段类型来源
+const (
+	SourceSchema   = "schema"   // 配置文件指定
+	SourceObserved = "observed" // 首次收到的值推断
+)
+
+// Result 指标规范化结果
+type Result struct {
+	Fields   map[string]interface{} // 已转换为字段类型的指标
+	Errors   map[string]string      // 采集错误，指标 -> 错误信息；不写入错误measurement时为空
+	Rejected []string               // 类型不符被丢弃的指标
+}
+
+// FieldInfo 指标字段类型及丢弃统计
+type FieldInfo struct {
+	Name     string `json:"name"`
+	Type     Type   `json:"type,omitempty"`
+	Source   string `json:"source,omitempty"`
+	Unit     string `json:"unit,omitempty"`
+	Rejected int64  `json:"rejected"`
+	Errors   int64  `json:"errors"`
+}
+
+// Normalizer 指标字段类型规范化
+// InfluxDB中同一字段的类型固定，类型不一致的数据点会被整体拒绝。字段类型优先取配置的schema，
+// 其次为首次收到的值推断的类型（保存到Redis，各副本一致）；之后收到的值转换为该类型，
+// 无法转换的字段丢弃并计数，采集错误（"error: ..."）从指标中分离
+type Normalizer struct {
+	mu          sync.RWMutex
+	schema      map[string]Type
+	routeErrors bool
+	observed    map[string]Type
+	units       map[string]string // 已保存到Redis的指标单位
+	warned      map[string]bool   // 已记录过丢弃日志的指标，避免刷屏
+	redis       *redis.Client
+	logger      *zap.Logger
+}
+
+// NewNormalizer 创建指标规范化，schema为指标 -> 字段类型，可为空；routeErrors为false时采集错误只计数
+func NewNormalizer(schema map[string]Type, routeErrors bool, redisClient *redis.Client, logger *zap.Logger) *Normalizer {
+	return &Normalizer{
+		schema:      schema,
+		routeErrors: routeErrors,
+		observed:    make(map[string]Type),
+		units:       make(map[string]string),
+		warned:      make(map[string]bool),
+		redis:       redisClient,
+		logger:      logger,
+	}
+}
+
+// Restore 从Redis加载已推断的字段类型
+func (n *Normalizer) Restore(ctx context.Context) (int, error) {
+	types, err := n.redis.HGetAll(ctx, typesKey).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	for name, value := range types {
+		if t := Type(value); t.Valid() {
+			n.observed[name] = t
+		}
+	}
+	return len(n.observed), nil
+}
+
+// Normalize 将指标转换为各自的字段类型
+func (n *Normalizer) Normalize(ctx context.Context, deviceID string, metrics map[string]interface{}) *Result {
+	result := &Result{Fields: make(map[string]interface{}, len(metrics))}
+	collectErrors := make(map[string]string)
+
+	for name, value := range metrics {
+		if s, ok := value.(string); ok && strings.HasPrefix(s, errorPrefix) {
+			collectErrors[name] = strings.TrimSpace(strings.TrimPrefix(s, errorPrefix))
+			continue
+		}
+
+		t, ok := n.fieldType(ctx, name, value)
+		if !ok {
+			n.reject(deviceID, name, value, "unsupported value")
+			result.Rejected = append(result.Rejected, name)
+			continue
+		}
+		converted, err := convert(value, t)
+		if err != nil {
+			n.reject(deviceID, name, value, err.Error())
+			result.Rejected = append(result.Rejected, name)
+			continue
+		}
+		result.Fields[name] = converted
+	}
+
+	n.count(ctx, result.Rejected, collectErrors)
+	if n.routeErrors && len(collectErrors) > 0 {
+		result.Errors = collectErrors
+	}
+	return result
+}
+
+// RecordUnits 保存指标单位，只在单位变化时写入Redis，失败只记录日志
+func (n *Normalizer) RecordUnits(ctx context.Context, units map[string]string) {
+	changed := make(map[string]interface{})
+	n.mu.RLock()
+	for name, unit := range units {
+		if n.units[name] != unit {
+			changed[name] = unit
+		}
+	}
+	n.mu.RUnlock()
+	if len(changed) == 0 {
+		return
+	}
+
+	if err := n.redis.HSet(ctx, unitsKey, changed).Err(); err != nil {
+		n.logger.Warn("failed to save metric units", zap.Error(err))
+		return
+	}
+
+	n.mu.Lock()
+	for name, unit := range changed {
+		n.units[name] = unit.(string)
+	}
+	n.mu.Unlock()
+}
+
+// Fields 所有已知指标的字段类型和丢弃统计
+func (n *Normalizer) Fields(ctx context.Context) ([]*FieldInfo, error) {
+	pipe := n.redis.Pipeline()
+	typesCmd := pipe.HGetAll(ctx, typesKey)
+	rejectedCmd := pipe.HGetAll(ctx, rejectedKey)
+	errorsCmd := pipe.HGetAll(ctx, errorsKey)
+	unitsCmd := pipe.HGetAll(ctx, unitsKey)
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	infos := make(map[string]*FieldInfo)
+	info := func(name string) *FieldInfo {
+		if _, ok := infos[name]; !ok {
+			infos[name] = &FieldInfo{Name: name}
+		}
+		return infos[name]
+	}
+	for name, t := range typesCmd.Val() {
+		i := info(name)
+		i.Type, i.Source = Type(t), SourceObserved
+	}
+	for name, t := range n.schema {
+		i := info(name)
+		i.Type, i.Source = t, SourceSchema
+	}
+	for name, count := range rejectedCmd.Val() {
+		info(name).Rejected, _ = strconv.ParseInt(count, 10, 64)
+	}
+	for name, count := range errorsCmd.Val() {
+		info(name).Errors, _ = strconv.ParseInt(count, 10, 64)
+	}
+	for name, unit := range unitsCmd.Val() {
+		info(name).Unit = unit
+	}
+
+	result := make([]*FieldInfo, 0, len(infos))
+	for _, i := range infos {
+		result = append(result, i)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result, nil
+}
+
+// fieldType 指标的字段类型，首次收到的指标按值推断并注册到Redis，以最先注册的类型为准
+func (n *Normalizer) fieldType(ctx context.Context, name string, value interface{}) (Type, bool) {
+	if t, ok := n.schema[name]; ok {
+		return t, true
+	}
+
+	n.mu.RLock()
+	t, ok := n.observed[name]
+	n.mu.RUnlock()
+	if ok {
+		return t, true
+	}
+
+	inferred, ok := inferType(value)
+	if !ok {
+		return "", false
+	}
+
+	t = inferred
+	if set, err := n.redis.HSetNX(ctx, typesKey, name, string(inferred)).Result(); err != nil {
+		// Redis不可用时先使用推断的类型，重启后以Redis中的类型为准
+		n.logger.Warn("failed to register field type", zap.String("metric", name), zap.Error(err))
+	} else if !set {
+		// 其他副本已注册
+		registered, err := n.redis.HGet(ctx, typesKey, name).Result()
+		if err != nil {
+			n.logger.Warn("failed to load field type", zap.String("metric", name), zap.Error(err))
+		} else if Type(registered).Valid() {
+			t = Type(registered)
+		}
+	}
+
+	n.mu.Lock()
+	if existing, ok := n.observed[name]; ok {
+		t = existing
+	} else {
+		n.observed[name] = t
+		n.logger.Info("registered field type", zap.String("metric", name), zap.String("type", string(t)))
+	}
+	n.mu.Unlock()
+	return t, true
+}
+
+// reject 记录丢弃的字段，每个指标只记录一次日志
+func (n *Normalizer) reject(deviceID, name string, value interface{}, reason string) {
+	n.mu.Lock()
+	warned := n.warned[name]
+	n.warned[name] = true
+	n.mu.Unlock()
+
+	if !warned {
+		n.logger.Warn("field type mismatch, dropping field",
+			zap.String("device_id", deviceID),
+			zap.String("metric", name),
+			zap.Any("value", value),
+			zap.String("reason", reason))
+	}
+}
+
+// count 累加丢弃和采集错误的次数，失败只记录日志
+func (n *Normalizer) count(ctx context.Context, rejected []string, collectErrors map[string]string) {
+	if len(rejected) == 0 && len(collectErrors) == 0 {
+		return
+	}
+
+	pipe := n.redis.Pipeline()
+	for _, name := range rejected {
+		pipe.HIncrBy(ctx, rejectedKey, name, 1)
+	}
+	for name := range collectErrors {
+		pipe.HIncrBy(ctx, errorsKey, name, 1)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		n.logger.Warn("failed to count rejected fields", zap.Error(err))
+	}
+}
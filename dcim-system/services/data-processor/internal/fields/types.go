@@ -0,0 +1,163 @@
+package fields
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Type InfluxDB字段类型
+type Type string
+
+const (
+	TypeFloat   Type = "float"
+	TypeInteger Type = "integer"
+	TypeBoolean Type = "boolean"
+	TypeString  Type = "string"
+)
+
+// Valid 是否为支持的字段类型
+func (t Type) Valid() bool {
+	switch t {
+	case TypeFloat, TypeInteger, TypeBoolean, TypeString:
+		return true
+	}
+	return false
+}
+
+// inferType 根据首次收到的值推断字段类型，数值统一为float（解码后的数值均为float64）
+func inferType(value interface{}) (Type, bool) {
+	switch value.(type) {
+	case float64, float32, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return TypeFloat, true
+	case bool:
+		return TypeBoolean, true
+	case string:
+		return TypeString, true
+	}
+	return "", false
+}
+
+// convert 将值转换为字段类型，无法无损转换时返回错误
+func convert(value interface{}, t Type) (interface{}, error) {
+	switch t {
+	case TypeFloat:
+		return toFloat(value)
+	case TypeInteger:
+		f, err := toFloat(value)
+		if err != nil {
+			return nil, err
+		}
+		if f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxInt64 {
+			return nil, fmt.Errorf("%v is not an integer", value)
+		}
+		return int64(f), nil
+	case TypeBoolean:
+		return toBool(value)
+	case TypeString:
+		return toString(value)
+	}
+	return nil, fmt.Errorf("unknown field type %q", t)
+}
+
+// Number 数值类型的值转换为float64，布尔值和字符串不转换
+func Number(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int8:
+		return float64(v), true
+	case int16:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint:
+		return float64(v), true
+	case uint8:
+		return float64(v), true
+	case uint16:
+		return float64(v), true
+	case uint32:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	}
+	return 0, false
+}
+
+// toFloat 数值、布尔值（1/0）和数值字符串转换为float64
+func toFloat(value interface{}) (float64, error) {
+	f, ok := Number(value)
+	if !ok {
+		switch v := value.(type) {
+		case bool:
+			if v {
+				f = 1
+			}
+		case string:
+			parsed, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+			if err != nil {
+				return 0, fmt.Errorf("%q is not a number", v)
+			}
+			f = parsed
+		default:
+			return 0, fmt.Errorf("unsupported value type %T", value)
+		}
+	}
+
+	// InfluxDB不支持NaN和Inf
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0, fmt.Errorf("%v is not a finite number", f)
+	}
+	return f, nil
+}
+
+// toBool 布尔值、0/1和"true"/"false"等字符串转换为bool
+func toBool(value interface{}) (bool, error) {
+	switch v := value.(type) {
+	case bool:
+		return v, nil
+	case string:
+		b, err := strconv.ParseBool(strings.TrimSpace(v))
+		if err != nil {
+			return false, fmt.Errorf("%q is not a boolean", v)
+		}
+		return b, nil
+	}
+
+	f, err := toFloat(value)
+	if err != nil {
+		return false, err
+	}
+	switch f {
+	case 0:
+		return false, nil
+	case 1:
+		return true, nil
+	}
+	return false, fmt.Errorf("%v is not a boolean", value)
+}
+
+// toString 标量值转换为字符串
+func toString(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32), nil
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return fmt.Sprint(v), nil
+	}
+	return "", fmt.Errorf("unsupported value type %T", value)
+}
@@ -0,0 +1,191 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/dcim/services/data-processor/internal/processor"
+	"go.uber.org/zap"
+)
+
+// flushTimeout 提交offset前等待数据写入的最长时间
+const flushTimeout = 30 * time.Second
+
+// Handler 处理一条消息，与MQTT消息使用同一处理流程
+type Handler interface {
+	Process(ctx context.Context, encoding processor.Encoding, data []byte) error
+}
+
+// Flusher 等待已提交的数据写入完成
+type Flusher interface {
+	Flush(ctx context.Context) error
+}
+
+// Options Kafka消费配置
+type Options struct {
+	Brokers        []string
+	Topic          string
+	Group          string
+	Version        string        // Kafka版本，如2.6.0
+	InitialOffset  string        // 消费组首次消费的位置：oldest/newest
+	CommitInterval time.Duration // 提交offset的间隔
+	Encoding       processor.Encoding
+}
+
+// Consumer Kafka消费组输入
+// 消息交给Handler处理，每隔commit_interval等待已处理的数据写入InfluxDB（或进入溢出队列）后再提交offset，
+// 进程异常退出时未提交的消息由消费组重新投递（重复的消息按幂等键跳过）。
+// 无法解码的消息已写入死信，直接跳过；其他错误（如写入器已关闭）停止消费当前分区，从已提交的offset重新消费
+type Consumer struct {
+	group   sarama.ConsumerGroup
+	opts    Options
+	handler Handler
+	flusher Flusher
+	logger  *zap.Logger
+}
+
+// NewConsumer 创建Kafka消费组
+func NewConsumer(opts Options, handler Handler, flusher Flusher, logger *zap.Logger) (*Consumer, error) {
+	config := sarama.NewConfig()
+	version, err := sarama.ParseKafkaVersion(opts.Version)
+	if err != nil {
+		return nil, fmt.Errorf("invalid kafka version: %w", err)
+	}
+	config.Version = version
+	config.Consumer.Return.Errors = true
+	config.Consumer.Offsets.AutoCommit.Enable = false
+	switch opts.InitialOffset {
+	case "", "oldest":
+		config.Consumer.Offsets.Initial = sarama.OffsetOldest
+	case "newest":
+		config.Consumer.Offsets.Initial = sarama.OffsetNewest
+	default:
+		return nil, fmt.Errorf("invalid initial offset %q", opts.InitialOffset)
+	}
+	if opts.CommitInterval <= 0 {
+		opts.CommitInterval = 5 * time.Second
+	}
+
+	group, err := sarama.NewConsumerGroup(opts.Brokers, opts.Group, config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kafka consumer group: %w", err)
+	}
+
+	return &Consumer{
+		group:   group,
+		opts:    opts,
+		handler: handler,
+		flusher: flusher,
+		logger:  logger,
+	}, nil
+}
+
+// Run 消费消息直到ctx结束，消费组重新均衡或出错后自动重新加入
+func (c *Consumer) Run(ctx context.Context) {
+	go func() {
+		for err := range c.group.Errors() {
+			c.logger.Error("kafka consumer error", zap.Error(err))
+		}
+	}()
+
+	for {
+		if err := c.group.Consume(ctx, []string{c.opts.Topic}, c); err != nil {
+			if errors.Is(err, sarama.ErrClosedConsumerGroup) {
+				return
+			}
+			c.logger.Error("kafka consume failed", zap.Error(err))
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		// 出错后稍后重新加入，避免频繁重试
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// Close 离开消费组
+func (c *Consumer) Close() error {
+	return c.group.Close()
+}
+
+// Setup 实现sarama.ConsumerGroupHandler
+func (c *Consumer) Setup(session sarama.ConsumerGroupSession) error {
+	c.logger.Info("kafka partitions assigned", zap.Any("claims", session.Claims()))
+	return nil
+}
+
+// Cleanup 实现sarama.ConsumerGroupHandler
+func (c *Consumer) Cleanup(session sarama.ConsumerGroupSession) error {
+	return nil
+}
+
+// ConsumeClaim 处理一个分区的消息，实现sarama.ConsumerGroupHandler
+func (c *Consumer) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	ticker := time.NewTicker(c.opts.CommitInterval)
+	defer ticker.Stop()
+
+	// 已处理尚未提交的最后一条消息
+	var last *sarama.ConsumerMessage
+	commit := func() error {
+		if last == nil {
+			return nil
+		}
+		// 分区被收回时session已结束，仍需等待写入完成后提交
+		ctx, cancel := context.WithTimeout(context.Background(), flushTimeout)
+		defer cancel()
+		if err := c.flusher.Flush(ctx); err != nil {
+			return err
+		}
+		session.MarkMessage(last, "")
+		session.Commit()
+		last = nil
+		return nil
+	}
+	// 分区被收回或消费结束时提交已处理的消息
+	defer func() {
+		if err := commit(); err != nil {
+			c.logger.Warn("failed to commit kafka offset",
+				zap.String("topic", claim.Topic()),
+				zap.Int32("partition", claim.Partition()),
+				zap.Error(err))
+		}
+	}()
+
+	for {
+		select {
+		case <-session.Context().Done():
+			return nil
+
+		case <-ticker.C:
+			if err := commit(); err != nil {
+				return err
+			}
+
+		case msg, ok := <-claim.Messages():
+			if !ok {
+				return nil
+			}
+
+			ctx, cancel := context.WithTimeout(session.Context(), 10*time.Second)
+			err := c.handler.Process(ctx, c.opts.Encoding, msg.Value)
+			cancel()
+			if err != nil && !errors.Is(err, processor.ErrDecode) {
+				c.logger.Error("failed to process kafka message, stop consuming partition",
+					zap.String("topic", msg.Topic),
+					zap.Int32("partition", msg.Partition),
+					zap.Int64("offset", msg.Offset),
+					zap.Error(err))
+				return err
+			}
+			last = msg
+		}
+	}
+}
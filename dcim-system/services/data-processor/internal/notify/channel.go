@@ -0,0 +1,265 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/dcim/services/data-processor/internal/alarm"
+)
+
+// 通知类型
+const (
+	KindAlarm      = "alarm"      // 告警状态变化（产生/确认/恢复）
+	KindEscalation = "escalation" // 告警超时未确认，升级通知
+	KindFlapping   = "flapping"   // 告警频繁产生和恢复，后续状态变化暂停通知
+)
+
+// Notification 一次通知，同一路由在group_wait内的告警合并为一条
+type Notification struct {
+	Kind   string         `json:"kind"`
+	Route  string         `json:"route"`
+	Level  int            `json:"level,omitempty"` // 升级级别，从1开始
+	Alarms []*alarm.Alarm `json:"alarms"`
+}
+
+// Subject 通知标题
+func (n *Notification) Subject() string {
+	if len(n.Alarms) == 1 {
+		a := n.Alarms[0]
+		return fmt.Sprintf("[%s] %s: %s (%s)", a.Severity, n.label(a), ruleName(a), a.DeviceID)
+	}
+	return fmt.Sprintf("[%s] %d条告警 (%s)", n.severity(), len(n.Alarms), n.Route)
+}
+
+// Text 通知正文，每条告警一行
+func (n *Notification) Text() string {
+	var b strings.Builder
+	b.WriteString(n.Subject())
+	for _, a := range n.Alarms {
+		fmt.Fprintf(&b, "\n[%s] %s %s 设备%s", a.Severity, n.label(a), ruleName(a), a.DeviceID)
+		if a.DeviceIP != "" {
+			fmt.Fprintf(&b, "(%s)", a.DeviceIP)
+		}
+		fmt.Fprintf(&b, " %s", a.Message)
+		switch {
+		case a.State == alarm.StateCleared && a.ClearValue != nil:
+			fmt.Fprintf(&b, " 恢复值%v", a.ClearValue)
+		case a.State != alarm.StateCleared && a.Value != nil:
+			fmt.Fprintf(&b, " 当前值%v", a.Value)
+		}
+		if a.AcknowledgedBy != "" {
+			fmt.Fprintf(&b, " 确认人%s", a.AcknowledgedBy)
+		}
+		fmt.Fprintf(&b, " 产生于%s", time.Unix(a.RaisedAt, 0).Format("2006-01-02 15:04:05"))
+	}
+	return b.String()
+}
+
+// label 告警在通知中的状态描述
+func (n *Notification) label(a *alarm.Alarm) string {
+	switch n.Kind {
+	case KindEscalation:
+		return fmt.Sprintf("告警升级(%d级)", n.Level)
+	case KindFlapping:
+		return "告警频繁抖动"
+	}
+	switch a.State {
+	case alarm.StateAcknowledged:
+		return "告警确认"
+	case alarm.StateCleared:
+		return "告警恢复"
+	}
+	return "告警产生"
+}
+
+// severity 通知中最高的告警级别
+func (n *Notification) severity() alarm.Severity {
+	var top alarm.Severity
+	for _, a := range n.Alarms {
+		if a.Severity.Rank() > top.Rank() {
+			top = a.Severity
+		}
+	}
+	return top
+}
+
+// ruleName 告警规则名称，未配置名称时取规则ID
+func ruleName(a *alarm.Alarm) string {
+	if a.RuleName != "" {
+		return a.RuleName
+	}
+	return a.RuleID
+}
+
+// Channel 通知渠道
+type Channel interface {
+	Name() string
+	Send(ctx context.Context, n *Notification) error
+}
+
+// WebhookChannel 以JSON POST通知内容
+type WebhookChannel struct {
+	name    string
+	url     string
+	headers map[string]string
+	client  *http.Client
+}
+
+// NewWebhookChannel 创建Webhook渠道
+func NewWebhookChannel(name, url string, headers map[string]string) *WebhookChannel {
+	return &WebhookChannel{
+		name:    name,
+		url:     url,
+		headers: headers,
+		client:  &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Name 渠道名称
+func (c *WebhookChannel) Name() string {
+	return c.name
+}
+
+// Send 发送通知
+func (c *WebhookChannel) Send(ctx context.Context, n *Notification) error {
+	body, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	return postJSON(ctx, c.client, c.url, c.headers, body)
+}
+
+// ChatChannel 聊天工具机器人Webhook（钉钉、企业微信、飞书、Slack等），请求体由模板生成
+type ChatChannel struct {
+	name     string
+	url      string
+	template *template.Template
+	client   *http.Client
+}
+
+// DefaultChatTemplate 默认的聊天消息模板（Slack格式）
+const DefaultChatTemplate = `{"text": {{json .Text}}}`
+
+// NewChatChannel 创建聊天Webhook渠道，模板可使用.Subject、.Text、.Kind、.Alarms和json函数
+func NewChatChannel(name, url, tmpl string) (*ChatChannel, error) {
+	if tmpl == "" {
+		tmpl = DefaultChatTemplate
+	}
+	t, err := template.New(name).Funcs(template.FuncMap{
+		"json": func(v interface{}) (string, error) {
+			var b strings.Builder
+			enc := json.NewEncoder(&b)
+			enc.SetEscapeHTML(false)
+			if err := enc.Encode(v); err != nil {
+				return "", err
+			}
+			return strings.TrimSuffix(b.String(), "\n"), nil
+		},
+	}).Parse(tmpl)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template: %w", err)
+	}
+
+	return &ChatChannel{
+		name:     name,
+		url:      url,
+		template: t,
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+// Name 渠道名称
+func (c *ChatChannel) Name() string {
+	return c.name
+}
+
+// Send 发送通知
+func (c *ChatChannel) Send(ctx context.Context, n *Notification) error {
+	var body bytes.Buffer
+	if err := c.template.Execute(&body, n); err != nil {
+		return fmt.Errorf("failed to render template: %w", err)
+	}
+	return postJSON(ctx, c.client, c.url, nil, body.Bytes())
+}
+
+// EmailChannel SMTP邮件，服务器支持时使用STARTTLS
+type EmailChannel struct {
+	name     string
+	addr     string // host:port
+	username string
+	password string
+	from     string
+	to       []string
+}
+
+// NewEmailChannel 创建邮件渠道，username为空时不认证
+func NewEmailChannel(name, addr, username, password, from string, to []string) *EmailChannel {
+	return &EmailChannel{
+		name:     name,
+		addr:     addr,
+		username: username,
+		password: password,
+		from:     from,
+		to:       to,
+	}
+}
+
+// Name 渠道名称
+func (c *EmailChannel) Name() string {
+	return c.name
+}
+
+// Send 发送通知，net/smtp不支持ctx，超时由SMTP服务器连接决定
+func (c *EmailChannel) Send(ctx context.Context, n *Notification) error {
+	var auth smtp.Auth
+	if c.username != "" {
+		host, _, _ := strings.Cut(c.addr, ":")
+		auth = smtp.PlainAuth("", c.username, c.password, host)
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", c.from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(c.to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.BEncoding.Encode("UTF-8", n.Subject()))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	msg.WriteString("\r\n")
+	msg.WriteString(strings.ReplaceAll(n.Text(), "\n", "\r\n"))
+	msg.WriteString("\r\n")
+
+	return smtp.SendMail(c.addr, auth, c.from, c.to, msg.Bytes())
+}
+
+// postJSON POST JSON请求体，非2xx响应视为失败
+func postJSON(ctx context.Context, client *http.Client, url string, headers map[string]string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("unexpected status %d: %s", resp.StatusCode, strings.TrimSpace(string(detail)))
+	}
+	return nil
+}
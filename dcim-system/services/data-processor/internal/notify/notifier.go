@@ -0,0 +1,392 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/dcim/services/data-processor/internal/alarm"
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+)
+
+const (
+	escalationKeyPrefix = "notify:escalation:" // 告警已发送的升级级别（HASH，路由 -> 级别）
+	escalationTTL       = 7 * 24 * time.Hour
+	sendTimeout         = 30 * time.Second
+)
+
+// group 路由在group_wait内累积的告警，同一告警只保留最新状态
+type group struct {
+	since  time.Time
+	alarms map[string]*alarm.Alarm
+	raised map[string]bool // 在本组内产生的告警，组内恢复时直接丢弃
+}
+
+// flapState 规则在单个设备上的抖动检测状态
+type flapState struct {
+	raises   []time.Time  // flap_window内的告警产生时间
+	flapping bool         // 抖动期间暂停通知
+	last     *alarm.Alarm // 最近一次状态变化，抖动结束时发送
+}
+
+// pendingAck 未确认的告警
+type pendingAck struct {
+	alarm  *alarm.Alarm
+	levels map[string]int // 路由 -> 已发送的升级级别
+}
+
+// AlarmLookup 查询告警的当前状态
+type AlarmLookup interface {
+	Get(ctx context.Context, id string) (*alarm.Alarm, error)
+}
+
+// Notifier 告警通知分发
+// 实现alarm.Publisher：告警状态变化进入队列后由Run按路由分组发送，
+// 对频繁产生和恢复的告警暂停通知，静默时段内屏蔽低级别通知，超时未确认的告警发送升级通知
+type Notifier struct {
+	routes        []*Route
+	redis         *redis.Client
+	groupWait     time.Duration
+	flapWindow    time.Duration
+	flapThreshold int
+	lookup        AlarmLookup // 可为nil
+	logger        *zap.Logger
+
+	events chan *alarm.Alarm
+	now    func() time.Time
+	wg     sync.WaitGroup // 发送中的通知
+
+	// 以下字段只在Run中访问
+	groups  map[string]*group      // 路由 -> 待发送的告警
+	flaps   map[string]*flapState  // 规则|设备 -> 抖动检测状态
+	unacked map[string]*pendingAck // 告警ID -> 未确认的告警
+}
+
+// NewNotifier 创建告警通知分发，flapThreshold为0时不检测抖动
+func NewNotifier(routes []*Route, redisClient *redis.Client, groupWait, flapWindow time.Duration, flapThreshold int, logger *zap.Logger) *Notifier {
+	return &Notifier{
+		routes:        routes,
+		redis:         redisClient,
+		groupWait:     groupWait,
+		flapWindow:    flapWindow,
+		flapThreshold: flapThreshold,
+		logger:        logger,
+		events:        make(chan *alarm.Alarm, 1000),
+		now:           time.Now,
+		groups:        make(map[string]*group),
+		flaps:         make(map[string]*flapState),
+		unacked:       make(map[string]*pendingAck),
+	}
+}
+
+// SetAlarmLookup 设置告警状态查询，需在Run之前调用
+// 多副本部署时告警可能在其他副本确认或恢复，状态变化只发布到该副本的Notifier，发送升级通知前查询告警的当前状态
+func (n *Notifier) SetAlarmLookup(lookup AlarmLookup) {
+	n.lookup = lookup
+}
+
+// Restore 恢复未确认告警的升级状态，需在Run之前调用
+func (n *Notifier) Restore(ctx context.Context, alarms []*alarm.Alarm) error {
+	for _, a := range alarms {
+		if a.State != alarm.StateRaised {
+			continue
+		}
+
+		sent, err := n.redis.HGetAll(ctx, escalationKeyPrefix+a.ID).Result()
+		if err != nil {
+			return err
+		}
+		p := &pendingAck{alarm: a, levels: make(map[string]int)}
+		for route, level := range sent {
+			p.levels[route], _ = strconv.Atoi(level)
+		}
+		n.unacked[a.ID] = p
+	}
+	return nil
+}
+
+// PublishAlarm 告警状态变化进入通知队列，队列满时丢弃
+func (n *Notifier) PublishAlarm(ctx context.Context, a *alarm.Alarm) error {
+	// 引擎会继续修改同一个告警，入队副本
+	event := *a
+	select {
+	case n.events <- &event:
+	default:
+		n.logger.Warn("notification queue full, dropping alarm event",
+			zap.String("alarm_id", a.ID),
+			zap.String("state", a.State))
+	}
+	return nil
+}
+
+// Run 处理通知队列，ctx结束时发送剩余的分组并等待发送完成
+func (n *Notifier) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			n.flush(n.now(), true)
+			n.wg.Wait()
+			return
+		case a := <-n.events:
+			now := n.now()
+			n.handle(ctx, a, now)
+			n.flush(now, false)
+		case <-ticker.C:
+			now := n.now()
+			n.recoverFlapping(now)
+			n.flush(now, false)
+			n.escalate(ctx, now)
+		}
+	}
+}
+
+// handle 处理一次告警状态变化
+func (n *Notifier) handle(ctx context.Context, a *alarm.Alarm, now time.Time) {
+	if a.State == alarm.StateRaised {
+		if _, ok := n.unacked[a.ID]; !ok {
+			n.unacked[a.ID] = &pendingAck{alarm: a, levels: make(map[string]int)}
+		}
+	} else if _, ok := n.unacked[a.ID]; ok {
+		delete(n.unacked, a.ID)
+		if err := n.redis.Del(ctx, escalationKeyPrefix+a.ID).Err(); err != nil {
+			n.logger.Warn("failed to delete escalation state", zap.String("alarm_id", a.ID), zap.Error(err))
+		}
+	}
+
+	if n.suppressFlapping(a, now) {
+		return
+	}
+	n.enqueue(a, now)
+}
+
+// enqueue 将告警加入所有匹配路由的分组
+func (n *Notifier) enqueue(a *alarm.Alarm, now time.Time) {
+	for _, route := range n.routes {
+		if !route.matches(a) {
+			continue
+		}
+		if route.quiet(now, a.Severity) {
+			n.logger.Debug("notification suppressed by quiet hours",
+				zap.String("route", route.Name),
+				zap.String("alarm_id", a.ID))
+			continue
+		}
+
+		g, ok := n.groups[route.Name]
+		if !ok {
+			g = &group{since: now, alarms: make(map[string]*alarm.Alarm), raised: make(map[string]bool)}
+			n.groups[route.Name] = g
+		}
+
+		// 组内产生又恢复的告警不再通知
+		if a.State == alarm.StateCleared && g.raised[a.ID] {
+			delete(g.alarms, a.ID)
+			delete(g.raised, a.ID)
+			continue
+		}
+		if a.State == alarm.StateRaised {
+			g.raised[a.ID] = true
+		}
+		g.alarms[a.ID] = a
+	}
+}
+
+// suppressFlapping 抖动检测：flap_window内产生告警达到flap_threshold次时发送一次抖动通知，
+// 之后暂停该规则在该设备上的通知，直到flap_window内不再产生告警
+func (n *Notifier) suppressFlapping(a *alarm.Alarm, now time.Time) bool {
+	if n.flapThreshold <= 0 {
+		return false
+	}
+
+	key := a.RuleID + "|" + a.DeviceID
+	st, ok := n.flaps[key]
+	if !ok {
+		if a.State != alarm.StateRaised {
+			return false
+		}
+		st = &flapState{}
+		n.flaps[key] = st
+	}
+	st.last = a
+
+	if a.State == alarm.StateRaised {
+		st.raises = append(pruneBefore(st.raises, now.Add(-n.flapWindow)), now)
+		if !st.flapping && len(st.raises) >= n.flapThreshold {
+			st.flapping = true
+			n.logger.Warn("alarm flapping, notifications paused",
+				zap.String("rule_id", a.RuleID),
+				zap.String("device_id", a.DeviceID),
+				zap.Int("raises", len(st.raises)))
+			for _, route := range n.routes {
+				if route.matches(a) && !route.quiet(now, a.Severity) {
+					n.deliver(route.Channels, &Notification{Kind: KindFlapping, Route: route.Name, Alarms: []*alarm.Alarm{a}})
+				}
+			}
+		}
+	}
+	return st.flapping
+}
+
+// recoverFlapping 结束flap_window内不再产生告警的抖动，并发送最近一次状态变化
+func (n *Notifier) recoverFlapping(now time.Time) {
+	for key, st := range n.flaps {
+		st.raises = pruneBefore(st.raises, now.Add(-n.flapWindow))
+		if len(st.raises) > 0 {
+			continue
+		}
+		delete(n.flaps, key)
+		if st.flapping {
+			n.logger.Info("alarm stopped flapping",
+				zap.String("rule_id", st.last.RuleID),
+				zap.String("device_id", st.last.DeviceID))
+			n.enqueue(st.last, now)
+		}
+	}
+}
+
+// flush 发送超过group_wait的分组，force为true时发送全部分组
+func (n *Notifier) flush(now time.Time, force bool) {
+	for _, route := range n.routes {
+		g, ok := n.groups[route.Name]
+		if !ok || (!force && now.Sub(g.since) < n.groupWait) {
+			continue
+		}
+		delete(n.groups, route.Name)
+		if len(g.alarms) == 0 {
+			continue
+		}
+
+		alarms := make([]*alarm.Alarm, 0, len(g.alarms))
+		for _, a := range g.alarms {
+			alarms = append(alarms, a)
+		}
+		sort.Slice(alarms, func(i, j int) bool {
+			if alarms[i].Severity != alarms[j].Severity {
+				return alarms[i].Severity.Rank() > alarms[j].Severity.Rank()
+			}
+			return alarms[i].RaisedAt < alarms[j].RaisedAt
+		})
+		n.deliver(route.Channels, &Notification{Kind: KindAlarm, Route: route.Name, Alarms: alarms})
+	}
+}
+
+// escalate 对超时未确认的告警逐级发送升级通知，静默时段内屏蔽的升级延后发送
+func (n *Notifier) escalate(ctx context.Context, now time.Time) {
+	for id, p := range n.unacked {
+		raisedAt := time.Unix(p.alarm.RaisedAt, 0)
+		if !n.escalationDue(p, now) {
+			continue
+		}
+		if !n.stillRaised(ctx, id) {
+			n.logger.Info("alarm acknowledged or cleared elsewhere, stop escalation", zap.String("alarm_id", id))
+			delete(n.unacked, id)
+			if err := n.redis.Del(ctx, escalationKeyPrefix+id).Err(); err != nil {
+				n.logger.Warn("failed to delete escalation state", zap.String("alarm_id", id), zap.Error(err))
+			}
+			continue
+		}
+
+		for _, route := range n.routes {
+			if len(route.Escalations) == 0 || !route.matches(p.alarm) {
+				continue
+			}
+
+			level := p.levels[route.Name]
+			for level < len(route.Escalations) && now.Sub(raisedAt) >= route.Escalations[level].After {
+				if route.quiet(now, p.alarm.Severity) {
+					break
+				}
+				level++
+				n.deliver(route.Escalations[level-1].Channels, &Notification{
+					Kind:   KindEscalation,
+					Route:  route.Name,
+					Level:  level,
+					Alarms: []*alarm.Alarm{p.alarm},
+				})
+			}
+			if level == p.levels[route.Name] {
+				continue
+			}
+			p.levels[route.Name] = level
+
+			key := escalationKeyPrefix + id
+			pipe := n.redis.TxPipeline()
+			pipe.HSet(ctx, key, route.Name, level)
+			pipe.Expire(ctx, key, escalationTTL)
+			if _, err := pipe.Exec(ctx); err != nil {
+				n.logger.Warn("failed to save escalation state", zap.String("alarm_id", id), zap.Error(err))
+			}
+		}
+	}
+}
+
+// escalationDue 是否有路由到了发送下一级升级通知的时间
+func (n *Notifier) escalationDue(p *pendingAck, now time.Time) bool {
+	elapsed := now.Sub(time.Unix(p.alarm.RaisedAt, 0))
+	for _, route := range n.routes {
+		level := p.levels[route.Name]
+		if level < len(route.Escalations) && route.matches(p.alarm) && elapsed >= route.Escalations[level].After {
+			return true
+		}
+	}
+	return false
+}
+
+// stillRaised 查询告警是否仍未确认，未设置查询或查询失败时视为未确认
+func (n *Notifier) stillRaised(ctx context.Context, id string) bool {
+	if n.lookup == nil {
+		return true
+	}
+	a, err := n.lookup.Get(ctx, id)
+	if errors.Is(err, alarm.ErrNotFound) {
+		return false
+	}
+	if err != nil {
+		n.logger.Warn("failed to check alarm state", zap.String("alarm_id", id), zap.Error(err))
+		return true
+	}
+	return a.State == alarm.StateRaised
+}
+
+// deliver 异步发送通知到各渠道，失败只记录日志
+func (n *Notifier) deliver(channels []Channel, notification *Notification) {
+	for _, ch := range channels {
+		n.wg.Add(1)
+		go func(ch Channel) {
+			defer n.wg.Done()
+
+			ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+			defer cancel()
+
+			if err := ch.Send(ctx, notification); err != nil {
+				n.logger.Error("failed to send notification",
+					zap.String("channel", ch.Name()),
+					zap.String("route", notification.Route),
+					zap.String("kind", notification.Kind),
+					zap.Error(err))
+				return
+			}
+			n.logger.Info("notification sent",
+				zap.String("channel", ch.Name()),
+				zap.String("route", notification.Route),
+				zap.String("kind", notification.Kind),
+				zap.Int("alarms", len(notification.Alarms)))
+		}(ch)
+	}
+}
+
+// pruneBefore 移除早于cutoff的时间
+func pruneBefore(times []time.Time, cutoff time.Time) []time.Time {
+	i := 0
+	for i < len(times) && times[i].Before(cutoff) {
+		i++
+	}
+	return times[i:]
+}
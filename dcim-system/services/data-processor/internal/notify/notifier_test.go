@@ -0,0 +1,483 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/dcim/services/data-processor/internal/alarm"
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+)
+
+// recordChannel 记录收到的通知
+type recordChannel struct {
+	name string
+	mu   sync.Mutex
+	sent []*Notification
+}
+
+func (c *recordChannel) Name() string {
+	return c.name
+}
+
+func (c *recordChannel) Send(ctx context.Context, n *Notification) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sent = append(c.sent, n)
+	return nil
+}
+
+// take 取出已收到的通知
+func (c *recordChannel) take() []*Notification {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	sent := c.sent
+	c.sent = nil
+	return sent
+}
+
+// testNotifier 使用miniredis和固定时钟的通知分发，不启动Run，由测试驱动各步骤
+type testNotifier struct {
+	*Notifier
+	now time.Time
+}
+
+func newTestNotifier(t *testing.T, routes []*Route, groupWait, flapWindow time.Duration, flapThreshold int) *testNotifier {
+	t.Helper()
+
+	mr := miniredis.RunT(t)
+	redisClient := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { redisClient.Close() })
+
+	tn := &testNotifier{
+		Notifier: NewNotifier(routes, redisClient, groupWait, flapWindow, flapThreshold, zap.NewNop()),
+		now:      time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC),
+	}
+	tn.Notifier.now = func() time.Time { return tn.now }
+	return tn
+}
+
+// publish 处理一次告警状态变化，与Run收到事件时一致
+func (tn *testNotifier) publish(a *alarm.Alarm) {
+	tn.handle(context.Background(), a, tn.now)
+	tn.flush(tn.now, false)
+	tn.wg.Wait()
+}
+
+// advance 推进时钟并执行一次定时处理，与Run的ticker一致
+func (tn *testNotifier) advance(d time.Duration) {
+	tn.now = tn.now.Add(d)
+	tn.recoverFlapping(tn.now)
+	tn.flush(tn.now, false)
+	tn.escalate(context.Background(), tn.now)
+	tn.wg.Wait()
+}
+
+func testAlarm(id, state string, severity alarm.Severity, site string) *alarm.Alarm {
+	return &alarm.Alarm{
+		ID:       id,
+		RuleID:   "rule-" + id,
+		RuleName: "机房温度过高",
+		Severity: severity,
+		DeviceID: "dev-" + id,
+		Tags:     map[string]string{"site": site},
+		Message:  "temperature > 30",
+		Value:    31.5,
+		State:    state,
+		RaisedAt: time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC).Unix(),
+	}
+}
+
+// alarmIDs 通知中的告警ID和状态
+func alarmIDs(n *Notification) []string {
+	ids := make([]string, 0, len(n.Alarms))
+	for _, a := range n.Alarms {
+		ids = append(ids, a.ID+"/"+a.State)
+	}
+	return ids
+}
+
+func TestNotifierRouting(t *testing.T) {
+	critical := &recordChannel{name: "critical"}
+	beijing := &recordChannel{name: "beijing"}
+	all := &recordChannel{name: "all"}
+	channels := []*recordChannel{critical, beijing, all}
+
+	tn := newTestNotifier(t, []*Route{
+		{Name: "critical", Severities: []alarm.Severity{alarm.SeverityCritical}, Channels: []Channel{critical}},
+		{Name: "beijing", Sites: []string{"bj"}, Channels: []Channel{beijing}},
+		{Name: "all", Channels: []Channel{all}},
+	}, 0, time.Minute, 0)
+
+	tests := []struct {
+		alarm *alarm.Alarm
+		want  []string // 收到通知的路由
+	}{
+		{testAlarm("a1", alarm.StateRaised, alarm.SeverityCritical, "sh"), []string{"critical", "all"}},
+		{testAlarm("a2", alarm.StateRaised, alarm.SeverityWarning, "bj"), []string{"beijing", "all"}},
+		{testAlarm("a3", alarm.StateRaised, alarm.SeverityCritical, "bj"), []string{"critical", "beijing", "all"}},
+		{testAlarm("a4", alarm.StateRaised, alarm.SeverityInfo, ""), []string{"all"}},
+	}
+	for _, tt := range tests {
+		tn.publish(tt.alarm)
+
+		var got []string
+		for _, ch := range channels {
+			for _, n := range ch.take() {
+				if n.Kind != KindAlarm || n.Route != ch.name || len(n.Alarms) != 1 || n.Alarms[0].ID != tt.alarm.ID {
+					t.Errorf("%s: unexpected notification on %s: %s %s %v", tt.alarm.ID, ch.name, n.Kind, n.Route, alarmIDs(n))
+				}
+				got = append(got, ch.name)
+			}
+		}
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%s (%s, site %q): routed to %v, want %v", tt.alarm.ID, tt.alarm.Severity, tt.alarm.Tags["site"], got, tt.want)
+		}
+	}
+}
+
+func TestNotifierQuietHours(t *testing.T) {
+	quietHours, err := NewQuietHours("22:00", "07:00", "UTC", alarm.SeverityCritical)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch := &recordChannel{name: "ops"}
+	tn := newTestNotifier(t, []*Route{{Name: "ops", Channels: []Channel{ch}, QuietHours: quietHours}}, 0, time.Minute, 0)
+	tn.now = time.Date(2026, 1, 1, 23, 30, 0, 0, time.UTC)
+
+	tn.publish(testAlarm("a1", alarm.StateRaised, alarm.SeverityWarning, ""))
+	tn.publish(testAlarm("a2", alarm.StateRaised, alarm.SeverityCritical, ""))
+
+	sent := ch.take()
+	if len(sent) != 1 || strings.Join(alarmIDs(sent[0]), ",") != "a2/raised" {
+		t.Fatalf("quiet hours: got %d notifications, want only critical a2", len(sent))
+	}
+}
+
+func TestNotifierGroupsAndDeduplicates(t *testing.T) {
+	ch := &recordChannel{name: "ops"}
+	tn := newTestNotifier(t, []*Route{{Name: "ops", Channels: []Channel{ch}}}, 30*time.Second, time.Minute, 0)
+
+	tn.publish(testAlarm("a1", alarm.StateRaised, alarm.SeverityWarning, ""))
+	tn.publish(testAlarm("a2", alarm.StateRaised, alarm.SeverityCritical, ""))
+	// 同一告警只保留最新状态
+	tn.publish(testAlarm("a1", alarm.StateAcknowledged, alarm.SeverityWarning, ""))
+	// 组内产生又恢复的告警不通知
+	tn.publish(testAlarm("a3", alarm.StateRaised, alarm.SeverityWarning, ""))
+	tn.publish(testAlarm("a3", alarm.StateCleared, alarm.SeverityWarning, ""))
+
+	if sent := ch.take(); len(sent) != 0 {
+		t.Fatalf("sent %d notifications before group_wait", len(sent))
+	}
+
+	tn.advance(31 * time.Second)
+	sent := ch.take()
+	if len(sent) != 1 {
+		t.Fatalf("got %d notifications after group_wait, want 1", len(sent))
+	}
+	// 按级别从高到低排列
+	if got := strings.Join(alarmIDs(sent[0]), ","); got != "a2/raised,a1/acknowledged" {
+		t.Errorf("grouped alarms = %s, want a2/raised,a1/acknowledged", got)
+	}
+	if want := "[critical] 2条告警 (ops)"; sent[0].Subject() != want {
+		t.Errorf("subject = %q, want %q", sent[0].Subject(), want)
+	}
+
+	tn.advance(31 * time.Second)
+	if sent := ch.take(); len(sent) != 0 {
+		t.Fatalf("group sent again: %d notifications", len(sent))
+	}
+
+	// 已通知过的告警恢复时仍然通知
+	tn.publish(testAlarm("a2", alarm.StateCleared, alarm.SeverityCritical, ""))
+	tn.advance(31 * time.Second)
+	sent = ch.take()
+	if len(sent) != 1 || strings.Join(alarmIDs(sent[0]), ",") != "a2/cleared" {
+		t.Fatalf("clear of notified alarm: got %d notifications", len(sent))
+	}
+}
+
+func TestNotifierFlapping(t *testing.T) {
+	ch := &recordChannel{name: "ops"}
+	tn := newTestNotifier(t, []*Route{{Name: "ops", Channels: []Channel{ch}}}, 0, 10*time.Minute, 3)
+
+	var kinds []string
+	for i := 0; i < 3; i++ {
+		tn.publish(testAlarm("a1", alarm.StateRaised, alarm.SeverityWarning, ""))
+		tn.advance(time.Minute)
+		tn.publish(testAlarm("a1", alarm.StateCleared, alarm.SeverityWarning, ""))
+		tn.advance(time.Minute)
+		for _, n := range ch.take() {
+			kinds = append(kinds, n.Kind+":"+strings.Join(alarmIDs(n), ","))
+		}
+	}
+
+	// 第三次产生时发送抖动通知，之后暂停通知
+	want := []string{
+		"alarm:a1/raised", "alarm:a1/cleared",
+		"alarm:a1/raised", "alarm:a1/cleared",
+		"flapping:a1/raised",
+	}
+	if strings.Join(kinds, " ") != strings.Join(want, " ") {
+		t.Fatalf("notifications = %v, want %v", kinds, want)
+	}
+
+	// flap_window内不再产生告警后恢复通知，并发送最近一次状态
+	tn.advance(10 * time.Minute)
+	sent := ch.take()
+	if len(sent) != 1 || sent[0].Kind != KindAlarm || strings.Join(alarmIDs(sent[0]), ",") != "a1/cleared" {
+		t.Fatalf("after flapping stopped: got %d notifications", len(sent))
+	}
+
+	tn.publish(testAlarm("a1", alarm.StateRaised, alarm.SeverityWarning, ""))
+	if sent := ch.take(); len(sent) != 1 || sent[0].Kind != KindAlarm {
+		t.Fatalf("notifications not resumed after flapping stopped")
+	}
+}
+
+// mapLookup 按ID返回告警的当前状态
+type mapLookup map[string]*alarm.Alarm
+
+func (m mapLookup) Get(ctx context.Context, id string) (*alarm.Alarm, error) {
+	if a, ok := m[id]; ok {
+		return a, nil
+	}
+	return nil, alarm.ErrNotFound
+}
+
+func TestNotifierEscalationChecksAlarmState(t *testing.T) {
+	ch := &recordChannel{name: "ops"}
+	oncall := &recordChannel{name: "oncall"}
+	tn := newTestNotifier(t, []*Route{{
+		Name:        "ops",
+		Channels:    []Channel{ch},
+		Escalations: []Escalation{{After: 10 * time.Minute, Channels: []Channel{oncall}}},
+	}}, 0, time.Minute, 0)
+
+	// a1在其他副本确认，a2已过期删除，只有a3仍未确认
+	tn.SetAlarmLookup(mapLookup{
+		"a1": testAlarm("a1", alarm.StateAcknowledged, alarm.SeverityWarning, ""),
+		"a3": testAlarm("a3", alarm.StateRaised, alarm.SeverityWarning, ""),
+	})
+	for _, id := range []string{"a1", "a2", "a3"} {
+		tn.publish(testAlarm(id, alarm.StateRaised, alarm.SeverityWarning, ""))
+	}
+	ch.take()
+
+	tn.advance(5 * time.Minute)
+	if sent := oncall.take(); len(sent) != 0 {
+		t.Fatalf("escalated before due: %d notifications", len(sent))
+	}
+
+	tn.advance(6 * time.Minute)
+	sent := oncall.take()
+	if len(sent) != 1 || sent[0].Kind != KindEscalation || strings.Join(alarmIDs(sent[0]), ",") != "a3/raised" {
+		t.Fatalf("escalations: got %d notifications, want only a3", len(sent))
+	}
+	if _, ok := tn.unacked["a1"]; ok {
+		t.Error("alarm acknowledged elsewhere still pending escalation")
+	}
+}
+
+func TestWebhookChannel(t *testing.T) {
+	requests := make(chan *http.Request, 1)
+	bodies := make(chan []byte, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests <- r
+		bodies <- body
+	}))
+	defer server.Close()
+
+	n := &Notification{Kind: KindAlarm, Route: "ops", Alarms: []*alarm.Alarm{testAlarm("a1", alarm.StateRaised, alarm.SeverityCritical, "bj")}}
+	ch := NewWebhookChannel("hook", server.URL, map[string]string{"X-Token": "secret"})
+	if err := ch.Send(context.Background(), n); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	r := <-requests
+	if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" || r.Header.Get("X-Token") != "secret" {
+		t.Errorf("request = %s content-type=%q x-token=%q", r.Method, r.Header.Get("Content-Type"), r.Header.Get("X-Token"))
+	}
+	var got Notification
+	if err := json.Unmarshal(<-bodies, &got); err != nil {
+		t.Fatalf("decode webhook body: %v", err)
+	}
+	if got.Kind != KindAlarm || got.Route != "ops" || len(got.Alarms) != 1 || got.Alarms[0].ID != "a1" || got.Alarms[0].Tags["site"] != "bj" {
+		t.Errorf("body = %+v", got)
+	}
+}
+
+func TestWebhookChannelErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "rate limited", http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	n := &Notification{Kind: KindAlarm, Route: "ops", Alarms: []*alarm.Alarm{testAlarm("a1", alarm.StateRaised, alarm.SeverityCritical, "")}}
+	err := NewWebhookChannel("hook", server.URL, nil).Send(context.Background(), n)
+	if err == nil || err.Error() != "unexpected status 429: rate limited" {
+		t.Fatalf("Send error = %v, want unexpected status 429", err)
+	}
+}
+
+func TestChatChannelTemplate(t *testing.T) {
+	bodies := make(chan []byte, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies <- body
+	}))
+	defer server.Close()
+
+	ch, err := NewChatChannel("chat", server.URL, `{"msgtype":"text","text":{"content":{{json .Text}}}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := &Notification{Kind: KindAlarm, Route: "ops", Alarms: []*alarm.Alarm{testAlarm("a1", alarm.StateRaised, alarm.SeverityCritical, "")}}
+	if err := ch.Send(context.Background(), n); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	var msg struct {
+		Text struct {
+			Content string `json:"content"`
+		} `json:"text"`
+	}
+	body := <-bodies
+	if err := json.Unmarshal(body, &msg); err != nil {
+		t.Fatalf("rendered body is not JSON: %v: %s", err, body)
+	}
+	if msg.Text.Content != n.Text() {
+		t.Errorf("content = %q, want %q", msg.Text.Content, n.Text())
+	}
+}
+
+// smtpMessage 假SMTP服务器收到的邮件
+type smtpMessage struct {
+	from string
+	to   []string
+	data string
+}
+
+// fakeSMTPServer 只支持明文会话的SMTP服务器（不声明STARTTLS和AUTH），收到的邮件写入返回的channel
+func fakeSMTPServer(t *testing.T) (string, <-chan smtpMessage) {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	messages := make(chan smtpMessage, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		r := bufio.NewReader(conn)
+		reply := func(line string) { io.WriteString(conn, line+"\r\n") }
+		reply("220 localhost ESMTP")
+
+		var msg smtpMessage
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			cmd := strings.TrimRight(line, "\r\n")
+			switch {
+			case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+				reply("250 localhost")
+			case strings.HasPrefix(cmd, "MAIL FROM:"):
+				msg.from = strings.Trim(strings.TrimPrefix(cmd, "MAIL FROM:"), "<>")
+				reply("250 OK")
+			case strings.HasPrefix(cmd, "RCPT TO:"):
+				msg.to = append(msg.to, strings.Trim(strings.TrimPrefix(cmd, "RCPT TO:"), "<>"))
+				reply("250 OK")
+			case cmd == "DATA":
+				reply("354 End data with <CR><LF>.<CR><LF>")
+				var data strings.Builder
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if line == ".\r\n" {
+						break
+					}
+					data.WriteString(line)
+				}
+				msg.data = data.String()
+				reply("250 OK")
+				messages <- msg
+			case cmd == "QUIT":
+				reply("221 Bye")
+				return
+			default:
+				reply("250 OK")
+			}
+		}
+	}()
+
+	return ln.Addr().String(), messages
+}
+
+func TestEmailChannel(t *testing.T) {
+	addr, messages := fakeSMTPServer(t)
+
+	n := &Notification{Kind: KindEscalation, Route: "ops", Level: 1, Alarms: []*alarm.Alarm{testAlarm("a1", alarm.StateRaised, alarm.SeverityCritical, "")}}
+	ch := NewEmailChannel("mail", addr, "", "", "dcim@example.com", []string{"ops@example.com", "oncall@example.com"})
+	if err := ch.Send(context.Background(), n); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	var msg smtpMessage
+	select {
+	case msg = <-messages:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message received")
+	}
+
+	if msg.from != "dcim@example.com" || strings.Join(msg.to, ",") != "ops@example.com,oncall@example.com" {
+		t.Errorf("envelope from=%s to=%v", msg.from, msg.to)
+	}
+
+	headers, body, ok := strings.Cut(msg.data, "\r\n\r\n")
+	if !ok {
+		t.Fatalf("message has no header/body separator: %q", msg.data)
+	}
+	var subject string
+	for _, line := range strings.Split(headers, "\r\n") {
+		if v, ok := strings.CutPrefix(line, "Subject: "); ok {
+			subject = v
+		}
+	}
+	decoded, err := new(mime.WordDecoder).DecodeHeader(subject)
+	if err != nil {
+		t.Fatalf("decode subject %q: %v", subject, err)
+	}
+	if decoded != n.Subject() {
+		t.Errorf("subject = %q, want %q", decoded, n.Subject())
+	}
+	if !strings.Contains(headers, "To: ops@example.com, oncall@example.com") ||
+		!strings.Contains(headers, "Content-Type: text/plain; charset=UTF-8") {
+		t.Errorf("headers = %q", headers)
+	}
+	if want := strings.ReplaceAll(n.Text(), "\n", "\r\n") + "\r\n"; body != want {
+		t.Errorf("body = %q, want %q", body, want)
+	}
+}
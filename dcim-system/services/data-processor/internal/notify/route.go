@@ -0,0 +1,107 @@
+package notify
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/dcim/services/data-processor/internal/alarm"
+)
+
+// Route 通知路由，告警发送到所有匹配的路由
+type Route struct {
+	Name        string
+	Severities  []alarm.Severity // 为空时不限制
+	Sites       []string         // 匹配告警设备的site标签，为空时不限制
+	Channels    []Channel
+	QuietHours  *QuietHours // 可为nil
+	Escalations []Escalation
+}
+
+// Escalation 告警产生后超过After仍未确认时，通知升级渠道
+type Escalation struct {
+	After    time.Duration
+	Channels []Channel
+}
+
+// matches 判断告警是否匹配路由
+func (r *Route) matches(a *alarm.Alarm) bool {
+	if len(r.Severities) > 0 {
+		matched := false
+		for _, s := range r.Severities {
+			if s == a.Severity {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	if len(r.Sites) > 0 {
+		site := a.Tags["site"]
+		for _, s := range r.Sites {
+			if s == site {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// quiet 判断路由在t时刻是否屏蔽该级别的通知
+func (r *Route) quiet(t time.Time, severity alarm.Severity) bool {
+	return r.QuietHours != nil && r.QuietHours.Suppresses(t, severity)
+}
+
+// QuietHours 静默时段，时段内低于minSeverity的通知不发送（升级通知延后到时段结束）
+type QuietHours struct {
+	start, end  int // 一天中的分钟数
+	location    *time.Location
+	minSeverity alarm.Severity
+}
+
+// NewQuietHours 创建静默时段，start/end格式为HH:MM，end早于start时跨越午夜；
+// minSeverity为空时屏蔽全部通知
+func NewQuietHours(start, end, timezone string, minSeverity alarm.Severity) (*QuietHours, error) {
+	startMin, err := parseClock(start)
+	if err != nil {
+		return nil, err
+	}
+	endMin, err := parseClock(end)
+	if err != nil {
+		return nil, err
+	}
+
+	location := time.Local
+	if timezone != "" {
+		if location, err = time.LoadLocation(timezone); err != nil {
+			return nil, err
+		}
+	}
+
+	return &QuietHours{start: startMin, end: endMin, location: location, minSeverity: minSeverity}, nil
+}
+
+// Suppresses 判断t时刻是否屏蔽该级别的通知
+func (q *QuietHours) Suppresses(t time.Time, severity alarm.Severity) bool {
+	if q.minSeverity != "" && severity.Rank() >= q.minSeverity.Rank() {
+		return false
+	}
+
+	local := t.In(q.location)
+	minute := local.Hour()*60 + local.Minute()
+	if q.start <= q.end {
+		return minute >= q.start && minute < q.end
+	}
+	return minute >= q.start || minute < q.end
+}
+
+// parseClock 解析HH:MM
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
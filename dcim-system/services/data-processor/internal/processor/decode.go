@@ -0,0 +1,271 @@
+package processor
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Encoding 设备数据载荷编码格式
+type Encoding string
+
+const (
+	// EncodingJSON JSON编码（默认）
+	EncodingJSON Encoding = "json"
+	// EncodingProtobuf Protobuf编码，消息定义见 proto/collector.proto 中的 DeviceData
+	EncodingProtobuf Encoding = "protobuf"
+	// EncodingCBOR CBOR编码
+	EncodingCBOR Encoding = "cbor"
+	// EncodingOPC opc-collector写入Kafka的MetricData（JSON）
+	EncodingOPC Encoding = "opc"
+	// EncodingLineProtocol 被InfluxDB拒绝写入的行协议数据，只出现在死信中
+	EncodingLineProtocol Encoding = "line_protocol"
+)
+
+// topicSuffixes 上报Topic后缀与编码格式的对应关系（与采集Agent保持一致）
+var topicSuffixes = map[string]Encoding{
+	"proto": EncodingProtobuf,
+	"cbor":  EncodingCBOR,
+}
+
+// DataTopics 返回基础Topic对应的所有编码的订阅Topic
+func DataTopics(base string) []string {
+	topics := []string{base}
+	for suffix := range topicSuffixes {
+		topics = append(topics, base+"/"+suffix)
+	}
+	return topics
+}
+
+// EncodingFromTopic 根据消息Topic后缀识别载荷编码格式
+func EncodingFromTopic(base, topic string) Encoding {
+	suffix := strings.TrimPrefix(strings.TrimPrefix(topic, base), "/")
+	if encoding, ok := topicSuffixes[suffix]; ok {
+		return encoding
+	}
+	return EncodingJSON
+}
+
+// decodeDeviceData 按编码格式解码设备数据
+func decodeDeviceData(encoding Encoding, payload []byte, data *DeviceData) error {
+	switch encoding {
+	case "", EncodingJSON:
+		return json.Unmarshal(payload, data)
+	case EncodingProtobuf:
+		return unmarshalProtobuf(payload, data)
+	case EncodingCBOR:
+		return unmarshalCBOR(payload, data)
+	case EncodingOPC:
+		return unmarshalOPC(payload, data)
+	default:
+		return fmt.Errorf("unsupported encoding: %s", encoding)
+	}
+}
+
+// unmarshalCBOR 解码CBOR载荷，整数统一转为与JSON一致的float64
+func unmarshalCBOR(payload []byte, data *DeviceData) error {
+	if err := cbor.Unmarshal(payload, data); err != nil {
+		return err
+	}
+
+	for name, value := range data.Metrics {
+		switch v := value.(type) {
+		case uint64:
+			data.Metrics[name] = float64(v)
+		case int64:
+			data.Metrics[name] = float64(v)
+		}
+	}
+
+	return nil
+}
+
+// DeviceData 消息字段编号（与 proto/collector.proto 保持一致）
+const (
+	fieldDeviceID   protowire.Number = 1
+	fieldDeviceIP   protowire.Number = 2
+	fieldDeviceType protowire.Number = 3
+	fieldTimestamp  protowire.Number = 4
+	fieldMetrics    protowire.Number = 5
+	fieldStatus     protowire.Number = 6
+	fieldError      protowire.Number = 7
+
+	fieldMapKey   protowire.Number = 1
+	fieldMapValue protowire.Number = 2
+
+	fieldDoubleValue protowire.Number = 1
+	fieldIntValue    protowire.Number = 2
+	fieldUintValue   protowire.Number = 3
+	fieldStringValue protowire.Number = 4
+	fieldBoolValue   protowire.Number = 5
+)
+
+// unmarshalProtobuf 解码 collector.DeviceData 消息
+func unmarshalProtobuf(payload []byte, data *DeviceData) error {
+	data.Metrics = make(map[string]interface{})
+
+	for len(payload) > 0 {
+		num, typ, n := protowire.ConsumeTag(payload)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		payload = payload[n:]
+
+		if num == fieldTimestamp && typ == protowire.VarintType {
+			v, n := protowire.ConsumeVarint(payload)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			data.Timestamp = time.Unix(0, int64(v))
+			payload = payload[n:]
+			continue
+		}
+
+		if typ != protowire.BytesType {
+			// 跳过未知字段，保证前向兼容
+			n := protowire.ConsumeFieldValue(num, typ, payload)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			payload = payload[n:]
+			continue
+		}
+
+		v, n := protowire.ConsumeBytes(payload)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		payload = payload[n:]
+
+		switch num {
+		case fieldDeviceID:
+			data.DeviceID = string(v)
+		case fieldDeviceIP:
+			data.DeviceIP = string(v)
+		case fieldDeviceType:
+			data.DeviceType = string(v)
+		case fieldStatus:
+			data.Status = string(v)
+		case fieldError:
+			data.Error = string(v)
+		case fieldMetrics:
+			name, value, err := decodeMetricEntry(v)
+			if err != nil {
+				return fmt.Errorf("invalid metric entry: %w", err)
+			}
+			if value != nil {
+				data.Metrics[name] = value
+			}
+		}
+	}
+
+	return nil
+}
+
+// decodeMetricEntry 解码 metrics map 的单个条目
+func decodeMetricEntry(b []byte) (string, interface{}, error) {
+	var (
+		name  string
+		value interface{}
+	)
+
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return "", nil, protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		if typ != protowire.BytesType {
+			n := protowire.ConsumeFieldValue(num, typ, b)
+			if n < 0 {
+				return "", nil, protowire.ParseError(n)
+			}
+			b = b[n:]
+			continue
+		}
+
+		v, n := protowire.ConsumeBytes(b)
+		if n < 0 {
+			return "", nil, protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		switch num {
+		case fieldMapKey:
+			name = string(v)
+		case fieldMapValue:
+			decoded, err := decodeMetricValue(v)
+			if err != nil {
+				return "", nil, err
+			}
+			value = decoded
+		}
+	}
+
+	return name, value, nil
+}
+
+// decodeMetricValue 解码 MetricValue 消息，数值统一转为与JSON一致的float64
+func decodeMetricValue(b []byte) (interface{}, error) {
+	var value interface{}
+
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		switch {
+		case num == fieldDoubleValue && typ == protowire.Fixed64Type:
+			v, n := protowire.ConsumeFixed64(b)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			value = math.Float64frombits(v)
+			b = b[n:]
+		case num == fieldIntValue && typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			value = float64(protowire.DecodeZigZag(v))
+			b = b[n:]
+		case num == fieldUintValue && typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			value = float64(v)
+			b = b[n:]
+		case num == fieldBoolValue && typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			value = protowire.DecodeBool(v)
+			b = b[n:]
+		case num == fieldStringValue && typ == protowire.BytesType:
+			v, n := protowire.ConsumeString(b)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			value = v
+			b = b[n:]
+		default:
+			n := protowire.ConsumeFieldValue(num, typ, b)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			b = b[n:]
+		}
+	}
+
+	return value, nil
+}
@@ -0,0 +1,68 @@
+package processor
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// vectorsFile 与采集Agent共用的Protobuf测试向量，Agent编码得到hex，这里解码后应得到want
+const vectorsFile = "../../../../proto/testdata/device_data_vectors.json"
+
+// vector 测试向量
+type vector struct {
+	Name   string `json:"name"`
+	Device struct {
+		DeviceID    string `json:"device_id"`
+		DeviceIP    string `json:"device_ip"`
+		DeviceType  string `json:"device_type"`
+		TimestampNS int64  `json:"timestamp_ns"`
+		Status      string `json:"status"`
+		Error       string `json:"error"`
+	} `json:"device"`
+	Want map[string]interface{} `json:"want"`
+	Hex  string                 `json:"hex"`
+}
+
+func TestUnmarshalProtobufVectors(t *testing.T) {
+	raw, err := os.ReadFile(vectorsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var vectors []vector
+	if err := json.Unmarshal(raw, &vectors); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, v := range vectors {
+		t.Run(v.Name, func(t *testing.T) {
+			payload, err := hex.DecodeString(v.Hex)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var data DeviceData
+			if err := decodeDeviceData(EncodingProtobuf, payload, &data); err != nil {
+				t.Fatal(err)
+			}
+
+			if data.DeviceID != v.Device.DeviceID || data.DeviceIP != v.Device.DeviceIP ||
+				data.DeviceType != v.Device.DeviceType || data.Status != v.Device.Status || data.Error != v.Device.Error {
+				t.Errorf("decoded %+v, want %+v", data, v.Device)
+			}
+			var want time.Time
+			if v.Device.TimestampNS != 0 {
+				want = time.Unix(0, v.Device.TimestampNS)
+			}
+			if !data.Timestamp.Equal(want) {
+				t.Errorf("timestamp %v, want %v", data.Timestamp, want)
+			}
+			// 数值指标统一解码为与JSON一致的float64
+			if !reflect.DeepEqual(data.Metrics, v.Want) {
+				t.Errorf("metrics %#v, want %#v", data.Metrics, v.Want)
+			}
+		})
+	}
+}
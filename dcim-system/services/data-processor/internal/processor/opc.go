@@ -0,0 +1,80 @@
+package processor
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// opc-collector数据质量（与 opc-collector/pkg/models 保持一致）
+const (
+	opcQualityBad       = "bad" // 整体质量：没有质量正常的指标
+	opcMetricQualityBad = "Bad" // 单个指标质量
+	opcDefaultType      = "opc" // 标签中没有device_type时的设备类型
+	opcDeviceTypeTag    = "device_type"
+)
+
+// opcMetricData opc-collector写入Kafka的 models.MetricData
+type opcMetricData struct {
+	DeviceID  string                    `json:"device_id"`
+	DeviceIP  string                    `json:"device_ip"`
+	Timestamp time.Time                 `json:"timestamp"`
+	Metrics   map[string]opcMetricValue `json:"metrics"`
+	Tags      map[string]string         `json:"tags"`
+	Quality   string                    `json:"quality"`
+}
+
+// opcMetricValue opc-collector的 models.MetricValue
+type opcMetricValue struct {
+	Name    string      `json:"name"`
+	Value   interface{} `json:"value"`
+	Unit    string      `json:"unit"`
+	Quality string      `json:"quality"` // Good, Bad, Uncertain
+}
+
+// unmarshalOPC 解码opc-collector的MetricData：单位和质量分别保存，质量为Bad的指标按采集错误处理，
+// 整体质量为bad（没有可用指标）时视为采集失败
+func unmarshalOPC(payload []byte, data *DeviceData) error {
+	var m opcMetricData
+	if err := json.Unmarshal(payload, &m); err != nil {
+		return err
+	}
+
+	data.DeviceID = m.DeviceID
+	data.DeviceIP = m.DeviceIP
+	data.DeviceType = m.Tags[opcDeviceTypeTag]
+	if data.DeviceType == "" {
+		data.DeviceType = opcDefaultType
+	}
+	data.Timestamp = m.Timestamp
+	data.Status = "success"
+	if m.Quality == opcQualityBad {
+		data.Status = "failed"
+		data.Error = "no metric with good quality"
+	}
+
+	data.Tags = make(map[string]string, len(m.Tags))
+	for k, v := range m.Tags {
+		if k != opcDeviceTypeTag {
+			data.Tags[k] = v
+		}
+	}
+
+	data.Metrics = make(map[string]interface{}, len(m.Metrics))
+	data.Units = make(map[string]string)
+	data.Quality = make(map[string]string)
+	for name, v := range m.Metrics {
+		if v.Unit != "" {
+			data.Units[name] = v.Unit
+		}
+		if v.Quality != "" {
+			data.Quality[name] = v.Quality
+		}
+		if v.Quality == opcMetricQualityBad {
+			data.Metrics[name] = fmt.Sprintf("error: quality %s", v.Quality)
+			continue
+		}
+		data.Metrics[name] = v.Value
+	}
+	return nil
+}
@@ -3,15 +3,43 @@ package processor
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/dcim/services/data-processor/internal/alarm"
+	"github.com/dcim/services/data-processor/internal/availability"
+	"github.com/dcim/services/data-processor/internal/deadletter"
+	"github.com/dcim/services/data-processor/internal/energy"
+	"github.com/dcim/services/data-processor/internal/fields"
+	"github.com/dcim/services/data-processor/internal/virtual"
 	"github.com/go-redis/redis/v8"
 	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
 	"github.com/influxdata/influxdb-client-go/v2/api"
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
 	"go.uber.org/zap"
 )
 
+// dedupKeyPrefix 已处理消息的幂等键，<设备ID>:<采集时间（纳秒）>，与InfluxDB数据点的series+时间一一对应。
+// 写入InfluxDB以series+时间覆盖，本身是幂等的；幂等键在写入之后设置，只用于跳过可用性、缓存、告警等重复处理
+const dedupKeyPrefix = "processed:"
+
+// InfluxDB measurement
+const (
+	metricsMeasurement = "device_metrics"
+	errorsMeasurement  = "device_metric_errors" // 单个指标的采集错误，tag metric为指标名，字段error为错误信息
+)
+
+var (
+	// ErrDecode 载荷无法解码，重新处理也不会成功
+	ErrDecode = errors.New("failed to decode payload")
+	// ErrFieldsRejected 部分指标类型不符被丢弃，其余指标已写入
+	ErrFieldsRejected = errors.New("fields rejected")
+)
+
 // DeviceData 设备采集数据
 type DeviceData struct {
 	DeviceID   string                 `json:"device_id"`
@@ -21,36 +49,88 @@ type DeviceData struct {
 	Metrics    map[string]interface{} `json:"metrics"`
 	Status     string                 `json:"status"`
 	Error      string                 `json:"error"`
+	Tags       map[string]string      `json:"tags,omitempty"`    // 附加的InfluxDB标签
+	Units      map[string]string      `json:"units,omitempty"`   // 指标 -> 单位
+	Quality    map[string]string      `json:"quality,omitempty"` // 指标 -> 数据质量（Good/Bad/Uncertain）
 }
 
 // DataProcessor 数据处理器
 type DataProcessor struct {
 	influxWriter api.WriteAPIBlocking
 	redisClient  *redis.Client
+	alarms       *alarm.Engine
+	availability *availability.Tracker
+	fields       *fields.Normalizer
+	dedupWindow  time.Duration
+	deadLetter   deadletter.Sink
+	broadcaster  Broadcaster
+	energy       *energy.Analyzer
+	virtual      *virtual.Engine
 	logger       *zap.Logger
 }
 
-// NewDataProcessor 创建数据处理器
+// waitWriter 可以等待写入结果的写入器（writer.BatchWriter的WritePoint只放入队列），重放死信时使用
+type waitWriter interface {
+	WritePointWait(ctx context.Context, points ...*write.Point) error
+	WriteRecordWait(ctx context.Context, lines ...string) error
+}
+
+// Broadcaster 设备最新数据的实时推送
+type Broadcaster interface {
+	Broadcast(ctx context.Context, data []byte)
+}
+
+// NewDataProcessor 创建数据处理器，alarms为nil时不评估告警规则，tracker为nil时不跟踪设备可用性，
+// normalizer为nil时指标原样写入InfluxDB，dedupWindow为0时不对重复消息去重
 func NewDataProcessor(
-	influxClient influxdb2.Client,
-	org string,
-	bucket string,
+	influxWriter api.WriteAPIBlocking,
 	redisClient *redis.Client,
+	alarms *alarm.Engine,
+	tracker *availability.Tracker,
+	normalizer *fields.Normalizer,
+	dedupWindow time.Duration,
 	logger *zap.Logger,
 ) *DataProcessor {
 	return &DataProcessor{
-		influxWriter: influxClient.WriteAPIBlocking(org, bucket),
+		influxWriter: influxWriter,
 		redisClient:  redisClient,
+		alarms:       alarms,
+		availability: tracker,
+		fields:       normalizer,
+		dedupWindow:  dedupWindow,
 		logger:       logger,
 	}
 }
 
-// Process 处理采集数据
-func (p *DataProcessor) Process(ctx context.Context, data []byte) error {
+// SetDeadLetter 设置死信输出，无法处理的消息连同原始载荷和原因写入死信，为nil时只记录日志
+func (p *DataProcessor) SetDeadLetter(sink deadletter.Sink) {
+	p.deadLetter = sink
+}
+
+// SetBroadcaster 设置实时推送，更新Redis缓存的同时推送设备最新数据，为nil时不推送
+func (p *DataProcessor) SetBroadcaster(b Broadcaster) {
+	p.broadcaster = b
+}
+
+// SetEnergy 设置能耗分析，供电拓扑中设备的功率读数用于计算PUE和用电量，为nil时不分析
+func (p *DataProcessor) SetEnergy(analyzer *energy.Analyzer) {
+	p.energy = analyzer
+}
+
+// SetVirtual 设置虚拟设备计算，设备数据处理完成后计算依赖该设备的虚拟设备，为nil时不计算
+func (p *DataProcessor) SetVirtual(engine *virtual.Engine) {
+	p.virtual = engine
+}
+
+// Process 处理采集数据，encoding为载荷编码格式(json/protobuf/cbor)
+func (p *DataProcessor) Process(ctx context.Context, encoding Encoding, data []byte) error {
 	var deviceData DeviceData
-	if err := json.Unmarshal(data, &deviceData); err != nil {
-		p.logger.Error("failed to unmarshal data", zap.Error(err))
-		return err
+	if err := decodeDeviceData(encoding, data, &deviceData); err != nil {
+		p.logger.Error("failed to unmarshal data",
+			zap.String("encoding", string(encoding)),
+			zap.Error(err))
+		p.sendDeadLetter(ctx, encoding, "", deadletter.ReasonDecode, err, data)
+		return fmt.Errorf("%w: %v", ErrDecode, err)
 	}
 
 	p.logger.Info("processing device data",
@@ -58,6 +138,33 @@ func (p *DataProcessor) Process(ctx context.Context, data []byte) error {
 		zap.String("device_ip", deviceData.DeviceIP),
 		zap.String("status", deviceData.Status))
 
+	// 先写入InfluxDB再判断是否重复：重复写入会覆盖相同的数据点，而写入完成前进程退出时，
+	// 重新投递的消息不会因幂等键已设置而丢失。部分指标被丢弃时继续处理
+	if deviceData.Status == "success" {
+		if err := p.write(ctx, encoding, &deviceData, data, false); err != nil && !errors.Is(err, ErrFieldsRejected) {
+			return err
+		}
+	}
+
+	// 跳过其他副本或本副本已处理过的重复消息
+	if p.duplicate(ctx, &deviceData) {
+		p.logger.Debug("skip duplicate data",
+			zap.String("device_id", deviceData.DeviceID),
+			zap.Time("timestamp", deviceData.Timestamp))
+		return nil
+	}
+
+	// 记录设备可用性（包括采集失败）
+	if p.availability != nil {
+		p.availability.Record(ctx, &availability.Result{
+			DeviceID:   deviceData.DeviceID,
+			DeviceIP:   deviceData.DeviceIP,
+			DeviceType: deviceData.DeviceType,
+			Success:    deviceData.Status == "success",
+			Error:      deviceData.Error,
+		})
+	}
+
 	// 只处理成功采集的数据
 	if deviceData.Status != "success" {
 		p.logger.Warn("skip failed data",
@@ -66,37 +173,247 @@ func (p *DataProcessor) Process(ctx context.Context, data []byte) error {
 		return nil
 	}
 
-	// 写入InfluxDB
-	if err := p.writeToInfluxDB(ctx, &deviceData); err != nil {
-		p.logger.Error("failed to write to influxdb", zap.Error(err))
-		return err
-	}
+	p.apply(ctx, &deviceData)
+	return nil
+}
 
+// apply 已写入InfluxDB的设备数据更新缓存、评估告警、记录功率读数，并计算依赖该设备的虚拟设备
+func (p *DataProcessor) apply(ctx context.Context, data *DeviceData) {
 	// 更新Redis缓存（用于监控大屏）
-	if err := p.updateRedisCache(ctx, &deviceData); err != nil {
+	if err := p.updateRedisCache(ctx, data); err != nil {
 		p.logger.Error("failed to update redis cache", zap.Error(err))
 		// Redis失败不影响主流程
 	}
 
+	// 评估告警规则
+	if p.alarms != nil {
+		p.alarms.Evaluate(ctx, &alarm.Sample{
+			DeviceID:   data.DeviceID,
+			DeviceType: data.DeviceType,
+			DeviceIP:   data.DeviceIP,
+			Timestamp:  data.Timestamp,
+			Metrics:    data.Metrics,
+		})
+	}
+
+	// 记录功率读数
+	if p.energy != nil {
+		p.energy.Observe(ctx, data.DeviceID, data.Timestamp, data.Metrics)
+	}
+
+	// 虚拟设备与采集的设备一样处理，虚拟设备之间没有循环依赖
+	if p.virtual != nil {
+		for _, r := range p.virtual.Evaluate(ctx, data.DeviceID, data.Timestamp) {
+			p.processVirtual(ctx, r)
+		}
+	}
+}
+
+// processVirtual 写入虚拟设备的计算结果，写入失败只记录日志
+func (p *DataProcessor) processVirtual(ctx context.Context, r *virtual.Result) {
+	data := &DeviceData{
+		DeviceID:   r.DeviceID,
+		DeviceType: r.DeviceType,
+		Timestamp:  r.Timestamp,
+		Metrics:    r.Metrics,
+		Status:     "success",
+		Tags:       r.Tags,
+		Units:      r.Units,
+	}
+	if _, err := p.writeToInfluxDB(ctx, data, false); err != nil {
+		p.logger.Error("failed to write virtual device to influxdb",
+			zap.String("device_id", data.DeviceID),
+			zap.Error(err))
+		return
+	}
+	p.apply(ctx, data)
+}
+
+// Replay 重放死信消息：只解码并写入InfluxDB，等待写入完成，不再记录设备可用性、更新缓存和评估告警；
+// 仍然无法处理时重新进入死信
+func (p *DataProcessor) Replay(ctx context.Context, m *deadletter.Message) error {
+	encoding := Encoding(m.Encoding)
+	if encoding == EncodingLineProtocol {
+		return p.replayLines(ctx, m)
+	}
+
+	var deviceData DeviceData
+	if err := decodeDeviceData(encoding, m.Payload, &deviceData); err != nil {
+		p.sendDeadLetter(ctx, encoding, "", deadletter.ReasonDecode, err, m.Payload)
+		return fmt.Errorf("%w: %v", ErrDecode, err)
+	}
+	if deviceData.Status != "success" {
+		return nil
+	}
+	return p.write(ctx, encoding, &deviceData, m.Payload, true)
+}
+
+// replayLines 重放被InfluxDB拒绝的行协议数据
+func (p *DataProcessor) replayLines(ctx context.Context, m *deadletter.Message) error {
+	lines := strings.Split(strings.TrimSpace(string(m.Payload)), "\n")
+
+	var err error
+	if w, ok := p.influxWriter.(waitWriter); ok {
+		err = w.WriteRecordWait(ctx, lines...)
+	} else {
+		err = p.influxWriter.WriteRecord(ctx, lines...)
+	}
+	if err != nil {
+		p.logger.Error("failed to write to influxdb", zap.Error(err))
+		p.sendDeadLetter(ctx, EncodingLineProtocol, m.DeviceID, deadletter.ReasonWrite, err, m.Payload)
+	}
+	return err
+}
+
+// WriteRejected 被InfluxDB拒绝写入的数据以行协议写入死信，作为writer.BatchWriter的RejectHandler
+func (p *DataProcessor) WriteRejected(lines []string, err error) {
+	payload := []byte(strings.Join(lines, "\n") + "\n")
+	p.sendDeadLetter(context.Background(), EncodingLineProtocol, lineDeviceID(lines), deadletter.ReasonWrite, err, payload)
+}
+
+// write 写入InfluxDB，写入失败或有指标被丢弃时原始载荷写入死信并返回错误；
+// wait为true时等待写入完成，否则写入InfluxDB被拒绝的数据由WriteRejected写入死信
+func (p *DataProcessor) write(ctx context.Context, encoding Encoding, data *DeviceData, payload []byte, wait bool) error {
+	rejected, err := p.writeToInfluxDB(ctx, data, wait)
+	if err != nil {
+		p.logger.Error("failed to write to influxdb", zap.Error(err))
+		p.sendDeadLetter(ctx, encoding, data.DeviceID, deadletter.ReasonWrite, err, payload)
+		return err
+	}
+	if len(rejected) > 0 {
+		// 其余指标已写入，修正字段类型后重放会以相同时间戳覆盖
+		sort.Strings(rejected)
+		err := fmt.Errorf("%w: %s", ErrFieldsRejected, strings.Join(rejected, ", "))
+		p.sendDeadLetter(ctx, encoding, data.DeviceID, deadletter.ReasonRejected, err, payload)
+		return err
+	}
 	return nil
 }
 
-// writeToInfluxDB 写入InfluxDB
-func (p *DataProcessor) writeToInfluxDB(ctx context.Context, data *DeviceData) error {
-	// 创建数据点
-	point := influxdb2.NewPoint(
-		"device_metrics",
-		map[string]string{
-			"device_id":   data.DeviceID,
-			"device_ip":   data.DeviceIP,
-			"device_type": data.DeviceType,
-		},
-		data.Metrics,
-		data.Timestamp,
-	)
+// duplicate 以设备ID和采集时间作为幂等键判断消息是否已处理并设置幂等键，需在写入InfluxDB之后调用；
+// 没有采集时间的消息或Redis失败时视为未处理
+func (p *DataProcessor) duplicate(ctx context.Context, data *DeviceData) bool {
+	if p.dedupWindow <= 0 || data.DeviceID == "" || data.Timestamp.IsZero() {
+		return false
+	}
+
+	set, err := p.redisClient.SetNX(ctx, dedupKey(data), 1, p.dedupWindow).Result()
+	if err != nil {
+		p.logger.Warn("failed to check duplicate data", zap.String("device_id", data.DeviceID), zap.Error(err))
+		return false
+	}
+	return !set
+}
+
+// dedupKey 消息的幂等键
+func dedupKey(data *DeviceData) string {
+	return dedupKeyPrefix + data.DeviceID + ":" + strconv.FormatInt(data.Timestamp.UnixNano(), 10)
+}
+
+// sendDeadLetter 写入死信，失败只记录日志
+func (p *DataProcessor) sendDeadLetter(ctx context.Context, encoding Encoding, deviceID, reason string, err error, payload []byte) {
+	if p.deadLetter == nil {
+		return
+	}
+	m := deadletter.NewMessage(string(encoding), deviceID, reason, err, payload)
+	if err := p.deadLetter.Send(ctx, m); err != nil {
+		p.logger.Error("failed to write dead letter",
+			zap.String("device_id", deviceID),
+			zap.String("reason", reason),
+			zap.Error(err))
+	}
+}
+
+// writeToInfluxDB 写入InfluxDB，指标按字段类型规范化，采集错误写入单独的measurement，返回类型不符被丢弃的指标；
+// wait为true时等待写入完成
+func (p *DataProcessor) writeToInfluxDB(ctx context.Context, data *DeviceData, wait bool) ([]string, error) {
+	tags := make(map[string]string, len(data.Tags)+3)
+	for k, v := range data.Tags {
+		tags[k] = v
+	}
+	tags["device_id"] = data.DeviceID
+	tags["device_type"] = data.DeviceType
+	if data.DeviceIP != "" {
+		tags["device_ip"] = data.DeviceIP // 虚拟设备没有IP
+	}
+
+	metrics := data.Metrics
+	var collectErrors map[string]string
+	var rejected []string
+	if p.fields != nil {
+		p.fields.RecordUnits(ctx, data.Units)
+		result := p.fields.Normalize(ctx, data.DeviceID, data.Metrics)
+		metrics, collectErrors, rejected = result.Fields, result.Errors, result.Rejected
+	}
+
+	// 创建数据点，没有有效指标时不写入
+	var points []*write.Point
+	if len(metrics) > 0 {
+		points = append(points, influxdb2.NewPoint(metricsMeasurement, tags, metrics, data.Timestamp))
+	}
+	for metric, message := range collectErrors {
+		errorTags := map[string]string{"metric": metric}
+		for k, v := range tags {
+			errorTags[k] = v
+		}
+		points = append(points, influxdb2.NewPoint(errorsMeasurement, errorTags, map[string]interface{}{"error": message}, data.Timestamp))
+	}
+	if len(points) == 0 {
+		return rejected, nil
+	}
 
 	// 写入数据
-	return p.influxWriter.WritePoint(ctx, point)
+	if w, ok := p.influxWriter.(waitWriter); ok && wait {
+		return rejected, w.WritePointWait(ctx, points...)
+	}
+	return rejected, p.influxWriter.WritePoint(ctx, points...)
+}
+
+// lineDeviceID 行协议数据中的device_id标签，数据属于多个设备时返回空字符串
+func lineDeviceID(lines []string) string {
+	var deviceID string
+	for i, line := range lines {
+		id := lineTag(line, "device_id")
+		if i > 0 && id != deviceID {
+			return ""
+		}
+		deviceID = id
+	}
+	return deviceID
+}
+
+// lineTag 读取一行行协议数据中标签的值（保留转义字符）
+func lineTag(line, key string) string {
+	// series key到第一个未转义的空格为止
+	end := len(line)
+	for i := 0; i < len(line); i++ {
+		if line[i] == '\\' {
+			i++
+			continue
+		}
+		if line[i] == ' ' {
+			end = i
+			break
+		}
+	}
+
+	prefix := "," + key + "="
+	series := line[:end]
+	start := strings.Index(series, prefix)
+	if start < 0 {
+		return ""
+	}
+	value := series[start+len(prefix):]
+	for i := 0; i < len(value); i++ {
+		if value[i] == '\\' {
+			i++
+			continue
+		}
+		if value[i] == ',' {
+			return value[:i]
+		}
+	}
+	return value
 }
 
 // updateRedisCache 更新Redis缓存
@@ -110,11 +427,23 @@ func (p *DataProcessor) updateRedisCache(ctx context.Context, data *DeviceData)
 		"timestamp":   data.Timestamp.Unix(),
 		"metrics":     data.Metrics,
 	}
+	if len(data.Units) > 0 {
+		cacheData["units"] = data.Units
+	}
+	if len(data.Quality) > 0 {
+		cacheData["quality"] = data.Quality
+	}
+	if len(data.Tags) > 0 {
+		cacheData["tags"] = data.Tags
+	}
 
 	jsonData, err := json.Marshal(cacheData)
 	if err != nil {
 		return err
 	}
+	if p.broadcaster != nil {
+		p.broadcaster.Broadcast(ctx, jsonData)
+	}
 
 	// 缓存最新数据，TTL 5分钟
 	return p.redisClient.Set(ctx, key, jsonData, 5*time.Minute).Err()
@@ -0,0 +1,30 @@
+package processor
+
+import "testing"
+
+func TestLineDeviceID(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []string
+		want  string
+	}{
+		{"single device", []string{
+			"device_metrics,device_id=ups-01,device_type=ups load=35 1767225600000000000",
+			"device_metric_errors,device_id=ups-01,metric=temp error=\"timeout\" 1767225600000000000",
+		}, "ups-01"},
+		{"last tag", []string{"device_availability,device_ip=10.0.0.1,device_id=pdu-02 up=1i 1767225600000000000"}, "pdu-02"},
+		{"escaped", []string{`device_metrics,device_id=rack\ a\,01,device_type=pdu power=1 1767225600000000000`}, `rack\ a\,01`},
+		{"multiple devices", []string{
+			"device_metrics,device_id=ups-01 load=35 1767225600000000000",
+			"device_metrics,device_id=ups-02 load=36 1767225600000000000",
+		}, ""},
+		{"no device tag", []string{"pue,site=bj value=1.5 1767225600000000000"}, ""},
+		{"device_id in field only", []string{`events,site=bj message="device_id=x" 1767225600000000000`}, ""},
+	}
+
+	for _, tt := range tests {
+		if got := lineDeviceID(tt.lines); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
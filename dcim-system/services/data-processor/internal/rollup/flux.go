@@ -0,0 +1,100 @@
+package rollup
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// fluxFuncs 聚合方式对应的Flux函数
+var fluxFuncs = map[string]string{
+	AggMin:  "min",
+	AggMax:  "max",
+	AggAvg:  "mean",
+	AggLast: "last",
+}
+
+// fluxString Flux字符串字面量
+func fluxString(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	s = strings.ReplaceAll(s, "${", `\${`)
+	return `"` + s + `"`
+}
+
+// fluxDuration Flux时长字面量
+func fluxDuration(d time.Duration) string {
+	if d%time.Second == 0 {
+		return fmt.Sprintf("%ds", d/time.Second)
+	}
+	return fmt.Sprintf("%dms", d/time.Millisecond)
+}
+
+// fluxTime Flux时间字面量
+func fluxTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// fluxAnyOf 列名等于任一值的过滤条件
+func fluxAnyOf(column string, values []string) string {
+	conds := make([]string, len(values))
+	for i, v := range values {
+		conds[i] = fmt.Sprintf("r[%s] == %s", fluxString(column), fluxString(v))
+	}
+	return strings.Join(conds, " or ")
+}
+
+// taskName 层级的降采样任务名
+func taskName(tier Tier) string {
+	return taskPrefix + tier.Name
+}
+
+// taskFlux 层级的降采样任务：每个窗口结束offset后，从原始数据桶读取该窗口内的数值字段，
+// 计算各聚合写入层级的桶，聚合方式写入tag agg，时间为窗口开始时间
+func taskFlux(raw, tier Tier, measurements []string, offset time.Duration) string {
+	var b strings.Builder
+	b.WriteString("import \"types\"\n\n")
+	fmt.Fprintf(&b, "option task = {name: %s, every: %s, offset: %s}\n\n",
+		fluxString(taskName(tier)), fluxDuration(tier.Every), fluxDuration(offset))
+
+	fmt.Fprintf(&b, "data = from(bucket: %s)\n", fluxString(raw.Bucket))
+	b.WriteString("    |> range(start: -task.every)\n")
+	fmt.Fprintf(&b, "    |> filter(fn: (r) => %s)\n", fluxAnyOf("_measurement", measurements))
+	b.WriteString("    |> filter(fn: (r) => types.isNumeric(v: r._value))\n")
+	b.WriteString("    |> toFloat()\n\n")
+
+	b.WriteString("union(tables: [\n")
+	for _, agg := range Aggregates {
+		fmt.Fprintf(&b, "    data |> aggregateWindow(every: %s, fn: %s, timeSrc: \"_start\", createEmpty: false) |> set(key: %s, value: %s),\n",
+			fluxDuration(tier.Every), fluxFuncs[agg], fluxString(aggTag), fluxString(agg))
+	}
+	b.WriteString("])\n")
+	fmt.Fprintf(&b, "    |> to(bucket: %s)\n", fluxString(tier.Bucket))
+	return b.String()
+}
+
+// queryFlux 查询的Flux：降采样层级按聚合方式读取对应的聚合后按step再次聚合，原始数据直接按step聚合
+func queryFlux(tier Tier, q *Query, step time.Duration) string {
+	var b strings.Builder
+	if tier.Raw() {
+		b.WriteString("import \"types\"\n\n")
+	}
+	fmt.Fprintf(&b, "from(bucket: %s)\n", fluxString(tier.Bucket))
+	fmt.Fprintf(&b, "    |> range(start: %s, stop: %s)\n", fluxTime(q.Start), fluxTime(q.Stop))
+	fmt.Fprintf(&b, "    |> filter(fn: (r) => r._measurement == %s)\n", fluxString(q.Measurement))
+	if len(q.Fields) > 0 {
+		fmt.Fprintf(&b, "    |> filter(fn: (r) => %s)\n", fluxAnyOf("_field", q.Fields))
+	}
+	for _, tag := range sortedKeys(q.Tags) {
+		fmt.Fprintf(&b, "    |> filter(fn: (r) => %s)\n", fluxAnyOf(tag, q.Tags[tag]))
+	}
+	if tier.Raw() {
+		b.WriteString("    |> filter(fn: (r) => types.isNumeric(v: r._value))\n")
+		b.WriteString("    |> toFloat()\n")
+	} else {
+		fmt.Fprintf(&b, "    |> filter(fn: (r) => r[%s] == %s)\n", fluxString(aggTag), fluxString(q.Aggregate))
+		fmt.Fprintf(&b, "    |> drop(columns: [%s])\n", fluxString(aggTag))
+	}
+	fmt.Fprintf(&b, "    |> aggregateWindow(every: %s, fn: %s, createEmpty: false)\n", fluxDuration(step), fluxFuncs[q.Aggregate])
+	return b.String()
+}
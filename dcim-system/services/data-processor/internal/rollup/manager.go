@@ -0,0 +1,185 @@
+package rollup
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
+	"github.com/influxdata/influxdb-client-go/v2/api"
+	"github.com/influxdata/influxdb-client-go/v2/domain"
+	"go.uber.org/zap"
+)
+
+// taskPrefix 降采样任务名前缀，以此前缀命名但不在配置中的任务会被删除
+const taskPrefix = "dcim-downsample-"
+
+// lockKey 多副本同时启动时只由一个副本同步桶和任务
+const lockKey = "rollup:ensure_lock"
+
+// Manager 降采样管理
+// 启动时为每个降采样层级创建（或更新保留时间）InfluxDB桶，并创建（或更新）定期执行的Flux任务，
+// 由InfluxDB从原始数据桶计算各窗口的min/max/avg/last写入层级的桶；原始数据桶按配置设置保留时间
+type Manager struct {
+	client       influxdb2.Client
+	org          string
+	tiers        []Tier
+	measurements []string
+	offset       time.Duration
+	redis        *redis.Client
+	logger       *zap.Logger
+}
+
+// NewManager 创建降采样管理，tiers第一个为原始数据，offset为窗口结束后延迟执行任务的时间，等待迟到的数据
+func NewManager(client influxdb2.Client, org string, tiers []Tier, measurements []string, offset time.Duration, redisClient *redis.Client, logger *zap.Logger) *Manager {
+	return &Manager{
+		client:       client,
+		org:          org,
+		tiers:        tiers,
+		measurements: measurements,
+		offset:       offset,
+		redis:        redisClient,
+		logger:       logger,
+	}
+}
+
+// Tiers 数据层级
+func (m *Manager) Tiers() []Tier {
+	return m.tiers
+}
+
+// Run 同步桶和降采样任务，失败时（如InfluxDB尚未就绪）每隔retryInterval重试，直到成功或ctx结束
+func (m *Manager) Run(ctx context.Context, retryInterval time.Duration) {
+	for {
+		err := m.Ensure(ctx)
+		if err == nil {
+			return
+		}
+		m.logger.Error("failed to sync rollup buckets and tasks, retrying", zap.Duration("retry_interval", retryInterval), zap.Error(err))
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(retryInterval):
+		}
+	}
+}
+
+// Ensure 同步桶和降采样任务，其他副本正在同步时跳过
+func (m *Manager) Ensure(ctx context.Context) error {
+	ok, err := m.redis.SetNX(ctx, lockKey, 1, time.Minute).Result()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		m.logger.Info("rollup buckets and tasks are being synced by another replica")
+		return nil
+	}
+	defer m.redis.Del(ctx, lockKey)
+
+	org, err := m.client.OrganizationsAPI().FindOrganizationByName(ctx, m.org)
+	if err != nil {
+		return fmt.Errorf("failed to find org %s: %w", m.org, err)
+	}
+
+	for _, tier := range m.tiers {
+		if err := m.ensureBucket(ctx, org, tier); err != nil {
+			return fmt.Errorf("tier %s: %w", tier.Name, err)
+		}
+	}
+	return m.ensureTasks(ctx, *org.Id)
+}
+
+// ensureBucket 创建桶，已存在时更新保留时间
+func (m *Manager) ensureBucket(ctx context.Context, org *domain.Organization, tier Tier) error {
+	bucketsAPI := m.client.BucketsAPI()
+	retention := domain.RetentionRule{EverySeconds: int64(tier.Retention / time.Second)}
+
+	bucket, err := bucketsAPI.FindBucketByName(ctx, tier.Bucket)
+	if err != nil {
+		if !notFound(err) {
+			return err
+		}
+		if _, err := bucketsAPI.CreateBucketWithName(ctx, org, tier.Bucket, retention); err != nil {
+			return fmt.Errorf("failed to create bucket %s: %w", tier.Bucket, err)
+		}
+		m.logger.Info("rollup bucket created",
+			zap.String("bucket", tier.Bucket),
+			zap.Duration("retention", tier.Retention))
+		return nil
+	}
+
+	if len(bucket.RetentionRules) == 1 && bucket.RetentionRules[0].EverySeconds == retention.EverySeconds {
+		return nil
+	}
+	// 保留分片时长由InfluxDB按保留时间重新计算
+	bucket.RetentionRules = domain.RetentionRules{retention}
+	if _, err := bucketsAPI.UpdateBucket(ctx, bucket); err != nil {
+		return fmt.Errorf("failed to update bucket %s: %w", tier.Bucket, err)
+	}
+	m.logger.Info("bucket retention updated",
+		zap.String("bucket", tier.Bucket),
+		zap.Duration("retention", tier.Retention))
+	return nil
+}
+
+// ensureTasks 创建或更新各层级的降采样任务，删除已不在配置中的任务
+func (m *Manager) ensureTasks(ctx context.Context, orgID string) error {
+	tasksAPI := m.client.TasksAPI()
+	tasks, err := tasksAPI.FindTasks(ctx, &api.TaskFilter{OrgID: orgID, Limit: 500})
+	if err != nil {
+		return fmt.Errorf("failed to list tasks: %w", err)
+	}
+	existing := make(map[string]domain.Task)
+	for _, task := range tasks {
+		if strings.HasPrefix(task.Name, taskPrefix) {
+			existing[task.Name] = task
+		}
+	}
+
+	raw := m.tiers[0]
+	for _, tier := range m.tiers[1:] {
+		name := taskName(tier)
+		flux := taskFlux(raw, tier, m.measurements, m.offset)
+
+		task, ok := existing[name]
+		delete(existing, name)
+		if !ok {
+			if _, err := tasksAPI.CreateTaskByFlux(ctx, flux, orgID); err != nil {
+				return fmt.Errorf("failed to create task %s: %w", name, err)
+			}
+			m.logger.Info("rollup task created", zap.String("task", name))
+			continue
+		}
+
+		active := domain.TaskStatusTypeActive
+		if task.Flux == flux && task.Status != nil && *task.Status == active {
+			continue
+		}
+		task.Flux = flux
+		task.Status = &active
+		// every和offset由Flux中的task选项决定
+		task.Every = nil
+		task.Offset = nil
+		task.Cron = nil
+		if _, err := tasksAPI.UpdateTask(ctx, &task); err != nil {
+			return fmt.Errorf("failed to update task %s: %w", name, err)
+		}
+		m.logger.Info("rollup task updated", zap.String("task", name))
+	}
+
+	for name, task := range existing {
+		if err := tasksAPI.DeleteTaskWithID(ctx, task.Id); err != nil {
+			return fmt.Errorf("failed to delete task %s: %w", name, err)
+		}
+		m.logger.Info("stale rollup task deleted", zap.String("task", name))
+	}
+	return nil
+}
+
+// notFound 是否为InfluxDB未找到资源的错误
+func notFound(err error) bool {
+	return strings.Contains(err.Error(), "not found")
+}
@@ -0,0 +1,355 @@
+package rollup
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/influxdata/influxdb-client-go/v2/api"
+	"go.uber.org/zap"
+)
+
+// cacheKeyPrefix 查询结果缓存，<查询条件的hash>
+const cacheKeyPrefix = "metrics:query:"
+
+var (
+	// ErrInvalidQuery 查询条件无效
+	ErrInvalidQuery = errors.New("invalid query")
+	// ErrTooManyPoints 查询的数据点超过上限
+	ErrTooManyPoints = errors.New("too many points")
+)
+
+// Query 历史数据查询条件
+type Query struct {
+	Measurement string
+	Fields      []string            // 为空时查询全部数值字段
+	Tags        map[string][]string // tag -> 可选值，如device_id
+	Start       time.Time
+	Stop        time.Time
+	Step        time.Duration // 数据点间隔，0表示按每个序列的最大点数自动选择
+	Aggregate   string        // min/max/avg/last
+}
+
+// Plan 查询使用的层级和实际的数据点间隔
+type Plan struct {
+	Tier Tier
+	Step time.Duration
+}
+
+// Point 数据点
+type Point struct {
+	Time  time.Time `json:"time"`
+	Value float64   `json:"value"`
+}
+
+// Series 一个字段在一组tag下的数据
+type Series struct {
+	Measurement string            `json:"measurement"`
+	Field       string            `json:"field"`
+	Tags        map[string]string `json:"tags"`
+	Points      []Point           `json:"points"`
+}
+
+// Result 查询结果，start/stop为按step对齐后的时间范围
+type Result struct {
+	Tier      string    `json:"tier"`
+	Step      int64     `json:"step"` // 数据点间隔（秒）
+	Start     time.Time `json:"start"`
+	Stop      time.Time `json:"stop"`
+	Aggregate string    `json:"aggregate"`
+	Points    int       `json:"points"`
+	Cached    bool      `json:"cached"`
+	Series    []*Series `json:"series"`
+}
+
+// Querier 历史数据查询，按查询的时间范围和数据点间隔选择数据层级
+type Querier struct {
+	queryAPI       api.QueryAPI
+	tiers          []Tier
+	maxPoints      int
+	maxTotalPoints int
+	redis          *redis.Client // 为nil时不缓存
+	cacheTTL       time.Duration
+	logger         *zap.Logger
+	now            func() time.Time
+}
+
+// NewQuerier 创建历史数据查询，tiers第一个为原始数据；maxPoints为每个序列的最大点数，
+// maxTotalPoints为一次查询返回的最大点数，0表示不限制
+func NewQuerier(queryAPI api.QueryAPI, tiers []Tier, maxPoints, maxTotalPoints int, logger *zap.Logger) *Querier {
+	if maxPoints <= 0 {
+		maxPoints = 1000
+	}
+	return &Querier{
+		queryAPI:       queryAPI,
+		tiers:          tiers,
+		maxPoints:      maxPoints,
+		maxTotalPoints: maxTotalPoints,
+		logger:         logger,
+		now:            time.Now,
+	}
+}
+
+// SetCache 将查询结果缓存到Redis，相同条件（时间范围按step对齐）的查询在ttl内直接返回缓存
+func (q *Querier) SetCache(redisClient *redis.Client, ttl time.Duration) {
+	q.redis = redisClient
+	q.cacheTTL = ttl
+}
+
+// Plan 选择层级：在仍保留查询开始时间数据的层级中，选择聚合窗口不超过step的最粗层级；
+// 没有这样的层级时选择保留了开始时间的最细层级，都没有保留时选择保留时间最长的层级。
+// step按层级的聚合窗口向上取整
+func (q *Querier) Plan(query *Query) (*Plan, error) {
+	if err := validate(query); err != nil {
+		return nil, err
+	}
+
+	span := query.Stop.Sub(query.Start)
+	step := query.Step
+	if step <= 0 {
+		if step = ceil(span/time.Duration(q.maxPoints), time.Second); step == 0 {
+			step = time.Second
+		}
+	}
+	if n := ceil(span, step) / step; n > time.Duration(q.maxPoints) {
+		return nil, fmt.Errorf("%w: %d points per series exceeds %d, increase step or shorten the range",
+			ErrTooManyPoints, n, q.maxPoints)
+	}
+
+	// tiers按聚合窗口递增
+	now := q.now()
+	var tier, finer *Tier
+	for i := range q.tiers {
+		t := &q.tiers[i]
+		switch {
+		case !t.covers(query.Start, now):
+		case t.Every <= step:
+			tier = t
+		case finer == nil:
+			finer = t
+		}
+	}
+	if tier == nil {
+		tier = finer
+	}
+	if tier == nil {
+		tier = &q.tiers[0]
+		for i := range q.tiers {
+			if t := &q.tiers[i]; t.Retention > tier.Retention {
+				tier = t
+			}
+		}
+	}
+
+	if !tier.Raw() {
+		step = ceil(step, tier.Every)
+	}
+	return &Plan{Tier: *tier, Step: step}, nil
+}
+
+// Query 查询历史数据，时间范围按step对齐（与聚合窗口一致，相对时间的查询在一个step内命中缓存），
+// 返回按measurement、字段和tag排序的序列
+func (q *Querier) Query(ctx context.Context, query *Query) (*Result, error) {
+	plan, err := q.Plan(query)
+	if err != nil {
+		return nil, err
+	}
+
+	aligned := *query
+	aligned.Start = time.Unix(0, int64(floor(time.Duration(query.Start.UnixNano()), plan.Step))).UTC()
+	aligned.Stop = time.Unix(0, int64(ceil(time.Duration(query.Stop.UnixNano()), plan.Step))).UTC()
+
+	key := cacheKey(plan, &aligned)
+	if result := q.cached(ctx, key); result != nil {
+		return result, nil
+	}
+
+	series, points, err := q.run(ctx, plan, &aligned)
+	if err != nil {
+		return nil, err
+	}
+	result := &Result{
+		Tier:      plan.Tier.Name,
+		Step:      int64(plan.Step / time.Second),
+		Start:     aligned.Start,
+		Stop:      aligned.Stop,
+		Aggregate: query.Aggregate,
+		Points:    points,
+		Series:    series,
+	}
+	q.store(ctx, key, result)
+	return result, nil
+}
+
+// run 执行查询，数据点总数超过上限时中止
+func (q *Querier) run(ctx context.Context, plan *Plan, query *Query) ([]*Series, int, error) {
+	result, err := q.queryAPI.Query(ctx, queryFlux(plan.Tier, query, plan.Step))
+	if err != nil {
+		return nil, 0, err
+	}
+	defer result.Close()
+
+	series := make(map[string]*Series)
+	points := 0
+	for result.Next() {
+		record := result.Record()
+		value, ok := record.Value().(float64)
+		if !ok {
+			continue
+		}
+		if points++; q.maxTotalPoints > 0 && points > q.maxTotalPoints {
+			return nil, 0, fmt.Errorf("%w: more than %d points in total, narrow the selection or increase step",
+				ErrTooManyPoints, q.maxTotalPoints)
+		}
+
+		s := &Series{Measurement: record.Measurement(), Field: record.Field(), Tags: make(map[string]string)}
+		for k, v := range record.Values() {
+			if tag, ok := v.(string); ok && !strings.HasPrefix(k, "_") && k != "result" && k != "table" {
+				s.Tags[k] = tag
+			}
+		}
+		key := seriesKey(s)
+		if existing, ok := series[key]; ok {
+			s = existing
+		} else {
+			series[key] = s
+		}
+		s.Points = append(s.Points, Point{Time: record.Time(), Value: value})
+	}
+	if err := result.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	keys := make([]string, 0, len(series))
+	for key := range series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	list := make([]*Series, len(keys))
+	for i, key := range keys {
+		list[i] = series[key]
+	}
+	return list, points, nil
+}
+
+// cached 读取缓存的查询结果，未命中或读取失败时返回nil
+func (q *Querier) cached(ctx context.Context, key string) *Result {
+	if q.redis == nil || q.cacheTTL <= 0 {
+		return nil
+	}
+
+	data, err := q.redis.Get(ctx, key).Bytes()
+	if err != nil {
+		if err != redis.Nil {
+			q.logger.Warn("failed to load cached query", zap.Error(err))
+		}
+		return nil
+	}
+	var result Result
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil
+	}
+	result.Cached = true
+	return &result
+}
+
+// store 缓存查询结果，失败只记录日志
+func (q *Querier) store(ctx context.Context, key string, result *Result) {
+	if q.redis == nil || q.cacheTTL <= 0 {
+		return
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		return
+	}
+	if err := q.redis.Set(ctx, key, data, q.cacheTTL).Err(); err != nil {
+		q.logger.Warn("failed to cache query", zap.Error(err))
+	}
+}
+
+// validate 校验查询条件
+func validate(query *Query) error {
+	if query.Measurement == "" {
+		return fmt.Errorf("%w: measurement is required", ErrInvalidQuery)
+	}
+	if !query.Stop.After(query.Start) {
+		return fmt.Errorf("%w: stop must be after start", ErrInvalidQuery)
+	}
+	if query.Step < 0 || query.Step%time.Second != 0 {
+		return fmt.Errorf("%w: step must be whole seconds", ErrInvalidQuery)
+	}
+	if !ValidAggregate(query.Aggregate) {
+		return fmt.Errorf("%w: unknown aggregate %q", ErrInvalidQuery, query.Aggregate)
+	}
+	for tag, values := range query.Tags {
+		if tag == "" || len(values) == 0 {
+			return fmt.Errorf("%w: tag %q requires at least one value", ErrInvalidQuery, tag)
+		}
+	}
+	return nil
+}
+
+// cacheKey 查询条件的缓存key，字段和tag值排序后计算
+func cacheKey(plan *Plan, query *Query) string {
+	fields := append([]string(nil), query.Fields...)
+	sort.Strings(fields)
+	tags := make(map[string][]string, len(query.Tags))
+	for k, v := range query.Tags {
+		values := append([]string(nil), v...)
+		sort.Strings(values)
+		tags[k] = values
+	}
+
+	data, _ := json.Marshal([]interface{}{
+		plan.Tier.Bucket, plan.Step, query.Measurement, fields, tags,
+		query.Start.UnixNano(), query.Stop.UnixNano(), query.Aggregate,
+	})
+	sum := sha1.Sum(data)
+	return cacheKeyPrefix + hex.EncodeToString(sum[:])
+}
+
+// seriesKey 序列的唯一标识
+func seriesKey(s *Series) string {
+	var b strings.Builder
+	b.WriteString(s.Measurement)
+	b.WriteByte(0)
+	b.WriteString(s.Field)
+	for _, k := range sortedKeys(s.Tags) {
+		b.WriteByte(0)
+		b.WriteString(k)
+		b.WriteByte('=')
+		b.WriteString(s.Tags[k])
+	}
+	return b.String()
+}
+
+// floor d按unit向下取整
+func floor(d, unit time.Duration) time.Duration {
+	return d / unit * unit
+}
+
+// ceil d按unit向上取整
+func ceil(d, unit time.Duration) time.Duration {
+	if r := d % unit; r != 0 {
+		return d - r + unit
+	}
+	return d
+}
+
+// sortedKeys map的key排序
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
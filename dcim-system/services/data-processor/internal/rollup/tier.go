@@ -0,0 +1,79 @@
+package rollup
+
+import (
+	"fmt"
+	"time"
+)
+
+// 聚合方式，降采样桶中以tag agg区分
+const (
+	AggMin  = "min"
+	AggMax  = "max"
+	AggAvg  = "avg"
+	AggLast = "last"
+)
+
+// Aggregates 每个聚合窗口计算的聚合
+var Aggregates = []string{AggMin, AggMax, AggAvg, AggLast}
+
+// aggTag 降采样数据中聚合方式的tag
+const aggTag = "agg"
+
+// Tier 数据层级，Every为0表示原始数据
+type Tier struct {
+	Name      string
+	Every     time.Duration // 聚合窗口
+	Bucket    string
+	Retention time.Duration // 保留时间，0表示永久保留
+}
+
+// Raw 是否为原始数据
+func (t Tier) Raw() bool {
+	return t.Every == 0
+}
+
+// covers 层级在now时是否仍保留start之后的数据
+func (t Tier) covers(start, now time.Time) bool {
+	return t.Retention == 0 || !start.Before(now.Add(-t.Retention))
+}
+
+// ValidAggregate 是否为支持的聚合方式
+func ValidAggregate(agg string) bool {
+	for _, a := range Aggregates {
+		if a == agg {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate 校验层级：第一个为原始数据，之后的聚合窗口递增且为整秒，原始数据至少保留到最长的窗口计算完成
+func Validate(tiers []Tier) error {
+	if len(tiers) == 0 || !tiers[0].Raw() {
+		return fmt.Errorf("first tier must be raw data")
+	}
+
+	names := make(map[string]bool)
+	buckets := make(map[string]bool)
+	for i, t := range tiers {
+		if t.Name == "" || names[t.Name] {
+			return fmt.Errorf("tier name %q is empty or duplicated", t.Name)
+		}
+		if t.Bucket == "" || buckets[t.Bucket] {
+			return fmt.Errorf("tier %s: bucket %q is empty or duplicated", t.Name, t.Bucket)
+		}
+		names[t.Name] = true
+		buckets[t.Bucket] = true
+
+		if i == 0 {
+			continue
+		}
+		if t.Every < time.Second || t.Every%time.Second != 0 || t.Every <= tiers[i-1].Every {
+			return fmt.Errorf("tier %s: every must be whole seconds and increasing", t.Name)
+		}
+		if raw := tiers[0].Retention; raw != 0 && raw < 2*t.Every {
+			return fmt.Errorf("tier %s: raw retention must be at least twice the window", t.Name)
+		}
+	}
+	return nil
+}
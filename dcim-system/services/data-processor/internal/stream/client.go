@@ -0,0 +1,136 @@
+package stream
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 推送的事件类型
+const (
+	EventSnapshot = "snapshot" // 订阅时的设备最新数据
+	EventUpdate   = "update"   // 推送间隔内变化的设备数据
+)
+
+// sender 推送协议（WebSocket/SSE），只在客户端的推送循环中调用
+type sender interface {
+	send(event string, updates []*Update) error
+	ping() error
+}
+
+// client 推送客户端，待推送数据按设备只保留最新的一条
+type client struct {
+	mu       sync.Mutex
+	sub      Subscription
+	pending  map[string]*Update
+	interval time.Duration
+}
+
+// newClient 创建推送客户端
+func newClient(sub Subscription, interval time.Duration) *client {
+	return &client{sub: sub, pending: make(map[string]*Update), interval: interval}
+}
+
+// offer 符合订阅条件的数据放入待推送数据
+func (c *client) offer(u *Update) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.sub.Matches(u) {
+		c.pending[u.DeviceID] = u
+	}
+}
+
+// subscribe 替换订阅条件并清空待推送数据
+func (c *client) subscribe(sub Subscription) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.sub = sub
+	c.pending = make(map[string]*Update)
+}
+
+// subscription 当前的订阅条件
+func (c *client) subscription() Subscription {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.sub
+}
+
+// take 取出待推送数据，按设备ID排序
+func (c *client) take() []*Update {
+	c.mu.Lock()
+	pending := c.pending
+	c.pending = make(map[string]*Update)
+	c.mu.Unlock()
+
+	updates := make([]*Update, 0, len(pending))
+	for _, u := range pending {
+		updates = append(updates, u)
+	}
+	sort.Slice(updates, func(i, j int) bool { return updates[i].DeviceID < updates[j].DeviceID })
+	return updates
+}
+
+// discardOlder 丢弃不比快照新的待推送数据，避免快照之后又推送旧数据
+func (c *client) discardOlder(snapshot []*Update) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, s := range snapshot {
+		if u, ok := c.pending[s.DeviceID]; ok && u.Timestamp <= s.Timestamp {
+			delete(c.pending, s.DeviceID)
+		}
+	}
+}
+
+// serve 客户端推送循环：先推送快照，之后每个推送间隔推送变化的设备数据，收到新的订阅条件时重新推送快照；
+// 推送失败或ctx结束时返回
+func (h *Hub) serve(ctx context.Context, c *client, s sender, subs <-chan Subscription) error {
+	if err := h.sendSnapshot(ctx, c, s); err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+	heartbeat := time.NewTicker(h.heartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case sub, ok := <-subs:
+			if !ok {
+				return nil
+			}
+			c.subscribe(sub)
+			if err := h.sendSnapshot(ctx, c, s); err != nil {
+				return err
+			}
+		case <-ticker.C:
+			if updates := c.take(); len(updates) > 0 {
+				if err := s.send(EventUpdate, updates); err != nil {
+					return err
+				}
+			}
+		case <-heartbeat.C:
+			if err := s.ping(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// sendSnapshot 推送符合订阅条件的设备最新数据
+func (h *Hub) sendSnapshot(ctx context.Context, c *client, s sender) error {
+	sub := c.subscription()
+	updates, err := h.snapshot(ctx, &sub)
+	if err != nil {
+		return err
+	}
+	c.discardOlder(updates)
+	sort.Slice(updates, func(i, j int) bool { return updates[i].DeviceID < updates[j].DeviceID })
+	return s.send(EventSnapshot, updates)
+}
@@ -0,0 +1,198 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+)
+
+// writeTimeout 单次推送的写超时，超时的慢客户端断开
+const writeTimeout = 10 * time.Second
+
+// wsMessage WebSocket客户端消息，{"action":"subscribe",...}替换订阅条件并重新推送快照
+type wsMessage struct {
+	Action string `json:"action"`
+	Subscription
+}
+
+// event 推送的消息
+type event struct {
+	Type string    `json:"type"`
+	Data []*Update `json:"data"`
+}
+
+// ServeSSE GET /api/v1/stream?device_id=&room=&device_type=&interval= 以Server-Sent Events推送
+func (h *Hub) ServeSSE(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	sub, interval, err := h.parseRequest(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	c := newClient(sub, interval)
+	if err := h.register(c); err != nil {
+		writeError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	defer h.unregister(c)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no") // 禁止反向代理缓冲
+	w.WriteHeader(http.StatusOK)
+
+	s := &sseSender{w: w, rc: http.NewResponseController(w)}
+	if err := h.serve(r.Context(), c, s, nil); err != nil {
+		h.logger.Debug("sse client disconnected", zap.String("remote", r.RemoteAddr), zap.Error(err))
+	}
+}
+
+// ServeWS GET /api/v1/stream/ws?device_id=&room=&device_type=&interval= 以WebSocket推送，连接后可以发送subscribe消息修改订阅条件
+func (h *Hub) ServeWS(w http.ResponseWriter, r *http.Request) {
+	sub, interval, err := h.parseRequest(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	c := newClient(sub, interval)
+	if err := h.register(c); err != nil {
+		writeError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	defer h.unregister(c)
+
+	// 升级失败时由upgrader返回错误响应
+	conn, err := h.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	// 连接被接管后r.Context()不会随连接关闭结束，由读取循环在连接断开时结束
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	conn.SetReadLimit(64 << 10)
+	conn.SetReadDeadline(time.Now().Add(2 * h.heartbeat))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(2 * h.heartbeat))
+	})
+
+	subs := make(chan Subscription, 1)
+	go func() {
+		defer cancel()
+		for {
+			var msg wsMessage
+			if err := conn.ReadJSON(&msg); err != nil {
+				return
+			}
+			if msg.Action != "subscribe" {
+				continue
+			}
+			select {
+			case subs <- msg.Subscription:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	if err := h.serve(ctx, c, &wsSender{conn: conn}, subs); err != nil {
+		h.logger.Debug("websocket client disconnected", zap.String("remote", r.RemoteAddr), zap.Error(err))
+	}
+}
+
+// parseRequest 解析订阅条件和推送间隔（毫秒），推送间隔不小于配置的最短间隔
+func (h *Hub) parseRequest(params url.Values) (Subscription, time.Duration, error) {
+	sub := Subscription{
+		DeviceIDs:   listParam(params, "device_id"),
+		Rooms:       listParam(params, "room"),
+		DeviceTypes: listParam(params, "device_type"),
+	}
+
+	interval := h.minInterval
+	if v := params.Get("interval"); v != "" {
+		ms, err := strconv.Atoi(v)
+		if err != nil || ms <= 0 {
+			return sub, 0, errors.New("invalid interval")
+		}
+		if d := time.Duration(ms) * time.Millisecond; d > interval {
+			interval = d
+		}
+	}
+	return sub, interval, nil
+}
+
+// sseSender Server-Sent Events推送
+type sseSender struct {
+	w  http.ResponseWriter
+	rc *http.ResponseController
+}
+
+func (s *sseSender) send(eventType string, updates []*Update) error {
+	data, err := json.Marshal(updates)
+	if err != nil {
+		return err
+	}
+	return s.write(fmt.Sprintf("event: %s\ndata: %s\n\n", eventType, data))
+}
+
+func (s *sseSender) ping() error {
+	return s.write(": ping\n\n")
+}
+
+func (s *sseSender) write(msg string) error {
+	s.rc.SetWriteDeadline(time.Now().Add(writeTimeout))
+	if _, err := s.w.Write([]byte(msg)); err != nil {
+		return err
+	}
+	return s.rc.Flush()
+}
+
+// wsSender WebSocket推送
+type wsSender struct {
+	conn *websocket.Conn
+}
+
+func (s *wsSender) send(eventType string, updates []*Update) error {
+	s.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	return s.conn.WriteJSON(&event{Type: eventType, Data: updates})
+}
+
+func (s *wsSender) ping() error {
+	return s.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeTimeout))
+}
+
+// listParam 可重复、以逗号分隔的参数
+func listParam(params url.Values, name string) []string {
+	var list []string
+	for _, v := range params[name] {
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+	}
+	return list
+}
+
+// writeError 返回错误响应
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{"error": message})
+}
@@ -0,0 +1,242 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+)
+
+// Redis key
+const (
+	channel      = "stream:device_updates" // 设备最新数据的Pub/Sub频道，各副本把处理的数据发布到该频道
+	latestPrefix = "device:latest:"        // 设备最新数据缓存，由数据处理器写入
+)
+
+// ErrTooManyClients 连接数达到上限
+var ErrTooManyClients = errors.New("too many stream clients")
+
+// Update 设备最新数据，与device:latest:<设备ID>的内容一致，room按标签或配置解析
+type Update struct {
+	DeviceID   string                 `json:"device_id"`
+	DeviceIP   string                 `json:"device_ip"`
+	DeviceType string                 `json:"device_type"`
+	Room       string                 `json:"room,omitempty"`
+	Timestamp  int64                  `json:"timestamp"`
+	Metrics    map[string]interface{} `json:"metrics"`
+	Units      map[string]string      `json:"units,omitempty"`
+	Quality    map[string]string      `json:"quality,omitempty"`
+	Tags       map[string]string      `json:"tags,omitempty"`
+}
+
+// Subscription 订阅条件，设备ID、机房、设备类型任一匹配即推送，都为空时推送全部设备
+type Subscription struct {
+	DeviceIDs   []string `json:"device_ids"`
+	Rooms       []string `json:"rooms"`
+	DeviceTypes []string `json:"device_types"`
+}
+
+// Matches 设备数据是否符合订阅条件
+func (s *Subscription) Matches(u *Update) bool {
+	if len(s.DeviceIDs) == 0 && len(s.Rooms) == 0 && len(s.DeviceTypes) == 0 {
+		return true
+	}
+	return contains(s.DeviceIDs, u.DeviceID) ||
+		(u.Room != "" && contains(s.Rooms, u.Room)) ||
+		contains(s.DeviceTypes, u.DeviceType)
+}
+
+// onlyDevices 是否只按设备ID订阅
+func (s *Subscription) onlyDevices() bool {
+	return len(s.DeviceIDs) > 0 && len(s.Rooms) == 0 && len(s.DeviceTypes) == 0
+}
+
+// Hub 设备数据实时推送
+// 数据处理器通过Broadcast把每条设备最新数据发布到Redis频道，各副本订阅该频道后分发给本副本的WebSocket/SSE客户端，
+// 多副本共享订阅时客户端连接任一副本都能收到全部设备的数据。每个客户端按推送间隔合并同一设备的数据，只推送最新的一条
+type Hub struct {
+	redis       *redis.Client
+	rooms       map[string]string // 设备ID -> 机房，数据标签中没有room时使用
+	minInterval time.Duration
+	heartbeat   time.Duration
+	maxClients  int
+	upgrader    websocket.Upgrader
+	logger      *zap.Logger
+
+	mu      sync.RWMutex
+	clients map[*client]struct{}
+}
+
+// NewHub 创建实时推送，minInterval为同一客户端的最短推送间隔，maxClients为0时不限制连接数；
+// origins为允许建立WebSocket连接的页面来源，为空时只允许同源，"*"表示不限制
+func NewHub(
+	redisClient *redis.Client,
+	rooms map[string]string,
+	minInterval time.Duration,
+	heartbeat time.Duration,
+	maxClients int,
+	origins []string,
+	logger *zap.Logger,
+) *Hub {
+	h := &Hub{
+		redis:       redisClient,
+		rooms:       rooms,
+		minInterval: minInterval,
+		heartbeat:   heartbeat,
+		maxClients:  maxClients,
+		logger:      logger,
+		clients:     make(map[*client]struct{}),
+	}
+	if len(origins) > 0 {
+		h.upgrader.CheckOrigin = func(r *http.Request) bool {
+			return contains(origins, "*") || contains(origins, r.Header.Get("Origin"))
+		}
+	}
+	return h
+}
+
+// Broadcast 发布设备最新数据（device:latest缓存的JSON），失败只记录日志
+func (h *Hub) Broadcast(ctx context.Context, data []byte) {
+	if err := h.redis.Publish(ctx, channel, data).Err(); err != nil {
+		h.logger.Warn("failed to publish device update", zap.Error(err))
+	}
+}
+
+// Run 订阅Redis频道并分发给客户端，直到ctx结束；连接断开时由Redis客户端自动重新订阅
+func (h *Hub) Run(ctx context.Context) {
+	pubsub := h.redis.Subscribe(ctx, channel)
+	defer pubsub.Close()
+
+	messages := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-messages:
+			if !ok {
+				return
+			}
+			u, err := h.decode([]byte(msg.Payload))
+			if err != nil {
+				h.logger.Warn("invalid device update", zap.Error(err))
+				continue
+			}
+			h.dispatch(u)
+		}
+	}
+}
+
+// register 注册客户端，连接数达到上限时返回ErrTooManyClients
+func (h *Hub) register(c *client) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.maxClients > 0 && len(h.clients) >= h.maxClients {
+		return ErrTooManyClients
+	}
+	h.clients[c] = struct{}{}
+	return nil
+}
+
+// unregister 注销客户端
+func (h *Hub) unregister(c *client) {
+	h.mu.Lock()
+	delete(h.clients, c)
+	h.mu.Unlock()
+}
+
+// dispatch 把设备数据放入订阅了该设备的客户端的待推送数据
+func (h *Hub) dispatch(u *Update) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for c := range h.clients {
+		c.offer(u)
+	}
+}
+
+// snapshot 读取符合订阅条件的设备最新数据；只按设备ID订阅时直接读取，否则遍历全部设备
+func (h *Hub) snapshot(ctx context.Context, sub *Subscription) ([]*Update, error) {
+	if sub.onlyDevices() {
+		keys := make([]string, len(sub.DeviceIDs))
+		for i, id := range sub.DeviceIDs {
+			keys[i] = latestPrefix + id
+		}
+		return h.load(ctx, keys, sub)
+	}
+
+	var updates []*Update
+	iter := h.redis.Scan(ctx, 0, latestPrefix+"*", 1000).Iterator()
+	keys := make([]string, 0, 500)
+	for iter.Next(ctx) {
+		if keys = append(keys, iter.Val()); len(keys) == cap(keys) {
+			batch, err := h.load(ctx, keys, sub)
+			if err != nil {
+				return nil, err
+			}
+			updates = append(updates, batch...)
+			keys = keys[:0]
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+	batch, err := h.load(ctx, keys, sub)
+	if err != nil {
+		return nil, err
+	}
+	return append(updates, batch...), nil
+}
+
+// load 批量读取设备最新数据，跳过已过期和不符合订阅条件的设备
+func (h *Hub) load(ctx context.Context, keys []string, sub *Subscription) ([]*Update, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	values, err := h.redis.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	updates := make([]*Update, 0, len(values))
+	for _, value := range values {
+		data, ok := value.(string)
+		if !ok {
+			continue
+		}
+		u, err := h.decode([]byte(data))
+		if err != nil || !sub.Matches(u) {
+			continue
+		}
+		updates = append(updates, u)
+	}
+	return updates, nil
+}
+
+// decode 解析设备最新数据并确定所在机房
+func (h *Hub) decode(data []byte) (*Update, error) {
+	var u Update
+	if err := json.Unmarshal(data, &u); err != nil {
+		return nil, err
+	}
+	if u.Room = u.Tags["room"]; u.Room == "" {
+		u.Room = h.rooms[u.DeviceID]
+	}
+	return &u, nil
+}
+
+// contains 列表中是否包含s
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,129 @@
+package virtual
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+)
+
+// DefaultDeviceType 未指定设备类型时虚拟设备的类型
+const DefaultDeviceType = "virtual"
+
+// Input 表达式变量引用的设备指标，指标名包含通配符（如outlet_*_power）时为列表输入
+type Input struct {
+	DeviceID string
+	Metric   string
+}
+
+// list 是否为列表输入
+func (i Input) list() bool {
+	return strings.ContainsAny(i.Metric, "*?[")
+}
+
+// Metric 虚拟设备的计算指标
+type Metric struct {
+	Name       string
+	Expression string
+	Unit       string
+	StaleAfter time.Duration // 为0时使用默认值
+
+	expr *Expression
+}
+
+// Device 虚拟设备，指标由其他设备（可以是虚拟设备）的最新指标计算
+type Device struct {
+	DeviceID   string
+	DeviceType string
+	Tags       map[string]string
+	Inputs     map[string]Input // 变量 -> 设备指标
+	Metrics    []*Metric
+}
+
+// Validate 校验虚拟设备并解析表达式：设备ID不能重复或与输入设备相同，表达式只能引用已定义的变量，
+// 虚拟设备之间不能循环依赖
+func Validate(devices []*Device) error {
+	byID := make(map[string]*Device, len(devices))
+	for _, d := range devices {
+		if d.DeviceID == "" || byID[d.DeviceID] != nil {
+			return fmt.Errorf("device_id %q is empty or duplicated", d.DeviceID)
+		}
+		byID[d.DeviceID] = d
+		if d.DeviceType == "" {
+			d.DeviceType = DefaultDeviceType
+		}
+		if err := d.validate(); err != nil {
+			return fmt.Errorf("device %s: %w", d.DeviceID, err)
+		}
+	}
+
+	// 按依赖深度优先遍历检查循环：1为遍历中，2为已完成
+	state := make(map[string]int, len(devices))
+	var visit func(d *Device, chain []string) error
+	visit = func(d *Device, chain []string) error {
+		switch state[d.DeviceID] {
+		case 1:
+			return fmt.Errorf("circular dependency: %s", strings.Join(append(chain, d.DeviceID), " -> "))
+		case 2:
+			return nil
+		}
+		state[d.DeviceID] = 1
+		for _, in := range d.Inputs {
+			if dep := byID[in.DeviceID]; dep != nil {
+				if err := visit(dep, append(chain, d.DeviceID)); err != nil {
+					return err
+				}
+			}
+		}
+		state[d.DeviceID] = 2
+		return nil
+	}
+	for _, d := range devices {
+		if err := visit(d, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validate 校验输入和指标
+func (d *Device) validate() error {
+	if len(d.Metrics) == 0 {
+		return errors.New("metrics are required")
+	}
+
+	lists := make(map[string]bool)
+	for name, in := range d.Inputs {
+		if in.DeviceID == "" || in.Metric == "" {
+			return fmt.Errorf("input %s: device_id and metric are required", name)
+		}
+		if in.DeviceID == d.DeviceID {
+			return fmt.Errorf("input %s: device cannot depend on itself", name)
+		}
+		if _, err := path.Match(in.Metric, ""); err != nil {
+			return fmt.Errorf("input %s: invalid metric pattern %q", name, in.Metric)
+		}
+		lists[name] = in.list()
+	}
+
+	names := make(map[string]bool)
+	for _, m := range d.Metrics {
+		if m.Name == "" || names[m.Name] {
+			return fmt.Errorf("metric name %q is empty or duplicated", m.Name)
+		}
+		names[m.Name] = true
+
+		expr, err := ParseExpression(m.Expression, lists)
+		if err != nil {
+			return fmt.Errorf("metric %s: %w", m.Name, err)
+		}
+		for _, v := range expr.Vars() {
+			if _, ok := d.Inputs[v]; !ok {
+				return fmt.Errorf("metric %s: undefined input %s", m.Name, v)
+			}
+		}
+		m.expr = expr
+	}
+	return nil
+}
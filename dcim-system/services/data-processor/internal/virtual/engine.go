@@ -0,0 +1,204 @@
+package virtual
+
+import (
+	"context"
+	"encoding/json"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/dcim/services/data-processor/internal/fields"
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+)
+
+// latestPrefix 设备最新数据缓存，由数据处理器写入
+const latestPrefix = "device:latest:"
+
+// Result 虚拟设备的一次计算结果，作为设备数据写入
+type Result struct {
+	DeviceID   string
+	DeviceType string
+	Tags       map[string]string
+	Units      map[string]string
+	Timestamp  time.Time
+	Metrics    map[string]interface{}
+}
+
+// latest 设备最新数据
+type latest struct {
+	Timestamp int64                  `json:"timestamp"`
+	Metrics   map[string]interface{} `json:"metrics"`
+}
+
+// Engine 虚拟设备计算
+// 设备数据处理完成后，依赖该设备的虚拟设备从Redis读取各输入设备的最新数据（多副本共享）并计算表达式，
+// 输入缺失或比触发计算的数据早staleAfter以上时跳过该指标，全部指标都跳过时不产生数据
+type Engine struct {
+	dependents map[string][]*Device // 输入设备ID -> 依赖该设备的虚拟设备
+	redis      *redis.Client
+	staleAfter time.Duration
+	logger     *zap.Logger
+}
+
+// NewEngine 创建虚拟设备计算，devices需要先经过Validate，staleAfter为指标未配置时的默认值
+func NewEngine(devices []*Device, redisClient *redis.Client, staleAfter time.Duration, logger *zap.Logger) *Engine {
+	e := &Engine{
+		dependents: make(map[string][]*Device),
+		redis:      redisClient,
+		staleAfter: staleAfter,
+		logger:     logger,
+	}
+	for _, d := range devices {
+		seen := make(map[string]bool)
+		for _, in := range d.Inputs {
+			if !seen[in.DeviceID] {
+				seen[in.DeviceID] = true
+				e.dependents[in.DeviceID] = append(e.dependents[in.DeviceID], d)
+			}
+		}
+	}
+	return e
+}
+
+// Evaluate 计算依赖deviceID的虚拟设备，timestamp为触发计算的数据的采集时间，也是计算结果的时间
+func (e *Engine) Evaluate(ctx context.Context, deviceID string, timestamp time.Time) []*Result {
+	dependents := e.dependents[deviceID]
+	if len(dependents) == 0 {
+		return nil
+	}
+	if timestamp.IsZero() {
+		timestamp = time.Now()
+	}
+
+	data, err := e.load(ctx, dependents)
+	if err != nil {
+		e.logger.Warn("failed to load virtual device inputs", zap.String("device_id", deviceID), zap.Error(err))
+		return nil
+	}
+
+	var results []*Result
+	for _, d := range dependents {
+		if r := e.evaluate(d, data, timestamp); r != nil {
+			results = append(results, r)
+		}
+	}
+	return results
+}
+
+// evaluate 计算虚拟设备的各个指标
+func (e *Engine) evaluate(d *Device, data map[string]*latest, timestamp time.Time) *Result {
+	r := &Result{
+		DeviceID:   d.DeviceID,
+		DeviceType: d.DeviceType,
+		Tags:       d.Tags,
+		Units:      make(map[string]string),
+		Timestamp:  timestamp,
+		Metrics:    make(map[string]interface{}),
+	}
+
+	for _, m := range d.Metrics {
+		staleAfter := m.StaleAfter
+		if staleAfter == 0 {
+			staleAfter = e.staleAfter
+		}
+
+		vars, missing := inputValues(d, m, data, timestamp.Add(-staleAfter))
+		if missing != "" {
+			e.logger.Debug("skip virtual metric with missing or stale input",
+				zap.String("device_id", d.DeviceID),
+				zap.String("metric", m.Name),
+				zap.String("input", missing))
+			continue
+		}
+		value, err := m.expr.Eval(vars)
+		if err != nil {
+			e.logger.Debug("failed to evaluate virtual metric",
+				zap.String("device_id", d.DeviceID),
+				zap.String("metric", m.Name),
+				zap.Error(err))
+			continue
+		}
+
+		r.Metrics[m.Name] = value
+		if m.Unit != "" {
+			r.Units[m.Name] = m.Unit
+		}
+	}
+
+	if len(r.Metrics) == 0 {
+		return nil
+	}
+	return r
+}
+
+// inputValues 表达式引用的各输入的值，早于since的数据视为过期；返回缺失或过期的输入名
+func inputValues(d *Device, m *Metric, data map[string]*latest, since time.Time) (map[string][]float64, string) {
+	vars := make(map[string][]float64, len(m.expr.Vars()))
+	for _, name := range m.expr.Vars() {
+		in := d.Inputs[name]
+		l := data[in.DeviceID]
+		if l == nil || time.Unix(l.Timestamp, 0).Before(since.Truncate(time.Second)) {
+			return nil, name
+		}
+
+		if !in.list() {
+			v, ok := fields.Number(l.Metrics[in.Metric])
+			if !ok {
+				return nil, name
+			}
+			vars[name] = []float64{v}
+			continue
+		}
+
+		// 列表输入按指标名排序，没有匹配的数值指标时视为缺失
+		keys := make([]string, 0, len(l.Metrics))
+		for k := range l.Metrics {
+			if ok, _ := path.Match(in.Metric, k); ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if v, ok := fields.Number(l.Metrics[k]); ok {
+				vars[name] = append(vars[name], v)
+			}
+		}
+		if len(vars[name]) == 0 {
+			return nil, name
+		}
+	}
+	return vars, ""
+}
+
+// load 批量读取虚拟设备的全部输入设备的最新数据
+func (e *Engine) load(ctx context.Context, devices []*Device) (map[string]*latest, error) {
+	seen := make(map[string]bool)
+	var ids, keys []string
+	for _, d := range devices {
+		for _, in := range d.Inputs {
+			if !seen[in.DeviceID] {
+				seen[in.DeviceID] = true
+				ids = append(ids, in.DeviceID)
+				keys = append(keys, latestPrefix+in.DeviceID)
+			}
+		}
+	}
+
+	values, err := e.redis.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+	data := make(map[string]*latest, len(values))
+	for i, value := range values {
+		s, ok := value.(string)
+		if !ok {
+			continue
+		}
+		var l latest
+		if err := json.Unmarshal([]byte(s), &l); err == nil {
+			data[ids[i]] = &l
+		}
+	}
+	return data, nil
+}
@@ -0,0 +1,347 @@
+package virtual
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// aggregates 聚合函数，参数可以是列表输入（通配符匹配的多个指标）
+var aggregates = map[string]func([]float64) float64{
+	"sum": func(v []float64) float64 {
+		var s float64
+		for _, x := range v {
+			s += x
+		}
+		return s
+	},
+	"avg": func(v []float64) float64 {
+		var s float64
+		for _, x := range v {
+			s += x
+		}
+		return s / float64(len(v))
+	},
+	"min": func(v []float64) float64 {
+		m := v[0]
+		for _, x := range v[1:] {
+			m = math.Min(m, x)
+		}
+		return m
+	},
+	"max": func(v []float64) float64 {
+		m := v[0]
+		for _, x := range v[1:] {
+			m = math.Max(m, x)
+		}
+		return m
+	},
+	"count": func(v []float64) float64 { return float64(len(v)) },
+}
+
+// scalars 标量函数，参数个数固定
+var scalars = map[string]struct {
+	args int
+	fn   func(...float64) float64
+}{
+	"abs":   {1, func(v ...float64) float64 { return math.Abs(v[0]) }},
+	"round": {2, func(v ...float64) float64 { p := math.Pow(10, v[1]); return math.Round(v[0]*p) / p }},
+}
+
+// node 表达式节点，vars为变量 -> 值（标量输入只有一个值）
+type node interface {
+	eval(vars map[string][]float64) ([]float64, error)
+}
+
+type number float64
+
+func (n number) eval(map[string][]float64) ([]float64, error) {
+	return []float64{float64(n)}, nil
+}
+
+type variable string
+
+func (v variable) eval(vars map[string][]float64) ([]float64, error) {
+	return vars[string(v)], nil
+}
+
+type negate struct{ x node }
+
+func (n *negate) eval(vars map[string][]float64) ([]float64, error) {
+	x, err := n.x.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	return []float64{-x[0]}, nil
+}
+
+type binary struct {
+	op   byte
+	l, r node
+}
+
+func (b *binary) eval(vars map[string][]float64) ([]float64, error) {
+	l, err := b.l.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	r, err := b.r.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	switch b.op {
+	case '+':
+		return []float64{l[0] + r[0]}, nil
+	case '-':
+		return []float64{l[0] - r[0]}, nil
+	case '*':
+		return []float64{l[0] * r[0]}, nil
+	default:
+		if r[0] == 0 {
+			return nil, errors.New("division by zero")
+		}
+		return []float64{l[0] / r[0]}, nil
+	}
+}
+
+type call struct {
+	name string
+	args []node
+}
+
+func (c *call) eval(vars map[string][]float64) ([]float64, error) {
+	var values []float64
+	for _, arg := range c.args {
+		v, err := arg.eval(vars)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v...)
+	}
+	if fn, ok := aggregates[c.name]; ok {
+		if len(values) == 0 && c.name != "count" {
+			return nil, fmt.Errorf("%s of no values", c.name)
+		}
+		return []float64{fn(values)}, nil
+	}
+	return []float64{scalars[c.name].fn(values...)}, nil
+}
+
+// Expression 解析后的表达式
+// 支持数值、变量、+ - * /、括号、聚合函数sum/avg/min/max/count（参数可以是列表输入）和abs(x)、round(x, 小数位数)；
+// 列表输入只能作为聚合函数的参数
+type Expression struct {
+	source string
+	root   node
+	vars   []string // 引用的变量
+}
+
+// ParseExpression 解析表达式，lists为列表输入的变量名
+func ParseExpression(source string, lists map[string]bool) (*Expression, error) {
+	p := &parser{src: source, lists: lists, seen: make(map[string]bool)}
+	p.next()
+	root, err := p.expr()
+	if err == nil && p.tok != "" {
+		err = fmt.Errorf("unexpected %q", p.tok)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("expression %q: %w", source, err)
+	}
+	return &Expression{source: source, root: root, vars: p.vars}, nil
+}
+
+// Vars 表达式引用的变量
+func (e *Expression) Vars() []string {
+	return e.vars
+}
+
+// Eval 计算表达式，结果不是有限数值时返回错误
+func (e *Expression) Eval(vars map[string][]float64) (float64, error) {
+	v, err := e.root.eval(vars)
+	if err != nil {
+		return 0, err
+	}
+	if math.IsNaN(v[0]) || math.IsInf(v[0], 0) {
+		return 0, fmt.Errorf("result is %v", v[0])
+	}
+	return v[0], nil
+}
+
+// String 表达式原文
+func (e *Expression) String() string {
+	return e.source
+}
+
+// parser 递归下降解析
+type parser struct {
+	src   string
+	pos   int
+	tok   string // 当前词法单元，结束时为空
+	lists map[string]bool
+	seen  map[string]bool
+	vars  []string
+}
+
+// next 读取下一个词法单元：数值、标识符或单个符号
+func (p *parser) next() {
+	for p.pos < len(p.src) && (p.src[p.pos] == ' ' || p.src[p.pos] == '\t') {
+		p.pos++
+	}
+	start := p.pos
+	switch {
+	case p.pos == len(p.src):
+	case isDigit(p.src[p.pos]) || p.src[p.pos] == '.':
+		for p.pos < len(p.src) && (isDigit(p.src[p.pos]) || p.src[p.pos] == '.' ||
+			p.src[p.pos] == 'e' || p.src[p.pos] == 'E' ||
+			((p.src[p.pos] == '+' || p.src[p.pos] == '-') && (p.src[p.pos-1] == 'e' || p.src[p.pos-1] == 'E'))) {
+			p.pos++
+		}
+	case isIdent(p.src[p.pos]):
+		for p.pos < len(p.src) && (isIdent(p.src[p.pos]) || isDigit(p.src[p.pos])) {
+			p.pos++
+		}
+	default:
+		p.pos++
+	}
+	p.tok = p.src[start:p.pos]
+}
+
+// expr := term (('+'|'-') term)*
+func (p *parser) expr() (node, error) {
+	l, err := p.term()
+	for err == nil && (p.tok == "+" || p.tok == "-") {
+		op := p.tok[0]
+		p.next()
+		var r node
+		if r, err = p.term(); err == nil {
+			l = &binary{op: op, l: l, r: r}
+		}
+	}
+	return l, err
+}
+
+// term := unary (('*'|'/') unary)*
+func (p *parser) term() (node, error) {
+	l, err := p.unary()
+	for err == nil && (p.tok == "*" || p.tok == "/") {
+		op := p.tok[0]
+		p.next()
+		var r node
+		if r, err = p.unary(); err == nil {
+			l = &binary{op: op, l: l, r: r}
+		}
+	}
+	return l, err
+}
+
+// unary := '-' unary | primary
+func (p *parser) unary() (node, error) {
+	if p.tok == "-" {
+		p.next()
+		x, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return &negate{x: x}, nil
+	}
+	return p.primary()
+}
+
+// primary := number | variable | function '(' args ')' | '(' expr ')'
+func (p *parser) primary() (node, error) {
+	tok := p.tok
+	switch {
+	case tok == "":
+		return nil, errors.New("unexpected end")
+	case tok == "(":
+		p.next()
+		x, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		if p.tok != ")" {
+			return nil, errors.New("missing ')'")
+		}
+		p.next()
+		return x, nil
+	case isDigit(tok[0]) || tok[0] == '.':
+		v, err := strconv.ParseFloat(tok, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q", tok)
+		}
+		p.next()
+		return number(v), nil
+	case isIdent(tok[0]):
+		p.next()
+		if p.tok == "(" {
+			return p.call(tok)
+		}
+		if p.lists[tok] {
+			return nil, fmt.Errorf("list input %s must be an argument of sum/avg/min/max/count", tok)
+		}
+		return p.variable(tok), nil
+	default:
+		return nil, fmt.Errorf("unexpected %q", tok)
+	}
+}
+
+// variable 引用变量并记录
+func (p *parser) variable(name string) node {
+	if !p.seen[name] {
+		p.seen[name] = true
+		p.vars = append(p.vars, name)
+	}
+	return variable(name)
+}
+
+// call 解析函数调用的参数
+func (p *parser) call(name string) (node, error) {
+	_, aggregate := aggregates[name]
+	scalar, ok := scalars[name]
+	if !aggregate && !ok {
+		return nil, fmt.Errorf("unknown function %s", name)
+	}
+
+	c := &call{name: name}
+	p.next()
+	for p.tok != ")" {
+		if len(c.args) > 0 {
+			if p.tok != "," {
+				return nil, fmt.Errorf("expected ',' or ')' in %s()", name)
+			}
+			p.next()
+		}
+		// 列表输入直接作为聚合函数的参数
+		if tok := p.tok; aggregate && p.lists[tok] {
+			p.next()
+			if p.tok != "," && p.tok != ")" {
+				return nil, fmt.Errorf("list input %s must be an argument of sum/avg/min/max/count", tok)
+			}
+			c.args = append(c.args, p.variable(tok))
+			continue
+		}
+		arg, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		c.args = append(c.args, arg)
+	}
+	p.next()
+
+	if aggregate && len(c.args) == 0 {
+		return nil, fmt.Errorf("%s() requires arguments", name)
+	}
+	if !aggregate && len(c.args) != scalar.args {
+		return nil, fmt.Errorf("%s() requires %d arguments", name, scalar.args)
+	}
+	return c, nil
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdent(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
@@ -0,0 +1,472 @@
+package writer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/influxdata/influxdb-client-go/v2/api"
+	ihttp "github.com/influxdata/influxdb-client-go/v2/api/http"
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+	lp "github.com/influxdata/line-protocol"
+	"go.uber.org/zap"
+)
+
+// ErrClosed 写入器已关闭
+var ErrClosed = errors.New("writer closed")
+
+// Options 批量写入配置
+type Options struct {
+	BatchSize        int           // 每批最多的数据点数
+	FlushInterval    time.Duration // 批次未满时的最长等待时间
+	Workers          int           // 并发写入的协程数
+	QueueSize        int           // 内存队列容量（数据点），队列满时写入溢出队列
+	MaxRetries       int           // 写入失败的重试次数
+	RetryInterval    time.Duration // 首次重试间隔，之后按指数退避
+	MaxRetryInterval time.Duration // 最长重试间隔
+	SpillDir         string        // 磁盘溢出队列目录，为空时重试失败和队列满的数据直接丢弃
+	MaxSpillBytes    int64         // 溢出队列容量，超过后删除最早的批次，0表示不限制
+	ReplayInterval   time.Duration // 溢出队列回放间隔
+}
+
+// flushEpoch 两次Flush之间入队的数据
+// Flush开始时切换到新的epoch，只等待之前各epoch的数据完成，不受调用后持续入队的数据影响
+type flushEpoch struct {
+	pending int64       // 尚未写入、溢出或丢弃的数据点数
+	prev    *flushEpoch // 上一个epoch，之前的数据全部完成后置为nil
+}
+
+// queuedLine 队列中的一行数据
+type queuedLine struct {
+	line  string
+	epoch *flushEpoch
+}
+
+// RejectHandler 处理被InfluxDB拒绝（不可重试）的数据
+type RejectHandler func(lines []string, err error)
+
+// BatchWriter 批量写入InfluxDB
+// 实现api.WriteAPIBlocking，WritePoint/WriteRecord只将数据转换为行协议放入内存队列，不等待InfluxDB；
+// 多个worker从队列中按批次大小或刷新间隔组批写入，失败时按指数退避重试，
+// 重试失败的批次和队列满时的数据写入磁盘溢出队列，InfluxDB恢复后按顺序回放；
+// 被InfluxDB拒绝的批次交给RejectHandler
+type BatchWriter struct {
+	writeAPI api.WriteAPIBlocking
+	opts     Options
+	logger   *zap.Logger
+	reject   RejectHandler // 可为nil
+
+	queue    chan queuedLine
+	spill    *spillQueue // 可为nil
+	epoch    atomic.Pointer[flushEpoch]
+	epochMu  sync.Mutex // 保护epoch的切换和epoch链
+	closed   int32
+	closeMu  sync.RWMutex // 保护queue关闭与入队
+	done     chan struct{}
+	wg       sync.WaitGroup
+	overflow struct {
+		sync.Mutex
+		lines []queuedLine
+	}
+}
+
+// NewBatchWriter 创建批量写入器并启动worker
+func NewBatchWriter(writeAPI api.WriteAPIBlocking, opts Options, logger *zap.Logger) (*BatchWriter, error) {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 1000
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = time.Second
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = 1
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = opts.BatchSize * opts.Workers * 10
+	}
+	if opts.RetryInterval <= 0 {
+		opts.RetryInterval = time.Second
+	}
+	if opts.MaxRetryInterval < opts.RetryInterval {
+		opts.MaxRetryInterval = opts.RetryInterval
+	}
+	if opts.ReplayInterval <= 0 {
+		opts.ReplayInterval = 10 * time.Second
+	}
+
+	w := &BatchWriter{
+		writeAPI: writeAPI,
+		opts:     opts,
+		logger:   logger,
+		queue:    make(chan queuedLine, opts.QueueSize),
+		done:     make(chan struct{}),
+	}
+	w.epoch.Store(&flushEpoch{})
+	if opts.SpillDir != "" {
+		spill, err := newSpillQueue(opts.SpillDir, opts.MaxSpillBytes)
+		if err != nil {
+			return nil, err
+		}
+		w.spill = spill
+	}
+
+	for i := 0; i < opts.Workers; i++ {
+		w.wg.Add(1)
+		go w.worker()
+	}
+	if w.spill != nil {
+		w.wg.Add(1)
+		go w.replayLoop()
+	}
+	return w, nil
+}
+
+// SetRejectHandler 设置被InfluxDB拒绝的数据的处理函数，需在写入数据前调用；未设置时只记录日志并丢弃
+func (w *BatchWriter) SetRejectHandler(handler RejectHandler) {
+	w.reject = handler
+}
+
+// WritePoint 将数据点编码为行协议（纳秒精度）放入写入队列，无法编码的数据点直接返回错误
+func (w *BatchWriter) WritePoint(ctx context.Context, points ...*write.Point) error {
+	lines, err := encodePoints(points)
+	if err != nil {
+		return err
+	}
+	return w.WriteRecord(ctx, lines...)
+}
+
+// WritePointWait 与WritePoint相同，但不经过队列，直接写入InfluxDB并返回结果
+func (w *BatchWriter) WritePointWait(ctx context.Context, points ...*write.Point) error {
+	lines, err := encodePoints(points)
+	if err != nil {
+		return err
+	}
+	return w.WriteRecordWait(ctx, lines...)
+}
+
+// WriteRecordWait 直接写入InfluxDB并返回结果，不重试，失败时不写入溢出队列也不交给RejectHandler，
+// 用于需要确认写入结果的场景（如重放死信）
+func (w *BatchWriter) WriteRecordWait(ctx context.Context, lines ...string) error {
+	if atomic.LoadInt32(&w.closed) == 1 {
+		return ErrClosed
+	}
+
+	batch := make([]string, 0, len(lines))
+	for _, line := range lines {
+		if line = strings.TrimRight(line, "\r\n"); line != "" {
+			batch = append(batch, line)
+		}
+	}
+	if len(batch) == 0 {
+		return nil
+	}
+	return w.write(ctx, batch)
+}
+
+// WriteRecord 将行协议数据放入写入队列
+func (w *BatchWriter) WriteRecord(ctx context.Context, lines ...string) error {
+	w.closeMu.RLock()
+	defer w.closeMu.RUnlock()
+
+	if atomic.LoadInt32(&w.closed) == 1 {
+		return ErrClosed
+	}
+
+	for _, line := range lines {
+		if line == "" {
+			continue
+		}
+		epoch := w.epoch.Load()
+		atomic.AddInt64(&epoch.pending, 1)
+		entry := queuedLine{line: strings.TrimRight(line, "\r\n"), epoch: epoch}
+		select {
+		case w.queue <- entry:
+		default:
+			w.addOverflow(entry)
+		}
+	}
+	return nil
+}
+
+// EnableBatching 始终批量写入，无需开启
+func (w *BatchWriter) EnableBatching() {}
+
+// Flush 等待调用前入队的数据写入（或溢出、丢弃）完成，调用后入队的数据不影响等待
+func (w *BatchWriter) Flush(ctx context.Context) error {
+	w.epochMu.Lock()
+	target := w.epoch.Load()
+	w.epoch.Store(&flushEpoch{prev: target})
+	w.epochMu.Unlock()
+
+	w.spillOverflow()
+
+	ticker := time.NewTicker(20 * time.Millisecond)
+	defer ticker.Stop()
+	for !w.flushed(target) {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			w.spillOverflow()
+		}
+	}
+	return nil
+}
+
+// flushed 判断epoch及之前的数据是否全部完成，完成时截断epoch链
+func (w *BatchWriter) flushed(target *flushEpoch) bool {
+	w.epochMu.Lock()
+	defer w.epochMu.Unlock()
+
+	for e := target; e != nil; e = e.prev {
+		if atomic.LoadInt64(&e.pending) > 0 {
+			return false
+		}
+	}
+	target.prev = nil
+	return true
+}
+
+// Close 停止接收数据，写入队列中剩余的数据（失败时写入溢出队列）后返回
+func (w *BatchWriter) Close() {
+	w.closeMu.Lock()
+	if !atomic.CompareAndSwapInt32(&w.closed, 0, 1) {
+		w.closeMu.Unlock()
+		return
+	}
+	close(w.queue)
+	w.closeMu.Unlock()
+
+	close(w.done)
+	w.wg.Wait()
+	w.spillOverflow()
+}
+
+// worker 从队列中组批写入
+func (w *BatchWriter) worker() {
+	defer w.wg.Done()
+
+	batch := make([]queuedLine, 0, w.opts.BatchSize)
+	timer := time.NewTimer(w.opts.FlushInterval)
+	defer timer.Stop()
+
+	flush := func() {
+		if len(batch) > 0 {
+			w.writeBatch(batch)
+			batch = make([]queuedLine, 0, w.opts.BatchSize)
+		}
+	}
+
+	for {
+		select {
+		case entry, ok := <-w.queue:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, entry)
+			if len(batch) >= w.opts.BatchSize {
+				flush()
+			}
+		case <-timer.C:
+			flush()
+			timer.Reset(w.opts.FlushInterval)
+		}
+	}
+}
+
+// writeBatch 写入一个批次，可重试的错误按指数退避重试，重试失败或关闭时写入溢出队列
+func (w *BatchWriter) writeBatch(entries []queuedLine) {
+	defer complete(entries)
+	batch := entryLines(entries)
+
+	backoff := w.opts.RetryInterval
+	for attempt := 0; ; attempt++ {
+		err := w.write(context.Background(), batch)
+		if err == nil {
+			return
+		}
+		if !retryable(err) {
+			w.logger.Error("influxdb rejected batch", zap.Int("points", len(batch)), zap.Error(err))
+			w.rejected(batch, err)
+			return
+		}
+		if attempt >= w.opts.MaxRetries {
+			w.logger.Warn("failed to write batch after retries", zap.Int("points", len(batch)), zap.Error(err))
+			w.spillBatch(batch)
+			return
+		}
+
+		w.logger.Warn("failed to write batch, retrying",
+			zap.Int("points", len(batch)),
+			zap.Int("attempt", attempt+1),
+			zap.Duration("backoff", backoff),
+			zap.Error(err))
+		select {
+		case <-w.done:
+			// 关闭时不再等待重试
+			w.spillBatch(batch)
+			return
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > w.opts.MaxRetryInterval {
+			backoff = w.opts.MaxRetryInterval
+		}
+	}
+}
+
+// write 写入InfluxDB
+func (w *BatchWriter) write(ctx context.Context, lines []string) error {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	return w.writeAPI.WriteRecord(ctx, lines...)
+}
+
+// rejected 将被InfluxDB拒绝的数据交给RejectHandler，未设置时丢弃
+func (w *BatchWriter) rejected(lines []string, err error) {
+	if w.reject != nil {
+		w.reject(lines, err)
+	}
+}
+
+// replayLoop 定期回放溢出队列
+func (w *BatchWriter) replayLoop() {
+	defer w.wg.Done()
+
+	ticker := time.NewTicker(w.opts.ReplayInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-ticker.C:
+			w.spillOverflow()
+			w.replay()
+		}
+	}
+}
+
+// replay 按顺序回放溢出的批次，遇到失败时停止，等待下次回放
+func (w *BatchWriter) replay() {
+	for {
+		select {
+		case <-w.done:
+			return
+		default:
+		}
+
+		path, err := w.spill.oldest()
+		if err != nil {
+			w.logger.Error("failed to list spill queue", zap.Error(err))
+			return
+		}
+		if path == "" {
+			return
+		}
+
+		lines, err := w.spill.read(path)
+		if err != nil {
+			w.logger.Error("dropping unreadable spill file", zap.String("file", path), zap.Error(err))
+		} else if len(lines) > 0 {
+			if err := w.write(context.Background(), lines); err != nil {
+				if retryable(err) {
+					return
+				}
+				w.logger.Error("influxdb rejected spilled batch", zap.String("file", path), zap.Error(err))
+				w.rejected(lines, err)
+			} else {
+				w.logger.Info("replayed spilled batch", zap.String("file", path), zap.Int("points", len(lines)))
+			}
+		}
+		if err := w.spill.remove(path); err != nil {
+			w.logger.Error("failed to remove spill file", zap.String("file", path), zap.Error(err))
+			return
+		}
+	}
+}
+
+// addOverflow 队列满时暂存数据，满一个批次后写入溢出队列
+func (w *BatchWriter) addOverflow(entry queuedLine) {
+	w.overflow.Lock()
+	w.overflow.lines = append(w.overflow.lines, entry)
+	full := len(w.overflow.lines) >= w.opts.BatchSize
+	w.overflow.Unlock()
+
+	if full {
+		w.spillOverflow()
+	}
+}
+
+// spillOverflow 将暂存的数据写入溢出队列
+func (w *BatchWriter) spillOverflow() {
+	w.overflow.Lock()
+	entries := w.overflow.lines
+	w.overflow.lines = nil
+	w.overflow.Unlock()
+
+	if len(entries) == 0 {
+		return
+	}
+	w.logger.Warn("write queue full", zap.Int("points", len(entries)))
+	w.spillBatch(entryLines(entries))
+	complete(entries)
+}
+
+// spillBatch 将批次写入溢出队列，未配置溢出队列或写入失败时丢弃
+func (w *BatchWriter) spillBatch(lines []string) {
+	if w.spill == nil {
+		w.logger.Error("no spill queue configured, dropping points", zap.Int("points", len(lines)))
+		return
+	}
+	if err := w.spill.put(lines); err != nil {
+		w.logger.Error("failed to spill points, dropping", zap.Int("points", len(lines)), zap.Error(err))
+	}
+}
+
+// entryLines 队列中数据的行协议
+func entryLines(entries []queuedLine) []string {
+	result := make([]string, len(entries))
+	for i, entry := range entries {
+		result[i] = entry.line
+	}
+	return result
+}
+
+// complete 数据已写入、溢出或丢弃，减少所属epoch的未完成数
+func complete(entries []queuedLine) {
+	for _, entry := range entries {
+		atomic.AddInt64(&entry.epoch.pending, -1)
+	}
+}
+
+// encodePoints 将数据点编码为行协议（纳秒精度）
+func encodePoints(points []*write.Point) ([]string, error) {
+	var buf bytes.Buffer
+	encoder := lp.NewEncoder(&buf)
+	encoder.SetFieldTypeSupport(lp.UintSupport)
+	encoder.FailOnFieldErr(true)
+
+	lines := make([]string, 0, len(points))
+	for _, p := range points {
+		buf.Reset()
+		if _, err := encoder.Encode(p); err != nil {
+			return nil, err
+		}
+		lines = append(lines, buf.String())
+	}
+	return lines, nil
+}
+
+// retryable 判断写入错误是否可以重试：网络错误、超时、429和5xx可以重试，其余（如行协议错误）不再重试
+func retryable(err error) bool {
+	var httpErr *ihttp.Error
+	if errors.As(err, &httpErr) && httpErr.StatusCode != 0 {
+		return httpErr.StatusCode == 429 || httpErr.StatusCode >= 500
+	}
+	return true
+}
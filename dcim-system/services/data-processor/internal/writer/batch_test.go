@@ -0,0 +1,90 @@
+package writer
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+	"go.uber.org/zap"
+)
+
+// blockingAPI 记录写入的数据点数，写入slow行时阻塞到release关闭
+type blockingAPI struct {
+	written int64
+	release chan struct{}
+}
+
+func (a *blockingAPI) WriteRecord(ctx context.Context, lines ...string) error {
+	for _, line := range lines {
+		if line == "slow value=1" {
+			<-a.release
+		}
+	}
+	atomic.AddInt64(&a.written, int64(len(lines)))
+	return nil
+}
+
+func (a *blockingAPI) WritePoint(ctx context.Context, points ...*write.Point) error { return nil }
+func (a *blockingAPI) EnableBatching()                                              {}
+func (a *blockingAPI) Flush(ctx context.Context) error                              { return nil }
+
+func TestFlushWaitsOnlyForEarlierLines(t *testing.T) {
+	api := &blockingAPI{release: make(chan struct{})}
+	w, err := NewBatchWriter(api, Options{BatchSize: 1, Workers: 2, FlushInterval: 5 * time.Millisecond}, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	ctx := context.Background()
+
+	w.WriteRecord(ctx, "a value=1", "b value=1")
+	if err := w.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if written := atomic.LoadInt64(&api.written); written != 2 {
+		t.Fatalf("written %d points after flush, want 2", written)
+	}
+
+	// 持续入队的数据不会使Flush一直等待
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				w.WriteRecord(ctx, "c value=1")
+				time.Sleep(time.Millisecond)
+			}
+		}
+	}()
+	defer func() {
+		close(stop)
+		wg.Wait()
+	}()
+
+	timeout, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	if err := w.Flush(timeout); err != nil {
+		t.Fatalf("flush while writing: %v", err)
+	}
+
+	// 调用前入队的数据未完成时继续等待
+	w.WriteRecord(ctx, "slow value=1")
+	short, cancelShort := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancelShort()
+	if err := w.Flush(short); err == nil {
+		t.Fatal("flush returned before an earlier line was written")
+	}
+
+	close(api.release)
+	if err := w.Flush(timeout); err != nil {
+		t.Fatalf("flush after release: %v", err)
+	}
+}
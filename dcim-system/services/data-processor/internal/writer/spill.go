@@ -0,0 +1,135 @@
+package writer
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const spillExt = ".lp"
+
+// spillQueue 磁盘溢出队列，每个批次保存为一个行协议文件，按文件名（写入时间）先进先出
+type spillQueue struct {
+	mu       sync.Mutex
+	dir      string
+	maxBytes int64 // 超过后删除最早的文件，0表示不限制
+	seq      uint64
+}
+
+// newSpillQueue 创建磁盘溢出队列
+func newSpillQueue(dir string, maxBytes int64) (*spillQueue, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create spill dir: %w", err)
+	}
+	return &spillQueue{dir: dir, maxBytes: maxBytes}, nil
+}
+
+// put 保存一个批次，先写临时文件再重命名，避免回放读到不完整的文件
+func (q *spillQueue) put(lines []string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.seq++
+	name := fmt.Sprintf("%020d-%06d", time.Now().UnixNano(), q.seq%1000000)
+	tmp := filepath.Join(q.dir, name+".tmp")
+	if err := os.WriteFile(tmp, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, filepath.Join(q.dir, name+spillExt)); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return q.enforceLimit()
+}
+
+// oldest 最早的批次文件，队列为空时返回空字符串
+func (q *spillQueue) oldest() (string, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	files, _, err := q.list()
+	if err != nil || len(files) == 0 {
+		return "", err
+	}
+	return files[0], nil
+}
+
+// read 读取批次文件
+func (q *spillQueue) read(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		if line := scanner.Text(); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, scanner.Err()
+}
+
+// remove 删除已回放的批次文件
+func (q *spillQueue) remove(path string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return os.Remove(path)
+}
+
+// enforceLimit 超过容量时删除最早的文件，调用方需持有锁
+func (q *spillQueue) enforceLimit() error {
+	if q.maxBytes <= 0 {
+		return nil
+	}
+
+	files, total, err := q.list()
+	if err != nil {
+		return err
+	}
+	for _, path := range files {
+		if total <= q.maxBytes {
+			break
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		total -= info.Size()
+	}
+	return nil
+}
+
+// list 按写入顺序列出批次文件，调用方需持有锁
+func (q *spillQueue) list() ([]string, int64, error) {
+	entries, err := os.ReadDir(q.dir)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var files []string
+	var total int64
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != spillExt {
+			continue
+		}
+		if info, err := entry.Info(); err == nil {
+			total += info.Size()
+		}
+		files = append(files, filepath.Join(q.dir, entry.Name()))
+	}
+	sort.Strings(files)
+	return files, total, nil
+}
@@ -1,33 +1,73 @@
 package config
 
 import (
-	"os"
 	"gopkg.in/yaml.v3"
+	"os"
 )
 
 // Config 数据处理服务配置
 type Config struct {
-	MQTT     MQTTConfig     `yaml:"mqtt"`
-	InfluxDB InfluxDBConfig `yaml:"influxdb"`
-	Redis    RedisConfig    `yaml:"redis"`
+	MQTT         MQTTConfig         `yaml:"mqtt"`
+	Kafka        KafkaConfig        `yaml:"kafka"`
+	InfluxDB     InfluxDBConfig     `yaml:"influxdb"`
+	Redis        RedisConfig        `yaml:"redis"`
+	Server       ServerConfig       `yaml:"server"`
+	Alarm        AlarmConfig        `yaml:"alarm"`
+	Notify       NotifyConfig       `yaml:"notify"`
+	Availability AvailabilityConfig `yaml:"availability"`
+	Fields       FieldsConfig       `yaml:"fields"`
+	DeadLetter   DeadLetterConfig   `yaml:"dead_letter"`
+	Rollup       RollupConfig       `yaml:"rollup"`
+	Query        QueryConfig        `yaml:"query"`
+	Stream       StreamConfig       `yaml:"stream"`
+	Energy       EnergyConfig       `yaml:"energy"`
+	Virtual      VirtualConfig      `yaml:"virtual"`
 }
 
 // MQTTConfig MQTT配置
 type MQTTConfig struct {
-	Broker   string `yaml:"broker"`
-	Username string `yaml:"username"`
-	Password string `yaml:"password"`
-	Topic    string `yaml:"topic"`
-	QoS      byte   `yaml:"qos"`
-	ClientID string `yaml:"client_id"`
+	Broker      string `yaml:"broker"`
+	Username    string `yaml:"username"`
+	Password    string `yaml:"password"`
+	Topic       string `yaml:"topic"`
+	QoS         byte   `yaml:"qos"`
+	ClientID    string `yaml:"client_id"`    // 支持${ENV}环境变量，多副本部署时需各不相同；为空时使用data-processor-<主机名>
+	SharedGroup string `yaml:"shared_group"` // 共享订阅组，多个副本以$share/<group>/<topic>订阅分摊消息，为空时普通订阅
+	DedupWindow int    `yaml:"dedup_window"` // 重复消息（QoS 1重发、副本切换）的去重窗口（秒），0表示不去重
+}
+
+// KafkaConfig Kafka输入配置，消费opc-collector写入Kafka的数据
+type KafkaConfig struct {
+	Enabled        bool     `yaml:"enabled"`
+	Brokers        []string `yaml:"brokers"`
+	Topic          string   `yaml:"topic"`           // 与opc-collector的kafka.topic一致
+	Group          string   `yaml:"group"`           // 消费组，多个副本分摊分区
+	Version        string   `yaml:"version"`         // Kafka版本
+	InitialOffset  string   `yaml:"initial_offset"`  // 消费组首次消费的位置：oldest/newest
+	CommitInterval int      `yaml:"commit_interval"` // 数据写入后提交offset的间隔（秒）
 }
 
 // InfluxDBConfig InfluxDB配置
 type InfluxDBConfig struct {
-	URL    string `yaml:"url"`
-	Token  string `yaml:"token"`
-	Org    string `yaml:"org"`
-	Bucket string `yaml:"bucket"`
+	URL    string            `yaml:"url"`
+	Token  string            `yaml:"token"`
+	Org    string            `yaml:"org"`
+	Bucket string            `yaml:"bucket"`
+	Write  InfluxWriteConfig `yaml:"write"`
+}
+
+// InfluxWriteConfig InfluxDB批量写入配置
+type InfluxWriteConfig struct {
+	BatchSize        int    `yaml:"batch_size"`         // 每批最多的数据点数
+	FlushInterval    int    `yaml:"flush_interval"`     // 批次未满时的最长等待时间（毫秒）
+	Workers          int    `yaml:"workers"`            // 并发写入数
+	QueueSize        int    `yaml:"queue_size"`         // 内存队列容量（数据点）
+	MaxRetries       int    `yaml:"max_retries"`        // 写入失败的重试次数
+	RetryInterval    int    `yaml:"retry_interval"`     // 首次重试间隔（毫秒），之后按指数退避
+	MaxRetryInterval int    `yaml:"max_retry_interval"` // 最长重试间隔（毫秒）
+	SpillDir         string `yaml:"spill_dir"`          // 磁盘溢出队列目录，为空时InfluxDB不可用期间的数据直接丢弃
+	MaxSpillMB       int    `yaml:"max_spill_mb"`       // 溢出队列容量（MB），超过后删除最早的数据，0表示不限制
+	ReplayInterval   int    `yaml:"replay_interval"`    // 溢出队列回放间隔（秒）
 }
 
 // RedisConfig Redis配置
@@ -37,6 +77,192 @@ type RedisConfig struct {
 	DB       int    `yaml:"db"`
 }
 
+// ServerConfig HTTP接口配置
+type ServerConfig struct {
+	Port int `yaml:"port"` // 0表示不启动HTTP接口
+}
+
+// AlarmConfig 告警规则引擎配置
+type AlarmConfig struct {
+	Enabled        bool   `yaml:"enabled"`
+	RulesFile      string `yaml:"rules_file"`      // 告警规则文件
+	Topic          string `yaml:"topic"`           // 告警发布Topic，实际发布到 <topic>/<device_id>
+	QoS            byte   `yaml:"qos"`             // 告警发布QoS
+	CheckInterval  int    `yaml:"check_interval"`  // missing_data规则检查间隔（秒）
+	RetentionHours int    `yaml:"retention_hours"` // 已恢复告警的保留时间（小时），0表示永久保留
+}
+
+// NotifyConfig 告警通知配置（需启用告警规则引擎）
+type NotifyConfig struct {
+	Enabled       bool                  `yaml:"enabled"`
+	GroupWait     int                   `yaml:"group_wait"`     // 同一路由的告警合并发送的等待时间（秒），0表示立即发送
+	FlapWindow    int                   `yaml:"flap_window"`    // 抖动检测窗口（秒）
+	FlapThreshold int                   `yaml:"flap_threshold"` // 窗口内产生告警达到该次数视为抖动并暂停通知，0表示不检测
+	Channels      []NotifyChannelConfig `yaml:"channels"`
+	Routes        []NotifyRouteConfig   `yaml:"routes"`
+}
+
+// NotifyChannelConfig 通知渠道配置
+type NotifyChannelConfig struct {
+	Name string `yaml:"name"`
+	Type string `yaml:"type"` // webhook, email, chat
+
+	// webhook/chat
+	URL      string            `yaml:"url"`
+	Headers  map[string]string `yaml:"headers"`  // webhook请求头
+	Template string            `yaml:"template"` // chat请求体模板（text/template），为空时使用{"text": ...}
+
+	// email
+	SMTPAddr string   `yaml:"smtp_addr"` // host:port
+	Username string   `yaml:"username"`  // 为空时不认证
+	Password string   `yaml:"password"`
+	From     string   `yaml:"from"`
+	To       []string `yaml:"to"`
+}
+
+// NotifyRouteConfig 通知路由配置，告警发送到所有匹配的路由
+type NotifyRouteConfig struct {
+	Name        string                   `yaml:"name"`
+	Severities  []string                 `yaml:"severities"` // 为空时不限制
+	Sites       []string                 `yaml:"sites"`      // 设备的site标签（告警规则文件device_tags），为空时不限制
+	Channels    []string                 `yaml:"channels"`
+	QuietHours  *QuietHoursConfig        `yaml:"quiet_hours"`
+	Escalations []NotifyEscalationConfig `yaml:"escalations"`
+}
+
+// QuietHoursConfig 静默时段配置
+type QuietHoursConfig struct {
+	Start       string `yaml:"start"`        // HH:MM
+	End         string `yaml:"end"`          // HH:MM，早于start时跨越午夜
+	Timezone    string `yaml:"timezone"`     // 为空时使用本地时区
+	MinSeverity string `yaml:"min_severity"` // 不低于该级别的告警仍然通知，为空时全部屏蔽
+}
+
+// NotifyEscalationConfig 告警升级配置
+type NotifyEscalationConfig struct {
+	After    int      `yaml:"after"` // 告警产生后超过该时间（分钟）未确认时升级
+	Channels []string `yaml:"channels"`
+}
+
+// AvailabilityConfig 设备可用性跟踪配置
+type AvailabilityConfig struct {
+	Enabled          bool   `yaml:"enabled"`
+	FailureThreshold int    `yaml:"failure_threshold"` // 连续采集失败达到该次数判定为不可达，0表示不按失败判定
+	MissedIntervals  int    `yaml:"missed_intervals"`  // 超过该数量的采集间隔未收到数据判定为不可达，0表示不检查
+	DefaultInterval  int    `yaml:"default_interval"`  // 尚未估计出采集间隔的设备使用的间隔（秒）
+	CheckInterval    int    `yaml:"check_interval"`    // 未收到数据的检查间隔（秒）
+	AlarmSeverity    string `yaml:"alarm_severity"`    // 启用告警时设备不可达告警的级别
+}
+
+// FieldsConfig 指标字段类型配置
+type FieldsConfig struct {
+	Types  map[string]string `yaml:"types"`  // 指标 -> 字段类型(float/integer/boolean/string)，未配置的指标按首次收到的值推断
+	Errors string            `yaml:"errors"` // 采集错误（"error: ..."）的处理方式：route写入device_metric_errors，drop丢弃
+}
+
+// DeadLetterConfig 死信配置，无法处理的消息连同原始载荷和原因保存，修复后可以重放
+type DeadLetterConfig struct {
+	Enabled   bool   `yaml:"enabled"`
+	Dir       string `yaml:"dir"`         // 本地死信文件目录，为空时不保存到本地（无法通过接口查询和重放）
+	MaxFileMB int    `yaml:"max_file_mb"` // 单个文件超过该大小（MB）后轮转，0表示不轮转
+	MaxFiles  int    `yaml:"max_files"`   // 保留的文件数，超过后删除最早的文件，0表示不限制
+	Topic     string `yaml:"topic"`       // 死信发布Topic，为空时不发布
+	QoS       byte   `yaml:"qos"`
+}
+
+// RollupConfig 历史数据降采样配置，由InfluxDB任务将原始数据聚合到各层级的桶，查询按时间范围选择层级
+type RollupConfig struct {
+	Enabled      bool               `yaml:"enabled"`
+	RawRetention int                `yaml:"raw_retention"` // 原始数据（influxdb.bucket）的保留时间（小时），0表示永久保留
+	Measurements []string           `yaml:"measurements"`  // 降采样的measurement，只聚合数值字段
+	Offset       int                `yaml:"offset"`        // 窗口结束后延迟计算的时间（秒），等待迟到的数据
+	Tiers        []RollupTierConfig `yaml:"tiers"`         // 按聚合窗口从小到大
+}
+
+// RollupTierConfig 降采样层级配置，每个窗口计算min/max/avg/last
+type RollupTierConfig struct {
+	Name      string `yaml:"name"`
+	Every     int    `yaml:"every"`     // 聚合窗口（秒）
+	Bucket    string `yaml:"bucket"`    // 为空时使用<influxdb.bucket>_<name>
+	Retention int    `yaml:"retention"` // 保留时间（小时），0表示永久保留
+}
+
+// QueryConfig 历史数据查询接口配置
+type QueryConfig struct {
+	Enabled        bool `yaml:"enabled"`
+	MaxPoints      int  `yaml:"max_points"`       // 每个序列的最大点数，未指定step时按此选择数据点间隔
+	MaxTotalPoints int  `yaml:"max_total_points"` // 一次查询返回的最大点数，0表示不限制
+	CacheTTL       int  `yaml:"cache_ttl"`        // 查询结果在Redis中的缓存时间（秒），0表示不缓存
+	Timeout        int  `yaml:"timeout"`          // 查询超时（秒）
+}
+
+// StreamConfig 设备数据实时推送配置（WebSocket/SSE）
+type StreamConfig struct {
+	Enabled        bool              `yaml:"enabled"`
+	MinInterval    int               `yaml:"min_interval"`    // 同一客户端的最短推送间隔（毫秒），期间同一设备只推送最新数据
+	Heartbeat      int               `yaml:"heartbeat"`       // 心跳间隔（秒）
+	MaxClients     int               `yaml:"max_clients"`     // 每个副本的最大连接数，0表示不限制
+	AllowedOrigins []string          `yaml:"allowed_origins"` // 允许建立WebSocket连接的页面来源，为空时只允许同源，"*"表示不限制
+	DeviceRooms    map[string]string `yaml:"device_rooms"`    // 设备ID -> 机房，数据标签中没有room时使用
+}
+
+// EnergyConfig 能耗分析配置（PUE、机柜用电量）
+type EnergyConfig struct {
+	Enabled    bool                 `yaml:"enabled"`
+	Interval   int                  `yaml:"interval"`    // 计算周期（秒），每个周期写入一次功率、电量和PUE
+	StaleAfter int                  `yaml:"stale_after"` // 功率读数超过该时间（秒）未更新视为缺失，相邻读数间隔超过该时间时不积分
+	Retention  int                  `yaml:"retention"`   // 按日累计电量的保留天数
+	Timezone   string               `yaml:"timezone"`    // 日报和月报划分日期的时区，为空时使用本地时区
+	Utility    []EnergySourceConfig `yaml:"utility"`     // 市电进线，之和为设施总功率
+	UPS        []EnergySourceConfig `yaml:"ups"`         // UPS输出，之和为IT功率；为空时IT功率为各机柜PDU之和
+	Cooling    []EnergySourceConfig `yaml:"cooling"`     // 制冷设备
+	Racks      []EnergyRackConfig   `yaml:"racks"`
+}
+
+// EnergySourceConfig 功率读数来源
+type EnergySourceConfig struct {
+	DeviceID string  `yaml:"device_id"`
+	Metric   string  `yaml:"metric"`
+	Scale    float64 `yaml:"scale"` // 读数乘以scale换算为kW（读数为W时0.001），默认1
+}
+
+// EnergyRackConfig 机柜及其IT PDU
+type EnergyRackConfig struct {
+	ID      string               `yaml:"id"`
+	Room    string               `yaml:"room"`
+	Sources []EnergySourceConfig `yaml:"sources"`
+}
+
+// VirtualConfig 虚拟设备配置，指标由其他设备的最新指标按表达式计算，与采集的设备一样写入
+type VirtualConfig struct {
+	Enabled    bool                  `yaml:"enabled"`
+	StaleAfter int                   `yaml:"stale_after"` // 输入数据比触发计算的数据早该时间（秒）以上时视为过期，跳过该指标
+	Devices    []VirtualDeviceConfig `yaml:"devices"`
+}
+
+// VirtualDeviceConfig 虚拟设备
+type VirtualDeviceConfig struct {
+	DeviceID   string                        `yaml:"device_id"`
+	DeviceType string                        `yaml:"device_type"` // 默认virtual
+	Tags       map[string]string             `yaml:"tags"`
+	Inputs     map[string]VirtualInputConfig `yaml:"inputs"` // 表达式变量 -> 设备指标
+	Metrics    []VirtualMetricConfig         `yaml:"metrics"`
+}
+
+// VirtualInputConfig 表达式变量引用的设备指标
+type VirtualInputConfig struct {
+	DeviceID string `yaml:"device_id"`
+	Metric   string `yaml:"metric"` // 可以使用通配符（如outlet_*_power），匹配的多个指标只能作为聚合函数的参数
+}
+
+// VirtualMetricConfig 虚拟设备的计算指标
+type VirtualMetricConfig struct {
+	Name       string `yaml:"name"`
+	Expression string `yaml:"expression"`
+	Unit       string `yaml:"unit"`
+	StaleAfter int    `yaml:"stale_after"` // 秒，0表示使用virtual.stale_after
+}
+
 // LoadConfig 加载配置文件
 func LoadConfig(path string) (*Config, error) {
 	data, err := os.ReadFile(path)
@@ -44,7 +270,84 @@ func LoadConfig(path string) (*Config, error) {
 		return nil, err
 	}
 
-	var config Config
+	config := Config{
+		MQTT: MQTTConfig{DedupWindow: 300},
+		Kafka: KafkaConfig{
+			Topic:          "opc-metrics",
+			Group:          "dcim-data-processor",
+			Version:        "2.6.0",
+			InitialOffset:  "oldest",
+			CommitInterval: 5,
+		},
+		InfluxDB: InfluxDBConfig{
+			Write: InfluxWriteConfig{
+				BatchSize:        1000,
+				FlushInterval:    1000,
+				Workers:          4,
+				QueueSize:        100000,
+				MaxRetries:       5,
+				RetryInterval:    1000,
+				MaxRetryInterval: 30000,
+				MaxSpillMB:       1024,
+				ReplayInterval:   10,
+			},
+		},
+		Server: ServerConfig{Port: 8081},
+		Alarm: AlarmConfig{
+			RulesFile:      "alarm-rules.yaml",
+			Topic:          "dcim/alarms",
+			QoS:            1,
+			CheckInterval:  10,
+			RetentionHours: 720,
+		},
+		Notify: NotifyConfig{
+			GroupWait:     30,
+			FlapWindow:    600,
+			FlapThreshold: 3,
+		},
+		Availability: AvailabilityConfig{
+			FailureThreshold: 3,
+			MissedIntervals:  3,
+			DefaultInterval:  60,
+			CheckInterval:    30,
+			AlarmSeverity:    "major",
+		},
+		Fields: FieldsConfig{Errors: "route"},
+		DeadLetter: DeadLetterConfig{
+			Dir:       "deadletter",
+			MaxFileMB: 64,
+			MaxFiles:  10,
+			QoS:       1,
+		},
+		Rollup: RollupConfig{
+			RawRetention: 168,
+			Measurements: []string{"device_metrics", "device_availability", "datacenter_energy", "rack_energy"},
+			Offset:       30,
+			Tiers: []RollupTierConfig{
+				{Name: "1m", Every: 60, Retention: 720},
+				{Name: "5m", Every: 300, Retention: 2160},
+				{Name: "1h", Every: 3600, Retention: 17520},
+			},
+		},
+		Query: QueryConfig{
+			Enabled:        true,
+			MaxPoints:      1000,
+			MaxTotalPoints: 100000,
+			CacheTTL:       60,
+			Timeout:        30,
+		},
+		Stream: StreamConfig{
+			MinInterval: 1000,
+			Heartbeat:   30,
+			MaxClients:  1000,
+		},
+		Energy: EnergyConfig{
+			Interval:   60,
+			StaleAfter: 300,
+			Retention:  400,
+		},
+		Virtual: VirtualConfig{StaleAfter: 300},
+	}
 	if err := yaml.Unmarshal(data, &config); err != nil {
 		return nil, err
 	}